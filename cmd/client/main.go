@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,8 +11,13 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/croisade/chimichanga/pkg/breached"
 	"github.com/croisade/chimichanga/pkg/conf"
 	"github.com/croisade/chimichanga/pkg/controllers"
+	"github.com/croisade/chimichanga/pkg/mail"
+	"github.com/croisade/chimichanga/pkg/middleware"
+	"github.com/croisade/chimichanga/pkg/migrations"
+	"github.com/croisade/chimichanga/pkg/repositories"
 	"github.com/croisade/chimichanga/pkg/services"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -23,63 +29,284 @@ var (
 	server      *gin.Engine
 	ctx         context.Context
 	mongoClient *mongo.Client
+	sqliteDB    *sql.DB
+	migrator    migrations.Migrator
 	err         error
 
 	accountService    services.AccountService
 	accountController controllers.AccountController
-	accountCollection *mongo.Collection
+	accountRepository repositories.AccountRepository
 
-	runCollection *mongo.Collection
+	tokenFamilyRepository  repositories.TokenFamilyRepository
+	revokedTokenRepository repositories.RevokedTokenRepository
+	sessionService         services.SessionService
+	revocationService      services.RevocationService
+
+	passwordResetRepository repositories.PasswordResetTokenRepository
+	passwordResetService    services.PasswordResetService
+
+	verificationRepository repositories.EmailVerificationTokenRepository
+	verificationService    services.EmailVerificationService
+	twoFactorService       services.TwoFactorService
+	throttleRepository     repositories.LoginThrottleRepository
+
+	personalAccessTokenRepository repositories.PersonalAccessTokenRepository
+	personalAccessTokenController controllers.PersonalAccessTokenController
+
+	oauthClientRepository  repositories.OAuthClientRepository
+	oauthConsentRepository repositories.OAuthConsentRepository
+	oauthCodeRepository    repositories.OAuthAuthorizationCodeRepository
+	oauthController        controllers.OAuthController
+
+	signingKeyRepository repositories.SigningKeyRepository
+	keyService           *services.KeyServiceImpl
+	keyController        controllers.KeyController
+
+	runRepository repositories.RunRepository
 	runService    services.RunService
 	runController controllers.RunController
+
+	mongoIndexes []mongoIndex
 )
 
-func init() {
-	config, err := conf.LoadConfig("../../")
-	if err != nil {
-		log.Fatal("cannot load config:", err)
+// mongoIndex builds the indexes of a Mongo repository. They are built once
+// the schema is current, a database with duplicates must still be able to
+// run `client migrate` to find them.
+type mongoIndex struct {
+	name   string
+	ensure func() error
+}
+
+// ensureIndexes builds the indexes of the Mongo repositories. It is safe to
+// call on every startup.
+func ensureIndexes() error {
+	for _, index := range mongoIndexes {
+		if err := index.ensure(); err != nil {
+			return fmt.Errorf("cannot ensure %s indexes: %w", index.name, err)
+		}
 	}
+	return nil
+}
 
-	//? Can I plug the the config into the context?
+// setup connects the configured storage backend and builds the services
+// and controllers on top of it.
+func setup(config conf.Config) {
 	ctx = context.TODO()
 
-	mongoConn := options.Client().ApplyURI(config.MongoURI)
-	mongoClient, err = mongo.Connect(ctx, mongoConn)
+	switch config.StorageBackend {
+	case "memory":
+		fmt.Println("using in-memory storage, data will not survive a restart")
 
-	if err != nil {
-		log.Fatal(err)
+		accountRepository = repositories.NewMemoryAccountRepository()
+		runRepository = repositories.NewMemoryRunRepository()
+		tokenFamilyRepository = repositories.NewMemoryTokenFamilyRepository()
+		revokedTokenRepository = repositories.NewMemoryRevokedTokenRepository()
+		signingKeyRepository = repositories.NewMemorySigningKeyRepository()
+		passwordResetRepository = repositories.NewMemoryPasswordResetTokenRepository()
+		verificationRepository = repositories.NewMemoryEmailVerificationTokenRepository()
+		throttleRepository = repositories.NewMemoryLoginThrottleRepository()
+		personalAccessTokenRepository = repositories.NewMemoryPersonalAccessTokenRepository()
+		oauthClientRepository = repositories.NewMemoryOAuthClientRepository()
+		oauthConsentRepository = repositories.NewMemoryOAuthConsentRepository()
+		oauthCodeRepository = repositories.NewMemoryOAuthAuthorizationCodeRepository()
+	case "sqlite":
+		sqliteDB, err = repositories.OpenSQLite(config.SQLitePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println("sqlite database opened at", config.SQLitePath)
+
+		migrator = migrations.NewSQLiteMigrator(sqliteDB)
+
+		accountRepository = repositories.NewSQLiteAccountRepository(sqliteDB)
+		runRepository = repositories.NewSQLiteRunRepository(sqliteDB)
+		tokenFamilyRepository = repositories.NewSQLiteTokenFamilyRepository(sqliteDB)
+		revokedTokenRepository = repositories.NewSQLiteRevokedTokenRepository(sqliteDB)
+		signingKeyRepository = repositories.NewSQLiteSigningKeyRepository(sqliteDB)
+		passwordResetRepository = repositories.NewSQLitePasswordResetTokenRepository(sqliteDB)
+		verificationRepository = repositories.NewSQLiteEmailVerificationTokenRepository(sqliteDB)
+		throttleRepository = repositories.NewSQLiteLoginThrottleRepository(sqliteDB)
+		personalAccessTokenRepository = repositories.NewSQLitePersonalAccessTokenRepository(sqliteDB)
+		oauthClientRepository = repositories.NewSQLiteOAuthClientRepository(sqliteDB)
+		oauthConsentRepository = repositories.NewSQLiteOAuthConsentRepository(sqliteDB)
+		oauthCodeRepository = repositories.NewSQLiteOAuthAuthorizationCodeRepository(sqliteDB)
+	case "mongo":
+		mongoConn := options.Client().ApplyURI(config.MongoURI)
+		mongoClient, err = mongo.Connect(ctx, mongoConn)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = mongoClient.Ping(ctx, readpref.Primary())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println("mongo connection established")
+
+		migrator = migrations.NewMongoMigrator(mongoClient.Database(config.MongoDatabase), ctx)
+
+		mongoAccountRepository := repositories.NewMongoAccountRepository(mongoClient.Database(config.MongoDatabase).Collection("accounts"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"account", mongoAccountRepository.EnsureIndexes})
+		mongoRunRepository := repositories.NewMongoRunRepository(mongoClient.Database(config.MongoDatabase).Collection("runs"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"run", mongoRunRepository.EnsureIndexes})
+		mongoTokenFamilyRepository := repositories.NewMongoTokenFamilyRepository(mongoClient.Database(config.MongoDatabase).Collection("tokenFamilies"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"token family", mongoTokenFamilyRepository.EnsureIndexes})
+		mongoRevokedTokenRepository := repositories.NewMongoRevokedTokenRepository(mongoClient.Database(config.MongoDatabase).Collection("revokedTokens"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"revoked token", mongoRevokedTokenRepository.EnsureIndexes})
+		mongoSigningKeyRepository := repositories.NewMongoSigningKeyRepository(mongoClient.Database(config.MongoDatabase).Collection("signingKeys"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"signing key", mongoSigningKeyRepository.EnsureIndexes})
+		mongoPasswordResetRepository := repositories.NewMongoPasswordResetTokenRepository(mongoClient.Database(config.MongoDatabase).Collection("passwordResetTokens"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"password reset token", mongoPasswordResetRepository.EnsureIndexes})
+		mongoVerificationRepository := repositories.NewMongoEmailVerificationTokenRepository(mongoClient.Database(config.MongoDatabase).Collection("emailVerificationTokens"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"email verification token", mongoVerificationRepository.EnsureIndexes})
+		mongoThrottleRepository := repositories.NewMongoLoginThrottleRepository(mongoClient.Database(config.MongoDatabase).Collection("loginThrottles"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"login throttle", mongoThrottleRepository.EnsureIndexes})
+		mongoPersonalAccessTokenRepository := repositories.NewMongoPersonalAccessTokenRepository(mongoClient.Database(config.MongoDatabase).Collection("personalAccessTokens"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"personal access token", mongoPersonalAccessTokenRepository.EnsureIndexes})
+		mongoOAuthClientRepository := repositories.NewMongoOAuthClientRepository(mongoClient.Database(config.MongoDatabase).Collection("oauthClients"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"oauth client", mongoOAuthClientRepository.EnsureIndexes})
+		mongoOAuthConsentRepository := repositories.NewMongoOAuthConsentRepository(mongoClient.Database(config.MongoDatabase).Collection("oauthConsents"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"oauth consent", mongoOAuthConsentRepository.EnsureIndexes})
+		mongoOAuthCodeRepository := repositories.NewMongoOAuthAuthorizationCodeRepository(mongoClient.Database(config.MongoDatabase).Collection("oauthAuthorizationCodes"), ctx)
+		mongoIndexes = append(mongoIndexes, mongoIndex{"oauth authorization code", mongoOAuthCodeRepository.EnsureIndexes})
+
+		accountRepository = mongoAccountRepository
+		runRepository = mongoRunRepository
+		tokenFamilyRepository = mongoTokenFamilyRepository
+		revokedTokenRepository = mongoRevokedTokenRepository
+		signingKeyRepository = mongoSigningKeyRepository
+		passwordResetRepository = mongoPasswordResetRepository
+		verificationRepository = mongoVerificationRepository
+		throttleRepository = mongoThrottleRepository
+		personalAccessTokenRepository = mongoPersonalAccessTokenRepository
+		oauthClientRepository = mongoOAuthClientRepository
+		oauthConsentRepository = mongoOAuthConsentRepository
+		oauthCodeRepository = mongoOAuthCodeRepository
+	default:
+		log.Fatalf("unknown storage backend: %s", config.StorageBackend)
 	}
 
-	err = mongoClient.Ping(ctx, readpref.Primary())
-	if err != nil {
-		log.Fatal(err)
+	tokenConfig := services.TokenConfig{
+		Issuer:               config.JWTIssuer,
+		Audience:             config.JWTAudience,
+		AccessTokenLifetime:  config.JWTAccessTokenLifetime,
+		RefreshTokenLifetime: config.JWTRefreshTokenLifetime,
+		Leeway:               config.JWTLeeway,
 	}
+	keyService = services.NewKeyServiceImpl(signingKeyRepository, services.KeyRotation{
+		Algorithm:    config.JWTAlgorithm,
+		Period:       config.JWTKeyRotation,
+		PublishAhead: config.JWTKeyPublishAhead,
+		Retention:    config.JWTRefreshTokenLifetime + config.JWTLeeway,
+	})
+	keyController = controllers.NewKeyController(keyService)
+	jwtService := services.NewJWTAuthService(keyService, tokenConfig)
 
-	fmt.Println("mongo connection established")
+	var breachedPasswords breached.List
+	if config.BreachedPasswordsDir != "" {
+		breachedPasswords = breached.NewDirectory(config.BreachedPasswordsDir)
+	}
+	passwordPolicy := services.NewPasswordPolicyImpl(services.PasswordPolicyConfig{
+		MinLength:  config.PasswordMinLength,
+		MinClasses: config.PasswordMinClasses,
+	}, breachedPasswords)
 
-	accountCollection = mongoClient.Database("CorroYouRun").Collection("accounts")
-	runCollection = mongoClient.Database("CorroYouRun").Collection("runs")
+	accountService = services.NewAccountServiceImpl(accountRepository, passwordPolicy)
+	sessionService = services.NewSessionServiceImpl(tokenFamilyRepository, accountRepository, jwtService)
+	revocationService = services.NewRevocationServiceImpl(revokedTokenRepository, tokenFamilyRepository, config.JWTLeeway)
+	personalAccessTokenService := services.NewPersonalAccessTokenServiceImpl(personalAccessTokenRepository, accountRepository, services.PersonalAccessTokenConfig{
+		MaxLifetime: config.PersonalAccessTokenMaxLifetime,
+	})
+	authorizer := middleware.NewAuthorizer(jwtService, revocationService, personalAccessTokenService)
+	personalAccessTokenController = controllers.NewPersonalAccessTokenController(personalAccessTokenService, authorizer)
+	oauthService := services.NewOAuthServiceImpl(oauthClientRepository, oauthConsentRepository, oauthCodeRepository, tokenFamilyRepository, accountService, jwtService, revocationService, services.OAuthConfig{
+		CodeLifetime: config.OAuthCodeLifetime,
+	})
+	oauthController = controllers.NewOAuthController(oauthService, authorizer)
 
-	jwtService := services.NewJWTAuthService()
+	var mailSender mail.Sender = mail.NewWriterSender(log.Writer())
+	if config.MailSender == "file" {
+		mailSender = mail.NewFileSender(config.MailFile)
+	}
+	passwordResetService = services.NewPasswordResetServiceImpl(passwordResetRepository, accountRepository, sessionService, personalAccessTokenService, passwordPolicy, mailSender, services.PasswordResetConfig{
+		TokenLifetime:  config.PasswordResetTokenLifetime,
+		ResendInterval: config.PasswordResetResendInterval,
+		URL:            config.PasswordResetURL,
+	})
+	verificationService = services.NewEmailVerificationServiceImpl(verificationRepository, accountRepository, mailSender, services.EmailVerificationConfig{
+		TokenLifetime:   config.EmailVerificationTokenLifetime,
+		ResendInterval:  config.EmailVerificationResendInterval,
+		URL:             config.EmailVerificationURL,
+		RequireVerified: config.EmailVerificationRequired,
+	})
+	twoFactorService = services.NewTwoFactorServiceImpl(accountRepository, jwtService, config.JWTIssuer)
+	throttleService := services.NewLoginThrottleServiceImpl(throttleRepository, services.LoginThrottleConfig{
+		EmailFreeAttempts: config.LoginEmailFreeAttempts,
+		IPFreeAttempts:    config.LoginIPFreeAttempts,
+		BaseDelay:         config.LoginBackoffBase,
+		MaxDelay:          config.LoginLockoutMax,
+		Window:            config.LoginFailureWindow,
+	})
 
-	runService = services.NewRunService(runCollection, ctx)
-	runController = controllers.NewRunController(runService, jwtService)
+	runService = services.NewRunService(runRepository)
+	runController = controllers.NewRunController(runService, accountService, jwtService, authorizer, config.ImportMaxBytes)
 
-	accountService = services.NewAccountServiceImpl(accountCollection, ctx)
-	accountController = controllers.NewAccountController(accountService, jwtService)
+	accountController = controllers.NewAccountController(accountService, sessionService, personalAccessTokenService, revocationService, passwordResetService, verificationService, twoFactorService, throttleService, jwtService, authorizer)
 
 	server = gin.Default()
+	// Without trusted proxies the client address is the peer of the
+	// connection, a forwarded one could be made up to dodge login throttling.
+	if err := server.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatal("cannot trust proxies: ", err)
+	}
 }
 
 func main() {
-	defer mongoClient.Disconnect(ctx)
+	config, args, err := conf.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("cannot load config: ", err)
+	}
+	setup(config)
+
+	if mongoClient != nil {
+		defer mongoClient.Disconnect(ctx)
+	}
+	if sqliteDB != nil {
+		defer sqliteDB.Close()
+	}
 
+	if len(args) > 0 && args[0] == "migrate" {
+		if err := migrate(args[1:]); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := migrateOnStartup(); err != nil {
+		log.Fatal(err)
+	}
+	if err := ensureIndexes(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := keyService.Rotate(); err != nil {
+		log.Fatal("cannot rotate signing keys: ", err)
+	}
+	go rotateKeys()
+
+	keyController.RegisterKeyRoutes(&server.RouterGroup)
 	basePath := server.Group("/v1")
 	runController.RegisterRunRoutes(basePath)
 	accountController.RegisterAccountRoutes(basePath)
+	personalAccessTokenController.RegisterPersonalAccessTokenRoutes(basePath)
+	oauthController.RegisterOAuthRoutes(basePath)
 
 	srv := &http.Server{
-		Addr:    ":9090",
+		Addr:    config.HTTPAddr,
 		Handler: server,
 	}
 
@@ -111,3 +338,13 @@ func main() {
 
 	log.Println("Server exiting")
 }
+
+// rotateKeys checks hourly whether a signing key is due, which also picks up
+// keys other instances generated.
+func rotateKeys() {
+	for range time.Tick(time.Hour) {
+		if err := keyService.Rotate(); err != nil {
+			log.Println("cannot rotate signing keys:", err)
+		}
+	}
+}
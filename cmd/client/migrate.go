@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/croisade/chimichanga/pkg/migrations"
+)
+
+const migrateUsage = "usage: client [flags] migrate up|down|status"
+
+// migrate runs the `migrate` subcommand against the configured storage backend.
+func migrate(args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+	if migrator == nil {
+		return errors.New("the configured storage backend has no schema to migrate")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		for _, version := range applied {
+			fmt.Println("applied migration", version)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return nil
+	case "down":
+		reverted, err := migrator.Down()
+		if err != nil {
+			return err
+		}
+		fmt.Println("reverted migration", reverted)
+		return nil
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(statuses)
+		return nil
+	}
+	return errors.New(migrateUsage)
+}
+
+func printMigrationStatus(statuses []migrations.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tSTATUS\tAPPLIED AT\tDESCRIPTION")
+	for _, status := range statuses {
+		state, appliedAt := "pending", "-"
+		if status.Applied {
+			state, appliedAt = "applied", status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, state, appliedAt, status.Description)
+	}
+	w.Flush()
+}
+
+// migrateOnStartup brings an embedded SQLite database up to date before the
+// server starts. Shared databases are migrated explicitly with `client
+// migrate up`; until they are, the server refuses to start rather than
+// writing data the pending migrations would convert a second time.
+func migrateOnStartup() error {
+	if migrator == nil {
+		return nil
+	}
+
+	if sqliteDB != nil {
+		applied, err := migrator.Up()
+		for _, version := range applied {
+			log.Println("applied migration", version)
+		}
+		return err
+	}
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		return fmt.Errorf("cannot read migration status: %w", err)
+	}
+
+	if pending := migrations.Pending(statuses); len(pending) > 0 {
+		return fmt.Errorf("%d pending migration(s), run `client migrate up` before serving traffic", len(pending))
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package breached tells whether passwords appear in known data breaches.
+// Lists are kept on disk laid out like the range API of Have I Been Pwned:
+// the upper case hex SHA-1 of a password is split after five characters, the
+// prefix names a file and the suffix is listed in it on a SUFFIX:COUNT line.
+// Checking a password reads the one file of its prefix, never the password
+// or its full hash.
+package breached
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PrefixLength is how many characters of the hash name the file listing it.
+const PrefixLength = 5
+
+type List interface {
+	Contains(password string) (bool, error)
+}
+
+// Directory is a list kept as one file per hash prefix in a directory.
+type Directory struct {
+	dir string
+}
+
+func NewDirectory(dir string) *Directory {
+	return &Directory{dir: dir}
+}
+
+func (d *Directory) Contains(password string) (bool, error) {
+	prefix, suffix := Split(password)
+
+	file, err := os.Open(filepath.Join(d.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		listed, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(listed, suffix) {
+			return true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("cannot read breached passwords %s: %w", prefix, err)
+	}
+	return false, nil
+}
+
+// Split returns the prefix and the suffix of the hash of password.
+func Split(password string) (string, string) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return hash[:PrefixLength], hash[PrefixLength:]
+}
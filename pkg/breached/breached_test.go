@@ -0,0 +1,52 @@
+package breached
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplit(t *testing.T) {
+	// The SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8.
+	prefix, suffix := Split("password")
+
+	assert.Equal(t, "5BAA6", prefix)
+	assert.Equal(t, "1E4C9B93F3F0682250B6CF8331B7EE68FD8", suffix)
+}
+
+func TestDirectory(t *testing.T) {
+	dir := t.TempDir()
+	content := "003D68EB55068C33ACE09247EE4C639306B:3\r\n1e4c9b93f3f0682250b6cf8331b7ee68fd8:9545824\r\n"
+	if err := os.WriteFile(filepath.Join(dir, "5BAA6"), []byte(content), 0o600); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	list := NewDirectory(dir)
+
+	t.Run("finds listed passwords", func(t *testing.T) {
+		got, err := list.Contains("password")
+
+		assert.Nil(t, err)
+		assert.True(t, got)
+	})
+
+	t.Run("misses passwords of a listed prefix", func(t *testing.T) {
+		prefix, _ := Split("correct horse battery staple")
+		if err := os.WriteFile(filepath.Join(dir, prefix), []byte("0000000000000000000000000000000000A:1\n"), 0o600); err != nil {
+			t.Fatalf("Error: %v", err)
+		}
+
+		got, err := list.Contains("correct horse battery staple")
+
+		assert.Nil(t, err)
+		assert.False(t, got)
+	})
+
+	t.Run("misses passwords without a prefix file", func(t *testing.T) {
+		got, err := list.Contains("Tr0ub4dor&3")
+
+		assert.Nil(t, err)
+		assert.False(t, got)
+	})
+}
@@ -1,24 +1,279 @@
 package conf
 
-import "github.com/spf13/viper"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Config is the configuration of the server. It is loaded once at startup,
+// every source overriding the previous one: defaults, the configuration file,
+// the environment and command-line flags.
 type Config struct {
-	MongoURI  string `mapstructure:"MONGO_URI"`
-	JWTSecret string `mapstructure:"JWT_SECRET"`
+	HTTPAddr       string `mapstructure:"HTTP_ADDR"`
+	StorageBackend string `mapstructure:"STORAGE_BACKEND"`
+	SQLitePath     string `mapstructure:"SQLITE_PATH"`
+	MongoURI       string `mapstructure:"MONGO_URI"`
+	MongoDatabase  string `mapstructure:"MONGO_DATABASE"`
+	// JWTAlgorithm is RS256 or EdDSA. A new signing key is generated every
+	// JWTKeyRotation and published JWTKeyPublishAhead before it signs.
+	JWTAlgorithm       string        `mapstructure:"JWT_ALGORITHM"`
+	JWTKeyRotation     time.Duration `mapstructure:"JWT_KEY_ROTATION"`
+	JWTKeyPublishAhead time.Duration `mapstructure:"JWT_KEY_PUBLISH_AHEAD"`
+	// Tokens name JWTIssuer and JWTAudience, both are checked on every token
+	// accepted, and their times with JWTLeeway of clock skew.
+	JWTIssuer               string        `mapstructure:"JWT_ISSUER"`
+	JWTAudience             string        `mapstructure:"JWT_AUDIENCE"`
+	JWTAccessTokenLifetime  time.Duration `mapstructure:"JWT_ACCESS_TOKEN_LIFETIME"`
+	JWTRefreshTokenLifetime time.Duration `mapstructure:"JWT_REFRESH_TOKEN_LIFETIME"`
+	JWTLeeway               time.Duration `mapstructure:"JWT_LEEWAY"`
+	// MailSender is log, writing mail to the server log, or file, appending
+	// it to MailFile. Neither delivers anything; they serve development.
+	MailSender string `mapstructure:"MAIL_SENDER"`
+	MailFile   string `mapstructure:"MAIL_FILE"`
+	// Reset tokens are mailed as a link to PasswordResetURL when it is set,
+	// at most once every PasswordResetResendInterval to an account.
+	PasswordResetURL            string        `mapstructure:"PASSWORD_RESET_URL"`
+	PasswordResetTokenLifetime  time.Duration `mapstructure:"PASSWORD_RESET_TOKEN_LIFETIME"`
+	PasswordResetResendInterval time.Duration `mapstructure:"PASSWORD_RESET_RESEND_INTERVAL"`
+	// New accounts are mailed a verification token, as a link to
+	// EmailVerificationURL when it is set. With EmailVerificationRequired
+	// unverified accounts cannot log in.
+	EmailVerificationURL            string        `mapstructure:"EMAIL_VERIFICATION_URL"`
+	EmailVerificationTokenLifetime  time.Duration `mapstructure:"EMAIL_VERIFICATION_TOKEN_LIFETIME"`
+	EmailVerificationResendInterval time.Duration `mapstructure:"EMAIL_VERIFICATION_RESEND_INTERVAL"`
+	EmailVerificationRequired       bool          `mapstructure:"EMAIL_VERIFICATION_REQUIRED"`
+	// Passwords need PasswordMinLength characters of PasswordMinClasses
+	// classes. Those listed in BreachedPasswordsDir, one file per hash prefix
+	// as Have I Been Pwned serves them, are refused as well.
+	PasswordMinLength    int    `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMinClasses   int    `mapstructure:"PASSWORD_MIN_CLASSES"`
+	BreachedPasswordsDir string `mapstructure:"BREACHED_PASSWORDS_DIR"`
+	// Past LoginEmailFreeAttempts failed logins to an email, or
+	// LoginIPFreeAttempts from a client address, logins are locked for
+	// LoginBackoffBase, doubled on each further failure up to LoginLockoutMax.
+	// Failures are forgotten after LoginFailureWindow without a new one.
+	LoginEmailFreeAttempts int           `mapstructure:"LOGIN_EMAIL_FREE_ATTEMPTS"`
+	LoginIPFreeAttempts    int           `mapstructure:"LOGIN_IP_FREE_ATTEMPTS"`
+	LoginBackoffBase       time.Duration `mapstructure:"LOGIN_BACKOFF_BASE"`
+	LoginLockoutMax        time.Duration `mapstructure:"LOGIN_LOCKOUT_MAX"`
+	LoginFailureWindow     time.Duration `mapstructure:"LOGIN_FAILURE_WINDOW"`
+	// Personal access tokens expire within PersonalAccessTokenMaxLifetime
+	// when it is set, otherwise they may live until revoked.
+	PersonalAccessTokenMaxLifetime time.Duration `mapstructure:"PERSONAL_ACCESS_TOKEN_MAX_LIFETIME"`
+	// Third-party apps trade authorization codes for tokens within
+	// OAuthCodeLifetime, which RFC 6749 caps at ten minutes.
+	OAuthCodeLifetime time.Duration `mapstructure:"OAUTH_CODE_LIFETIME"`
+	// Run file uploads larger than ImportMaxBytes are refused.
+	ImportMaxBytes int64 `mapstructure:"IMPORT_MAX_BYTES"`
+	// Client addresses are taken from X-Forwarded-For only behind one of
+	// TrustedProxies.
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
+}
+
+// Load builds the configuration from the file named by --config, the
+// environment and the flags in args, and validates it. It returns the
+// arguments following the flags.
+func Load(args []string) (Config, []string, error) {
+	var config Config
+	v := viper.New()
+
+	flags := pflag.NewFlagSet("client", pflag.ContinueOnError)
+	flags.SetInterspersed(false)
+	configFile := flags.String("config", "app.env", "configuration file, KEY=value lines")
+	flags.String("http-addr", ":9090", "address the server listens on")
+	flags.String("storage-backend", "mongo", "storage backend: memory, sqlite or mongo")
+	flags.String("sqlite-path", "chimichanga.db", "SQLite database file")
+	flags.String("mongo-uri", "", "MongoDB connection string")
+	flags.String("mongo-database", "CorroYouRun", "MongoDB database")
+	flags.String("jwt-algorithm", models.AlgorithmEdDSA, "token signing algorithm: RS256 or EdDSA")
+	flags.Duration("jwt-key-rotation", 30*24*time.Hour, "how long a signing key signs before the next one takes over")
+	flags.Duration("jwt-key-publish-ahead", time.Hour, "how long a signing key is published before it signs")
+	flags.String("jwt-issuer", "CorroYouRun", "issuer tokens are issued and accepted from")
+	flags.String("jwt-audience", "CorroYouRun", "audience tokens are issued and accepted for")
+	flags.Duration("jwt-access-token-lifetime", 15*time.Minute, "how long an access token is accepted")
+	flags.Duration("jwt-refresh-token-lifetime", 168*time.Hour, "how long a refresh token is accepted")
+	flags.Duration("jwt-leeway", 30*time.Second, "clock skew tolerated when checking token times")
+	flags.String("mail-sender", "log", "where mail goes: log or file")
+	flags.String("mail-file", "mail.log", "file the file mail sender appends to")
+	flags.String("password-reset-url", "", "page password reset links point to, the token is added as a query parameter")
+	flags.Duration("password-reset-token-lifetime", time.Hour, "how long a password reset token can be used")
+	flags.Duration("password-reset-resend-interval", 5*time.Minute, "how long before a password reset email can be sent again")
+	flags.String("email-verification-url", "", "page email verification links point to, the token is added as a query parameter")
+	flags.Duration("email-verification-token-lifetime", 48*time.Hour, "how long an email verification token can be used")
+	flags.Duration("email-verification-resend-interval", 5*time.Minute, "how long before a verification email can be sent again")
+	flags.Bool("email-verification-required", false, "refuse logins of accounts whose email is not verified")
+	flags.Int("password-min-length", 10, "shortest password accepted")
+	flags.Int("password-min-classes", 2, "how many of lower case, upper case, digits and symbols a password mixes")
+	flags.String("breached-passwords-dir", "", "directory of breached password hashes, one file per five character SHA-1 prefix; empty skips the check")
+	flags.Int("login-email-free-attempts", 5, "failed logins to an email before it is locked out")
+	flags.Int("login-ip-free-attempts", 20, "failed logins from a client address before it is locked out")
+	flags.Duration("login-backoff-base", time.Second, "first lockout, doubled on every further failed login")
+	flags.Duration("login-lockout-max", 15*time.Minute, "longest lockout")
+	flags.Duration("login-failure-window", time.Hour, "how long failed logins are remembered")
+	flags.Duration("personal-access-token-max-lifetime", 0, "longest lifetime of a personal access token, 0 allows tokens that never expire")
+	flags.Duration("oauth-code-lifetime", time.Minute, "how long an OAuth authorization code can be traded for tokens")
+	flags.Int64("import-max-bytes", 10<<20, "largest run file upload accepted, in bytes")
+	flags.StringSlice("trusted-proxies", nil, "addresses or networks of the proxies whose X-Forwarded-For is trusted")
+	if err := flags.Parse(args); err != nil {
+		return config, nil, err
+	}
+
+	// Every flag is bound to the environment variable of the same name, the
+	// flag wins when given.
+	var bindErr error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "config" {
+			return
+		}
+		key := strings.ToUpper(strings.ReplaceAll(flag.Name, "-", "_"))
+		if err := v.BindPFlag(key, flag); err != nil {
+			bindErr = err
+		}
+	})
+	if bindErr != nil {
+		return config, nil, bindErr
+	}
+	v.AutomaticEnv()
+
+	// The default file is optional, one asked for explicitly is not.
+	if _, err := os.Stat(*configFile); err == nil || flags.Changed("config") {
+		v.SetConfigFile(*configFile)
+		v.SetConfigType("env")
+		if err := v.ReadInConfig(); err != nil {
+			return config, nil, fmt.Errorf("cannot read %s: %w", *configFile, err)
+		}
+	}
+
+	if err := v.Unmarshal(&config); err != nil {
+		return config, nil, err
+	}
+	return config, flags.Args(), config.Validate()
 }
 
-func LoadConfig(path string) (config Config, err error) {
-	viper.AddConfigPath(path)
-	viper.SetConfigName("app")
-	viper.SetConfigType("env")
+// Validate reports every setting the server cannot start with.
+func (c Config) Validate() error {
+	var problems []string
+
+	if c.HTTPAddr == "" {
+		problems = append(problems, "HTTP_ADDR is required")
+	}
+
+	switch c.StorageBackend {
+	case "memory":
+	case "sqlite":
+		if c.SQLitePath == "" {
+			problems = append(problems, "SQLITE_PATH is required for the sqlite backend")
+		}
+	case "mongo":
+		if c.MongoURI == "" {
+			problems = append(problems, "MONGO_URI is required for the mongo backend")
+		}
+		if c.MongoDatabase == "" {
+			problems = append(problems, "MONGO_DATABASE is required for the mongo backend")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown STORAGE_BACKEND %q", c.StorageBackend))
+	}
 
-	viper.AutomaticEnv()
+	if c.JWTAlgorithm != models.AlgorithmRS256 && c.JWTAlgorithm != models.AlgorithmEdDSA {
+		problems = append(problems, fmt.Sprintf("unknown JWT_ALGORITHM %q", c.JWTAlgorithm))
+	}
+	if c.JWTKeyRotation <= 0 {
+		problems = append(problems, "JWT_KEY_ROTATION has to be positive")
+	}
+	if c.JWTKeyPublishAhead <= 0 || c.JWTKeyPublishAhead >= c.JWTKeyRotation {
+		problems = append(problems, "JWT_KEY_PUBLISH_AHEAD has to be positive and shorter than JWT_KEY_ROTATION")
+	}
 
-	err = viper.ReadInConfig()
-	if err != nil {
-		return
+	if c.JWTIssuer == "" || c.JWTAudience == "" {
+		problems = append(problems, "JWT_ISSUER and JWT_AUDIENCE are required")
+	}
+	if c.JWTAccessTokenLifetime <= 0 || c.JWTRefreshTokenLifetime <= 0 {
+		problems = append(problems, "JWT_ACCESS_TOKEN_LIFETIME and JWT_REFRESH_TOKEN_LIFETIME have to be positive")
+	}
+	if c.JWTLeeway < 0 {
+		problems = append(problems, "JWT_LEEWAY cannot be negative")
 	}
 
-	err = viper.Unmarshal(&config)
-	return
+	switch c.MailSender {
+	case "log":
+	case "file":
+		if c.MailFile == "" {
+			problems = append(problems, "MAIL_FILE is required for the file mail sender")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown MAIL_SENDER %q", c.MailSender))
+	}
+	if c.PasswordResetURL != "" {
+		if _, err := url.ParseRequestURI(c.PasswordResetURL); err != nil {
+			problems = append(problems, "PASSWORD_RESET_URL is not a valid URL")
+		}
+	}
+	if c.PasswordResetTokenLifetime <= 0 {
+		problems = append(problems, "PASSWORD_RESET_TOKEN_LIFETIME has to be positive")
+	}
+	if c.PasswordResetResendInterval < 0 {
+		problems = append(problems, "PASSWORD_RESET_RESEND_INTERVAL cannot be negative")
+	}
+	if c.EmailVerificationURL != "" {
+		if _, err := url.ParseRequestURI(c.EmailVerificationURL); err != nil {
+			problems = append(problems, "EMAIL_VERIFICATION_URL is not a valid URL")
+		}
+	}
+	if c.EmailVerificationTokenLifetime <= 0 {
+		problems = append(problems, "EMAIL_VERIFICATION_TOKEN_LIFETIME has to be positive")
+	}
+	if c.EmailVerificationResendInterval < 0 {
+		problems = append(problems, "EMAIL_VERIFICATION_RESEND_INTERVAL cannot be negative")
+	}
+	if c.PasswordMinLength < 1 || c.PasswordMinLength > 72 {
+		problems = append(problems, "PASSWORD_MIN_LENGTH has to be between 1 and 72")
+	}
+	if c.PasswordMinClasses < 0 || c.PasswordMinClasses > 4 {
+		problems = append(problems, "PASSWORD_MIN_CLASSES has to be between 0 and 4")
+	}
+	if c.BreachedPasswordsDir != "" {
+		if info, err := os.Stat(c.BreachedPasswordsDir); err != nil || !info.IsDir() {
+			problems = append(problems, "BREACHED_PASSWORDS_DIR is not a directory")
+		}
+	}
+	if c.LoginEmailFreeAttempts < 0 || c.LoginIPFreeAttempts < 0 {
+		problems = append(problems, "LOGIN_EMAIL_FREE_ATTEMPTS and LOGIN_IP_FREE_ATTEMPTS cannot be negative")
+	}
+	if c.LoginBackoffBase <= 0 || c.LoginLockoutMax < c.LoginBackoffBase {
+		problems = append(problems, "LOGIN_BACKOFF_BASE has to be positive and LOGIN_LOCKOUT_MAX at least as long")
+	}
+	if c.LoginFailureWindow <= 0 {
+		problems = append(problems, "LOGIN_FAILURE_WINDOW has to be positive")
+	}
+	if c.PersonalAccessTokenMaxLifetime < 0 {
+		problems = append(problems, "PERSONAL_ACCESS_TOKEN_MAX_LIFETIME cannot be negative")
+	}
+	if c.OAuthCodeLifetime <= 0 || c.OAuthCodeLifetime > 10*time.Minute {
+		problems = append(problems, "OAUTH_CODE_LIFETIME has to be positive and at most 10m")
+	}
+	if c.ImportMaxBytes <= 0 {
+		problems = append(problems, "IMPORT_MAX_BYTES has to be positive")
+	}
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				problems = append(problems, fmt.Sprintf("TRUSTED_PROXIES has an invalid address %q", proxy))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
 }
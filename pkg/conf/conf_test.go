@@ -0,0 +1,161 @@
+package conf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "app.env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("defaults apply without a configuration file", func(t *testing.T) {
+		config, args, err := Load([]string{"--config", writeConfigFile(t, ""), "--storage-backend", "memory"})
+
+		assert.Nil(t, err)
+		assert.Empty(t, args)
+		assert.Equal(t, ":9090", config.HTTPAddr)
+		assert.Equal(t, "EdDSA", config.JWTAlgorithm)
+		assert.Equal(t, 30*24*time.Hour, config.JWTKeyRotation)
+		assert.Equal(t, "CorroYouRun", config.JWTIssuer)
+		assert.Equal(t, 15*time.Minute, config.JWTAccessTokenLifetime)
+		assert.Equal(t, "log", config.MailSender)
+		assert.Equal(t, time.Hour, config.PasswordResetTokenLifetime)
+		assert.Equal(t, 5*time.Minute, config.PasswordResetResendInterval)
+		assert.False(t, config.EmailVerificationRequired)
+		assert.Equal(t, 10, config.PasswordMinLength)
+		assert.Empty(t, config.BreachedPasswordsDir)
+		assert.Equal(t, 5, config.LoginEmailFreeAttempts)
+		assert.Equal(t, 15*time.Minute, config.LoginLockoutMax)
+		assert.Empty(t, config.TrustedProxies)
+		assert.Equal(t, int64(10<<20), config.ImportMaxBytes)
+	})
+
+	t.Run("the environment overrides the file and flags override both", func(t *testing.T) {
+		path := writeConfigFile(t, "STORAGE_BACKEND=sqlite\nSQLITE_PATH=file.db\nHTTP_ADDR=:1000\nJWT_KEY_ROTATION=48h\n")
+		t.Setenv("SQLITE_PATH", "env.db")
+		t.Setenv("HTTP_ADDR", ":2000")
+
+		config, args, err := Load([]string{"--config", path, "--http-addr", ":3000", "migrate", "up"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"migrate", "up"}, args)
+		assert.Equal(t, "sqlite", config.StorageBackend)
+		assert.Equal(t, "env.db", config.SQLitePath)
+		assert.Equal(t, ":3000", config.HTTPAddr)
+		assert.Equal(t, 48*time.Hour, config.JWTKeyRotation)
+	})
+
+	t.Run("trusted proxies are a list", func(t *testing.T) {
+		t.Setenv("TRUSTED_PROXIES", "10.0.0.1,192.168.0.0/16")
+
+		config, _, err := Load([]string{"--config", writeConfigFile(t, ""), "--storage-backend", "memory"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"10.0.0.1", "192.168.0.0/16"}, config.TrustedProxies)
+	})
+
+	t.Run("a configuration file asked for has to exist", func(t *testing.T) {
+		_, _, err := Load([]string{"--config", filepath.Join(t.TempDir(), "missing.env")})
+
+		assert.ErrorContains(t, err, "missing.env")
+	})
+
+	t.Run("invalid settings are reported together", func(t *testing.T) {
+		_, _, err := Load([]string{"--config", writeConfigFile(t, ""), "--storage-backend", "mongo", "--jwt-algorithm", "HS256"})
+
+		assert.ErrorContains(t, err, "MONGO_URI is required")
+		assert.ErrorContains(t, err, `unknown JWT_ALGORITHM "HS256"`)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	config := Config{
+		HTTPAddr:                       ":9090",
+		StorageBackend:                 "memory",
+		JWTAlgorithm:                   "RS256",
+		JWTKeyRotation:                 time.Hour,
+		JWTKeyPublishAhead:             time.Minute,
+		JWTIssuer:                      "issuer",
+		JWTAudience:                    "audience",
+		JWTAccessTokenLifetime:         time.Minute,
+		JWTRefreshTokenLifetime:        time.Hour,
+		MailSender:                     "log",
+		PasswordResetTokenLifetime:     time.Hour,
+		EmailVerificationTokenLifetime: time.Hour,
+		PasswordMinLength:              8,
+		LoginBackoffBase:               time.Second,
+		LoginLockoutMax:                time.Minute,
+		LoginFailureWindow:             time.Hour,
+		OAuthCodeLifetime:              time.Minute,
+		ImportMaxBytes:                 1 << 20,
+	}
+	assert.Nil(t, config.Validate())
+
+	config.JWTLeeway = -time.Second
+	assert.ErrorContains(t, config.Validate(), "JWT_LEEWAY")
+
+	config.JWTLeeway = 0
+	config.JWTAudience = ""
+	assert.ErrorContains(t, config.Validate(), "JWT_AUDIENCE")
+
+	config.JWTAudience = "audience"
+
+	config.JWTKeyPublishAhead = time.Hour
+	assert.ErrorContains(t, config.Validate(), "JWT_KEY_PUBLISH_AHEAD")
+
+	config.JWTKeyPublishAhead = time.Minute
+	config.MailSender = "smtp"
+	assert.ErrorContains(t, config.Validate(), `unknown MAIL_SENDER "smtp"`)
+
+	config.MailSender = "log"
+	config.PasswordResetResendInterval = -time.Minute
+	assert.ErrorContains(t, config.Validate(), "PASSWORD_RESET_RESEND_INTERVAL")
+
+	config.PasswordResetResendInterval = 0
+	config.EmailVerificationURL = "not a url"
+	assert.ErrorContains(t, config.Validate(), "EMAIL_VERIFICATION_URL")
+
+	config.EmailVerificationURL = ""
+	config.PasswordMinClasses = 5
+	assert.ErrorContains(t, config.Validate(), "PASSWORD_MIN_CLASSES")
+
+	config.PasswordMinClasses = 2
+	config.BreachedPasswordsDir = filepath.Join(t.TempDir(), "missing")
+	assert.ErrorContains(t, config.Validate(), "BREACHED_PASSWORDS_DIR")
+
+	config.BreachedPasswordsDir = t.TempDir()
+	assert.Nil(t, config.Validate())
+
+	config.LoginLockoutMax = time.Millisecond
+	assert.ErrorContains(t, config.Validate(), "LOGIN_LOCKOUT_MAX")
+
+	config.LoginLockoutMax = time.Minute
+	config.PersonalAccessTokenMaxLifetime = -time.Hour
+	assert.ErrorContains(t, config.Validate(), "PERSONAL_ACCESS_TOKEN_MAX_LIFETIME")
+
+	config.PersonalAccessTokenMaxLifetime = 0
+	config.OAuthCodeLifetime = time.Hour
+	assert.ErrorContains(t, config.Validate(), "OAUTH_CODE_LIFETIME")
+
+	config.OAuthCodeLifetime = time.Minute
+	config.ImportMaxBytes = 0
+	assert.ErrorContains(t, config.Validate(), "IMPORT_MAX_BYTES")
+
+	config.ImportMaxBytes = 1 << 20
+	config.TrustedProxies = []string{"10.0.0.1", "proxy.local"}
+	assert.ErrorContains(t, config.Validate(), `TRUSTED_PROXIES has an invalid address "proxy.local"`)
+
+	config.TrustedProxies = nil
+	config.StorageBackend = "postgres"
+	assert.ErrorContains(t, config.Validate(), `unknown STORAGE_BACKEND "postgres"`)
+}
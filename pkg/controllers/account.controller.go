@@ -2,18 +2,30 @@ package controllers
 
 import (
 	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/croisade/chimichanga/pkg/middleware"
 	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
 	"github.com/croisade/chimichanga/pkg/services"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
 
 type AccountController struct {
-	AccountService services.AccountService
-	JWTService     services.JWTAuthService
+	AccountService       services.AccountService
+	SessionService       services.SessionService
+	TokenService         services.PersonalAccessTokenService
+	RevocationService    services.RevocationService
+	PasswordResetService services.PasswordResetService
+	VerificationService  services.EmailVerificationService
+	TwoFactorService     services.TwoFactorService
+	ThrottleService      services.LoginThrottleService
+	JWTService           services.JWTAuthService
+	Authorizer           middleware.Authorizer
 }
 
 type RefreshToken struct {
@@ -25,6 +37,26 @@ type JWTtoken struct {
 	RefreshToken string `json:"refreshToken"`
 }
 
+// TwoFactorChallenge answers logins to accounts with two-factor
+// authentication. The challenge token and a code complete the login.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+type TwoFactorLogin struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorCode struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
 type ErrorValidationMsg struct {
 	Field   string `json:"field"`
 	Message string `json:"message"`
@@ -34,18 +66,57 @@ type ErrorResponse struct {
 	Errors string `json:"errors"`
 }
 
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type VerificationRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type VerificationConfirmation struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type PasswordResetConfirmation struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// LockoutRequest names the email or client address to unlock.
+type LockoutRequest struct {
+	Kind  string `json:"kind" binding:"required,oneof=email ip"`
+	Value string `json:"value" binding:"required"`
+}
+
+type SetRolesRequest struct {
+	Roles []string `json:"roles" binding:"required,min=1"`
+}
+
+// UpdateAccountRequest changes the password when Password is set, which
+// takes the CurrentPassword as well.
 type UpdateAccountRequest struct {
-	AccountId string `json:"accountId" bson:"accountId"`
-	Email     string `json:"email" bson:"email"`
-	Password  string `json:"password" bson:"password"`
-	FirstName string `json:"firstName" bson:"firstName"`
-	LastName  string `json:"lastName" bson:"lastName"`
+	AccountId       string            `json:"accountId" bson:"accountId"`
+	Email           string            `json:"email" bson:"email"`
+	Password        string            `json:"password" bson:"password"`
+	CurrentPassword string            `json:"currentPassword" bson:"currentPassword" binding:"required_with=Password"`
+	FirstName       string            `json:"firstName" bson:"firstName"`
+	LastName        string            `json:"lastName" bson:"lastName"`
+	Units           models.UnitSystem `json:"units" bson:"units" binding:"omitempty,oneof=metric imperial"`
 }
 
-func NewAccountController(accountService services.AccountService, jwtService services.JWTAuthService) AccountController {
+func NewAccountController(accountService services.AccountService, sessionService services.SessionService, tokenService services.PersonalAccessTokenService, revocationService services.RevocationService, passwordResetService services.PasswordResetService, verificationService services.EmailVerificationService, twoFactorService services.TwoFactorService, throttleService services.LoginThrottleService, jwtService services.JWTAuthService, authorizer middleware.Authorizer) AccountController {
 	return AccountController{
-		AccountService: accountService,
-		JWTService:     jwtService,
+		AccountService:       accountService,
+		SessionService:       sessionService,
+		TokenService:         tokenService,
+		RevocationService:    revocationService,
+		PasswordResetService: passwordResetService,
+		VerificationService:  verificationService,
+		TwoFactorService:     twoFactorService,
+		ThrottleService:      throttleService,
+		JWTService:           jwtService,
+		Authorizer:           authorizer,
 	}
 }
 
@@ -57,6 +128,12 @@ func (ac *AccountController) getErrorMsg(fe validator.FieldError) string {
 		return "Should be less than " + fe.Param()
 	case "gte":
 		return "Should be greater than " + fe.Param()
+	case "oneof":
+		return "Should be one of " + fe.Param()
+	case "email":
+		return "Should be an email address"
+	case "required_with":
+		return "This field is required with " + fe.Param()
 	}
 	return "Unknown error"
 }
@@ -83,16 +160,33 @@ func (ac *AccountController) CreateAccount(ctx *gin.Context) {
 		return
 	}
 	result, err := ac.AccountService.CreateAccount(&account)
+	if refusedPassword(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrAccountExists) {
+		ctx.JSON(http.StatusConflict, gin.H{"errors": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
 		return
 	}
+
+	// The account exists either way, a verification that could not be sent
+	// can be asked for again.
+	if err := ac.VerificationService.SendVerification(result); err != nil {
+		log.Printf("account %s: cannot send verification: %v", result.AccountId, err)
+	}
 	ctx.JSON(http.StatusOK, result)
 	return
 }
 
 func (ac *AccountController) GetAccount(ctx *gin.Context) {
 	accountId := ctx.Param("accountId")
+	if !authorizeAccount(ctx, accountId) {
+		return
+	}
 	result, err := ac.AccountService.GetAccount(accountId)
 	if err != nil {
 		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
@@ -117,11 +211,24 @@ func (ac *AccountController) GetAccounts(ctx *gin.Context) {
 
 func (ac *AccountController) DeleteAccount(ctx *gin.Context) {
 	accountId := ctx.Param("accountId")
+	if !authorizeAccount(ctx, accountId) {
+		return
+	}
 	err := ac.AccountService.DeleteAccount(accountId)
 	if err != nil {
 		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
 		return
 	}
+
+	// Tokens issued to the account stop working with it, not when they expire.
+	if err := ac.SessionService.EndSession(accountId, ""); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return
+	}
+	if err := ac.TokenService.RevokeAll(accountId); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return
+	}
 	ctx.JSON(http.StatusOK, gin.H{"errors": "success"})
 	return
 }
@@ -130,20 +237,55 @@ func (ac *AccountController) UpdateAccount(ctx *gin.Context) {
 	var account *UpdateAccountRequest
 	var accountToBeUpdated models.Account
 	if err := ctx.ShouldBindJSON(&account); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		ac.handleValidationError(ctx, err)
+		return
+	}
+	if account.AccountId == "" {
+		account.AccountId = callerAccountId(ctx)
+	}
+	if !authorizeAccount(ctx, account.AccountId) {
 		return
 	}
 	accountToBeUpdated.AccountId = account.AccountId
 	accountToBeUpdated.Email = account.Email
 	accountToBeUpdated.FirstName = account.FirstName
 	accountToBeUpdated.LastName = account.LastName
-	accountToBeUpdated.Password = account.Password
+	accountToBeUpdated.Units = account.Units
+
+	if account.Password != "" {
+		_, err := ac.AccountService.ChangePassword(account.AccountId, account.CurrentPassword, account.Password)
+		if errors.Is(err, services.ErrWrongPassword) {
+			ctx.JSON(http.StatusForbidden, gin.H{"errors": err.Error()})
+			return
+		}
+		if refusedPassword(err) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+			return
+		}
+	}
 
 	result, err := ac.AccountService.UpdateAccount(&accountToBeUpdated)
 	if err != nil {
 		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
 		return
 	}
+
+	// A new password logs every device out, including the caller's, and
+	// revokes the personal access tokens of the account.
+	if account.Password != "" {
+		if err := ac.SessionService.EndSession(account.AccountId, ""); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+		if err := ac.TokenService.RevokeAll(account.AccountId); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+	}
 	ctx.JSON(http.StatusOK, result)
 	return
 }
@@ -156,36 +298,174 @@ func (ac *AccountController) Login(ctx *gin.Context) {
 		return
 	}
 
+	if !ac.checkThrottle(ctx, login.Email) {
+		return
+	}
+
 	account, err := ac.AccountService.Login(login)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		ac.recordFailure(ctx, login.Email)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"errors": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+
+	if err := ac.VerificationService.CheckLogin(account); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"errors": err.Error()})
+		return
+	}
 
+	if account.TOTPEnabled {
+		challengeToken, err := ac.TwoFactorService.Challenge(account)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, TwoFactorChallenge{TwoFactorRequired: true, ChallengeToken: challengeToken})
+		return
+	}
+
+	ac.startSession(ctx, account)
+}
+
+// LoginTwoFactor completes the login of an account with two-factor
+// authentication with a code from the authenticator app or a recovery code.
+func (ac *AccountController) LoginTwoFactor(ctx *gin.Context) {
+	var login TwoFactorLogin
+	if err := ctx.ShouldBindJSON(&login); err != nil {
+		ac.handleValidationError(ctx, err)
+		return
+	}
+
+	account, err := ac.TwoFactorService.ChallengeAccount(login.ChallengeToken)
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"errors": err.Error()})
+		ctx.JSON(http.StatusUnauthorized, gin.H{"errors": err.Error()})
 		return
 	}
 
-	token, err := ac.JWTService.CreateToken()
+	// Codes are guessed like passwords, they count against the same limits.
+	if !ac.checkThrottle(ctx, account.Email) {
+		return
+	}
+
+	completed, err := ac.TwoFactorService.CompleteChallenge(account, login.Code)
+	if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+		ac.recordFailure(ctx, account.Email)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"errors": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+
+	ac.startSession(ctx, completed)
+}
+
+// startSession answers a completed login with the tokens of a new session.
+func (ac *AccountController) startSession(ctx *gin.Context, account *models.Account) {
+	if err := ac.ThrottleService.RecordSuccess(account.Email); err != nil {
+		log.Printf("could not reset failed logins of %s: %v", account.AccountId, err)
+	}
+
+	token, refreshToken, err := ac.SessionService.StartSession(account, ctx.Request.UserAgent())
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
 		return
 	}
+	ctx.JSON(http.StatusOK, JWTtoken{Token: token, RefreshToken: refreshToken})
+}
+
+// refusedPassword tells whether err is the password policy refusing a
+// password, which the caller can fix by choosing another one.
+func refusedPassword(err error) bool {
+	return errors.Is(err, services.ErrWeakPassword) || errors.Is(err, services.ErrBreachedPassword)
+}
+
+// checkThrottle answers 429 with a Retry-After header while logins to email
+// or from the client address are locked out.
+func (ac *AccountController) checkThrottle(ctx *gin.Context, email string) bool {
+	err := ac.ThrottleService.Check(email, ctx.ClientIP())
+	var locked *services.LoginLockedError
+	if errors.As(err, &locked) {
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"errors": err.Error()})
+		return false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return false
+	}
+	return true
+}
+
+func (ac *AccountController) recordFailure(ctx *gin.Context, email string) {
+	if err := ac.ThrottleService.RecordFailure(email, ctx.ClientIP()); err != nil {
+		log.Printf("could not record failed login from %s: %v", ctx.ClientIP(), err)
+	}
+}
 
-	refreshToken, err := ac.JWTService.CreateRefreshToken()
+// EnrollTwoFactor starts two-factor enrollment of the caller's account.
+func (ac *AccountController) EnrollTwoFactor(ctx *gin.Context) {
+	enrollment, err := ac.TwoFactorService.Enroll(callerAccountId(ctx))
+	if errors.Is(err, services.ErrTwoFactorEnabled) {
+		ctx.JSON(http.StatusConflict, gin.H{"errors": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
 		return
 	}
+	ctx.JSON(http.StatusOK, enrollment)
+}
 
-	account.RefreshToken = refreshToken
-	ac.AccountService.UpdateAccount(account)
+// ConfirmTwoFactor enables two-factor authentication of the caller's account
+// and answers the recovery codes, the only time they are shown.
+func (ac *AccountController) ConfirmTwoFactor(ctx *gin.Context) {
+	var confirmation TwoFactorCode
+	if err := ctx.ShouldBindJSON(&confirmation); err != nil {
+		ac.handleValidationError(ctx, err)
+		return
+	}
 
+	codes, err := ac.TwoFactorService.Confirm(callerAccountId(ctx), confirmation.Code)
+	if errors.Is(err, services.ErrTwoFactorEnabled) {
+		ctx.JSON(http.StatusConflict, gin.H{"errors": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrTwoFactorNotEnrolled) || errors.Is(err, services.ErrInvalidTwoFactorCode) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, gin.H{"errors": err.Error()})
+		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
 		return
 	}
+	ctx.JSON(http.StatusOK, RecoveryCodes{RecoveryCodes: codes})
+}
 
-	result := JWTtoken{Token: token, RefreshToken: refreshToken}
-	ctx.JSON(http.StatusOK, result)
-	return
+// DisableTwoFactor turns two-factor authentication of the caller's account
+// off, given a current code.
+func (ac *AccountController) DisableTwoFactor(ctx *gin.Context) {
+	var confirmation TwoFactorCode
+	if err := ctx.ShouldBindJSON(&confirmation); err != nil {
+		ac.handleValidationError(ctx, err)
+		return
+	}
+
+	err := ac.TwoFactorService.Disable(callerAccountId(ctx), confirmation.Code)
+	if errors.Is(err, services.ErrTwoFactorNotEnrolled) || errors.Is(err, services.ErrInvalidTwoFactorCode) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, nil)
 }
 
 func (ac *AccountController) Token(ctx *gin.Context) {
@@ -196,54 +476,188 @@ func (ac *AccountController) Token(ctx *gin.Context) {
 		return
 	}
 
-	_, err := ac.JWTService.ValidateToken(refreshToken.RefreshToken)
+	token, nextRefreshToken, err := ac.SessionService.Refresh(refreshToken.RefreshToken)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		ctx.JSON(http.StatusUnauthorized, gin.H{"errors": err.Error()})
+		return
+	}
+
+	result := JWTtoken{Token: token, RefreshToken: nextRefreshToken}
+
+	ctx.JSON(http.StatusOK, result)
+	return
+}
+func (ac *AccountController) Logout(ctx *gin.Context) {
+	var logoutValidation *services.LogoutValidation
+	if err := ctx.ShouldBindJSON(&logoutValidation); err != nil {
+		ac.handleValidationError(ctx, err)
+		return
+	}
+	if !authorizeAccount(ctx, logoutValidation.AccountId) {
 		return
 	}
 
-	token, err := ac.JWTService.CreateToken()
+	identity, _ := middleware.GetIdentity(ctx)
+	if identity.TokenId != "" {
+		if err := ac.RevocationService.RevokeToken(identity.TokenId, identity.AccountId, identity.ExpiresAt); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+	}
+
+	err := ac.SessionService.EndSession(logoutValidation.AccountId, logoutValidation.RefreshToken)
+	if errors.Is(err, services.ErrNotRefreshToken) || errors.Is(err, services.ErrSessionRevoked) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
 		return
 	}
 
-	refreshTokens, err := ac.JWTService.CreateRefreshToken()
-	if err != nil {
+	ctx.JSON(http.StatusOK, nil)
+}
+
+// RequestPasswordReset mails a reset token to the account registered with the
+// email. It answers the same whether or not the email is registered.
+func (ac *AccountController) RequestPasswordReset(ctx *gin.Context) {
+	var request PasswordResetRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ac.handleValidationError(ctx, err)
+		return
+	}
+
+	if err := ac.PasswordResetService.RequestReset(request.Email); err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
 		return
 	}
+	ctx.JSON(http.StatusOK, nil)
+}
 
-	account, err := ac.AccountService.FindByRefreshToken(refreshToken.RefreshToken)
+// ResetPassword sets a new password with a mailed reset token.
+func (ac *AccountController) ResetPassword(ctx *gin.Context) {
+	var confirmation PasswordResetConfirmation
+	if err := ctx.ShouldBindJSON(&confirmation); err != nil {
+		ac.handleValidationError(ctx, err)
+		return
+	}
+
+	err := ac.PasswordResetService.ResetPassword(confirmation.Token, confirmation.Password)
+	if errors.Is(err, services.ErrInvalidResetToken) || refusedPassword(err) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
 		return
 	}
+	ctx.JSON(http.StatusOK, nil)
+}
+
+// VerifyEmail marks the account a mailed verification token was sent for as
+// verified.
+func (ac *AccountController) VerifyEmail(ctx *gin.Context) {
+	var confirmation VerificationConfirmation
+	if err := ctx.ShouldBindJSON(&confirmation); err != nil {
+		ac.handleValidationError(ctx, err)
+		return
+	}
 
-	_, err = ac.AccountService.UpdateAccount(account)
+	result, err := ac.VerificationService.Verify(confirmation.Token)
+	if errors.Is(err, services.ErrInvalidVerificationToken) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
 		return
 	}
+	ctx.JSON(http.StatusOK, result)
+}
 
-	result := JWTtoken{Token: token, RefreshToken: refreshTokens}
+// ResendVerification mails a new verification token to an unverified account.
+func (ac *AccountController) ResendVerification(ctx *gin.Context) {
+	var request VerificationRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ac.handleValidationError(ctx, err)
+		return
+	}
 
-	ctx.JSON(http.StatusOK, result)
-	return
+	if err := ac.VerificationService.Resend(request.Email); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, nil)
 }
-func (ac *AccountController) Logout(ctx *gin.Context) {
-	var logoutValidation *services.LogoutValidation
-	if err := ctx.ShouldBindJSON(&logoutValidation); err != nil {
+
+// RevokeSessions logs an account out of every device at once.
+func (ac *AccountController) RevokeSessions(ctx *gin.Context) {
+	accountId := ctx.Param("accountId")
+	if _, err := ac.AccountService.GetAccount(accountId); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"errors": err.Error()})
+		return
+	}
+
+	if err := ac.SessionService.EndSession(accountId, ""); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, nil)
+}
+
+// SetRoles replaces the roles of an account. Tokens already issued keep their
+// scopes until they are refreshed.
+func (ac *AccountController) SetRoles(ctx *gin.Context) {
+	var request SetRolesRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
 		ac.handleValidationError(ctx, err)
 		return
 	}
 
-	err := ac.AccountService.Logout(logoutValidation)
+	result, err := ac.AccountService.SetRoles(ctx.Param("accountId"), request.Roles)
+	if errors.Is(err, services.ErrUnknownRole) || errors.Is(err, services.ErrNoRoles) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+	if errors.Is(err, repositories.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"errors": err.Error()})
+		return
+	}
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// GetLockouts lists the emails and client addresses with failed logins.
+func (ac *AccountController) GetLockouts(ctx *gin.Context) {
+	result, err := ac.ThrottleService.Lockouts()
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// DeleteLockout forgets the failed logins of an email or a client address,
+// unlocking it at once.
+func (ac *AccountController) DeleteLockout(ctx *gin.Context) {
+	var request LockoutRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ac.handleValidationError(ctx, err)
 		return
 	}
 
+	err := ac.ThrottleService.Clear(request.Kind, request.Value)
+	if errors.Is(err, repositories.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"errors": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
 	ctx.JSON(http.StatusOK, nil)
 }
 
@@ -251,12 +665,26 @@ func (ac *AccountController) RegisterAccountRoutes(rg *gin.RouterGroup) {
 	accountRouteNoMw := rg.Group("/account")
 	accountRouteNoMw.POST("/create", ac.CreateAccount)
 	accountRouteNoMw.PUT("/login", ac.Login)
-	accountRouteUser := rg.Group("/account", middleware.AuthorizeUserJWT())
-	accountRouteUser.GET("/get/:accountId", ac.GetAccount)
-	accountRouteUser.DELETE("/delete/:accountId", ac.DeleteAccount)
-	accountRouteUser.PUT("/update", ac.UpdateAccount)
-	accountRouteUser.PUT("/token", ac.Token)
-	accountRouteUser.PUT("/logout", ac.Logout)
-	accountRouteAdmin := rg.Group("/account", middleware.AuthorizeAdminJWT())
+	accountRouteNoMw.PUT("/login/2fa", ac.LoginTwoFactor)
+	// The refresh token authenticates the request itself.
+	accountRouteNoMw.PUT("/token", ac.Token)
+	accountRouteNoMw.POST("/password/reset-request", ac.RequestPasswordReset)
+	accountRouteNoMw.POST("/password/reset", ac.ResetPassword)
+	accountRouteNoMw.POST("/email/verify", ac.VerifyEmail)
+	accountRouteNoMw.POST("/email/resend", ac.ResendVerification)
+	accountRouteRead := rg.Group("/account", ac.Authorizer.RequireScopes(models.ScopeAccountRead))
+	accountRouteRead.GET("/get/:accountId", ac.GetAccount)
+	accountRouteWrite := rg.Group("/account", ac.Authorizer.RequireScopes(models.ScopeAccountWrite))
+	accountRouteWrite.DELETE("/delete/:accountId", ac.DeleteAccount)
+	accountRouteWrite.PUT("/update", ac.UpdateAccount)
+	accountRouteWrite.PUT("/logout", ac.Logout)
+	accountRouteWrite.POST("/2fa/enroll", ac.EnrollTwoFactor)
+	accountRouteWrite.POST("/2fa/confirm", ac.ConfirmTwoFactor)
+	accountRouteWrite.POST("/2fa/disable", ac.DisableTwoFactor)
+	accountRouteAdmin := rg.Group("/account", ac.Authorizer.RequireScopes(models.ScopeAccountsAdmin))
 	accountRouteAdmin.GET("/fetch", ac.GetAccounts)
+	accountRouteAdmin.PUT("/revoke/:accountId", ac.RevokeSessions)
+	accountRouteAdmin.PUT("/roles/:accountId", ac.SetRoles)
+	accountRouteAdmin.GET("/lockout/fetch", ac.GetLockouts)
+	accountRouteAdmin.DELETE("/lockout/delete", ac.DeleteLockout)
 }
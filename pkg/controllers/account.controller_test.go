@@ -2,84 +2,124 @@ package controllers
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/croisade/chimichanga/pkg/mail"
+	"github.com/croisade/chimichanga/pkg/middleware"
 	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
 	"github.com/croisade/chimichanga/pkg/services"
+	"github.com/croisade/chimichanga/pkg/totp"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var accountCollection *mongo.Collection
 var accountController AccountController
 var accountService *services.AccountServiceImpl
-var runsCollection *mongo.Collection
+var sessionService *services.SessionServiceImpl
+var authorizer middleware.Authorizer
+var outbox bytes.Buffer
+var verificationConfig = services.EmailVerificationConfig{TokenLifetime: time.Hour, ResendInterval: time.Minute}
+var passwordPolicy = services.NewPasswordPolicyImpl(services.PasswordPolicyConfig{MinLength: 8, MinClasses: 1}, nil)
+var throttleConfig = services.LoginThrottleConfig{
+	EmailFreeAttempts: 3,
+	IPFreeAttempts:    10,
+	BaseDelay:         time.Minute,
+	MaxDelay:          time.Hour,
+	Window:            time.Hour,
+}
+var keyService = newKeyService()
+var tokenConfig = services.TokenConfig{
+	Issuer:               "CorroYouRun",
+	Audience:             "CorroYouRun",
+	AccessTokenLifetime:  15 * time.Minute,
+	RefreshTokenLifetime: 168 * time.Hour,
+	Leeway:               time.Minute,
+}
+var jwtService = services.NewJWTAuthService(keyService, tokenConfig)
 var runController RunController
+var personalAccessTokenController PersonalAccessTokenController
+var oauthController OAuthController
 var runService *services.RunServiceImpl
 
-var ctx context.Context
 var r *gin.Engine
 
-func setup() {
-	ctx = context.TODO()
-	c, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
-	if err != nil {
-		log.Fatalf("Error: %v", err)
-	}
-
-	accountCollection = c.Database("CorroYouRun").Collection("accounts")
-	runsCollection = c.Database("CorroYouRun").Collection("runs")
-	_, delErr := runsCollection.DeleteMany(ctx, bson.D{{}})
-	_, accDelErr := accountCollection.DeleteMany(ctx, bson.D{{}})
-
-	if delErr != nil {
-		log.Fatalf("Error: %v", delErr)
-	}
-	if accDelErr != nil {
-		log.Fatalf("Error: %v", delErr)
+func newKeyService() *services.KeyServiceImpl {
+	keyService := services.NewKeyServiceImpl(repositories.NewMemorySigningKeyRepository(), services.KeyRotation{
+		Algorithm:    models.AlgorithmEdDSA,
+		Period:       30 * 24 * time.Hour,
+		PublishAhead: time.Hour,
+		Retention:    168 * time.Hour,
+	})
+	if err := keyService.Rotate(); err != nil {
+		log.Fatal(err)
 	}
+	return keyService
+}
 
-	accountService = services.NewAccountServiceImpl(accountCollection, ctx)
-	runService = services.NewRunService(accountCollection, ctx)
-	jwtService := services.NewJWTAuthService()
-
-	accountController = NewAccountController(accountService, jwtService)
-	runController = NewRunController(runService, jwtService)
+func setup() {
+	resetAccounts()
+	resetRuns()
 	r = SetupRouter()
 	log.Println("\n-----Setup complete-----")
 }
 
+// resetAccounts swaps in an empty account store. Handlers registered on a
+// router keep working because they are bound to the package level controller.
+func resetAccounts() {
+	accountRepository := repositories.NewMemoryAccountRepository()
+	familyRepository := repositories.NewMemoryTokenFamilyRepository()
+	revocationService := services.NewRevocationServiceImpl(repositories.NewMemoryRevokedTokenRepository(), familyRepository, tokenConfig.Leeway)
+
+	accountService = services.NewAccountServiceImpl(accountRepository, passwordPolicy)
+	sessionService = services.NewSessionServiceImpl(familyRepository, accountRepository, jwtService)
+	personalAccessTokenService := services.NewPersonalAccessTokenServiceImpl(repositories.NewMemoryPersonalAccessTokenRepository(), accountRepository, services.PersonalAccessTokenConfig{})
+	passwordResetService := services.NewPasswordResetServiceImpl(repositories.NewMemoryPasswordResetTokenRepository(), accountRepository, sessionService, personalAccessTokenService, passwordPolicy, mail.NewWriterSender(&outbox), services.PasswordResetConfig{
+		TokenLifetime: time.Hour,
+	})
+	verificationService := services.NewEmailVerificationServiceImpl(repositories.NewMemoryEmailVerificationTokenRepository(), accountRepository, mail.NewWriterSender(&outbox), verificationConfig)
+	authorizer = middleware.NewAuthorizer(jwtService, revocationService, personalAccessTokenService)
+	personalAccessTokenController = NewPersonalAccessTokenController(personalAccessTokenService, authorizer)
+	twoFactorService := services.NewTwoFactorServiceImpl(accountRepository, jwtService, tokenConfig.Issuer)
+	throttleService := services.NewLoginThrottleServiceImpl(repositories.NewMemoryLoginThrottleRepository(), throttleConfig)
+	accountController = NewAccountController(accountService, sessionService, personalAccessTokenService, revocationService, passwordResetService, verificationService, twoFactorService, throttleService, jwtService, authorizer)
+	oauthService := services.NewOAuthServiceImpl(repositories.NewMemoryOAuthClientRepository(), repositories.NewMemoryOAuthConsentRepository(), repositories.NewMemoryOAuthAuthorizationCodeRepository(), familyRepository, accountService, jwtService, revocationService, services.OAuthConfig{
+		CodeLifetime: time.Minute,
+	})
+	oauthController = NewOAuthController(oauthService, authorizer)
+}
+
+func resetRuns() {
+	runService = services.NewRunService(repositories.NewMemoryRunRepository())
+	runController = NewRunController(runService, accountService, jwtService, authorizer, testImportMaxBytes)
+}
+
 func SetupRouter() *gin.Engine {
 	router := gin.Default()
 	gin.SetMode(gin.TestMode)
-	{
-		accountGroup := router.Group("account")
-		{
-			accountGroup.POST("/create", accountController.CreateAccount)
-		}
-		runGroup := router.Group("run")
-		{
-			runGroup.POST("/create", runController.CreateRun)
-			runGroup.GET("", runController.GetRun)
-			runGroup.GET("/fetch", runController.GetAll)
-			runGroup.PUT("/update", runController.UpdateRun)
-			runGroup.DELETE("/delete", runController.DeleteRun)
-		}
-	}
+	accountController.RegisterAccountRoutes(&router.RouterGroup)
+	runController.RegisterRunRoutes(&router.RouterGroup)
+	personalAccessTokenController.RegisterPersonalAccessTokenRoutes(&router.RouterGroup)
+	oauthController.RegisterOAuthRoutes(&router.RouterGroup)
+	keyController := NewKeyController(keyService)
+	keyController.RegisterKeyRoutes(&router.RouterGroup)
 	return router
 }
 
+// authorize signs req with an access token carrying the scopes of role.
+func authorize(req *http.Request, accountId string, role string) {
+	token, _ := jwtService.CreateToken(accountId, models.ScopesFor([]string{role}), "")
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
 func TestMain(m *testing.M) {
 	setup()
 	m.Run()
@@ -105,6 +145,34 @@ func TestCreate(t *testing.T) {
 		assert.Equal(t, account.Email, response.Email)
 	})
 
+	t.Run("Should refuse passwords the policy refuses", func(t *testing.T) {
+		account := &models.Account{Email: "weak@example.com", Password: "weak", FirstName: "first", LastName: "last"}
+		response := &ErrorResponse{}
+
+		jsonValue, _ := json.Marshal(account)
+		req, _ := http.NewRequest("POST", "/account/create", bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		json.Unmarshal(w.Body.Bytes(), response)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "password is too weak: use at least 8 characters", response.Errors)
+	})
+
+	t.Run("Should conflict if the email is already registered", func(t *testing.T) {
+		account := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"}
+		response := &ErrorResponse{}
+
+		jsonValue, _ := json.Marshal(account)
+		req, _ := http.NewRequest("POST", "/account/create", bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		json.Unmarshal(w.Body.Bytes(), response)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Equal(t, "account already exists", response.Errors)
+	})
+
 	t.Run("Should raise if a required field is missing", func(t *testing.T) {
 		account := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first"}
 		response := &Response{}
@@ -123,11 +191,10 @@ func TestCreate(t *testing.T) {
 
 func TestLogin(t *testing.T) {
 	t.Run("Should Raise if account does not exist", func(t *testing.T) {
-		accountCollection.DeleteMany(ctx, bson.D{{}})
+		resetAccounts()
 		response := &ErrorResponse{}
 
 		r := SetupRouter()
-		r.PUT("/account/login", accountController.Login)
 
 		login := &services.LoginValidation{Email: "test@example.com", Password: "password"}
 		jsonValue, _ := json.Marshal(login)
@@ -136,8 +203,8 @@ func TestLogin(t *testing.T) {
 		r.ServeHTTP(w, req)
 
 		json.Unmarshal(w.Body.Bytes(), response)
-		assert.Equal(t, http.StatusNotFound, w.Code)
-		assert.Equal(t, "mongo: no documents in result", response.Errors)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "invalid credentials", response.Errors)
 	})
 
 	t.Run("Should create a token", func(t *testing.T) {
@@ -146,7 +213,6 @@ func TestLogin(t *testing.T) {
 		token := &JWTtoken{}
 
 		r := SetupRouter()
-		r.PUT("/account/login", accountController.Login)
 
 		login := &services.LoginValidation{Email: "test@example.com", Password: "password"}
 		jsonValue, _ := json.Marshal(login)
@@ -165,7 +231,6 @@ func TestLogin(t *testing.T) {
 		response := &Response{}
 
 		r := SetupRouter()
-		r.PUT("/account/login", accountController.Login)
 
 		jsonValue, _ := json.Marshal(login)
 		req, _ := http.NewRequest("PUT", "/account/login", bytes.NewBuffer(jsonValue))
@@ -180,36 +245,66 @@ func TestLogin(t *testing.T) {
 }
 
 func TestToken(t *testing.T) {
-	t.Run("Should refresh a token", func(t *testing.T) {
-		accountCollection.DeleteMany(ctx, bson.D{{}})
-		var refreshToken JWTtoken
+	refresh := func(r *gin.Engine, refreshToken string) (*httptest.ResponseRecorder, *JWTtoken) {
 		var response *JWTtoken
-		token, _ := accountController.JWTService.CreateToken()
+		jsonValue, _ := json.Marshal(RefreshToken{RefreshToken: refreshToken})
+		req, _ := http.NewRequest("PUT", "/account/token", bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
 
-		want := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last", RefreshToken: token}
-		accountService.CreateAccount(want)
-		refreshToken.RefreshToken = token
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	t.Run("Should refresh a token", func(t *testing.T) {
+		resetAccounts()
+		account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+		token, refreshToken, _ := sessionService.StartSession(account, "test")
 
 		time.Sleep(1 * time.Second)
 
 		r := SetupRouter()
-		r.PUT("/account/token", accountController.Token)
+		w, response := refresh(r, refreshToken)
 
-		jsonValue, _ := json.Marshal(refreshToken)
-		req, _ := http.NewRequest("PUT", "/account/token", bytes.NewBuffer(jsonValue))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, response.Token, token)
+		assert.NotEqual(t, response.RefreshToken, refreshToken)
+	})
+
+	t.Run("Should revoke the session when a refresh token is reused", func(t *testing.T) {
+		resetAccounts()
+		account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+		_, refreshToken, _ := sessionService.StartSession(account, "test")
+
+		r := SetupRouter()
+		_, rotated := refresh(r, refreshToken)
+
+		w, _ := refresh(r, refreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w, _ = refresh(r, rotated.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Should refuse refresh tokens as access tokens", func(t *testing.T) {
+		resetAccounts()
+		account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+		_, refreshToken, _ := sessionService.StartSession(account, "test")
+
+		r := SetupRouter()
+
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/account/get/%v", account.AccountId), nil)
+		req.Header.Set("Authorization", "Bearer "+refreshToken)
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
-		json.Unmarshal(w.Body.Bytes(), &response)
-		assert.Equal(t, http.StatusOK, w.Code)
-		assert.NotEqual(t, response.Token, token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
 	})
 
 	t.Run("Should raise if a token is missing", func(t *testing.T) {
 		response := &ErrorResponse{}
 
 		r := SetupRouter()
-		r.PUT("/account/token", accountController.Token)
 
 		req, _ := http.NewRequest("PUT", "/account/token", nil)
 		w := httptest.NewRecorder()
@@ -220,36 +315,419 @@ func TestToken(t *testing.T) {
 		assert.Equal(t, response.Errors, "invalid request")
 	})
 }
+
 func TestLogout(t *testing.T) {
-	t.Run("Should logout and remove token from account document", func(t *testing.T) {
-		accountCollection.DeleteMany(ctx, bson.D{{}})
+	t.Run("Should logout and revoke the sessions of the account", func(t *testing.T) {
+		resetAccounts()
 		want := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"}
-		accountService.CreateAccount(want)
-		accounts, _ := accountService.GetAccounts()
-		var logout = &services.LogoutValidation{AccountId: accounts[0].AccountId}
+		account, _ := accountService.CreateAccount(want)
+		_, refreshToken, _ := sessionService.StartSession(account, "test")
+		var logout = &services.LogoutValidation{AccountId: account.AccountId}
 
 		r := SetupRouter()
-		r.PUT("/account/logout", accountController.Logout)
 
 		jsonValue, _ := json.Marshal(logout)
 		req, _ := http.NewRequest("PUT", "/account/logout", bytes.NewBuffer(jsonValue))
+		authorize(req, logout.AccountId, models.RoleUser)
 		w := httptest.NewRecorder()
 		r.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusOK, w.Code)
+
+		_, _, err := sessionService.Refresh(refreshToken)
+		assert.ErrorIs(t, err, services.ErrSessionRevoked)
+	})
+
+	t.Run("Should refuse the access token right after logout", func(t *testing.T) {
+		resetAccounts()
+		account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+		token, refreshToken, _ := sessionService.StartSession(account, "test")
+
+		r := SetupRouter()
+
+		jsonValue, _ := json.Marshal(services.LogoutValidation{AccountId: account.AccountId, RefreshToken: refreshToken})
+		req, _ := http.NewRequest("PUT", "/account/logout", bytes.NewBuffer(jsonValue))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		req, _ = http.NewRequest("GET", fmt.Sprintf("/account/get/%v", account.AccountId), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestRevokeSessions(t *testing.T) {
+	getAccount := func(r *gin.Engine, accountId string, token string) int {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/account/get/%v", accountId), nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Should refuse every token of the account after an admin revokes its sessions", func(t *testing.T) {
+		resetAccounts()
+		account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+		phone, _, _ := sessionService.StartSession(account, "phone")
+		laptop, _, _ := sessionService.StartSession(account, "laptop")
+
+		r := SetupRouter()
+		assert.Equal(t, http.StatusOK, getAccount(r, account.AccountId, phone))
+
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/account/revoke/%v", account.AccountId), nil)
+		authorize(req, "admin", models.RoleAdmin)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, getAccount(r, account.AccountId, phone))
+		assert.Equal(t, http.StatusUnauthorized, getAccount(r, account.AccountId, laptop))
+	})
+
+	t.Run("Should only let admins revoke sessions", func(t *testing.T) {
+		resetAccounts()
+		account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+
+		r := SetupRouter()
+
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/account/revoke/%v", account.AccountId), nil)
+		authorize(req, account.AccountId, models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Should log every device out and revoke access tokens when the password changes", func(t *testing.T) {
+		resetAccounts()
+		account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+		token, _, _ := sessionService.StartSession(account, "phone")
+
+		r := SetupRouter()
+
+		created := &CreatedPersonalAccessToken{}
+		jsonValue, _ := json.Marshal(CreatePersonalAccessTokenRequest{Name: "backup script", Scopes: []string{models.ScopeAccountRead}})
+		req, _ := http.NewRequest("POST", "/account/tokens/create", bytes.NewBuffer(jsonValue))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		json.Unmarshal(w.Body.Bytes(), created)
+		assert.Equal(t, http.StatusOK, getAccount(r, account.AccountId, created.Token))
+
+		jsonValue, _ = json.Marshal(UpdateAccountRequest{Password: "changed password", CurrentPassword: "password"})
+		req, _ = http.NewRequest("PUT", "/account/update", bytes.NewBuffer(jsonValue))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, getAccount(r, account.AccountId, token))
+		assert.Equal(t, http.StatusUnauthorized, getAccount(r, account.AccountId, created.Token))
+	})
+}
+
+func TestPasswordReset(t *testing.T) {
+	mailedToken := regexp.MustCompile(`password: ([A-Za-z0-9_-]+)`)
+	post := func(r *gin.Engine, path string, body interface{}) int {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Should let the holder of the mailed token log in with a new password", func(t *testing.T) {
+		resetAccounts()
+		outbox.Reset()
+		accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+
+		r := SetupRouter()
+
+		assert.Equal(t, http.StatusOK, post(r, "/account/password/reset-request", PasswordResetRequest{Email: "test@example.com"}))
+		match := mailedToken.FindStringSubmatch(outbox.String())
+		if match == nil {
+			t.Fatalf("no token mailed: %q", outbox.String())
+		}
+
+		assert.Equal(t, http.StatusOK, post(r, "/account/password/reset", PasswordResetConfirmation{Token: match[1], Password: "changed password"}))
+		assert.Equal(t, http.StatusBadRequest, post(r, "/account/password/reset", PasswordResetConfirmation{Token: match[1], Password: "password again"}))
+
+		_, err := accountService.Login(&services.LoginValidation{Email: "test@example.com", Password: "changed password"})
+		assert.Nil(t, err)
+	})
+
+	t.Run("Should answer the same for unknown emails", func(t *testing.T) {
+		resetAccounts()
+		outbox.Reset()
+
+		r := SetupRouter()
+
+		assert.Equal(t, http.StatusOK, post(r, "/account/password/reset-request", PasswordResetRequest{Email: "nobody@example.com"}))
+		assert.Empty(t, outbox.String())
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	mailedToken := regexp.MustCompile(`address: ([A-Za-z0-9_-]+)`)
+	send := func(r *gin.Engine, method string, path string, body interface{}) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	verificationConfig.RequireVerified = true
+	defer func() {
+		verificationConfig.RequireVerified = false
+		resetAccounts()
+	}()
+
+	t.Run("Should block login until the mailed token is used", func(t *testing.T) {
+		resetAccounts()
+		outbox.Reset()
+		r := SetupRouter()
+
+		account := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last", EmailVerified: true}
+		created := &models.Account{}
+		w := send(r, "POST", "/account/create", account)
+		json.Unmarshal(w.Body.Bytes(), created)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.False(t, created.EmailVerified)
+
+		login := services.LoginValidation{Email: "test@example.com", Password: "password"}
+		assert.Equal(t, http.StatusForbidden, send(r, "PUT", "/account/login", login).Code)
+		assert.Equal(t, http.StatusOK, send(r, "POST", "/account/email/resend", VerificationRequest{Email: "test@example.com"}).Code)
+		assert.Len(t, mailedToken.FindAllStringSubmatch(outbox.String(), -1), 1)
+
+		match := mailedToken.FindStringSubmatch(outbox.String())
+		if match == nil {
+			t.Fatalf("no token mailed: %q", outbox.String())
+		}
+		assert.Equal(t, http.StatusOK, send(r, "POST", "/account/email/verify", VerificationConfirmation{Token: match[1]}).Code)
+		assert.Equal(t, http.StatusBadRequest, send(r, "POST", "/account/email/verify", VerificationConfirmation{Token: match[1]}).Code)
+
+		assert.Equal(t, http.StatusOK, send(r, "PUT", "/account/login", login).Code)
+	})
+
+	t.Run("Should refuse signups without an email address", func(t *testing.T) {
+		resetAccounts()
+		r := SetupRouter()
+		response := &Response{}
+
+		w := send(r, "POST", "/account/create", &models.Account{Email: "not an email", Password: "password", FirstName: "first", LastName: "last"})
+		json.Unmarshal(w.Body.Bytes(), response)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, []ErrorValidationMsg{{Field: "Email", Message: "Should be an email address"}}, response.Errors)
+	})
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	send := func(r *gin.Engine, method string, path string, body interface{}, accountId string) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonValue))
+		if accountId != "" {
+			authorize(req, accountId, models.RoleUser)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	resetAccounts()
+	account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+	r := SetupRouter()
+
+	enrollment := &services.TOTPEnrollment{}
+	w := send(r, "POST", "/account/2fa/enroll", nil, account.AccountId)
+	json.Unmarshal(w.Body.Bytes(), enrollment)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	recovery := &RecoveryCodes{}
+	w = send(r, "POST", "/account/2fa/confirm", TwoFactorCode{Code: code}, account.AccountId)
+	json.Unmarshal(w.Body.Bytes(), recovery)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, recovery.RecoveryCodes)
+
+	t.Run("Should only issue tokens once the second factor is given", func(t *testing.T) {
+		challenge := &TwoFactorChallenge{}
+		w := send(r, "PUT", "/account/login", services.LoginValidation{Email: "test@example.com", Password: "password"}, "")
+		json.Unmarshal(w.Body.Bytes(), challenge)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, challenge.TwoFactorRequired)
+
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/account/get/%v", account.AccountId), nil)
+		req.Header.Set("Authorization", "Bearer "+challenge.ChallengeToken)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = send(r, "PUT", "/account/login/2fa", TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: "000000"}, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		tokens := &JWTtoken{}
+		w = send(r, "PUT", "/account/login/2fa", TwoFactorLogin{ChallengeToken: challenge.ChallengeToken, Code: recovery.RecoveryCodes[0]}, "")
+		json.Unmarshal(w.Body.Bytes(), tokens)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEmpty(t, tokens.Token)
+		assert.NotEmpty(t, tokens.RefreshToken)
+	})
+
+	t.Run("Should take a code to turn two-factor authentication off", func(t *testing.T) {
+		w := send(r, "POST", "/account/2fa/disable", TwoFactorCode{Code: "000000"}, account.AccountId)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = send(r, "POST", "/account/2fa/disable", TwoFactorCode{Code: recovery.RecoveryCodes[1]}, account.AccountId)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		tokens := &JWTtoken{}
+		w = send(r, "PUT", "/account/login", services.LoginValidation{Email: "test@example.com", Password: "password"}, "")
+		json.Unmarshal(w.Body.Bytes(), tokens)
+		assert.NotEmpty(t, tokens.Token)
+	})
+}
+
+func TestLoginThrottle(t *testing.T) {
+	send := func(r *gin.Engine, method string, path string, body interface{}, role string) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonValue))
+		if role != "" {
+			authorize(req, "admin", role)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	wrong := services.LoginValidation{Email: "test@example.com", Password: "wrong"}
+	right := services.LoginValidation{Email: "test@example.com", Password: "password"}
+
+	t.Run("Should lock an email out after the free attempts", func(t *testing.T) {
+		resetAccounts()
+		accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+		r := SetupRouter()
+
+		for i := 0; i < throttleConfig.EmailFreeAttempts; i++ {
+			assert.Equal(t, http.StatusUnauthorized, send(r, "PUT", "/account/login", wrong, "").Code)
+		}
+		w := send(r, "PUT", "/account/login", right, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		for i := 0; i <= throttleConfig.EmailFreeAttempts; i++ {
+			send(r, "PUT", "/account/login", wrong, "")
+		}
+		w = send(r, "PUT", "/account/login", right, "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("Should lock unknown emails out alike", func(t *testing.T) {
+		resetAccounts()
+		r := SetupRouter()
+
+		for i := 0; i <= throttleConfig.EmailFreeAttempts; i++ {
+			assert.Equal(t, http.StatusUnauthorized, send(r, "PUT", "/account/login", wrong, "").Code)
+		}
+		assert.Equal(t, http.StatusTooManyRequests, send(r, "PUT", "/account/login", wrong, "").Code)
+	})
+
+	t.Run("Should let admins list and clear lockouts", func(t *testing.T) {
+		resetAccounts()
+		accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+		r := SetupRouter()
+
+		for i := 0; i <= throttleConfig.EmailFreeAttempts; i++ {
+			send(r, "PUT", "/account/login", wrong, "")
+		}
+
+		assert.Equal(t, http.StatusForbidden, send(r, "GET", "/account/lockout/fetch", nil, models.RoleUser).Code)
+		w := send(r, "GET", "/account/lockout/fetch", nil, models.RoleAdmin)
+		lockouts := []*models.LoginThrottle{}
+		json.Unmarshal(w.Body.Bytes(), &lockouts)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, lockouts, 2)
+
+		w = send(r, "DELETE", "/account/lockout/delete", LockoutRequest{Kind: models.ThrottleEmail, Value: "Test@Example.com"}, models.RoleAdmin)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusOK, send(r, "PUT", "/account/login", right, "").Code)
+
+		w = send(r, "DELETE", "/account/lockout/delete", LockoutRequest{Kind: models.ThrottleEmail, Value: "test@example.com"}, models.RoleAdmin)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = send(r, "DELETE", "/account/lockout/delete", LockoutRequest{Kind: "account", Value: "test@example.com"}, models.RoleAdmin)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestSetRoles(t *testing.T) {
+	setRoles := func(r *gin.Engine, accountId string, roles []string) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(SetRolesRequest{Roles: roles})
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/account/roles/%v", accountId), bytes.NewBuffer(jsonValue))
+		authorize(req, "admin", models.RoleAdmin)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Should grant the scopes of new roles from the next refresh on", func(t *testing.T) {
+		resetAccounts()
+		account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+		_, refreshToken, _ := sessionService.StartSession(account, "phone")
+
+		r := SetupRouter()
+
+		w := setRoles(r, account.AccountId, []string{models.RoleUser, models.RoleAdmin})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		token, _, _ := sessionService.Refresh(refreshToken)
+		claims, _ := jwtService.ValidateClaims(token)
+		assert.Contains(t, claims.Scopes(), models.ScopeAccountsAdmin)
+	})
+
+	t.Run("Should refuse unknown roles", func(t *testing.T) {
+		resetAccounts()
+		account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+
+		r := SetupRouter()
+
+		w := setRoles(r, account.AccountId, []string{"OWNER"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Should refuse to remove every role", func(t *testing.T) {
+		resetAccounts()
+		account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+
+		r := SetupRouter()
+
+		w := setRoles(r, account.AccountId, []string{})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		_, err := accountService.SetRoles(account.AccountId, nil)
+		assert.ErrorIs(t, err, services.ErrNoRoles)
+	})
+
+	t.Run("Should not find unknown accounts", func(t *testing.T) {
+		resetAccounts()
+		r := SetupRouter()
+
+		w := setRoles(r, "missing", []string{models.RoleUser})
+		assert.Equal(t, http.StatusNotFound, w.Code)
 	})
 }
 
 func TestGetAccount(t *testing.T) {
-	accountCollection.DeleteMany(ctx, bson.D{{}})
+	resetAccounts()
 	var response *models.Account
 	fixture := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"}
 	account, _ := accountService.CreateAccount(fixture)
 
 	r := SetupRouter()
-	r.GET("/account/get/:accountId", accountController.GetAccount)
 
 	req, _ := http.NewRequest("GET", fmt.Sprintf("/account/get/%v", account.AccountId), nil)
+	authorize(req, account.AccountId, models.RoleUser)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -258,16 +736,31 @@ func TestGetAccount(t *testing.T) {
 	assert.Equal(t, response.AccountId, account.AccountId)
 }
 
+func TestGetAccountOfAnotherUser(t *testing.T) {
+	resetAccounts()
+	fixture := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"}
+	account, _ := accountService.CreateAccount(fixture)
+
+	r := SetupRouter()
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/account/get/%v", account.AccountId), nil)
+	authorize(req, "intruder", models.RoleUser)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
 func TestGetAccounts(t *testing.T) {
-	accountCollection.DeleteMany(ctx, bson.D{{}})
+	resetAccounts()
 	var response []*models.Account
 	fixture := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"}
 	account, _ := accountService.CreateAccount(fixture)
 
 	r := SetupRouter()
-	r.GET("/account/fetch", accountController.GetAccounts)
 
 	req, _ := http.NewRequest("GET", "/account/fetch", nil)
+	authorize(req, "admin", models.RoleAdmin)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -276,22 +769,49 @@ func TestGetAccounts(t *testing.T) {
 	assert.Equal(t, response[0].AccountId, account.AccountId)
 }
 func TestDeleteAccount(t *testing.T) {
-	accountCollection.DeleteMany(ctx, bson.D{{}})
+	resetAccounts()
 	fixture := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"}
 	account, _ := accountService.CreateAccount(fixture)
 
 	r := SetupRouter()
-	r.DELETE("/account/delete/:accountId", accountController.DeleteAccount)
 
 	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/account/delete/%v", account.AccountId), nil)
+	authorize(req, account.AccountId, models.RoleUser)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestDeleteAccountRevokesTokens(t *testing.T) {
+	resetAccounts()
+	resetRuns()
+	account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+	token, _, _ := sessionService.StartSession(account, "phone")
+	runService.CreateRun(&models.Run{AccountId: account.AccountId, Distance: 5})
+
+	r := SetupRouter()
+	fetchRuns := func() int {
+		jsonValue, _ := json.Marshal(services.RunFetchRequest{AccountId: account.AccountId})
+		req, _ := http.NewRequest("GET", "/run/fetch", bytes.NewBuffer(jsonValue))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, fetchRuns())
+
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/account/delete/%v", account.AccountId), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, fetchRuns())
+}
+
 func TestUpdateAccount(t *testing.T) {
-	accountCollection.DeleteMany(ctx, bson.D{{}})
+	resetAccounts()
 	fixture := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"}
 	account, _ := accountService.CreateAccount(fixture)
 	update := &models.Account{AccountId: account.AccountId, FirstName: "Jamal"}
@@ -300,9 +820,9 @@ func TestUpdateAccount(t *testing.T) {
 	jsonValue, _ := json.Marshal(update)
 
 	r := SetupRouter()
-	r.PUT("/account/update", accountController.UpdateAccount)
 
 	req, _ := http.NewRequest("PUT", "/account/update", bytes.NewBuffer(jsonValue))
+	authorize(req, account.AccountId, models.RoleUser)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -311,3 +831,28 @@ func TestUpdateAccount(t *testing.T) {
 	assert.Equal(t, response.FirstName, update.FirstName)
 	assert.Equal(t, response.LastName, fixture.LastName)
 }
+
+func TestChangePassword(t *testing.T) {
+	resetAccounts()
+	account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+	r := SetupRouter()
+
+	update := func(request UpdateAccountRequest) int {
+		jsonValue, _ := json.Marshal(request)
+		req, _ := http.NewRequest("PUT", "/account/update", bytes.NewBuffer(jsonValue))
+		authorize(req, account.AccountId, models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, update(UpdateAccountRequest{Password: "changed password"}))
+	assert.Equal(t, http.StatusForbidden, update(UpdateAccountRequest{Password: "changed password", CurrentPassword: "wrong"}))
+	assert.Equal(t, http.StatusBadRequest, update(UpdateAccountRequest{Password: "short", CurrentPassword: "password"}))
+	assert.Equal(t, http.StatusOK, update(UpdateAccountRequest{Password: "changed password", CurrentPassword: "password"}))
+
+	updated, _ := accountService.GetAccount(account.AccountId)
+	assert.NotEqual(t, "changed password", updated.Password)
+	_, err := accountService.Login(&services.LoginValidation{Email: "test@example.com", Password: "changed password"})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/croisade/chimichanga/pkg/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// authorizeAccount reports whether the authenticated caller may act on the
+// data of accountId: their own account, or any account for admins. It writes
+// the error response itself and returns false when the request must stop.
+func authorizeAccount(ctx *gin.Context, accountId string) bool {
+	identity, ok := middleware.GetIdentity(ctx)
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"errors": "request missing token"})
+		return false
+	}
+
+	if identity.IsAdmin() || identity.AccountId == accountId {
+		return true
+	}
+	ctx.JSON(http.StatusForbidden, gin.H{"errors": "account belongs to another user"})
+	return false
+}
+
+// callerAccountId is the account of the authenticated caller, the default for
+// requests that do not name one.
+func callerAccountId(ctx *gin.Context) string {
+	identity, _ := middleware.GetIdentity(ctx)
+	return identity.AccountId
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/croisade/chimichanga/pkg/services"
+	"github.com/gin-gonic/gin"
+)
+
+// keySetMaxAge is how long verifiers may cache the key set. It has to stay
+// below the time new keys are published ahead of signing.
+const keySetMaxAge = "max-age=300"
+
+type KeyController struct {
+	KeyService services.KeyService
+}
+
+func NewKeyController(keyService services.KeyService) KeyController {
+	return KeyController{
+		KeyService: keyService,
+	}
+}
+
+// GetKeySet publishes the public keys tokens are verified with.
+func (kc *KeyController) GetKeySet(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, "+keySetMaxAge)
+	ctx.JSON(http.StatusOK, kc.KeyService.KeySet())
+}
+
+// RegisterKeyRoutes registers the well-known routes, rg is expected to be
+// the root of the server rather than a versioned group.
+func (kc *KeyController) RegisterKeyRoutes(rg *gin.RouterGroup) {
+	rg.GET("/.well-known/jwks.json", kc.GetKeySet)
+}
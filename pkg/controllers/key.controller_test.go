@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetKeySet(t *testing.T) {
+	var keySet services.JSONWebKeySet
+	r := SetupRouter()
+
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Cache-Control"), "max-age")
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &keySet))
+	assert.Len(t, keySet.Keys, 1)
+
+	t.Run("published keys verify issued tokens", func(t *testing.T) {
+		key := keySet.Keys[0]
+		assert.Equal(t, "OKP", key.KeyType)
+		assert.Equal(t, "Ed25519", key.Curve)
+		assert.Equal(t, "sig", key.Use)
+
+		token, _ := jwtService.CreateToken("123", models.ScopesFor([]string{models.RoleUser}), "")
+		parts := strings.Split(token, ".")
+		public, _ := base64.RawURLEncoding.DecodeString(key.X)
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+
+		assert.True(t, ed25519.Verify(public, []byte(parts[0]+"."+parts[1]), signature))
+
+		var header map[string]string
+		rawHeader, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		json.Unmarshal(rawHeader, &header)
+		assert.Equal(t, key.KeyId, header["kid"])
+	})
+}
@@ -0,0 +1,328 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/croisade/chimichanga/pkg/middleware"
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/croisade/chimichanga/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// OAuthController serves the OAuth2 authorization server: the apps accounts
+// register, the consent step of the authorization code flow, the token and
+// introspection endpoints, and the consents accounts gave.
+type OAuthController struct {
+	OAuthService services.OAuthService
+	Authorizer   middleware.Authorizer
+}
+
+// RegisterOAuthClientRequest describes a new app. Confidential apps can keep
+// a secret, such as the backend of a coaching tool; apps running on a device,
+// such as a treadmill companion app, cannot.
+type RegisterOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirectUris" binding:"required,min=1"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	Confidential bool     `json:"confidential"`
+}
+
+// RegisteredOAuthClient is the only response the client secret is ever
+// shown in.
+type RegisteredOAuthClient struct {
+	ClientSecret string `json:"clientSecret,omitempty"`
+	*models.OAuthClient
+}
+
+// AuthorizationDecision is the answer of an account to an authorization
+// request, sent along with its parameters.
+type AuthorizationDecision struct {
+	services.AuthorizationRequest
+	Approved bool `json:"approved"`
+}
+
+func NewOAuthController(oauthService services.OAuthService, authorizer middleware.Authorizer) OAuthController {
+	return OAuthController{
+		OAuthService: oauthService,
+		Authorizer:   authorizer,
+	}
+}
+
+func (oc *OAuthController) getErrorMsg(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "This field is required"
+	case "max":
+		return "Should be at most " + fe.Param() + " long"
+	case "min":
+		return "Should have at least " + fe.Param()
+	}
+	return "Unknown error"
+}
+
+func (oc *OAuthController) handleValidationError(ctx *gin.Context, err error) {
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+
+		out := make([]ErrorValidationMsg, len(ve))
+		for i, fe := range ve {
+			out[i] = ErrorValidationMsg{fe.Field(), oc.getErrorMsg(fe)}
+		}
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": out})
+		return
+	}
+	ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+	return
+}
+
+// loggedIn returns the identity of a caller who logged in. Apps and personal
+// access tokens must not register apps or approve requests on their own.
+func (oc *OAuthController) loggedIn(ctx *gin.Context) (middleware.Identity, bool) {
+	identity, _ := middleware.GetIdentity(ctx)
+	if identity.PersonalAccessTokenId != "" || identity.ClientId != "" {
+		ctx.JSON(http.StatusForbidden, gin.H{"errors": "this requires logging in"})
+		return identity, false
+	}
+	return identity, true
+}
+
+// RegisterClient registers an app owned by the caller.
+func (oc *OAuthController) RegisterClient(ctx *gin.Context) {
+	identity, ok := oc.loggedIn(ctx)
+	if !ok {
+		return
+	}
+
+	var request RegisterOAuthClientRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		oc.handleValidationError(ctx, err)
+		return
+	}
+
+	secret, client, err := oc.OAuthService.RegisterClient(identity.AccountId, request.Name, request.RedirectURIs, request.Scopes, request.Confidential)
+	if errors.Is(err, services.ErrInvalidRedirectURI) || errors.Is(err, services.ErrInvalidClientScope) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, RegisteredOAuthClient{ClientSecret: secret, OAuthClient: client})
+}
+
+// GetClients lists the apps the caller registered.
+func (oc *OAuthController) GetClients(ctx *gin.Context) {
+	result, err := oc.OAuthService.Clients(callerAccountId(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// DeleteClient removes an app of the caller, revoking every grant it has.
+func (oc *OAuthController) DeleteClient(ctx *gin.Context) {
+	err := oc.OAuthService.DeleteClient(callerAccountId(ctx), ctx.Param("clientId"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"errors": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, nil)
+}
+
+// GetAuthorization checks the authorization request an app sent the caller
+// to, for the consent page to show what the app asks for.
+func (oc *OAuthController) GetAuthorization(ctx *gin.Context) {
+	identity, ok := oc.loggedIn(ctx)
+	if !ok {
+		return
+	}
+
+	var request services.AuthorizationRequest
+	if err := ctx.ShouldBindQuery(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+
+	prompt, err := oc.OAuthService.Authorize(identity.AccountId, &request)
+	if err != nil {
+		oc.handleAuthorizationError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, prompt)
+}
+
+// Authorize answers an authorization request with the decision of the
+// caller. The consent page sends the caller on to the redirect URI returned.
+func (oc *OAuthController) Authorize(ctx *gin.Context) {
+	identity, ok := oc.loggedIn(ctx)
+	if !ok {
+		return
+	}
+
+	var decision AuthorizationDecision
+	if err := ctx.ShouldBindJSON(&decision); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+
+	var redirectURI string
+	var err error
+	if decision.Approved {
+		redirectURI, err = oc.OAuthService.Approve(identity.AccountId, &decision.AuthorizationRequest)
+	} else {
+		redirectURI, err = oc.OAuthService.Deny(&decision.AuthorizationRequest)
+	}
+	if err != nil {
+		oc.handleAuthorizationError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"redirectUri": redirectURI})
+}
+
+// handleAuthorizationError answers a refused authorization request. When the
+// app may be told, the response carries the redirect URI telling it.
+func (oc *OAuthController) handleAuthorizationError(ctx *gin.Context, err error) {
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+
+	response := gin.H{"errors": oauthErr.Description, "error": oauthErr.Code}
+	if oauthErr.RedirectURI != "" {
+		response["redirectUri"] = oauthErr.RedirectURI
+	}
+	ctx.JSON(http.StatusBadRequest, response)
+}
+
+// Token is the token endpoint of RFC 6749. Apps authenticate with HTTP basic
+// authentication or the client_id and client_secret parameters, and errors
+// take the shape the RFC gives them.
+func (oc *OAuthController) Token(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Pragma", "no-cache")
+
+	var request services.TokenRequest
+	if err := ctx.ShouldBindWith(&request, binding.FormPost); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": services.OAuthInvalidRequest, "error_description": err.Error()})
+		return
+	}
+	if clientId, clientSecret, ok := clientCredentials(ctx); ok {
+		request.ClientId, request.ClientSecret = clientId, clientSecret
+	}
+
+	response, err := oc.OAuthService.Exchange(&request)
+	if err != nil {
+		oc.handleTokenError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Introspect is the introspection endpoint of RFC 7662, open to confidential
+// apps, which authenticate as they do on the token endpoint.
+func (oc *OAuthController) Introspect(ctx *gin.Context) {
+	clientId, clientSecret, ok := clientCredentials(ctx)
+	if !ok {
+		clientId, clientSecret = ctx.PostForm("client_id"), ctx.PostForm("client_secret")
+	}
+
+	token := ctx.PostForm("token")
+	if token == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": services.OAuthInvalidRequest, "error_description": "token is required"})
+		return
+	}
+
+	introspection, err := oc.OAuthService.Introspect(clientId, clientSecret, token)
+	if err != nil {
+		oc.handleTokenError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, introspection)
+}
+
+func (oc *OAuthController) handleTokenError(ctx *gin.Context, err error) {
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) {
+		ctx.JSON(http.StatusBadGateway, gin.H{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == services.OAuthInvalidClient {
+		status = http.StatusUnauthorized
+		if _, _, ok := ctx.Request.BasicAuth(); ok {
+			ctx.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+	}
+	ctx.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+}
+
+// clientCredentials reads the HTTP basic credentials of an app, which RFC
+// 6749 has form-urlencoded first.
+func clientCredentials(ctx *gin.Context) (string, string, bool) {
+	username, password, ok := ctx.Request.BasicAuth()
+	if !ok {
+		return "", "", false
+	}
+	clientId, err := url.QueryUnescape(username)
+	if err != nil {
+		return "", "", false
+	}
+	clientSecret, err := url.QueryUnescape(password)
+	if err != nil {
+		return "", "", false
+	}
+	return clientId, clientSecret, true
+}
+
+// GetConsents lists the apps the caller let act for them.
+func (oc *OAuthController) GetConsents(ctx *gin.Context) {
+	result, err := oc.OAuthService.Consents(callerAccountId(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// DeleteConsent takes the access of an app to the caller's account back.
+func (oc *OAuthController) DeleteConsent(ctx *gin.Context) {
+	err := oc.OAuthService.RevokeConsent(callerAccountId(ctx), ctx.Param("clientId"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"errors": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, nil)
+}
+
+func (oc *OAuthController) RegisterOAuthRoutes(rg *gin.RouterGroup) {
+	oauthRoute := rg.Group("/oauth")
+	oauthRoute.POST("/token", oc.Token)
+	oauthRoute.POST("/introspect", oc.Introspect)
+
+	oauthRouteRead := rg.Group("/oauth", oc.Authorizer.RequireScopes(models.ScopeAccountRead))
+	oauthRouteRead.GET("/authorize", oc.GetAuthorization)
+	oauthRouteRead.GET("/clients/fetch", oc.GetClients)
+	oauthRouteRead.GET("/consents/fetch", oc.GetConsents)
+	oauthRouteWrite := rg.Group("/oauth", oc.Authorizer.RequireScopes(models.ScopeAccountWrite))
+	oauthRouteWrite.POST("/authorize", oc.Authorize)
+	oauthRouteWrite.POST("/clients/create", oc.RegisterClient)
+	oauthRouteWrite.DELETE("/clients/delete/:clientId", oc.DeleteClient)
+	oauthRouteWrite.DELETE("/consents/delete/:clientId", oc.DeleteConsent)
+}
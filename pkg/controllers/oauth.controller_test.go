@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuth(t *testing.T) {
+	send := func(r *gin.Engine, method string, path string, body interface{}, bearer string) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	postForm := func(r *gin.Engine, path string, form url.Values, clientId string, clientSecret string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	resetAccounts()
+	resetRuns()
+	account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+	login, _, _ := sessionService.StartSession(account, "laptop")
+	r := SetupRouter()
+	fetch := services.RunFetchRequest{AccountId: account.AccountId}
+	runService.CreateRun(&models.Run{AccountId: account.AccountId, Distance: 5})
+
+	client := &RegisteredOAuthClient{}
+	w := send(r, "POST", "/oauth/clients/create", RegisterOAuthClientRequest{Name: "Coach", RedirectURIs: []string{"https://coach.example/callback"}, Scopes: []string{models.ScopeRunsRead}, Confidential: true}, login)
+	json.Unmarshal(w.Body.Bytes(), client)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, client.ClientSecret)
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	request := services.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientId:            client.ClientId,
+		Scope:               models.ScopeRunsRead,
+		State:               "xyz",
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: "S256",
+	}
+	query := url.Values{
+		"response_type":         {request.ResponseType},
+		"client_id":             {request.ClientId},
+		"scope":                 {request.Scope},
+		"state":                 {request.State},
+		"code_challenge":        {request.CodeChallenge},
+		"code_challenge_method": {request.CodeChallengeMethod},
+	}
+	var tokens services.TokenResponse
+
+	t.Run("Should refuse invalid redirect URIs", func(t *testing.T) {
+		w := send(r, "POST", "/oauth/clients/create", RegisterOAuthClientRequest{Name: "Bad", RedirectURIs: []string{"http://bad.example/callback"}, Scopes: []string{models.ScopeRunsRead}}, login)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Should issue scoped tokens for approved requests", func(t *testing.T) {
+		prompt := services.AuthorizationPrompt{}
+		w := send(r, "GET", "/oauth/authorize?"+query.Encode(), nil, login)
+		json.Unmarshal(w.Body.Bytes(), &prompt)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "Coach", prompt.ClientName)
+		assert.False(t, prompt.Consented)
+
+		w = send(r, "POST", "/oauth/authorize", AuthorizationDecision{AuthorizationRequest: request, Approved: true}, login)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var decision struct{ RedirectUri string }
+		json.Unmarshal(w.Body.Bytes(), &decision)
+		redirect, _ := url.Parse(decision.RedirectUri)
+		assert.Equal(t, "coach.example", redirect.Host)
+		assert.Equal(t, "xyz", redirect.Query().Get("state"))
+
+		form := url.Values{"grant_type": {"authorization_code"}, "code": {redirect.Query().Get("code")}, "code_verifier": {verifier}}
+		w = postForm(r, "/oauth/token", form, client.ClientId, "wrong")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), services.OAuthInvalidClient)
+
+		w = postForm(r, "/oauth/token", form, client.ClientId, client.ClientSecret)
+		json.Unmarshal(w.Body.Bytes(), &tokens)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.Equal(t, models.ScopeRunsRead, tokens.Scope)
+
+		assert.Equal(t, http.StatusOK, send(r, "GET", "/run/fetch", fetch, tokens.AccessToken).Code)
+		assert.Equal(t, http.StatusForbidden, send(r, "POST", "/run/create", models.Run{AccountId: account.AccountId}, tokens.AccessToken).Code)
+	})
+
+	t.Run("Should tell the app about denied requests", func(t *testing.T) {
+		w := send(r, "POST", "/oauth/authorize", AuthorizationDecision{AuthorizationRequest: request}, login)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "error=access_denied")
+	})
+
+	t.Run("Should refuse unsupported grant types", func(t *testing.T) {
+		w := postForm(r, "/oauth/token", url.Values{"grant_type": {"password"}}, client.ClientId, client.ClientSecret)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), services.OAuthUnsupportedGrantType)
+	})
+
+	t.Run("Should introspect tokens for confidential apps", func(t *testing.T) {
+		introspection := services.Introspection{}
+		w := postForm(r, "/oauth/introspect", url.Values{"token": {tokens.AccessToken}}, client.ClientId, client.ClientSecret)
+		json.Unmarshal(w.Body.Bytes(), &introspection)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, introspection.Active)
+		assert.Equal(t, account.AccountId, introspection.Subject)
+
+		w = postForm(r, "/oauth/introspect", url.Values{"token": {tokens.AccessToken}}, client.ClientId, "wrong")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Should stop accepting tokens once consent is revoked", func(t *testing.T) {
+		consents := []*models.OAuthConsent{}
+		w := send(r, "GET", "/oauth/consents/fetch", nil, login)
+		json.Unmarshal(w.Body.Bytes(), &consents)
+		assert.Len(t, consents, 1)
+
+		assert.Equal(t, http.StatusOK, send(r, "DELETE", "/oauth/consents/delete/"+client.ClientId, nil, login).Code)
+		assert.Equal(t, http.StatusNotFound, send(r, "DELETE", "/oauth/consents/delete/"+client.ClientId, nil, login).Code)
+		assert.Equal(t, http.StatusUnauthorized, send(r, "GET", "/run/fetch", fetch, tokens.AccessToken).Code)
+	})
+
+	t.Run("Should list and delete the apps of the account", func(t *testing.T) {
+		clients := []*models.OAuthClient{}
+		w := send(r, "GET", "/oauth/clients/fetch", nil, login)
+		json.Unmarshal(w.Body.Bytes(), &clients)
+		assert.Len(t, clients, 1)
+		assert.NotContains(t, w.Body.String(), client.ClientSecret)
+
+		assert.Equal(t, http.StatusOK, send(r, "DELETE", "/oauth/clients/delete/"+client.ClientId, nil, login).Code)
+		assert.Equal(t, http.StatusNotFound, send(r, "DELETE", "/oauth/clients/delete/"+client.ClientId, nil, login).Code)
+	})
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/middleware"
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/croisade/chimichanga/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+type PersonalAccessTokenController struct {
+	PersonalAccessTokenService services.PersonalAccessTokenService
+	Authorizer                 middleware.Authorizer
+}
+
+// CreatePersonalAccessTokenRequest names a new token and the scopes it
+// grants. Tokens without ExpiresInDays never expire.
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"gte=0"`
+}
+
+// CreatedPersonalAccessToken is the only response the token is ever shown in.
+type CreatedPersonalAccessToken struct {
+	Token string `json:"token"`
+	*models.PersonalAccessToken
+}
+
+func NewPersonalAccessTokenController(personalAccessTokenService services.PersonalAccessTokenService, authorizer middleware.Authorizer) PersonalAccessTokenController {
+	return PersonalAccessTokenController{
+		PersonalAccessTokenService: personalAccessTokenService,
+		Authorizer:                 authorizer,
+	}
+}
+
+func (pc *PersonalAccessTokenController) getErrorMsg(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "This field is required"
+	case "gte":
+		return "Should be greater than " + fe.Param()
+	case "max":
+		return "Should be at most " + fe.Param() + " long"
+	case "min":
+		return "Should have at least " + fe.Param()
+	}
+	return "Unknown error"
+}
+
+func (pc *PersonalAccessTokenController) handleValidationError(ctx *gin.Context, err error) {
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+
+		out := make([]ErrorValidationMsg, len(ve))
+		for i, fe := range ve {
+			out[i] = ErrorValidationMsg{fe.Field(), pc.getErrorMsg(fe)}
+		}
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": out})
+		return
+	}
+	ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+	return
+}
+
+// CreateToken issues a personal access token to the caller. A leaked token
+// must not be able to mint more, so this takes a login.
+func (pc *PersonalAccessTokenController) CreateToken(ctx *gin.Context) {
+	identity, _ := middleware.GetIdentity(ctx)
+	if identity.PersonalAccessTokenId != "" {
+		ctx.JSON(http.StatusForbidden, gin.H{"errors": "personal access tokens cannot create personal access tokens"})
+		return
+	}
+
+	var request CreatePersonalAccessTokenRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		pc.handleValidationError(ctx, err)
+		return
+	}
+
+	lifetime := time.Duration(request.ExpiresInDays) * 24 * time.Hour
+	token, created, err := pc.PersonalAccessTokenService.Create(identity.AccountId, request.Name, request.Scopes, lifetime)
+	if errors.Is(err, services.ErrScopeNotGranted) || errors.Is(err, services.ErrTokenLifetime) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrTokenNameTaken) {
+		ctx.JSON(http.StatusConflict, gin.H{"errors": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, CreatedPersonalAccessToken{Token: token, PersonalAccessToken: created})
+}
+
+// GetTokens lists the personal access tokens of the caller.
+func (pc *PersonalAccessTokenController) GetTokens(ctx *gin.Context) {
+	result, err := pc.PersonalAccessTokenService.List(callerAccountId(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, result)
+}
+
+// DeleteToken revokes a personal access token of the caller.
+func (pc *PersonalAccessTokenController) DeleteToken(ctx *gin.Context) {
+	err := pc.PersonalAccessTokenService.Revoke(callerAccountId(ctx), ctx.Param("tokenId"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{"errors": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, nil)
+}
+
+func (pc *PersonalAccessTokenController) RegisterPersonalAccessTokenRoutes(rg *gin.RouterGroup) {
+	tokenRouteRead := rg.Group("/account/tokens", pc.Authorizer.RequireScopes(models.ScopeAccountRead))
+	tokenRouteRead.GET("/fetch", pc.GetTokens)
+	tokenRouteWrite := rg.Group("/account/tokens", pc.Authorizer.RequireScopes(models.ScopeAccountWrite))
+	tokenRouteWrite.POST("/create", pc.CreateToken)
+	tokenRouteWrite.DELETE("/delete/:tokenId", pc.DeleteToken)
+}
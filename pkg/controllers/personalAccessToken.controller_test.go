@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersonalAccessTokens(t *testing.T) {
+	send := func(r *gin.Engine, method string, path string, body interface{}, bearer string) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	resetAccounts()
+	resetRuns()
+	account, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+	login, _, _ := sessionService.StartSession(account, "laptop")
+	r := SetupRouter()
+	fetch := services.RunFetchRequest{AccountId: account.AccountId}
+	runService.CreateRun(&models.Run{AccountId: account.AccountId, Distance: 5})
+
+	created := &CreatedPersonalAccessToken{}
+	w := send(r, "POST", "/account/tokens/create", CreatePersonalAccessTokenRequest{Name: "backup script", Scopes: []string{models.ScopeRunsRead}}, login)
+	json.Unmarshal(w.Body.Bytes(), created)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, created.Token)
+	assert.Equal(t, "backup script", created.Name)
+
+	t.Run("Should authorize requests within the scopes of the token", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send(r, "GET", "/run/fetch", fetch, created.Token).Code)
+		assert.Equal(t, http.StatusForbidden, send(r, "POST", "/run/create", models.Run{AccountId: account.AccountId}, created.Token).Code)
+		assert.Equal(t, http.StatusUnauthorized, send(r, "GET", "/run/fetch", fetch, models.PersonalAccessTokenPrefix+"unknown").Code)
+	})
+
+	t.Run("Should refuse scopes the account is not granted", func(t *testing.T) {
+		w := send(r, "POST", "/account/tokens/create", CreatePersonalAccessTokenRequest{Name: "admin", Scopes: []string{models.ScopeAccountsAdmin}}, login)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Should refuse taken names", func(t *testing.T) {
+		w := send(r, "POST", "/account/tokens/create", CreatePersonalAccessTokenRequest{Name: "backup script", Scopes: []string{models.ScopeRunsRead}}, login)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Should not let tokens create tokens", func(t *testing.T) {
+		writer := &CreatedPersonalAccessToken{}
+		w := send(r, "POST", "/account/tokens/create", CreatePersonalAccessTokenRequest{Name: "writer", Scopes: []string{models.ScopeAccountWrite}}, login)
+		json.Unmarshal(w.Body.Bytes(), writer)
+
+		w = send(r, "POST", "/account/tokens/create", CreatePersonalAccessTokenRequest{Name: "minted", Scopes: []string{models.ScopeRunsRead}}, writer.Token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Should list tokens without them", func(t *testing.T) {
+		w := send(r, "GET", "/account/tokens/fetch", nil, login)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), created.Token)
+
+		listed := []*models.PersonalAccessToken{}
+		json.Unmarshal(w.Body.Bytes(), &listed)
+		assert.Len(t, listed, 2)
+	})
+
+	t.Run("Should stop accepting revoked tokens", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send(r, "DELETE", "/account/tokens/delete/"+created.TokenId, nil, login).Code)
+		assert.Equal(t, http.StatusNotFound, send(r, "DELETE", "/account/tokens/delete/"+created.TokenId, nil, login).Code)
+		assert.Equal(t, http.StatusUnauthorized, send(r, "GET", "/run/fetch", fetch, created.Token).Code)
+	})
+}
@@ -1,25 +1,62 @@
 package controllers
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 
+	"github.com/croisade/chimichanga/pkg/formats/csv"
+	"github.com/croisade/chimichanga/pkg/formats/fit"
+	"github.com/croisade/chimichanga/pkg/formats/gpx"
+	"github.com/croisade/chimichanga/pkg/formats/tcx"
 	"github.com/croisade/chimichanga/pkg/middleware"
 	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
 	"github.com/croisade/chimichanga/pkg/services"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 )
 
 type RunController struct {
-	RunService services.RunService
-	JWTService services.JWTAuthService
+	RunService     services.RunService
+	AccountService services.AccountService
+	JWTService     services.JWTAuthService
+	Authorizer     middleware.Authorizer
+	// MaxUploadBytes caps the size of imported files, whole requests larger
+	// than it are refused.
+	MaxUploadBytes int64
 }
 
-func NewRunController(runService services.RunService, jwtService services.JWTAuthService) RunController {
+// RunImportRequest is the multipart form a recorded activity file is uploaded with.
+type RunImportRequest struct {
+	AccountId string                `form:"accountId" binding:"required"`
+	File      *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+// CSVImportRequest uploads run history. Mapping is a JSON object from column
+// header to run field, the suggested mapping is used when it is empty. A dry run
+// validates every row without storing anything.
+type CSVImportRequest struct {
+	RunImportRequest
+	Mapping string `form:"mapping"`
+	DryRun  bool   `form:"dryRun"`
+}
+
+type CSVColumnsRequest struct {
+	File *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+func NewRunController(runService services.RunService, accountService services.AccountService, jwtService services.JWTAuthService, authorizer middleware.Authorizer, maxUploadBytes int64) RunController {
 	return RunController{
-		RunService: runService,
-		JWTService: jwtService,
+		RunService:     runService,
+		AccountService: accountService,
+		JWTService:     jwtService,
+		Authorizer:     authorizer,
+		MaxUploadBytes: maxUploadBytes,
 	}
 }
 
@@ -31,6 +68,8 @@ func (rc *RunController) getErrorMsg(fe validator.FieldError) string {
 		return "Should be less than " + fe.Param()
 	case "gte":
 		return "Should be greater than " + fe.Param()
+	case "oneof":
+		return "Should be one of " + fe.Param()
 	}
 	return "Unknown error"
 }
@@ -50,20 +89,88 @@ func (rc *RunController) handleValidationError(ctx *gin.Context, err error) {
 	return
 }
 
+// handleServiceError answers with the status matching a RunService error.
+func (rc *RunController) handleServiceError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInconsistentRun),
+		errors.Is(err, services.ErrInconsistentSplit),
+		errors.Is(err, services.ErrIncompleteSplit),
+		errors.Is(err, services.ErrTotalsFromSplits):
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+	case errors.Is(err, services.ErrSplitNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"errors": err.Error()})
+	default:
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+	}
+}
+
+// bindUpload binds a multipart upload, reading no more than MaxUploadBytes
+// of the request. It writes the error response itself and returns false when
+// the request must stop.
+func (rc *RunController) bindUpload(ctx *gin.Context, request interface{}) bool {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, rc.MaxUploadBytes)
+	err := ctx.ShouldBind(request)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"errors": fmt.Sprintf("uploads are limited to %d bytes", rc.MaxUploadBytes)})
+		return false
+	}
+	if err != nil {
+		rc.handleValidationError(ctx, err)
+		return false
+	}
+	return true
+}
+
+// unitsFor resolves the unit system a request is answered in: the "units"
+// query parameter when present, the account's preference otherwise. It writes
+// the error response itself and returns false when the request must stop.
+func (rc *RunController) unitsFor(ctx *gin.Context, accountId string) (models.UnitSystem, bool) {
+	if override := models.UnitSystem(ctx.Query("units")); override != "" {
+		if !override.Valid() {
+			ctx.JSON(http.StatusBadRequest, gin.H{"errors": "units should be one of metric imperial"})
+			return "", false
+		}
+		return override, true
+	}
+
+	account, err := rc.AccountService.GetAccount(accountId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return models.Metric, true
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return "", false
+	}
+	return account.Units.OrDefault(), true
+}
+
 func (rc *RunController) CreateRun(ctx *gin.Context) {
 	var run models.Run
 	if err := ctx.ShouldBindJSON(&run); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
 		return
 	}
+	if run.AccountId == "" {
+		run.AccountId = callerAccountId(ctx)
+	}
+	if !authorizeAccount(ctx, run.AccountId) {
+		return
+	}
+
+	units, ok := rc.unitsFor(ctx, run.AccountId)
+	if !ok {
+		return
+	}
+	run.ToCanonical(units)
 
 	result, err := rc.RunService.CreateRun(&run)
 	if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		rc.handleServiceError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, result)
+	ctx.JSON(http.StatusOK, result.InUnits(units))
 	return
 }
 
@@ -74,12 +181,20 @@ func (rc *RunController) GetRun(ctx *gin.Context) {
 		rc.handleValidationError(ctx, err)
 		return
 	}
+	if !authorizeAccount(ctx, run.AccountId) {
+		return
+	}
+	units, ok := rc.unitsFor(ctx, run.AccountId)
+	if !ok {
+		return
+	}
+
 	returnedRun, err := rc.RunService.GetRun(run)
 	if err != nil {
 		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
 		return
 	}
-	ctx.JSON(http.StatusOK, returnedRun)
+	ctx.JSON(http.StatusOK, returnedRun.InUnits(units))
 	return
 }
 
@@ -90,12 +205,23 @@ func (rc *RunController) GetAll(ctx *gin.Context) {
 		rc.handleValidationError(ctx, err)
 		return
 	}
+	if !authorizeAccount(ctx, runAccountId.AccountId) {
+		return
+	}
+
+	units, ok := rc.unitsFor(ctx, runAccountId.AccountId)
+	if !ok {
+		return
+	}
 
 	runs, err := rc.RunService.GetAll(runAccountId)
 	if err != nil {
 		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
 		return
 	}
+	for i := range runs {
+		runs[i] = runs[i].InUnits(units)
+	}
 	ctx.JSON(http.StatusOK, runs)
 	return
 }
@@ -106,13 +232,23 @@ func (rc *RunController) UpdateRun(ctx *gin.Context) {
 		rc.handleValidationError(ctx, err)
 		return
 	}
+	if !authorizeAccount(ctx, run.AccountId) {
+		return
+	}
+
+	units, ok := rc.unitsFor(ctx, run.AccountId)
+	if !ok {
+		return
+	}
+	run.Distance = units.ToMetres(run.Distance)
+	run.Pace = units.ToMetresPerSecond(run.Pace)
 
 	updatedRun, err := rc.RunService.UpdateRun(&run)
 	if err != nil {
-		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		rc.handleServiceError(ctx, err)
 		return
 	}
-	ctx.JSON(http.StatusOK, updatedRun)
+	ctx.JSON(http.StatusOK, updatedRun.InUnits(units))
 	return
 }
 
@@ -123,6 +259,9 @@ func (rc *RunController) DeleteRun(ctx *gin.Context) {
 		rc.handleValidationError(ctx, err)
 		return
 	}
+	if !authorizeAccount(ctx, run.AccountId) {
+		return
+	}
 
 	err := rc.RunService.DeleteRun(run)
 	if err != nil {
@@ -133,11 +272,305 @@ func (rc *RunController) DeleteRun(ctx *gin.Context) {
 	return
 }
 
+func (rc *RunController) AddSplit(ctx *gin.Context) {
+	var split services.SplitRequest
+	if err := ctx.ShouldBindJSON(&split); err != nil {
+		rc.handleValidationError(ctx, err)
+		return
+	}
+	if !authorizeAccount(ctx, split.AccountId) {
+		return
+	}
+
+	units, ok := rc.unitsFor(ctx, split.AccountId)
+	if !ok {
+		return
+	}
+	split.Split.ToCanonical(units)
+
+	run, err := rc.RunService.AddSplit(&split)
+	if err != nil {
+		rc.handleServiceError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, run.InUnits(units))
+}
+
+func (rc *RunController) UpdateSplit(ctx *gin.Context) {
+	var split services.SplitUpdateRequest
+	if err := ctx.ShouldBindJSON(&split); err != nil {
+		rc.handleValidationError(ctx, err)
+		return
+	}
+	if !authorizeAccount(ctx, split.AccountId) {
+		return
+	}
+
+	units, ok := rc.unitsFor(ctx, split.AccountId)
+	if !ok {
+		return
+	}
+	split.Split.ToCanonical(units)
+
+	run, err := rc.RunService.UpdateSplit(&split)
+	if err != nil {
+		rc.handleServiceError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, run.InUnits(units))
+}
+
+func (rc *RunController) DeleteSplit(ctx *gin.Context) {
+	var split services.SplitDeleteRequest
+	if err := ctx.ShouldBindJSON(&split); err != nil {
+		rc.handleValidationError(ctx, err)
+		return
+	}
+	if !authorizeAccount(ctx, split.AccountId) {
+		return
+	}
+
+	units, ok := rc.unitsFor(ctx, split.AccountId)
+	if !ok {
+		return
+	}
+
+	run, err := rc.RunService.DeleteSplit(&split)
+	if err != nil {
+		rc.handleServiceError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, run.InUnits(units))
+}
+
+func (rc *RunController) ImportGPX(ctx *gin.Context) {
+	rc.importRun(ctx, gpx.Decode)
+}
+
+func (rc *RunController) ExportGPX(ctx *gin.Context) {
+	rc.exportRun(ctx, gpx.ContentType, ".gpx", gpx.Encode)
+}
+
+func (rc *RunController) ImportTCX(ctx *gin.Context) {
+	rc.importRun(ctx, tcx.Decode)
+}
+
+func (rc *RunController) ExportTCX(ctx *gin.Context) {
+	rc.exportRun(ctx, tcx.ContentType, ".tcx", tcx.Encode)
+}
+
+func (rc *RunController) ImportFIT(ctx *gin.Context) {
+	rc.importRun(ctx, fit.Decode)
+}
+
+// CSVColumns lists the columns of an uploaded CSV file with the mapping an
+// import would use by default, so the caller can adjust it.
+func (rc *RunController) CSVColumns(ctx *gin.Context) {
+	var request CSVColumnsRequest
+	if !rc.bindUpload(ctx, &request) {
+		return
+	}
+
+	file, err := request.File.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	columns, err := csv.Columns(file)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"columns": columns, "mapping": csv.SuggestMapping(columns), "fields": csv.Fields})
+}
+
+// ImportCSV creates a run for every row of an uploaded CSV file. Rows are all
+// checked first; when any of them is rejected nothing is stored and every row
+// error is returned.
+func (rc *RunController) ImportCSV(ctx *gin.Context) {
+	var request CSVImportRequest
+	if !rc.bindUpload(ctx, &request) {
+		return
+	}
+	if !authorizeAccount(ctx, request.AccountId) {
+		return
+	}
+
+	var mapping csv.Mapping
+	if request.Mapping != "" {
+		if err := json.Unmarshal([]byte(request.Mapping), &mapping); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"errors": "mapping should be a JSON object of column to field"})
+			return
+		}
+	}
+
+	units, ok := rc.unitsFor(ctx, request.AccountId)
+	if !ok {
+		return
+	}
+
+	file, err := request.File.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	rows, err := csv.Decode(file, mapping)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+
+	var rowErrors []csv.RowError
+	runs := make([]*models.Run, 0, len(rows))
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			rowErrors = append(rowErrors, row.Errors...)
+			continue
+		}
+		row.Run.AccountId = request.AccountId
+		row.Run.ToCanonical(units)
+		if err := rc.RunService.ValidateRun(row.Run); err != nil {
+			rowErrors = append(rowErrors, csv.RowError{Row: row.Line, Message: err.Error()})
+			continue
+		}
+		runs = append(runs, row.Run)
+	}
+	if len(rowErrors) > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": rowErrors})
+		return
+	}
+
+	for i, run := range runs {
+		if !request.DryRun {
+			created, err := rc.RunService.CreateRun(run)
+			if err != nil {
+				rc.handleServiceError(ctx, err)
+				return
+			}
+			run = created
+		}
+		runs[i] = run.InUnits(units)
+	}
+	ctx.JSON(http.StatusOK, gin.H{"dryRun": request.DryRun, "runs": runs})
+}
+
+func (rc *RunController) ExportCSV(ctx *gin.Context) {
+	var request services.RunFetchRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		rc.handleValidationError(ctx, err)
+		return
+	}
+	if !authorizeAccount(ctx, request.AccountId) {
+		return
+	}
+
+	units, ok := rc.unitsFor(ctx, request.AccountId)
+	if !ok {
+		return
+	}
+
+	runs, err := rc.RunService.GetAll(&request)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+	for i := range runs {
+		runs[i] = runs[i].InUnits(units)
+	}
+
+	var buf bytes.Buffer
+	if err := csv.Encode(&buf, runs); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.Header("Content-Disposition", `attachment; filename="runs-`+request.AccountId+`.csv"`)
+	ctx.Data(http.StatusOK, csv.ContentType, buf.Bytes())
+}
+
+// importRun creates a run from the uploaded file read by decode.
+func (rc *RunController) importRun(ctx *gin.Context, decode func(io.Reader) (*models.Run, error)) {
+	var request RunImportRequest
+	if !rc.bindUpload(ctx, &request) {
+		return
+	}
+	if !authorizeAccount(ctx, request.AccountId) {
+		return
+	}
+
+	units, ok := rc.unitsFor(ctx, request.AccountId)
+	if !ok {
+		return
+	}
+
+	file, err := request.File.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	run, err := decode(file)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		return
+	}
+	run.AccountId = request.AccountId
+
+	result, err := rc.RunService.CreateRun(run)
+	if err != nil {
+		rc.handleServiceError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, result.InUnits(units))
+}
+
+// exportRun answers with the requested run written by encode as an attachment.
+func (rc *RunController) exportRun(ctx *gin.Context, contentType string, extension string, encode func(io.Writer, *models.Run) error) {
+	var request services.RunRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		rc.handleValidationError(ctx, err)
+		return
+	}
+	if !authorizeAccount(ctx, request.AccountId) {
+		return
+	}
+
+	run, err := rc.RunService.GetRun(&request)
+	if err != nil {
+		ctx.JSON(http.StatusBadGateway, gin.H{"errors": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, run); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return
+	}
+	ctx.Header("Content-Disposition", `attachment; filename="run-`+run.RunId+extension+`"`)
+	ctx.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
 func (rc *RunController) RegisterRunRoutes(rg *gin.RouterGroup) {
-	runRoute := rg.Group("/run", middleware.AuthorizeUserJWT())
-	runRoute.POST("/create", rc.CreateRun)
-	runRoute.GET("", rc.GetRun)
-	runRoute.GET("/fetch", rc.GetAll)
-	runRoute.DELETE("/delete", rc.DeleteRun)
-	runRoute.PUT("/update", rc.UpdateRun)
+	runRouteRead := rg.Group("/run", rc.Authorizer.RequireScopes(models.ScopeRunsRead))
+	runRouteRead.GET("", rc.GetRun)
+	runRouteRead.GET("/fetch", rc.GetAll)
+	runRouteRead.GET("/export/gpx", rc.ExportGPX)
+	runRouteRead.GET("/export/tcx", rc.ExportTCX)
+	runRouteRead.GET("/export/csv", rc.ExportCSV)
+	runRouteWrite := rg.Group("/run", rc.Authorizer.RequireScopes(models.ScopeRunsWrite))
+	runRouteWrite.POST("/create", rc.CreateRun)
+	runRouteWrite.DELETE("/delete", rc.DeleteRun)
+	runRouteWrite.PUT("/update", rc.UpdateRun)
+	runRouteWrite.POST("/split/create", rc.AddSplit)
+	runRouteWrite.PUT("/split/update", rc.UpdateSplit)
+	runRouteWrite.DELETE("/split/delete", rc.DeleteSplit)
+	runRouteWrite.POST("/import/gpx", rc.ImportGPX)
+	runRouteWrite.POST("/import/tcx", rc.ImportTCX)
+	runRouteWrite.POST("/import/fit", rc.ImportFIT)
+	runRouteWrite.POST("/import/csv/columns", rc.CSVColumns)
+	runRouteWrite.POST("/import/csv", rc.ImportCSV)
 }
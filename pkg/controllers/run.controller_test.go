@@ -4,22 +4,27 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/croisade/chimichanga/pkg/formats/csv"
 	"github.com/croisade/chimichanga/pkg/models"
 	"github.com/croisade/chimichanga/pkg/services"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestCreateRun(t *testing.T) {
-	run := &models.Run{Pace: 6.0, Lap: 0, Distance: 3.0, Time: "30:00", Incline: 0.0, AccountId: "123"}
+	run := &models.Run{Pace: 6.0, Distance: 3.0, Time: models.Duration(30 * time.Minute), Incline: 0.0, AccountId: "123"}
 	response := &models.Run{}
 
 	jsonValue, _ := json.Marshal(run)
 	req, _ := http.NewRequest("POST", "/run/create", bytes.NewBuffer(jsonValue))
+	authorize(req, run.AccountId, models.RoleUser)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -29,14 +34,29 @@ func TestCreateRun(t *testing.T) {
 	assert.Equal(t, run.Pace, response.Pace)
 }
 
+func TestCreateRunRejectsInconsistentPace(t *testing.T) {
+	response := &ErrorResponse{}
+
+	jsonValue := []byte(`{"pace": 9.0, "distance": 3.0, "time": "30:00", "accountId": "123"}`)
+	req, _ := http.NewRequest("POST", "/run/create", bytes.NewBuffer(jsonValue))
+	authorize(req, "123", models.RoleUser)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	json.Unmarshal(w.Body.Bytes(), response)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "pace does not match distance and time", response.Errors)
+}
+
 func TestGetRun(t *testing.T) {
 	var response *models.Run
-	run := &models.Run{Pace: 6.0, Lap: 0, Distance: 3.0, Time: "30:00", Incline: 0.0, AccountId: "234"}
+	run := &models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), Incline: 0.0, AccountId: "234"}
 	createdRun, _ := runService.CreateRun(run)
 	request := &services.RunRequest{AccountId: createdRun.AccountId, RunId: createdRun.RunId}
 
 	jsonValue, _ := json.Marshal(request)
 	req, _ := http.NewRequest("GET", "/run", bytes.NewBuffer(jsonValue))
+	authorize(req, run.AccountId, models.RoleUser)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -47,27 +67,29 @@ func TestGetRun(t *testing.T) {
 }
 
 func TestUpdateRun(t *testing.T) {
-	run := &models.Run{Pace: 6.0, Lap: 0, Distance: 3.0, Time: "30:00", Incline: 0.0, AccountId: "567"}
+	run := &models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), Incline: 0.0, AccountId: "567"}
 	createdRun, _ := runService.CreateRun(run)
-	request := &services.RunUpdateRequest{AccountId: createdRun.AccountId, RunId: createdRun.RunId, Lap: 1}
+	request := &services.RunUpdateRequest{AccountId: createdRun.AccountId, RunId: createdRun.RunId, Incline: 1.5}
 	var response *models.Run
 
 	jsonValue, _ := json.Marshal(request)
 	req, _ := http.NewRequest("PUT", "/run/update", bytes.NewBuffer(jsonValue))
+	authorize(req, run.AccountId, models.RoleUser)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
 	json.Unmarshal(w.Body.Bytes(), &response)
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Equal(t, 1, response.Lap)
+	assert.Equal(t, float32(1.5), response.Incline)
 }
 func TestDeleteRun(t *testing.T) {
-	run := &models.Run{Pace: 6.0, Lap: 0, Distance: 3.0, Time: "30:00", Incline: 0.0, AccountId: "890"}
+	run := &models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), Incline: 0.0, AccountId: "890"}
 	createdRun, _ := runService.CreateRun(run)
 	request := &services.RunRequest{AccountId: createdRun.AccountId, RunId: createdRun.RunId}
 
 	jsonValue, _ := json.Marshal(request)
 	req, _ := http.NewRequest("DELETE", "/run/delete", bytes.NewBuffer(jsonValue))
+	authorize(req, run.AccountId, models.RoleUser)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -78,8 +100,8 @@ func TestDeleteRun(t *testing.T) {
 }
 
 func TestFetchRun(t *testing.T) {
-	runsCollection.DeleteMany(ctx, bson.D{{}})
-	run := &models.Run{Pace: 6.0, Lap: 0, Distance: 3.0, Time: "30:00", Incline: 0.0, AccountId: "123"}
+	resetRuns()
+	run := &models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), Incline: 0.0, AccountId: "123"}
 	createdRun, _ := runService.CreateRun(run)
 
 	request := &services.RunFetchRequest{AccountId: createdRun.AccountId}
@@ -87,6 +109,7 @@ func TestFetchRun(t *testing.T) {
 
 	jsonValue, _ := json.Marshal(request)
 	req, _ := http.NewRequest("GET", "/run/fetch", bytes.NewBuffer(jsonValue))
+	authorize(req, run.AccountId, models.RoleUser)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 
@@ -95,3 +118,422 @@ func TestFetchRun(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, response[0].AccountId, run.AccountId)
 }
+
+func TestRunUnits(t *testing.T) {
+	resetAccounts()
+	resetRuns()
+	account, _ := accountService.CreateAccount(&models.Account{Email: "miles@example.com", Password: "password", FirstName: "first", LastName: "last", Units: models.Imperial})
+
+	t.Run("Should use the account's unit system", func(t *testing.T) {
+		run := &models.Run{Distance: 3.0, Time: models.Duration(30 * time.Minute), AccountId: account.AccountId}
+		response := &models.Run{}
+
+		jsonValue, _ := json.Marshal(run)
+		req, _ := http.NewRequest("POST", "/run/create", bytes.NewBuffer(jsonValue))
+		authorize(req, account.AccountId, models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		json.Unmarshal(w.Body.Bytes(), response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, models.Imperial, response.Units)
+		assert.Equal(t, float32(3.0), response.Distance)
+		assert.Equal(t, float32(6.0), response.Pace)
+
+		stored, _ := runService.GetRun(&services.RunRequest{AccountId: account.AccountId, RunId: response.RunId})
+		assert.Equal(t, float32(4828.032), stored.Distance)
+	})
+
+	t.Run("Should honour the units query parameter", func(t *testing.T) {
+		var response []*models.Run
+
+		jsonValue, _ := json.Marshal(&services.RunFetchRequest{AccountId: account.AccountId})
+		req, _ := http.NewRequest("GET", "/run/fetch?units=metric", bytes.NewBuffer(jsonValue))
+		authorize(req, account.AccountId, models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, models.Metric, response[0].Units)
+		assert.Equal(t, float32(4.828), response[0].Distance)
+	})
+
+	t.Run("Should reject unknown units", func(t *testing.T) {
+		jsonValue, _ := json.Marshal(&services.RunFetchRequest{AccountId: account.AccountId})
+		req, _ := http.NewRequest("GET", "/run/fetch?units=furlongs", bytes.NewBuffer(jsonValue))
+		authorize(req, account.AccountId, models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRunSplits(t *testing.T) {
+	resetAccounts()
+	resetRuns()
+	createdRun, _ := runService.CreateRun(&models.Run{AccountId: "123", Splits: []models.Split{{Distance: 1000.0, Time: models.Duration(6 * time.Minute)}}})
+
+	t.Run("Should add a split in the caller's units", func(t *testing.T) {
+		var response *models.Run
+		request := &services.SplitRequest{AccountId: "123", RunId: createdRun.RunId, Split: models.Split{Distance: 1.0, Pace: 12.0, Incline: 2.0}}
+
+		jsonValue, _ := json.Marshal(request)
+		req, _ := http.NewRequest("POST", "/run/split/create", bytes.NewBuffer(jsonValue))
+		authorize(req, "123", models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 2, len(response.Splits))
+		assert.Equal(t, models.Duration(5*time.Minute), response.Splits[1].Time)
+		assert.Equal(t, float32(2.0), response.Distance)
+		assert.Equal(t, "11:00", response.Time.String())
+	})
+
+	t.Run("Should update a split", func(t *testing.T) {
+		var response *models.Run
+		request := &services.SplitUpdateRequest{AccountId: "123", RunId: createdRun.RunId, Lap: 2, Split: models.Split{Distance: 1.0, Time: models.Duration(4 * time.Minute)}}
+
+		jsonValue, _ := json.Marshal(request)
+		req, _ := http.NewRequest("PUT", "/run/split/update", bytes.NewBuffer(jsonValue))
+		authorize(req, "123", models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, float32(15.0), response.Splits[1].Pace)
+	})
+
+	t.Run("Should raise if the split does not exist", func(t *testing.T) {
+		request := &services.SplitDeleteRequest{AccountId: "123", RunId: createdRun.RunId, Lap: 5}
+
+		jsonValue, _ := json.Marshal(request)
+		req, _ := http.NewRequest("DELETE", "/run/split/delete", bytes.NewBuffer(jsonValue))
+		authorize(req, "123", models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Should delete a split", func(t *testing.T) {
+		var response *models.Run
+		request := &services.SplitDeleteRequest{AccountId: "123", RunId: createdRun.RunId, Lap: 1}
+
+		jsonValue, _ := json.Marshal(request)
+		req, _ := http.NewRequest("DELETE", "/run/split/delete", bytes.NewBuffer(jsonValue))
+		authorize(req, "123", models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 1, len(response.Splits))
+		assert.Equal(t, float32(1.0), response.Distance)
+	})
+}
+
+// testImportMaxBytes is the upload limit of the run controller under test.
+const testImportMaxBytes = 64 << 10
+
+// newUploadRequest builds the multipart form a run file is imported with.
+func newUploadRequest(url string, fields map[string]string, filename string, content []byte) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	part, _ := writer.CreateFormFile("file", filename)
+	part.Write(content)
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", url, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	authorize(req, fields["accountId"], models.RoleUser)
+	return req
+}
+
+func TestRunGPX(t *testing.T) {
+	const document = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk><trkseg>
+    <trkpt lat="51.500" lon="-0.12"><ele>10</ele><time>2022-05-01T07:00:00Z</time></trkpt>
+    <trkpt lat="51.509" lon="-0.12"><ele>25</ele><time>2022-05-01T07:05:00Z</time></trkpt>
+  </trkseg></trk>
+</gpx>`
+
+	var imported models.Run
+	t.Run("import", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newUploadRequest("/run/import/gpx", map[string]string{"accountId": "gpx"}, "run.gpx", []byte(document)))
+
+		json.Unmarshal(w.Body.Bytes(), &imported)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "gpx", imported.AccountId)
+		assert.Equal(t, float32(1.001), imported.Distance)
+		assert.Equal(t, models.Duration(5*time.Minute), imported.Time)
+		assert.Equal(t, float32(12.009), imported.Pace)
+		assert.Equal(t, float32(15.0), imported.ElevationGain)
+		assert.Equal(t, 2, len(imported.Track))
+	})
+
+	t.Run("import rejects an invalid file", func(t *testing.T) {
+		response := &ErrorResponse{}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newUploadRequest("/run/import/gpx", map[string]string{"accountId": "gpx"}, "run.gpx", []byte(`<gpx version="1.1"></gpx>`)))
+
+		json.Unmarshal(w.Body.Bytes(), response)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "gpx file has no track points", response.Errors)
+	})
+
+	t.Run("export", func(t *testing.T) {
+		jsonValue, _ := json.Marshal(&services.RunRequest{AccountId: "gpx", RunId: imported.RunId})
+		req, _ := http.NewRequest("GET", "/run/export/gpx", bytes.NewBuffer(jsonValue))
+		authorize(req, "gpx", models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/gpx+xml", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="run-`+imported.RunId+`.gpx"`, w.Header().Get("Content-Disposition"))
+		assert.Equal(t, 2, strings.Count(w.Body.String(), "<trkpt "))
+		assert.Contains(t, w.Body.String(), "<time>2022-05-01T07:05:00Z</time>")
+	})
+}
+
+func TestRunTCX(t *testing.T) {
+	const document = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">
+  <Activities><Activity Sport="Running"><Id>2022-05-01T07:00:00Z</Id>
+    <Lap StartTime="2022-05-01T07:00:00Z">
+      <TotalTimeSeconds>300</TotalTimeSeconds><DistanceMeters>1000</DistanceMeters>
+      <AverageHeartRateBpm><Value>140</Value></AverageHeartRateBpm>
+      <Track><Trackpoint><Time>2022-05-01T07:00:00Z</Time><HeartRateBpm><Value>120</Value></HeartRateBpm></Trackpoint></Track>
+    </Lap>
+    <Lap StartTime="2022-05-01T07:05:00Z">
+      <TotalTimeSeconds>300</TotalTimeSeconds><DistanceMeters>1000</DistanceMeters>
+    </Lap>
+  </Activity></Activities>
+</TrainingCenterDatabase>`
+
+	var imported models.Run
+	t.Run("import", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newUploadRequest("/run/import/tcx", map[string]string{"accountId": "tcx"}, "run.tcx", []byte(document)))
+
+		json.Unmarshal(w.Body.Bytes(), &imported)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, float32(2.0), imported.Distance)
+		assert.Equal(t, models.Duration(10*time.Minute), imported.Time)
+		assert.Equal(t, float32(12.0), imported.Pace)
+		assert.Equal(t, 2, len(imported.Splits))
+		assert.Equal(t, 140, imported.Splits[0].HeartRate)
+		assert.Equal(t, 1, len(imported.Track))
+	})
+
+	t.Run("export", func(t *testing.T) {
+		jsonValue, _ := json.Marshal(&services.RunRequest{AccountId: "tcx", RunId: imported.RunId})
+		req, _ := http.NewRequest("GET", "/run/export/tcx", bytes.NewBuffer(jsonValue))
+		authorize(req, "tcx", models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/vnd.garmin.tcx+xml", w.Header().Get("Content-Type"))
+		assert.Equal(t, 2, strings.Count(w.Body.String(), "<Lap "))
+		assert.Contains(t, w.Body.String(), "<DistanceMeters>1000</DistanceMeters>")
+	})
+}
+
+func TestImportFIT(t *testing.T) {
+	content, err := os.ReadFile("../formats/fit/testdata/run.fit")
+	assert.Nil(t, err)
+
+	t.Run("import", func(t *testing.T) {
+		var imported models.Run
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newUploadRequest("/run/import/fit", map[string]string{"accountId": "fit"}, "run.fit", content))
+
+		json.Unmarshal(w.Body.Bytes(), &imported)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, float32(2.0), imported.Distance)
+		assert.Equal(t, models.Duration(580*time.Second), imported.Time)
+		assert.Equal(t, 2, len(imported.Splits))
+		assert.Equal(t, 5, len(imported.Track))
+	})
+
+	t.Run("import rejects a corrupt file", func(t *testing.T) {
+		response := &ErrorResponse{}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newUploadRequest("/run/import/fit", map[string]string{"accountId": "fit"}, "run.fit", content[:len(content)-1]))
+
+		json.Unmarshal(w.Body.Bytes(), response)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "fit file is truncated", response.Errors)
+	})
+}
+
+func TestRunCSV(t *testing.T) {
+	const history = `Day,Km,Duration
+2021-03-01,5,25:00
+2021-03-08,10,50:00
+`
+
+	t.Run("columns", func(t *testing.T) {
+		var response struct {
+			Columns []string          `json:"columns"`
+			Mapping map[string]string `json:"mapping"`
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newUploadRequest("/run/import/csv/columns", map[string]string{"accountId": "csv"}, "runs.csv", []byte(history)))
+
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"Day", "Km", "Duration"}, response.Columns)
+		assert.Empty(t, response.Mapping)
+	})
+
+	fields := map[string]string{
+		"accountId": "csv",
+		"mapping":   `{"Day": "date", "Km": "distance", "Duration": "time"}`,
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		var response struct {
+			DryRun bool         `json:"dryRun"`
+			Runs   []models.Run `json:"runs"`
+		}
+		fields["dryRun"] = "true"
+		defer delete(fields, "dryRun")
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newUploadRequest("/run/import/csv", fields, "runs.csv", []byte(history)))
+
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, response.DryRun)
+		assert.Equal(t, 2, len(response.Runs))
+		assert.Equal(t, float32(12.0), response.Runs[1].Pace)
+
+		_, err := runService.GetAll(&services.RunFetchRequest{AccountId: "csv"})
+		assert.NotNil(t, err, "a dry run stores nothing")
+	})
+
+	t.Run("row errors", func(t *testing.T) {
+		var response struct {
+			Errors []csv.RowError `json:"errors"`
+		}
+		file := history + "2021-03-15,5,25:00,extra\n2021-03-22,5,soon\n"
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newUploadRequest("/run/import/csv", fields, "runs.csv", []byte(file)))
+
+		json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, []csv.RowError{
+			{Row: 4, Message: "wrong number of fields"},
+		}, response.Errors[:1])
+		assert.Equal(t, 5, response.Errors[1].Row)
+		assert.Equal(t, "Duration", response.Errors[1].Column)
+	})
+
+	t.Run("import and export", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newUploadRequest("/run/import/csv", fields, "runs.csv", []byte(history)))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		jsonValue, _ := json.Marshal(&services.RunFetchRequest{AccountId: "csv"})
+		req, _ := http.NewRequest("GET", "/run/export/csv", bytes.NewBuffer(jsonValue))
+		authorize(req, "csv", models.RoleUser)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+		lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+		assert.Equal(t, 3, len(lines))
+		assert.Contains(t, lines[1], ",2021-03-01T00:00:00Z,5,25:00,12,")
+	})
+}
+
+func TestRunOwnership(t *testing.T) {
+	createdRun, _ := runService.CreateRun(&models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), AccountId: "owner"})
+	jsonValue, _ := json.Marshal(&services.RunRequest{AccountId: "owner", RunId: createdRun.RunId})
+
+	t.Run("Should refuse requests without a token", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/run", bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Should refuse another user's run", func(t *testing.T) {
+		response := &ErrorResponse{}
+		req, _ := http.NewRequest("DELETE", "/run/delete", bytes.NewBuffer(jsonValue))
+		authorize(req, "intruder", models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		json.Unmarshal(w.Body.Bytes(), response)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "account belongs to another user", response.Errors)
+
+		_, err := runService.GetRun(&services.RunRequest{AccountId: "owner", RunId: createdRun.RunId})
+		assert.Nil(t, err)
+	})
+
+	t.Run("Should refuse tokens missing the scope of the route", func(t *testing.T) {
+		response := &ErrorResponse{}
+		token, _ := jwtService.CreateToken("owner", []string{models.ScopeRunsRead}, "")
+		req, _ := http.NewRequest("DELETE", "/run/delete", bytes.NewBuffer(jsonValue))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		json.Unmarshal(w.Body.Bytes(), response)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "missing scope "+models.ScopeRunsWrite, response.Errors)
+	})
+
+	t.Run("Should let admins read any run", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/run", bytes.NewBuffer(jsonValue))
+		authorize(req, "admin", models.RoleAdmin)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Should create runs for the caller by default", func(t *testing.T) {
+		response := &models.Run{}
+		req, _ := http.NewRequest("POST", "/run/create", bytes.NewBufferString(`{"distance": 3.0, "time": "30:00"}`))
+		authorize(req, "owner", models.RoleUser)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		json.Unmarshal(w.Body.Bytes(), response)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "owner", response.AccountId)
+	})
+}
+
+func TestRunImportSizeLimit(t *testing.T) {
+	resetRuns()
+	r := SetupRouter()
+
+	for _, path := range []string{"/run/import/fit", "/run/import/csv"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, newUploadRequest(path, map[string]string{"accountId": "big"}, "run", make([]byte, testImportMaxBytes)))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, path)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, newUploadRequest("/run/import/fit", map[string]string{"accountId": "big"}, "run.fit", []byte("not a fit file")))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
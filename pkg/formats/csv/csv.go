@@ -0,0 +1,266 @@
+// Package csv converts run history to and from flat CSV files. Values are read
+// and written in the caller's unit system, conversion is left to the caller.
+package csv
+
+import (
+	stdcsv "encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const ContentType = "text/csv"
+
+// The run fields a column can be mapped to.
+const (
+	FieldDate          = "date"
+	FieldDistance      = "distance"
+	FieldTime          = "time"
+	FieldPace          = "pace"
+	FieldIncline       = "incline"
+	FieldElevationGain = "elevationGain"
+)
+
+var Fields = []string{FieldDate, FieldDistance, FieldTime, FieldPace, FieldIncline, FieldElevationGain}
+
+var (
+	ErrEmpty         = errors.New("csv file has no header")
+	ErrNothingMapped = errors.New("no column is mapped to a run field")
+)
+
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// Mapping assigns run fields to the columns of a file, keyed by column header.
+// Columns left out are ignored.
+type Mapping map[string]string
+
+// RowError reports a value that could not be read. Row is the line of the
+// file, the header being line 1.
+type RowError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+	}
+	return fmt.Sprintf("row %d, column %s: %s", e.Row, e.Column, e.Message)
+}
+
+// Row is one run read from a file, Errors is empty when the run is usable.
+type Row struct {
+	Line   int
+	Run    *models.Run
+	Errors []RowError
+}
+
+// Columns returns the header of a CSV file.
+func Columns(r io.Reader) ([]string, error) {
+	return readHeader(newReader(r))
+}
+
+// SuggestMapping maps every column whose header names a run field, ignoring
+// case and surrounding spaces.
+func SuggestMapping(columns []string) Mapping {
+	mapping := make(Mapping)
+	for _, column := range columns {
+		for _, field := range Fields {
+			if strings.EqualFold(strings.TrimSpace(column), field) {
+				mapping[column] = field
+			}
+		}
+	}
+	return mapping
+}
+
+// Decode reads every row of a CSV file through mapping, a nil mapping uses
+// SuggestMapping. The error is only set when the file or the mapping cannot be
+// used at all; problems with single values are reported on their row.
+func Decode(r io.Reader, mapping Mapping) ([]Row, error) {
+	reader := newReader(r)
+	header, err := readHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if mapping == nil {
+		mapping = SuggestMapping(header)
+	}
+	fields, err := resolve(header, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *stdcsv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, Row{Line: parseErr.StartLine, Errors: []RowError{{Row: parseErr.StartLine, Message: parseErr.Err.Error()}}})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, decodeRow(line, header, record, fields))
+	}
+	return rows, nil
+}
+
+// resolve returns the field each column of header is mapped to.
+func resolve(header []string, mapping Mapping) ([]string, error) {
+	fields := make([]string, len(header))
+	mapped := make(map[string]string)
+	for column, field := range mapping {
+		if !isField(field) {
+			return nil, fmt.Errorf("column %q is mapped to unknown field %q", column, field)
+		}
+		if other, ok := mapped[field]; ok {
+			return nil, fmt.Errorf("columns %q and %q are both mapped to %s", other, column, field)
+		}
+		mapped[field] = column
+
+		i := indexOf(header, column)
+		if i < 0 {
+			return nil, fmt.Errorf("mapped column %q is not in the file", column)
+		}
+		fields[i] = field
+	}
+	if len(mapped) == 0 {
+		return nil, ErrNothingMapped
+	}
+	return fields, nil
+}
+
+func decodeRow(line int, header []string, record []string, fields []string) Row {
+	row := Row{Line: line, Run: &models.Run{}}
+	for i, field := range fields {
+		value := strings.TrimSpace(record[i])
+		if field == "" || value == "" {
+			continue
+		}
+		if err := setField(row.Run, field, value); err != nil {
+			row.Errors = append(row.Errors, RowError{Row: line, Column: header[i], Message: err.Error()})
+		}
+	}
+	return row
+}
+
+func setField(run *models.Run, field string, value string) error {
+	switch field {
+	case FieldDate:
+		date, err := parseDate(value)
+		if err != nil {
+			return err
+		}
+		run.CreatedAt = primitive.Timestamp{T: uint32(date.Unix())}
+	case FieldTime:
+		duration, err := models.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		run.Time = duration
+	default:
+		number, err := strconv.ParseFloat(value, 32)
+		if err != nil || number < 0 {
+			return fmt.Errorf("%q is not a positive number", value)
+		}
+		switch field {
+		case FieldDistance:
+			run.Distance = float32(number)
+		case FieldPace:
+			run.Pace = float32(number)
+		case FieldIncline:
+			run.Incline = float32(number)
+		case FieldElevationGain:
+			run.ElevationGain = float32(number)
+		}
+	}
+	return nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date, use YYYY-MM-DD or RFC 3339", value)
+}
+
+// Encode writes runs with one column per field after the run id. Runs are
+// expected in a single unit system, which is written in the last column.
+func Encode(w io.Writer, runs []*models.Run) error {
+	writer := stdcsv.NewWriter(w)
+	header := append([]string{"runId"}, Fields...)
+	if err := writer.Write(append(header, "units")); err != nil {
+		return err
+	}
+
+	for _, run := range runs {
+		record := []string{
+			run.RunId,
+			time.Unix(int64(run.CreatedAt.T), 0).UTC().Format(time.RFC3339),
+			formatNumber(run.Distance),
+			run.Time.String(),
+			formatNumber(run.Pace),
+			formatNumber(run.Incline),
+			formatNumber(run.ElevationGain),
+			string(run.Units),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatNumber(value float32) string {
+	return strconv.FormatFloat(float64(value), 'f', -1, 32)
+}
+
+func newReader(r io.Reader) *stdcsv.Reader {
+	reader := stdcsv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	return reader
+}
+
+// readHeader reads the first line of a file, dropping the byte order mark
+// spreadsheet programs put in front of it.
+func readHeader(reader *stdcsv.Reader) ([]string, error) {
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, ErrEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	return header, nil
+}
+
+func isField(field string) bool {
+	return indexOf(Fields, field) >= 0
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,88 @@
+package csv
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestColumns(t *testing.T) {
+	columns, err := Columns(strings.NewReader("\ufeffDate, Distance,Duration\n2022-05-01,5,25:00\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Date", "Distance", "Duration"}, columns)
+	assert.Equal(t, Mapping{"Date": FieldDate, "Distance": FieldDistance}, SuggestMapping(columns))
+
+	_, err = Columns(strings.NewReader(""))
+	assert.ErrorIs(t, err, ErrEmpty)
+}
+
+func TestDecode(t *testing.T) {
+	const file = `Day,Km,Duration,Notes
+2022-05-01,5,25:00,easy
+2022-05-02,ten,1:00:00,
+2022-05-03,8
+2022-05-04,,45:00,
+`
+	mapping := Mapping{"Day": FieldDate, "Km": FieldDistance, "Duration": FieldTime}
+
+	rows, err := Decode(strings.NewReader(file), mapping)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(rows))
+
+	assert.Equal(t, 2, rows[0].Line)
+	assert.Empty(t, rows[0].Errors)
+	assert.Equal(t, &models.Run{
+		Distance:  5,
+		Time:      models.Duration(25 * time.Minute),
+		CreatedAt: primitive.Timestamp{T: uint32(time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC).Unix())},
+	}, rows[0].Run)
+
+	assert.Equal(t, []RowError{{Row: 3, Column: "Km", Message: `"ten" is not a positive number`}}, rows[1].Errors)
+	assert.Equal(t, 4, rows[2].Line)
+	assert.Equal(t, "wrong number of fields", rows[2].Errors[0].Message)
+	assert.Empty(t, rows[3].Errors)
+	assert.Equal(t, float32(0), rows[3].Run.Distance)
+}
+
+func TestDecodeMapping(t *testing.T) {
+	const file = "distance,time\n5,25:00\n"
+
+	rows, err := Decode(strings.NewReader(file), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, float32(5), rows[0].Run.Distance)
+
+	_, err = Decode(strings.NewReader(file), Mapping{"distance": "speed"})
+	assert.EqualError(t, err, `column "distance" is mapped to unknown field "speed"`)
+
+	_, err = Decode(strings.NewReader(file), Mapping{"km": FieldDistance})
+	assert.EqualError(t, err, `mapped column "km" is not in the file`)
+
+	_, err = Decode(strings.NewReader("a,b\n1,2\n"), nil)
+	assert.ErrorIs(t, err, ErrNothingMapped)
+}
+
+func TestEncode(t *testing.T) {
+	runs := []*models.Run{{
+		RunId:     "abc",
+		Distance:  5.5,
+		Time:      models.Duration(30 * time.Minute),
+		Pace:      11,
+		CreatedAt: primitive.Timestamp{T: uint32(time.Date(2022, 5, 1, 7, 0, 0, 0, time.UTC).Unix())},
+		Units:     models.Metric,
+	}}
+
+	var buf bytes.Buffer
+	assert.Nil(t, Encode(&buf, runs))
+	assert.Equal(t, "runId,date,distance,time,pace,incline,elevationGain,units\n"+
+		"abc,2022-05-01T07:00:00Z,5.5,30:00,11,0,0,metric\n", buf.String())
+
+	rows, err := Decode(&buf, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, runs[0].Distance, rows[0].Run.Distance)
+	assert.Equal(t, runs[0].CreatedAt, rows[0].Run.CreatedAt)
+}
@@ -0,0 +1,239 @@
+package fit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrInvalidHeader = errors.New("not a fit file")
+	ErrChecksum      = errors.New("fit file checksum mismatch")
+	ErrTruncated     = errors.New("fit file is truncated")
+)
+
+const (
+	headerDefinition     = 0x40
+	headerDeveloperData  = 0x20
+	headerCompressedTime = 0x80
+	localTypeMask        = 0x0F
+
+	fieldTimestamp = 253
+)
+
+// message is one decoded data message. Fields hold the raw value of every
+// field, invalid values are already dropped.
+type message struct {
+	Global uint16
+	Fields map[byte]uint64
+}
+
+type fieldDefinition struct {
+	Number   byte
+	Size     byte
+	BaseType byte
+}
+
+type definition struct {
+	Global    uint16
+	Order     binary.ByteOrder
+	Fields    []fieldDefinition
+	DevLength int
+}
+
+// decoder walks the records of a FIT file. Only numeric fields are decoded,
+// strings, arrays past their first element and developer fields are skipped.
+type decoder struct {
+	data        []byte
+	pos         int
+	definitions [16]*definition
+	timestamp   uint32
+}
+
+// readMessages checks the header and checksum of a FIT file and returns its
+// data messages in file order.
+func readMessages(r io.Reader) ([]message, error) {
+	file, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(file) < 12 || (file[0] != 12 && file[0] != 14) || string(file[8:12]) != ".FIT" {
+		return nil, ErrInvalidHeader
+	}
+
+	headerSize := int(file[0])
+	dataSize := int(binary.LittleEndian.Uint32(file[4:8]))
+	end := headerSize + dataSize
+	if len(file) < end+2 {
+		return nil, ErrTruncated
+	}
+	if crc16(0, file[:end]) != binary.LittleEndian.Uint16(file[end:end+2]) {
+		return nil, ErrChecksum
+	}
+
+	d := &decoder{data: file[headerSize:end]}
+	var messages []message
+	for d.pos < len(d.data) {
+		msg, err := d.next()
+		if err != nil {
+			return nil, err
+		}
+		if msg != nil {
+			messages = append(messages, *msg)
+		}
+	}
+	return messages, nil
+}
+
+// next reads one record, it returns a nil message for definitions.
+func (d *decoder) next() (*message, error) {
+	header, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0]&headerCompressedTime != 0 {
+		local := (header[0] >> 5) & 0x03
+		offset := uint32(header[0] & 0x1F)
+		if offset >= d.timestamp&0x1F {
+			d.timestamp = d.timestamp&^0x1F + offset
+		} else {
+			d.timestamp = d.timestamp&^0x1F + offset + 0x20
+		}
+		return d.dataMessage(local, true)
+	}
+
+	local := header[0] & localTypeMask
+	if header[0]&headerDefinition != 0 {
+		return nil, d.define(local, header[0]&headerDeveloperData != 0)
+	}
+	return d.dataMessage(local, false)
+}
+
+func (d *decoder) define(local byte, developer bool) error {
+	fixed, err := d.read(5)
+	if err != nil {
+		return err
+	}
+
+	def := &definition{Order: binary.LittleEndian}
+	if fixed[1] == 1 {
+		def.Order = binary.BigEndian
+	}
+	def.Global = def.Order.Uint16(fixed[2:4])
+
+	fields, err := d.read(int(fixed[4]) * 3)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(fields); i += 3 {
+		def.Fields = append(def.Fields, fieldDefinition{Number: fields[i], Size: fields[i+1], BaseType: fields[i+2]})
+	}
+
+	if developer {
+		count, err := d.read(1)
+		if err != nil {
+			return err
+		}
+		devFields, err := d.read(int(count[0]) * 3)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(devFields); i += 3 {
+			def.DevLength += int(devFields[i+1])
+		}
+	}
+
+	d.definitions[local] = def
+	return nil
+}
+
+func (d *decoder) dataMessage(local byte, compressed bool) (*message, error) {
+	def := d.definitions[local]
+	if def == nil {
+		return nil, fmt.Errorf("fit data message for undefined local type %d", local)
+	}
+
+	msg := &message{Global: def.Global, Fields: make(map[byte]uint64)}
+	for _, field := range def.Fields {
+		raw, err := d.read(int(field.Size))
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := decodeValue(raw, field.BaseType, def.Order); ok {
+			msg.Fields[field.Number] = value
+		}
+	}
+	if _, err := d.read(def.DevLength); err != nil {
+		return nil, err
+	}
+
+	if timestamp, ok := msg.Fields[fieldTimestamp]; ok {
+		d.timestamp = uint32(timestamp)
+	} else if compressed {
+		msg.Fields[fieldTimestamp] = uint64(d.timestamp)
+	}
+	return msg, nil
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if d.pos+n > len(d.data) {
+		return nil, ErrTruncated
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// decodeValue reads the first element of an integer field. Signed values are
+// returned sign extended, floats and strings are not decoded.
+func decodeValue(raw []byte, baseType byte, order binary.ByteOrder) (uint64, bool) {
+	var size int
+	var signed bool
+	var invalid uint64
+	switch baseType & 0x1F {
+	case 0x00, 0x02, 0x0D: // enum, uint8, byte
+		size, invalid = 1, 0xFF
+	case 0x0A: // uint8z
+		size, invalid = 1, 0
+	case 0x01: // sint8
+		size, signed, invalid = 1, true, 0x7F
+	case 0x03: // sint16
+		size, signed, invalid = 2, true, 0x7FFF
+	case 0x04: // uint16
+		size, invalid = 2, 0xFFFF
+	case 0x0B: // uint16z
+		size, invalid = 2, 0
+	case 0x05: // sint32
+		size, signed, invalid = 4, true, 0x7FFFFFFF
+	case 0x06: // uint32
+		size, invalid = 4, 0xFFFFFFFF
+	case 0x0C: // uint32z
+		size, invalid = 4, 0
+	default:
+		return 0, false
+	}
+	if len(raw) < size {
+		return 0, false
+	}
+
+	var value uint64
+	switch size {
+	case 1:
+		value = uint64(raw[0])
+	case 2:
+		value = uint64(order.Uint16(raw))
+	case 4:
+		value = uint64(order.Uint32(raw))
+	}
+	if value == invalid {
+		return 0, false
+	}
+
+	if signed {
+		shift := 64 - 8*size
+		value = uint64(int64(value<<shift) >> shift)
+	}
+	return value, true
+}
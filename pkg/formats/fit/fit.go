@@ -0,0 +1,131 @@
+// Package fit decodes activities recorded in the binary Flexible and
+// Interoperable Data Transfer (FIT) format used by most running watches.
+package fit
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+var ErrNotActivity = errors.New("fit file is not an activity")
+
+// Global message numbers and field numbers from the FIT profile.
+const (
+	messageFileId  = 0
+	messageSession = 18
+	messageLap     = 19
+	messageRecord  = 20
+
+	fileIdType       = 0
+	fileTypeActivity = 4
+
+	recordLatitude         = 0
+	recordLongitude        = 1
+	recordAltitude         = 2
+	recordHeartRate        = 3
+	recordCadence          = 4
+	recordEnhancedAltitude = 78
+
+	lapTimerTime    = 8
+	lapDistance     = 9
+	lapAvgHeartRate = 15
+
+	sessionTimerTime   = 8
+	sessionDistance    = 9
+	sessionTotalAscent = 22
+)
+
+// epoch is the FIT timestamp origin, 1989-12-31T00:00:00Z.
+var epoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// Decode reads a FIT activity file and returns the run it records. Laps become
+// splits and records become track points. A file without laps takes its
+// totals from the session.
+func Decode(r io.Reader) (*models.Run, error) {
+	messages, err := readMessages(r)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &models.Run{}
+	var session *message
+	for i, msg := range messages {
+		switch msg.Global {
+		case messageFileId:
+			if fileType, ok := msg.Fields[fileIdType]; ok && fileType != fileTypeActivity {
+				return nil, ErrNotActivity
+			}
+		case messageRecord:
+			run.Track = append(run.Track, toTrackPoint(msg))
+		case messageLap:
+			run.Splits = append(run.Splits, toSplit(msg))
+		case messageSession:
+			if session == nil {
+				session = &messages[i]
+			}
+		}
+	}
+	if session == nil && len(run.Splits) == 0 {
+		return nil, ErrNotActivity
+	}
+
+	if len(run.Splits) == 0 {
+		run.Distance = scaled(session.Fields, sessionDistance, 100)
+		run.Time = models.DurationFromSeconds(float64(session.Fields[sessionTimerTime]) / 1000)
+	}
+	if ascent, ok := sessionAscent(session); ok {
+		run.ElevationGain = ascent
+	} else {
+		run.ElevationGain = float32(models.ElevationGain(run.Track))
+	}
+	return run, nil
+}
+
+func toTrackPoint(msg message) models.TrackPoint {
+	var point models.TrackPoint
+	if timestamp, ok := msg.Fields[fieldTimestamp]; ok {
+		point.Time = epoch.Add(time.Duration(timestamp) * time.Second)
+	}
+	if lat, ok := msg.Fields[recordLatitude]; ok {
+		point.Latitude = semicircles(lat)
+	}
+	if lon, ok := msg.Fields[recordLongitude]; ok {
+		point.Longitude = semicircles(lon)
+	}
+	if altitude, ok := msg.Fields[recordEnhancedAltitude]; ok {
+		point.Elevation = float32(float64(altitude)/5 - 500)
+	} else if altitude, ok := msg.Fields[recordAltitude]; ok {
+		point.Elevation = float32(float64(altitude)/5 - 500)
+	}
+	point.HeartRate = int(msg.Fields[recordHeartRate])
+	point.Cadence = int(msg.Fields[recordCadence])
+	return point
+}
+
+func toSplit(msg message) models.Split {
+	return models.Split{
+		Distance:  scaled(msg.Fields, lapDistance, 100),
+		Time:      models.DurationFromSeconds(float64(msg.Fields[lapTimerTime]) / 1000),
+		HeartRate: int(msg.Fields[lapAvgHeartRate]),
+	}
+}
+
+func sessionAscent(session *message) (float32, bool) {
+	if session == nil {
+		return 0, false
+	}
+	ascent, ok := session.Fields[sessionTotalAscent]
+	return float32(ascent), ok
+}
+
+func scaled(fields map[byte]uint64, field byte, scale float64) float32 {
+	return float32(float64(fields[field]) / scale)
+}
+
+// semicircles converts a sign extended FIT position to degrees.
+func semicircles(value uint64) float64 {
+	return float64(int32(value)) * 180 / (1 << 31)
+}
@@ -0,0 +1,70 @@
+package fit
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func readFixture(t *testing.T) []byte {
+	data, err := os.ReadFile("testdata/run.fit")
+	assert.Nil(t, err)
+	return data
+}
+
+func TestDecode(t *testing.T) {
+	run, err := Decode(bytes.NewReader(readFixture(t)))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []models.Split{
+		{Distance: 1000, Time: models.Duration(5 * time.Minute), HeartRate: 140},
+		{Distance: 1000, Time: models.Duration(280 * time.Second), HeartRate: 150},
+	}, run.Splits)
+	assert.Equal(t, float32(12), run.ElevationGain)
+
+	start := time.Date(2022, 5, 1, 7, 0, 0, 0, time.UTC)
+	assert.Equal(t, 5, len(run.Track))
+
+	first := run.Track[0]
+	assert.Equal(t, start, first.Time)
+	assert.InDelta(t, 51.5, first.Latitude, 1e-6)
+	assert.InDelta(t, -0.12, first.Longitude, 1e-6)
+	assert.Equal(t, float32(10), first.Elevation)
+	assert.Equal(t, 120, first.HeartRate)
+	assert.Equal(t, 80, first.Cadence)
+
+	assert.Equal(t, 0, run.Track[1].HeartRate, "invalid values are dropped")
+
+	compressed := run.Track[2]
+	assert.Equal(t, start.Add(160*time.Second), compressed.Time)
+	assert.Equal(t, 130, compressed.HeartRate)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	t.Run("not a fit file", func(t *testing.T) {
+		_, err := Decode(bytes.NewReader([]byte("<gpx></gpx>")))
+		assert.ErrorIs(t, err, ErrInvalidHeader)
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		data := readFixture(t)
+		data[len(data)-10] ^= 0xFF
+		_, err := Decode(bytes.NewReader(data))
+		assert.ErrorIs(t, err, ErrChecksum)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		data := readFixture(t)
+		_, err := Decode(bytes.NewReader(data[:len(data)-20]))
+		assert.ErrorIs(t, err, ErrTruncated)
+	})
+}
+
+func TestCRC(t *testing.T) {
+	data := readFixture(t)
+	assert.Equal(t, uint16(0), crc16(0, data), "a file followed by its checksum sums to zero")
+}
@@ -0,0 +1,129 @@
+//go:build ignore
+
+// generate writes the FIT fixtures used by the decoder tests:
+//
+//	go run testdata/generate.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"os"
+	"time"
+)
+
+var epoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+type field struct {
+	number   byte
+	size     byte
+	baseType byte
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) define(local byte, order binary.ByteOrder, global uint16, fields ...field) {
+	e.buf.WriteByte(0x40 | local)
+	e.buf.WriteByte(0)
+	if order == binary.BigEndian {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+	binary.Write(&e.buf, order, global)
+	e.buf.WriteByte(byte(len(fields)))
+	for _, f := range fields {
+		e.buf.Write([]byte{f.number, f.size, f.baseType})
+	}
+}
+
+func (e *encoder) data(header byte, order binary.ByteOrder, values ...interface{}) {
+	e.buf.WriteByte(header)
+	for _, v := range values {
+		binary.Write(&e.buf, order, v)
+	}
+}
+
+func (e *encoder) file() []byte {
+	header := []byte{14, 0x20, 0, 0, 0, 0, 0, 0, '.', 'F', 'I', 'T', 0, 0}
+	binary.LittleEndian.PutUint16(header[2:], 2140)
+	binary.LittleEndian.PutUint32(header[4:], uint32(e.buf.Len()))
+	binary.LittleEndian.PutUint16(header[12:], crc16(0, header[:12]))
+
+	file := append(header, e.buf.Bytes()...)
+	crc := crc16(0, file)
+	return append(file, byte(crc), byte(crc>>8))
+}
+
+func timestamp(t time.Time) uint32 {
+	return uint32(t.Sub(epoch) / time.Second)
+}
+
+func semicircles(degrees float64) int32 {
+	return int32(degrees * (1 << 31) / 180)
+}
+
+func altitude(metres float64) uint32 {
+	return uint32((metres + 500) * 5)
+}
+
+func main() {
+	le, be := binary.LittleEndian, binary.BigEndian
+	start := time.Date(2022, 5, 1, 7, 0, 0, 0, time.UTC)
+	at := func(seconds int) uint32 { return timestamp(start.Add(time.Duration(seconds) * time.Second)) }
+
+	var e encoder
+	// file_id: type, manufacturer, time_created
+	e.define(0, le, 0, field{0, 1, 0x00}, field{1, 2, 0x84}, field{4, 4, 0x86})
+	e.data(0, le, uint8(4), uint16(1), at(0))
+
+	// record: timestamp, position_lat, position_long, enhanced_altitude, heart_rate, cadence
+	e.define(1, le, 20, field{253, 4, 0x86}, field{0, 4, 0x85}, field{1, 4, 0x85}, field{78, 4, 0x86},
+		field{3, 1, 0x02}, field{4, 1, 0x02})
+	e.data(1, le, at(0), semicircles(51.5), semicircles(-0.12), altitude(10), uint8(120), uint8(80))
+	e.data(1, le, at(150), semicircles(51.504), semicircles(-0.12), altitude(16), uint8(0xFF), uint8(82))
+
+	// record without timestamp, sent with a compressed timestamp header
+	e.define(2, le, 20, field{0, 4, 0x85}, field{1, 4, 0x85}, field{3, 1, 0x02})
+	offset := byte(at(160) & 0x1F)
+	e.data(0x80|2<<5|offset, le, semicircles(51.505), semicircles(-0.12), uint8(130))
+
+	e.data(1, le, at(300), semicircles(51.509), semicircles(-0.12), altitude(12), uint8(145), uint8(84))
+	e.data(1, le, at(580), semicircles(51.518), semicircles(-0.12), altitude(18), uint8(155), uint8(86))
+
+	// lap: timestamp, start_time, total_timer_time, total_distance, avg_heart_rate
+	e.define(4, le, 19, field{253, 4, 0x86}, field{2, 4, 0x86}, field{8, 4, 0x86}, field{9, 4, 0x86},
+		field{15, 1, 0x02})
+	e.data(4, le, at(300), at(0), uint32(300000), uint32(100000), uint8(140))
+	e.data(4, le, at(580), at(300), uint32(280000), uint32(100000), uint8(150))
+
+	// session, big endian: timestamp, start_time, sport, total_timer_time, total_distance, total_ascent
+	e.define(5, be, 18, field{253, 4, 0x86}, field{2, 4, 0x86}, field{5, 1, 0x00}, field{8, 4, 0x86},
+		field{9, 4, 0x86}, field{22, 2, 0x84})
+	e.data(5, be, at(580), at(0), uint8(1), uint32(580000), uint32(200000), uint16(12))
+
+	if err := os.WriteFile("testdata/run.fit", e.file(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var crcTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+func crc16(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		tmp := crcTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ crcTable[b&0xF]
+
+		tmp = crcTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ crcTable[(b>>4)&0xF]
+	}
+	return crc
+}
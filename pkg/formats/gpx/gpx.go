@@ -0,0 +1,173 @@
+// Package gpx converts runs to and from GPX 1.1 documents. Heart rate and
+// cadence travel in the Garmin TrackPointExtension.
+package gpx
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+const (
+	ContentType = "application/gpx+xml"
+
+	namespace          = "http://www.topografix.com/GPX/1/1"
+	extensionNamespace = "http://www.garmin.com/xmlschemas/TrackPointExtension/v1"
+	creator            = "chimichanga"
+)
+
+var ErrNoTrackPoints = errors.New("gpx file has no track points")
+
+type document struct {
+	XMLName  xml.Name  `xml:"gpx"`
+	Xmlns    string    `xml:"xmlns,attr,omitempty"`
+	Version  string    `xml:"version,attr"`
+	Creator  string    `xml:"creator,attr"`
+	Metadata *metadata `xml:"metadata"`
+	Tracks   []track   `xml:"trk"`
+}
+
+type metadata struct {
+	Time *time.Time `xml:"time"`
+}
+
+type track struct {
+	Name     string    `xml:"name,omitempty"`
+	Type     string    `xml:"type,omitempty"`
+	Segments []segment `xml:"trkseg"`
+}
+
+type segment struct {
+	Points []point `xml:"trkpt"`
+}
+
+type point struct {
+	Latitude   float64     `xml:"lat,attr"`
+	Longitude  float64     `xml:"lon,attr"`
+	Elevation  *float64    `xml:"ele"`
+	Time       *time.Time  `xml:"time"`
+	Extensions *extensions `xml:"extensions"`
+}
+
+type extensions struct {
+	TrackPoint *trackPointExtension `xml:"TrackPointExtension"`
+}
+
+// trackPointExtension is matched by local name when decoding so that both
+// versions of the Garmin schema are read.
+type trackPointExtension struct {
+	XMLName   xml.Name
+	HeartRate int `xml:"hr,omitempty"`
+	Cadence   int `xml:"cad,omitempty"`
+}
+
+// Decode reads a GPX document and returns the run it records. Distance, time
+// and elevation gain are derived from the track points; the run has no id or
+// account yet.
+func Decode(r io.Reader) (*models.Run, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var points []models.TrackPoint
+	for _, trk := range doc.Tracks {
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				points = append(points, p.toTrackPoint())
+			}
+		}
+	}
+	if len(points) == 0 {
+		return nil, ErrNoTrackPoints
+	}
+
+	return &models.Run{
+		Distance:      float32(models.TrackDistance(points)),
+		Time:          models.TrackDuration(points),
+		ElevationGain: float32(models.ElevationGain(points)),
+		Track:         points,
+	}, nil
+}
+
+// Encode writes run as a GPX document. A run without positioned track points,
+// such as one on a treadmill, is written as a track with no segments.
+func Encode(w io.Writer, run *models.Run) error {
+	trk := track{Name: "Run " + run.RunId, Type: "running"}
+
+	var seg segment
+	for _, p := range run.Track {
+		if p.HasPosition() {
+			seg.Points = append(seg.Points, fromTrackPoint(p))
+		}
+	}
+	if len(seg.Points) > 0 {
+		trk.Segments = []segment{seg}
+	}
+
+	doc := document{
+		Xmlns:   namespace,
+		Version: "1.1",
+		Creator: creator,
+		Tracks:  []track{trk},
+	}
+	if len(run.Track) > 0 && !run.Track[0].Time.IsZero() {
+		start := run.Track[0].Time.UTC()
+		doc.Metadata = &metadata{Time: &start}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func (p point) toTrackPoint() models.TrackPoint {
+	trackPoint := models.TrackPoint{
+		Latitude:  p.Latitude,
+		Longitude: p.Longitude,
+	}
+	if p.Elevation != nil {
+		trackPoint.Elevation = float32(*p.Elevation)
+	}
+	if p.Time != nil {
+		trackPoint.Time = p.Time.UTC()
+	}
+	if p.Extensions != nil && p.Extensions.TrackPoint != nil {
+		trackPoint.HeartRate = p.Extensions.TrackPoint.HeartRate
+		trackPoint.Cadence = p.Extensions.TrackPoint.Cadence
+	}
+	return trackPoint
+}
+
+func fromTrackPoint(trackPoint models.TrackPoint) point {
+	p := point{
+		Latitude:  trackPoint.Latitude,
+		Longitude: trackPoint.Longitude,
+	}
+	if trackPoint.Elevation != 0 {
+		elevation := float64(trackPoint.Elevation)
+		p.Elevation = &elevation
+	}
+	if !trackPoint.Time.IsZero() {
+		t := trackPoint.Time.UTC()
+		p.Time = &t
+	}
+	if trackPoint.HeartRate != 0 || trackPoint.Cadence != 0 {
+		p.Extensions = &extensions{TrackPoint: &trackPointExtension{
+			XMLName:   xml.Name{Space: extensionNamespace, Local: "TrackPointExtension"},
+			HeartRate: trackPoint.HeartRate,
+			Cadence:   trackPoint.Cadence,
+		}}
+	}
+	return p
+}
@@ -0,0 +1,70 @@
+package gpx
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	file, err := os.Open("testdata/morning-run.gpx")
+	assert.Nil(t, err)
+	defer file.Close()
+
+	run, err := Decode(file)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 4, len(run.Track))
+	assert.InDelta(t, 333.6, run.Distance, 0.5)
+	assert.Equal(t, models.Duration(90*time.Second), run.Time)
+	assert.Equal(t, float32(7.0), run.ElevationGain)
+
+	first := run.Track[0]
+	assert.Equal(t, time.Date(2022, 5, 1, 7, 0, 0, 0, time.UTC), first.Time)
+	assert.Equal(t, 51.5, first.Latitude)
+	assert.Equal(t, float32(10.0), first.Elevation)
+	assert.Equal(t, 120, first.HeartRate)
+	assert.Equal(t, 80, first.Cadence)
+	assert.Equal(t, 0, run.Track[2].HeartRate)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode(strings.NewReader(`<gpx version="1.1"><trk><trkseg></trkseg></trk></gpx>`))
+	assert.ErrorIs(t, err, ErrNoTrackPoints)
+
+	_, err = Decode(strings.NewReader("not xml"))
+	assert.NotNil(t, err)
+}
+
+func TestEncode(t *testing.T) {
+	start := time.Date(2022, 5, 1, 7, 0, 0, 0, time.UTC)
+	run := &models.Run{
+		RunId: "abc",
+		Track: []models.TrackPoint{
+			{Time: start, Latitude: 51.5, Longitude: -0.12, Elevation: 10, HeartRate: 120, Cadence: 80},
+			{Time: start.Add(30 * time.Second), Latitude: 51.501, Longitude: -0.12, Elevation: 14},
+		},
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Nil(t, Encode(&buf, run))
+		assert.Contains(t, buf.String(), `<gpx xmlns="http://www.topografix.com/GPX/1/1" version="1.1" creator="chimichanga">`)
+
+		decoded, err := Decode(&buf)
+		assert.Nil(t, err)
+		assert.Equal(t, run.Track, decoded.Track)
+	})
+
+	t.Run("run without positions", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Nil(t, Encode(&buf, &models.Run{RunId: "abc", Distance: 5000}))
+		assert.Contains(t, buf.String(), "<name>Run abc</name>")
+		assert.NotContains(t, buf.String(), "<trkseg>")
+	})
+}
@@ -0,0 +1,232 @@
+// Package tcx converts runs to and from Garmin Training Center (TCX) documents.
+// Laps become the splits of a run; running cadence travels in the Garmin
+// ActivityExtension.
+package tcx
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+const (
+	ContentType = "application/vnd.garmin.tcx+xml"
+
+	namespace          = "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2"
+	extensionNamespace = "http://www.garmin.com/xmlschemas/ActivityExtension/v2"
+)
+
+var ErrNoLaps = errors.New("tcx file has no laps")
+
+type document struct {
+	XMLName    xml.Name   `xml:"TrainingCenterDatabase"`
+	Xmlns      string     `xml:"xmlns,attr,omitempty"`
+	Activities activities `xml:"Activities"`
+}
+
+type activities struct {
+	Activity []activity `xml:"Activity"`
+}
+
+type activity struct {
+	Sport string `xml:"Sport,attr"`
+	Id    string `xml:"Id"`
+	Laps  []lap  `xml:"Lap"`
+}
+
+type lap struct {
+	StartTime        string     `xml:"StartTime,attr"`
+	TotalTimeSeconds float64    `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64    `xml:"DistanceMeters"`
+	Calories         int        `xml:"Calories"`
+	AverageHeartRate *heartRate `xml:"AverageHeartRateBpm"`
+	Intensity        string     `xml:"Intensity"`
+	TriggerMethod    string     `xml:"TriggerMethod"`
+	Track            *track     `xml:"Track"`
+}
+
+type heartRate struct {
+	Value int `xml:"Value"`
+}
+
+type track struct {
+	Points []trackPoint `xml:"Trackpoint"`
+}
+
+type trackPoint struct {
+	Time       time.Time            `xml:"Time"`
+	Position   *position            `xml:"Position"`
+	Altitude   *float64             `xml:"AltitudeMeters"`
+	HeartRate  *heartRate           `xml:"HeartRateBpm"`
+	Cadence    int                  `xml:"Cadence,omitempty"`
+	Extensions *trackPointExtension `xml:"Extensions"`
+}
+
+type position struct {
+	Latitude  float64 `xml:"LatitudeDegrees"`
+	Longitude float64 `xml:"LongitudeDegrees"`
+}
+
+type trackPointExtension struct {
+	TPX *tpx `xml:"TPX"`
+}
+
+// tpx is matched by local name when decoding, exporters bind the namespace
+// to different prefixes.
+type tpx struct {
+	XMLName    xml.Name
+	RunCadence int `xml:"RunCadence,omitempty"`
+}
+
+// Decode reads a TCX document and returns the run recorded by its first
+// activity. Every lap becomes a split, the run totals are left for the run
+// service to compute from them.
+func Decode(r io.Reader) (*models.Run, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Activities.Activity) == 0 || len(doc.Activities.Activity[0].Laps) == 0 {
+		return nil, ErrNoLaps
+	}
+
+	run := &models.Run{}
+	for _, l := range doc.Activities.Activity[0].Laps {
+		split := models.Split{
+			Distance: float32(l.DistanceMeters),
+			Time:     models.DurationFromSeconds(l.TotalTimeSeconds),
+		}
+		if l.AverageHeartRate != nil {
+			split.HeartRate = l.AverageHeartRate.Value
+		}
+		run.Splits = append(run.Splits, split)
+
+		if l.Track != nil {
+			for _, p := range l.Track.Points {
+				run.Track = append(run.Track, p.toTrackPoint())
+			}
+		}
+	}
+	run.ElevationGain = float32(models.ElevationGain(run.Track))
+	return run, nil
+}
+
+// Encode writes run as a TCX running activity. Each split is written as a
+// lap holding the track points recorded during it; a run without splits is
+// written as a single lap.
+func Encode(w io.Writer, run *models.Run) error {
+	start := startTime(run)
+
+	splits := run.Splits
+	if len(splits) == 0 {
+		splits = []models.Split{{Distance: run.Distance, Time: run.Time}}
+	}
+
+	act := activity{Sport: "Running", Id: start.Format(time.RFC3339)}
+	points := run.Track
+	lapStart := start
+	for i, split := range splits {
+		lapEnd := lapStart.Add(time.Duration(split.Time))
+
+		l := lap{
+			StartTime:        lapStart.Format(time.RFC3339),
+			TotalTimeSeconds: split.Time.Seconds(),
+			DistanceMeters:   float64(split.Distance),
+			Intensity:        "Active",
+			TriggerMethod:    "Manual",
+		}
+		if split.HeartRate != 0 {
+			l.AverageHeartRate = &heartRate{Value: split.HeartRate}
+		}
+
+		// Points are given to the lap running when they were recorded, the
+		// last lap takes whatever is left.
+		n := len(points)
+		if i < len(splits)-1 {
+			n = 0
+			for n < len(points) && points[n].Time.Before(lapEnd) {
+				n++
+			}
+		}
+		if n > 0 {
+			l.Track = &track{}
+			for _, p := range points[:n] {
+				l.Track.Points = append(l.Track.Points, fromTrackPoint(p))
+			}
+			points = points[n:]
+		}
+
+		act.Laps = append(act.Laps, l)
+		lapStart = lapEnd
+	}
+
+	doc := document{
+		Xmlns:      namespace,
+		Activities: activities{Activity: []activity{act}},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// startTime is when the run began: its first track point, or its creation
+// time when it has no track.
+func startTime(run *models.Run) time.Time {
+	if len(run.Track) > 0 && !run.Track[0].Time.IsZero() {
+		return run.Track[0].Time.UTC()
+	}
+	return time.Unix(int64(run.CreatedAt.T), 0).UTC()
+}
+
+func (p trackPoint) toTrackPoint() models.TrackPoint {
+	point := models.TrackPoint{
+		Time:    p.Time.UTC(),
+		Cadence: p.Cadence,
+	}
+	if p.Position != nil {
+		point.Latitude = p.Position.Latitude
+		point.Longitude = p.Position.Longitude
+	}
+	if p.Altitude != nil {
+		point.Elevation = float32(*p.Altitude)
+	}
+	if p.HeartRate != nil {
+		point.HeartRate = p.HeartRate.Value
+	}
+	if p.Extensions != nil && p.Extensions.TPX != nil && p.Extensions.TPX.RunCadence != 0 {
+		point.Cadence = p.Extensions.TPX.RunCadence
+	}
+	return point
+}
+
+func fromTrackPoint(point models.TrackPoint) trackPoint {
+	p := trackPoint{Time: point.Time.UTC()}
+	if point.HasPosition() {
+		p.Position = &position{Latitude: point.Latitude, Longitude: point.Longitude}
+	}
+	if point.Elevation != 0 {
+		altitude := float64(point.Elevation)
+		p.Altitude = &altitude
+	}
+	if point.HeartRate != 0 {
+		p.HeartRate = &heartRate{Value: point.HeartRate}
+	}
+	if point.Cadence != 0 {
+		p.Extensions = &trackPointExtension{TPX: &tpx{
+			XMLName:    xml.Name{Space: extensionNamespace, Local: "TPX"},
+			RunCadence: point.Cadence,
+		}}
+	}
+	return p
+}
@@ -0,0 +1,88 @@
+package tcx
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	file, err := os.Open("testdata/treadmill.tcx")
+	assert.Nil(t, err)
+	defer file.Close()
+
+	run, err := Decode(file)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []models.Split{
+		{Distance: 1000, Time: models.Duration(5 * time.Minute), HeartRate: 140},
+		{Distance: 1000, Time: models.Duration(280 * time.Second), HeartRate: 152},
+	}, run.Splits)
+	assert.Equal(t, float32(0), run.Distance)
+
+	assert.Equal(t, 3, len(run.Track))
+	assert.Equal(t, models.TrackPoint{Time: time.Date(2022, 5, 1, 7, 0, 0, 0, time.UTC), HeartRate: 120, Cadence: 82}, run.Track[0])
+	assert.False(t, run.Track[1].HasPosition())
+	assert.Equal(t, 86, run.Track[2].Cadence)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode(strings.NewReader(`<TrainingCenterDatabase><Activities></Activities></TrainingCenterDatabase>`))
+	assert.ErrorIs(t, err, ErrNoLaps)
+
+	_, err = Decode(strings.NewReader("not xml"))
+	assert.NotNil(t, err)
+}
+
+func TestEncode(t *testing.T) {
+	start := time.Date(2022, 5, 1, 7, 0, 0, 0, time.UTC)
+	run := &models.Run{
+		Distance: 2000,
+		Time:     models.Duration(10 * time.Minute),
+		Splits: []models.Split{
+			{Distance: 1000, Time: models.Duration(5 * time.Minute), HeartRate: 140},
+			{Distance: 1000, Time: models.Duration(5 * time.Minute)},
+		},
+		Track: []models.TrackPoint{
+			{Time: start, Latitude: 51.5, Longitude: -0.12, Elevation: 10, HeartRate: 120, Cadence: 80},
+			{Time: start.Add(4 * time.Minute), HeartRate: 130},
+			{Time: start.Add(5 * time.Minute), HeartRate: 150},
+		},
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Nil(t, Encode(&buf, run))
+		assert.Contains(t, buf.String(), `<TPX xmlns="http://www.garmin.com/xmlschemas/ActivityExtension/v2">`)
+
+		decoded, err := Decode(&buf)
+		assert.Nil(t, err)
+		assert.Equal(t, run.Splits, decoded.Splits)
+		assert.Equal(t, run.Track, decoded.Track)
+	})
+
+	t.Run("track points follow their lap", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Nil(t, Encode(&buf, run))
+
+		laps := strings.Split(buf.String(), "<Lap ")
+		assert.Equal(t, 3, len(laps))
+		assert.Equal(t, 2, strings.Count(laps[1], "<Trackpoint>"))
+		assert.Equal(t, 1, strings.Count(laps[2], "<Trackpoint>"))
+		assert.Contains(t, laps[2], `StartTime="2022-05-01T07:05:00Z"`)
+	})
+
+	t.Run("run without splits", func(t *testing.T) {
+		var buf bytes.Buffer
+		assert.Nil(t, Encode(&buf, &models.Run{Distance: 5000, Time: models.Duration(25 * time.Minute)}))
+
+		decoded, err := Decode(&buf)
+		assert.Nil(t, err)
+		assert.Equal(t, []models.Split{{Distance: 5000, Time: models.Duration(25 * time.Minute)}}, decoded.Splits)
+	})
+}
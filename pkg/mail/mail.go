@@ -0,0 +1,65 @@
+// Package mail delivers the messages the server sends to account holders.
+package mail
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers messages. Implementations must be safe for concurrent use.
+type Sender interface {
+	Send(Message) error
+}
+
+// WriterSender writes every message to an io.Writer instead of delivering
+// it, for development and tests.
+type WriterSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSender(w io.Writer) *WriterSender {
+	return &WriterSender{w: w}
+}
+
+func (s *WriterSender) Send(message Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "To: %s\nSubject: %s\n\n%s\n\n", message.To, message.Subject, message.Body)
+	return err
+}
+
+// FileSender appends every message to a file instead of delivering it.
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSender(path string) *FileSender {
+	return &FileSender{path: path}
+}
+
+func (s *FileSender) Send(message Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := NewWriterSender(file).Send(message); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
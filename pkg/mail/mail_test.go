@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterSender(t *testing.T) {
+	var buf bytes.Buffer
+	sender := NewWriterSender(&buf)
+
+	assert.Nil(t, sender.Send(Message{To: "runner@example.com", Subject: "Hello", Body: "Go run."}))
+	assert.Equal(t, "To: runner@example.com\nSubject: Hello\n\nGo run.\n\n", buf.String())
+}
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	sender := NewFileSender(path)
+
+	assert.Nil(t, sender.Send(Message{To: "a@example.com", Subject: "First", Body: "1"}))
+	assert.Nil(t, sender.Send(Message{To: "b@example.com", Subject: "Second", Body: "2"}))
+
+	content, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "To: a@example.com\nSubject: First\n\n1\n\nTo: b@example.com\nSubject: Second\n\n2\n\n", string(content))
+}
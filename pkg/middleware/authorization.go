@@ -1,71 +1,170 @@
 package middleware
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/croisade/chimichanga/pkg/models"
 	"github.com/croisade/chimichanga/pkg/services"
 	"github.com/gin-gonic/gin"
 )
 
-func AuthorizeUserJWT() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		const BEARER_SCHEMA = "Bearer "
-		authHeader := ctx.GetHeader("Authorization")
+const identityKey = "identity"
 
-		if authHeader == "" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "request missing token"})
-			return
-		}
+// Identity is the authenticated caller, taken from the token subject and
+// scopes, along with the token it authenticated with. PersonalAccessTokenId
+// is set in place of TokenId for callers with a personal access token,
+// ClientId for third-party apps acting for the account.
+type Identity struct {
+	AccountId             string
+	Scopes                []string
+	TokenId               string
+	ExpiresAt             time.Time
+	PersonalAccessTokenId string
+	ClientId              string
+}
 
-		tokenString := authHeader[len(BEARER_SCHEMA):]
-		token, err := services.NewJWTAuthService().ValidateToken(tokenString)
+func (i Identity) HasScope(scope string) bool {
+	return contains(i.Scopes, scope)
+}
 
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": err.Error()})
-			return
-		}
+// IsAdmin reports whether the caller may act on accounts other than its own.
+func (i Identity) IsAdmin() bool {
+	return i.HasScope(models.ScopeAccountsAdmin)
+}
 
-		// https://github.com/dgrijalva/jwt-go/issues/262
-		claims := services.MyCustomClaims{}
-		tmp, _ := json.Marshal(token.Claims)
-		_ = json.Unmarshal(tmp, &claims)
+// GetIdentity returns the identity the authorization middlewares stored in ctx.
+func GetIdentity(ctx *gin.Context) (Identity, bool) {
+	value, ok := ctx.Get(identityKey)
+	if !ok {
+		return Identity{}, false
+	}
+	identity, ok := value.(Identity)
+	return identity, ok
+}
 
-		if claims.Group != "USER" && claims.Group != "ADMIN" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "invalid group"})
-			return
-		}
+// Authorizer checks bearer tokens: their signature, that they were not revoked
+// and that they grant the scopes a route requires. Personal access tokens are
+// accepted alongside JWTs, told apart by their prefix.
+type Authorizer struct {
+	jwtService                 services.JWTService
+	revocationService          services.RevocationService
+	personalAccessTokenService services.PersonalAccessTokenService
+}
 
-		ctx.Next()
+func NewAuthorizer(jwtService services.JWTService, revocationService services.RevocationService, personalAccessTokenService services.PersonalAccessTokenService) Authorizer {
+	return Authorizer{
+		jwtService:                 jwtService,
+		revocationService:          revocationService,
+		personalAccessTokenService: personalAccessTokenService,
 	}
 }
 
-func AuthorizeAdminJWT() gin.HandlerFunc {
+// RequireScopes accepts requests bearing a valid token that grants every one
+// of scopes and records the caller's identity in the context.
+func (a Authorizer) RequireScopes(scopes ...string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		const BEARER_SCHEMA = "Bearer "
 		authHeader := ctx.GetHeader("Authorization")
-		if authHeader == "" {
+
+		if len(authHeader) <= len(BEARER_SCHEMA) {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "request missing token"})
 			return
 		}
-		tokenString := authHeader[len(BEARER_SCHEMA):]
-		token, err := services.NewJWTAuthService().ValidateToken(tokenString)
 
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": err.Error()})
+		tokenString := authHeader[len(BEARER_SCHEMA):]
+		var identity Identity
+		var ok bool
+		if strings.HasPrefix(tokenString, models.PersonalAccessTokenPrefix) {
+			identity, ok = a.personalAccessTokenIdentity(ctx, tokenString)
+		} else {
+			identity, ok = a.jwtIdentity(ctx, tokenString)
+		}
+		if !ok {
 			return
 		}
 
-		// https://github.com/dgrijalva/jwt-go/issues/262
-		claims := services.MyCustomClaims{}
-		tmp, _ := json.Marshal(token.Claims)
-		_ = json.Unmarshal(tmp, &claims)
-
-		if claims.Group != "ADMIN" {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "invalid group"})
-			return
+		for _, scope := range scopes {
+			if !identity.HasScope(scope) {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"errors": "missing scope " + scope})
+				return
+			}
 		}
 
+		ctx.Set(identityKey, identity)
 		ctx.Next()
 	}
 }
+
+// jwtIdentity checks an access token. It aborts the request itself and
+// returns false when the token is refused.
+func (a Authorizer) jwtIdentity(ctx *gin.Context, tokenString string) (Identity, bool) {
+	claims, err := a.jwtService.ValidateClaims(tokenString)
+
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": err.Error()})
+		return Identity{}, false
+	}
+
+	if claims.IsRefreshToken() {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "refresh tokens cannot authorize requests"})
+		return Identity{}, false
+	}
+	if claims.IsChallengeToken() {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "challenge tokens cannot authorize requests"})
+		return Identity{}, false
+	}
+
+	revoked, err := a.revocationService.IsRevoked(claims)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return Identity{}, false
+	}
+	if revoked {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "token has been revoked"})
+		return Identity{}, false
+	}
+
+	return Identity{
+		AccountId: claims.Subject,
+		Scopes:    claims.Scopes(),
+		TokenId:   claims.Id,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+		ClientId:  claims.ClientId,
+	}, true
+}
+
+// personalAccessTokenIdentity checks a personal access token. It aborts the
+// request itself and returns false when the token is refused.
+func (a Authorizer) personalAccessTokenIdentity(ctx *gin.Context, tokenString string) (Identity, bool) {
+	token, err := a.personalAccessTokenService.Authenticate(tokenString)
+	if errors.Is(err, services.ErrInvalidAccessToken) {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": err.Error()})
+		return Identity{}, false
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return Identity{}, false
+	}
+
+	identity := Identity{
+		AccountId:             token.AccountId,
+		Scopes:                token.Scopes,
+		PersonalAccessTokenId: token.TokenId,
+	}
+	if token.ExpiresAt.T != 0 {
+		identity.ExpiresAt = time.Unix(int64(token.ExpiresAt.T), 0)
+	}
+	return identity, true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import "time"
+
+type Migrator interface {
+	// Up applies every pending migration in version order and returns the
+	// versions it applied.
+	Up() ([]int, error)
+	// Down reverts the most recently applied migration and returns its version.
+	Down() (int, error)
+	Status() ([]Status, error)
+}
+
+type Status struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+// Pending returns the entries of statuses that have not been applied yet.
+func Pending(statuses []Status) []Status {
+	var pending []Status
+	for _, status := range statuses {
+		if !status.Applied {
+			pending = append(pending, status)
+		}
+	}
+	return pending
+}
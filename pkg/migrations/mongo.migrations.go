@@ -0,0 +1,412 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoMigrations is the ordered history of the CorroYouRun database. Never
+// edit or reorder a released entry, append a new one instead.
+var MongoMigrations = []MongoMigration{
+	{
+		Version:     1,
+		Description: "create accounts and runs collections",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			existing, err := db.ListCollectionNames(ctx, bson.M{})
+			if err != nil {
+				return err
+			}
+
+			for _, name := range []string{"accounts", "runs"} {
+				if contains(existing, name) {
+					continue
+				}
+				if err := db.CreateCollection(ctx, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		// The collections hold user data, reverting the baseline leaves them in place.
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "store run time as seconds",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			filter := bson.M{"time": bson.M{"$type": "string"}}
+			return rewriteField(ctx, db.Collection("runs"), filter, "time", func(value bson.RawValue) (interface{}, bool) {
+				duration, err := models.ParseDuration(value.StringValue())
+				return duration.Seconds(), err == nil
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			filter := bson.M{"time": bson.M{"$type": "number"}}
+			return rewriteField(ctx, db.Collection("runs"), filter, "time", func(value bson.RawValue) (interface{}, bool) {
+				var duration models.Duration
+				err := duration.UnmarshalBSONValue(value.Type, value.Value)
+				return duration.String(), err == nil
+			})
+		},
+	},
+	{
+		Version:     3,
+		Description: "store runs in metres and metres per second",
+		// Runs were stored without units, they are taken to be kilometres and
+		// km/h, the default for accounts that have no preference.
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return scaleRuns(ctx, db, 1000, 1/3.6, 1)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return scaleRuns(ctx, db, 1.0/1000, 3.6, 0)
+		},
+	},
+	{
+		Version:     4,
+		Description: "replace run lap count with splits",
+		// A bare lap count carries no per lap data, it is not turned into splits.
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("runs").UpdateMany(ctx, bson.M{"lap": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"lap": ""}})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			filter := bson.M{"splits.0": bson.M{"$exists": true}}
+			pipeline := mongo.Pipeline{{{Key: "$set", Value: bson.M{"lap": bson.M{"$size": "$splits"}}}}, {{Key: "$unset", Value: "splits"}}}
+			_, err := db.Collection("runs").UpdateMany(ctx, filter, pipeline)
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "put existing accounts in the user group",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("accounts").UpdateMany(ctx, bson.M{"group": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"group": "USER"}})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("accounts").UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"group": ""}})
+			return err
+		},
+	},
+	{
+		Version:     6,
+		Description: "track refresh token families instead of the last refresh token",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			existing, err := db.ListCollectionNames(ctx, bson.M{"name": "tokenFamilies"})
+			if err != nil {
+				return err
+			}
+			if len(existing) == 0 {
+				if err := db.CreateCollection(ctx, "tokenFamilies"); err != nil {
+					return err
+				}
+			}
+
+			_, err = db.Collection("accounts").UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"refreshToken": ""}})
+			return err
+		},
+		// Sessions cannot be turned back into a single token per account,
+		// reverting drops them and every holder logs in again.
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("tokenFamilies").Drop(ctx)
+		},
+	},
+	{
+		Version:     7,
+		Description: "create revoked access tokens collection",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			existing, err := db.ListCollectionNames(ctx, bson.M{"name": "revokedTokens"})
+			if err != nil || len(existing) > 0 {
+				return err
+			}
+			return db.CreateCollection(ctx, "revokedTokens")
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("revokedTokens").Drop(ctx)
+		},
+	},
+	{
+		Version:     8,
+		Description: "create token signing keys collection",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			existing, err := db.ListCollectionNames(ctx, bson.M{"name": "signingKeys"})
+			if err != nil || len(existing) > 0 {
+				return err
+			}
+			return db.CreateCollection(ctx, "signingKeys")
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("signingKeys").Drop(ctx)
+		},
+	},
+	{
+		Version:     9,
+		Description: "replace account group with roles",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			pipeline := mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{"roles": bson.A{bson.M{"$ifNull": bson.A{"$group", "USER"}}}}}},
+				{{Key: "$unset", Value: "group"}},
+			}
+			_, err := db.Collection("accounts").UpdateMany(ctx, bson.M{"roles": bson.M{"$exists": false}}, pipeline)
+			return err
+		},
+		// Accounts holding several roles keep the most powerful one.
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			pipeline := mongo.Pipeline{
+				{{Key: "$set", Value: bson.M{"group": bson.M{"$cond": bson.A{bson.M{"$in": bson.A{"ADMIN", bson.M{"$ifNull": bson.A{"$roles", bson.A{}}}}}, "ADMIN", "USER"}}}}},
+				{{Key: "$unset", Value: "roles"}},
+			}
+			_, err := db.Collection("accounts").UpdateMany(ctx, bson.M{}, pipeline)
+			return err
+		},
+	},
+	{
+		Version:     10,
+		Description: "create password reset tokens collection",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			existing, err := db.ListCollectionNames(ctx, bson.M{"name": "passwordResetTokens"})
+			if err != nil || len(existing) > 0 {
+				return err
+			}
+			return db.CreateCollection(ctx, "passwordResetTokens")
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("passwordResetTokens").Drop(ctx)
+		},
+	},
+	{
+		Version:     11,
+		Description: "add email verification",
+		// Accounts created before verification existed stay usable.
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("accounts").UpdateMany(ctx, bson.M{"emailVerified": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"emailVerified": true}})
+			if err != nil {
+				return err
+			}
+
+			existing, err := db.ListCollectionNames(ctx, bson.M{"name": "emailVerificationTokens"})
+			if err != nil || len(existing) > 0 {
+				return err
+			}
+			return db.CreateCollection(ctx, "emailVerificationTokens")
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := db.Collection("emailVerificationTokens").Drop(ctx); err != nil {
+				return err
+			}
+			_, err := db.Collection("accounts").UpdateMany(ctx, bson.M{}, bson.M{"$unset": bson.M{"emailVerified": ""}})
+			return err
+		},
+	},
+	{
+		Version:     12,
+		Description: "create login throttles collection",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			existing, err := db.ListCollectionNames(ctx, bson.M{"name": "loginThrottles"})
+			if err != nil || len(existing) > 0 {
+				return err
+			}
+			return db.CreateCollection(ctx, "loginThrottles")
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("loginThrottles").Drop(ctx)
+		},
+	},
+	{
+		Version:     13,
+		Description: "create personal access tokens collection",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			existing, err := db.ListCollectionNames(ctx, bson.M{"name": "personalAccessTokens"})
+			if err != nil || len(existing) > 0 {
+				return err
+			}
+			return db.CreateCollection(ctx, "personalAccessTokens")
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return db.Collection("personalAccessTokens").Drop(ctx)
+		},
+	},
+	{
+		Version:     14,
+		Description: "create oauth collections",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range oauthCollections {
+				existing, err := db.ListCollectionNames(ctx, bson.M{"name": name})
+				if err != nil {
+					return err
+				}
+				if len(existing) > 0 {
+					continue
+				}
+				if err := db.CreateCollection(ctx, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			for _, name := range oauthCollections {
+				if err := db.Collection(name).Drop(ctx); err != nil {
+					return err
+				}
+			}
+			_, err := db.Collection("tokenFamilies").UpdateMany(ctx, bson.M{"clientId": bson.M{"$exists": true}}, bson.M{"$set": bson.M{"revoked": true}})
+			return err
+		},
+	},
+	{
+		Version:     15,
+		Description: "check unique keys before their indexes are built",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			var problems []string
+			for _, key := range uniqueKeys {
+				duplicates, err := findDuplicates(ctx, db.Collection(key.collection), key.fields)
+				if err != nil {
+					return err
+				}
+				problems = append(problems, duplicates...)
+			}
+			if len(problems) > 0 {
+				return errors.New("resolve these duplicates, the unique indexes cannot be built until then: " + strings.Join(problems, "; "))
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return nil
+		},
+	},
+}
+
+var oauthCollections = []string{"oauthClients", "oauthConsents", "oauthAuthorizationCodes"}
+
+// uniqueKeys are the fields the unique indexes of the repositories are built
+// on, which documents written before the indexes existed may share.
+var uniqueKeys = []struct {
+	collection string
+	fields     []string
+}{
+	{"accounts", []string{"email"}},
+	{"accounts", []string{"accountId"}},
+	{"runs", []string{"accountId", "runId"}},
+	{"tokenFamilies", []string{"familyId"}},
+	{"revokedTokens", []string{"tokenId"}},
+	{"signingKeys", []string{"kid"}},
+	{"passwordResetTokens", []string{"tokenHash"}},
+	{"emailVerificationTokens", []string{"tokenHash"}},
+	{"loginThrottles", []string{"kind", "value"}},
+	{"personalAccessTokens", []string{"tokenId"}},
+	{"personalAccessTokens", []string{"tokenHash"}},
+	{"personalAccessTokens", []string{"accountId", "name"}},
+	{"oauthClients", []string{"clientId"}},
+	{"oauthConsents", []string{"accountId", "clientId"}},
+	{"oauthAuthorizationCodes", []string{"codeHash"}},
+}
+
+// maxDuplicatesReported bounds how many duplicated keys of one index are
+// listed, the first ones are enough to see what went wrong.
+const maxDuplicatesReported = 20
+
+// findDuplicates describes the values of fields that more than one document
+// of collection shares, along with the ids of those documents.
+func findDuplicates(ctx context.Context, collection *mongo.Collection, fields []string) ([]string, error) {
+	key := bson.D{}
+	for _, field := range fields {
+		key = append(key, bson.E{Key: field, Value: "$" + field})
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: key},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+		{{Key: "$limit", Value: maxDuplicatesReported}},
+	}
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var groups []struct {
+		Key   bson.M        `bson:"_id"`
+		Count int           `bson:"count"`
+		Ids   []interface{} `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	duplicates := make([]string, 0, len(groups))
+	for _, group := range groups {
+		duplicates = append(duplicates, fmt.Sprintf("%s %v shared by %d documents %v", collection.Name(), group.Key, group.Count, group.Ids))
+	}
+	return duplicates, nil
+}
+
+// unitsVersion marks runs with the units they are stored in, 0 for the
+// unitless values and 1 for metres. Runs written by the server carry no
+// marker and are stored in metres, so Up only converts runs not marked 1 and
+// Down only converts runs not marked 0. Either can be run again after a
+// partial failure without scaling a run twice.
+func scaleRuns(ctx context.Context, db *mongo.Database, distance float64, pace float64, to int) error {
+	scale := func(field string, factor float64) bson.M {
+		return bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$type": "$" + field}, "missing"}},
+			"$$REMOVE",
+			bson.M{"$multiply": bson.A{"$" + field, factor}},
+		}}
+	}
+	pipeline := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"distance":     scale("distance", distance),
+		"pace":         scale("pace", pace),
+		"unitsVersion": to,
+	}}}}
+
+	_, err := db.Collection("runs").UpdateMany(ctx, bson.M{"unitsVersion": bson.M{"$ne": to}}, pipeline)
+	return err
+}
+
+// rewriteField replaces field on every document matched by filter with the
+// result of convert. Values convert cannot handle are logged and unset.
+func rewriteField(ctx context.Context, collection *mongo.Collection, filter bson.M, field string, convert func(bson.RawValue) (interface{}, bool)) error {
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		id := cursor.Current.Lookup("_id")
+		value := cursor.Current.Lookup(field)
+
+		update := bson.M{"$unset": bson.M{field: ""}}
+		if converted, ok := convert(value); ok {
+			update = bson.M{"$set": bson.M{field: converted}}
+		} else {
+			log.Printf("%s %v: cannot convert %s %v, unsetting it", collection.Name(), id, field, value)
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
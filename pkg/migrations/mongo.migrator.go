@@ -0,0 +1,132 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const mongoMigrationsCollection = "migrations"
+
+type MongoMigration struct {
+	Version     int
+	Description string
+	Up          func(context.Context, *mongo.Database) error
+	Down        func(context.Context, *mongo.Database) error
+}
+
+type mongoMigrationRecord struct {
+	Version     int       `bson:"version"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+type MongoMigrator struct {
+	database   *mongo.Database
+	ctx        context.Context
+	migrations []MongoMigration
+}
+
+func NewMongoMigrator(database *mongo.Database, ctx context.Context) *MongoMigrator {
+	return &MongoMigrator{
+		database:   database,
+		ctx:        ctx,
+		migrations: MongoMigrations,
+	}
+}
+
+func (m *MongoMigrator) Up() ([]int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if err := migration.Up(m.ctx, m.database); err != nil {
+			return versions, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+		}
+
+		record := mongoMigrationRecord{migration.Version, migration.Description, time.Now().UTC()}
+		if _, err := m.database.Collection(mongoMigrationsCollection).InsertOne(m.ctx, record); err != nil {
+			return versions, err
+		}
+		versions = append(versions, migration.Version)
+	}
+	return versions, nil
+}
+
+func (m *MongoMigrator) Down() (int, error) {
+	var latest mongoMigrationRecord
+	opt := options.FindOne().SetSort(bson.M{"version": -1})
+
+	err := m.database.Collection(mongoMigrationsCollection).FindOne(m.ctx, bson.M{}, opt).Decode(&latest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, errors.New("no migrations have been applied")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	migration, ok := m.find(latest.Version)
+	if !ok {
+		return 0, fmt.Errorf("migration %d is applied but unknown to this binary", latest.Version)
+	}
+
+	if err := migration.Down(m.ctx, m.database); err != nil {
+		return 0, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+	}
+
+	_, err = m.database.Collection(mongoMigrationsCollection).DeleteOne(m.ctx, bson.M{"version": latest.Version})
+	return latest.Version, err
+}
+
+func (m *MongoMigrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		record, ok := applied[migration.Version]
+		statuses[i] = Status{migration.Version, migration.Description, ok, record.AppliedAt}
+	}
+	return statuses, nil
+}
+
+func (m *MongoMigrator) applied() (map[int]mongoMigrationRecord, error) {
+	var records []mongoMigrationRecord
+
+	cursor, err := m.database.Collection(mongoMigrationsCollection).Find(m.ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(m.ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]mongoMigrationRecord, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func (m *MongoMigrator) find(version int) (MongoMigration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return MongoMigration{}, false
+}
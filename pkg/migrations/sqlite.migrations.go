@@ -0,0 +1,428 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+// SQLiteMigrations is the ordered history of the SQLite schema. Never edit or
+// reorder a released entry, append a new one instead.
+var SQLiteMigrations = []SQLiteMigration{
+	{
+		Version:     1,
+		Description: "create accounts and runs",
+		Up: execSQL(`
+CREATE TABLE accounts (
+	account_id    TEXT PRIMARY KEY,
+	email         TEXT NOT NULL,
+	password      TEXT NOT NULL,
+	first_name    TEXT NOT NULL,
+	last_name     TEXT NOT NULL,
+	refresh_token TEXT NOT NULL DEFAULT '',
+	created_at    INTEGER NOT NULL DEFAULT 0,
+	updated_at    INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX accounts_email ON accounts (email);
+CREATE INDEX accounts_refresh_token ON accounts (refresh_token);
+
+CREATE TABLE runs (
+	run_id     TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL,
+	pace       REAL NOT NULL DEFAULT 0,
+	time       TEXT NOT NULL DEFAULT '',
+	distance   REAL NOT NULL DEFAULT 0,
+	lap        INTEGER NOT NULL DEFAULT 0,
+	incline    REAL NOT NULL DEFAULT 0,
+	created_at INTEGER NOT NULL DEFAULT 0,
+	updated_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX runs_account_id ON runs (account_id);
+`),
+		Down: execSQL(`
+DROP TABLE runs;
+DROP TABLE accounts;
+`),
+	},
+	{
+		Version:     2,
+		Description: "add unique and listing indexes",
+		// Run ids were the primary key, only emails can be shared.
+		Up: func(tx *sql.Tx) error {
+			if err := checkUnique(tx, "accounts", "account_id", "email"); err != nil {
+				return err
+			}
+
+			return execSQL(`
+DROP INDEX accounts_email;
+CREATE UNIQUE INDEX accounts_email ON accounts (email);
+
+DROP INDEX runs_account_id;
+CREATE UNIQUE INDEX runs_account_id_run_id ON runs (account_id, run_id);
+CREATE INDEX runs_account_id_created_at ON runs (account_id, created_at);
+`)(tx)
+		},
+		Down: execSQL(`
+DROP INDEX runs_account_id_created_at;
+DROP INDEX runs_account_id_run_id;
+CREATE INDEX runs_account_id ON runs (account_id);
+
+DROP INDEX accounts_email;
+CREATE INDEX accounts_email ON accounts (email);
+`),
+	}, {
+		Version:     3,
+		Description: "store run time as seconds",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec("ALTER TABLE runs ADD COLUMN seconds REAL NOT NULL DEFAULT 0")
+			if err != nil {
+				return err
+			}
+
+			err = convertRunTimes(tx, "SELECT run_id, time FROM runs", "UPDATE runs SET seconds = ? WHERE run_id = ?",
+				func(value string) (interface{}, bool) {
+					duration, err := models.ParseDuration(value)
+					return duration.Seconds(), err == nil || value == ""
+				})
+			if err != nil {
+				return err
+			}
+
+			return execSQL(`
+ALTER TABLE runs DROP COLUMN time;
+ALTER TABLE runs RENAME COLUMN seconds TO time;
+`)(tx)
+		},
+		Down: func(tx *sql.Tx) error {
+			_, err := tx.Exec("ALTER TABLE runs ADD COLUMN formatted TEXT NOT NULL DEFAULT ''")
+			if err != nil {
+				return err
+			}
+
+			err = convertRunTimes(tx, "SELECT run_id, time FROM runs WHERE time > 0", "UPDATE runs SET formatted = ? WHERE run_id = ?",
+				func(value string) (interface{}, bool) {
+					seconds, err := strconv.ParseFloat(value, 64)
+					return models.DurationFromSeconds(seconds).String(), err == nil
+				})
+			if err != nil {
+				return err
+			}
+
+			return execSQL(`
+ALTER TABLE runs DROP COLUMN time;
+ALTER TABLE runs RENAME COLUMN formatted TO time;
+`)(tx)
+		},
+	},
+	{
+		Version:     4,
+		Description: "add account units and store runs in metres",
+		// Runs were stored without units, they are taken to be kilometres and
+		// km/h, the default for accounts that have no preference.
+		Up: execSQL(`
+ALTER TABLE accounts ADD COLUMN units TEXT NOT NULL DEFAULT 'metric';
+UPDATE runs SET distance = distance * 1000, pace = pace / 3.6;
+`),
+		Down: execSQL(`
+UPDATE runs SET distance = distance / 1000, pace = pace * 3.6;
+ALTER TABLE accounts DROP COLUMN units;
+`),
+	},
+	{
+		Version:     5,
+		Description: "replace run lap count with splits",
+		// A bare lap count carries no per lap data, it is not turned into splits.
+		Up: execSQL(`
+ALTER TABLE runs ADD COLUMN splits TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE runs DROP COLUMN lap;
+`),
+		Down: execSQL(`
+ALTER TABLE runs ADD COLUMN lap INTEGER NOT NULL DEFAULT 0;
+UPDATE runs SET lap = json_array_length(splits);
+ALTER TABLE runs DROP COLUMN splits;
+`),
+	},
+	{
+		Version:     6,
+		Description: "add run elevation gain and track points",
+		Up: execSQL(`
+ALTER TABLE runs ADD COLUMN elevation_gain REAL NOT NULL DEFAULT 0;
+ALTER TABLE runs ADD COLUMN track TEXT NOT NULL DEFAULT '[]';
+`),
+		Down: execSQL(`
+ALTER TABLE runs DROP COLUMN track;
+ALTER TABLE runs DROP COLUMN elevation_gain;
+`),
+	},
+	{
+		Version:     7,
+		Description: "add account group",
+		// "group" is a keyword, the column is prefixed to avoid quoting it.
+		Up:   execSQL("ALTER TABLE accounts ADD COLUMN account_group TEXT NOT NULL DEFAULT 'USER'"),
+		Down: execSQL("ALTER TABLE accounts DROP COLUMN account_group"),
+	},
+	{
+		Version:     8,
+		Description: "track refresh token families instead of the last refresh token",
+		// Refresh tokens stored on accounts are not carried over, their
+		// holders log in again.
+		Up: execSQL(`
+CREATE TABLE token_families (
+	family_id        TEXT PRIMARY KEY,
+	account_id       TEXT NOT NULL,
+	device           TEXT NOT NULL DEFAULT '',
+	current_token_id TEXT NOT NULL,
+	revoked          BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at       INTEGER NOT NULL DEFAULT 0,
+	updated_at       INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX token_families_account_id ON token_families (account_id);
+DROP INDEX accounts_refresh_token;
+ALTER TABLE accounts DROP COLUMN refresh_token;
+`),
+		Down: execSQL(`
+ALTER TABLE accounts ADD COLUMN refresh_token TEXT NOT NULL DEFAULT '';
+CREATE INDEX accounts_refresh_token ON accounts (refresh_token);
+DROP TABLE token_families;
+`),
+	},
+	{
+		Version:     9,
+		Description: "create revoked access tokens",
+		Up: execSQL(`
+CREATE TABLE revoked_tokens (
+	token_id   TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX revoked_tokens_expires_at ON revoked_tokens (expires_at);
+`),
+		Down: execSQL("DROP TABLE revoked_tokens"),
+	},
+	{
+		Version:     10,
+		Description: "create token signing keys",
+		Up: execSQL(`
+CREATE TABLE signing_keys (
+	key_id      TEXT PRIMARY KEY,
+	algorithm   TEXT NOT NULL,
+	private_key BLOB NOT NULL,
+	created_at  INTEGER NOT NULL
+);
+`),
+		Down: execSQL("DROP TABLE signing_keys"),
+	},
+	{
+		Version:     11,
+		Description: "replace account group with roles",
+		Up: execSQL(`
+ALTER TABLE accounts ADD COLUMN roles TEXT NOT NULL DEFAULT '[]';
+UPDATE accounts SET roles = json_array(account_group);
+ALTER TABLE accounts DROP COLUMN account_group;
+`),
+		// Accounts holding several roles keep the most powerful one.
+		Down: execSQL(`
+ALTER TABLE accounts ADD COLUMN account_group TEXT NOT NULL DEFAULT 'USER';
+UPDATE accounts SET account_group = 'ADMIN' WHERE EXISTS (SELECT 1 FROM json_each(accounts.roles) WHERE value = 'ADMIN');
+ALTER TABLE accounts DROP COLUMN roles;
+`),
+	},
+	{
+		Version:     12,
+		Description: "create password reset tokens",
+		Up: execSQL(`
+CREATE TABLE password_reset_tokens (
+	token_hash TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL,
+	expires_at INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX password_reset_tokens_account_id ON password_reset_tokens (account_id);
+`),
+		Down: execSQL("DROP TABLE password_reset_tokens"),
+	},
+	{
+		Version:     13,
+		Description: "add email verification",
+		// Accounts created before verification existed stay usable.
+		Up: execSQL(`
+ALTER TABLE accounts ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 0;
+UPDATE accounts SET email_verified = 1;
+CREATE TABLE email_verification_tokens (
+	token_hash TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL,
+	expires_at INTEGER NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX email_verification_tokens_account_id ON email_verification_tokens (account_id);
+`),
+		Down: execSQL(`
+DROP TABLE email_verification_tokens;
+ALTER TABLE accounts DROP COLUMN email_verified;
+`),
+	},
+	{
+		Version:     14,
+		Description: "add two-factor authentication",
+		Up: execSQL(`
+ALTER TABLE accounts ADD COLUMN totp_enabled INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE accounts ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE accounts ADD COLUMN recovery_codes TEXT NOT NULL DEFAULT '[]';
+`),
+		Down: execSQL(`
+ALTER TABLE accounts DROP COLUMN totp_enabled;
+ALTER TABLE accounts DROP COLUMN totp_secret;
+ALTER TABLE accounts DROP COLUMN totp_last_step;
+ALTER TABLE accounts DROP COLUMN recovery_codes;
+`),
+	},
+	{
+		Version:     15,
+		Description: "create login throttles",
+		Up: execSQL(`
+CREATE TABLE login_throttles (
+	kind         TEXT NOT NULL,
+	value        TEXT NOT NULL,
+	failures     INTEGER NOT NULL,
+	locked_until INTEGER NOT NULL,
+	expires_at   INTEGER NOT NULL,
+	PRIMARY KEY (kind, value)
+);
+CREATE INDEX login_throttles_expires_at ON login_throttles (expires_at);
+`),
+		Down: execSQL("DROP TABLE login_throttles"),
+	},
+	{
+		Version:     16,
+		Description: "create personal access tokens",
+		Up: execSQL(`
+CREATE TABLE personal_access_tokens (
+	token_id     TEXT PRIMARY KEY,
+	account_id   TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	scopes       TEXT NOT NULL DEFAULT '[]',
+	token_hash   TEXT NOT NULL UNIQUE,
+	created_at   INTEGER NOT NULL,
+	expires_at   INTEGER NOT NULL DEFAULT 0,
+	last_used_at INTEGER NOT NULL DEFAULT 0,
+	UNIQUE (account_id, name)
+);
+`),
+		Down: execSQL("DROP TABLE personal_access_tokens"),
+	},
+	{
+		Version:     17,
+		Description: "create oauth clients, consents and authorization codes",
+		Up: execSQL(`
+CREATE TABLE oauth_clients (
+	client_id     TEXT PRIMARY KEY,
+	owner_id      TEXT NOT NULL,
+	name          TEXT NOT NULL,
+	redirect_uris TEXT NOT NULL DEFAULT '[]',
+	scopes        TEXT NOT NULL DEFAULT '[]',
+	secret_hash   TEXT NOT NULL DEFAULT '',
+	created_at    INTEGER NOT NULL
+);
+CREATE INDEX oauth_clients_owner_id ON oauth_clients (owner_id);
+CREATE TABLE oauth_consents (
+	account_id TEXT NOT NULL,
+	client_id  TEXT NOT NULL,
+	scopes     TEXT NOT NULL DEFAULT '[]',
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (account_id, client_id)
+);
+CREATE INDEX oauth_consents_client_id ON oauth_consents (client_id);
+CREATE TABLE oauth_authorization_codes (
+	code_hash      TEXT PRIMARY KEY,
+	client_id      TEXT NOT NULL,
+	account_id     TEXT NOT NULL,
+	redirect_uri   TEXT NOT NULL,
+	scopes         TEXT NOT NULL DEFAULT '[]',
+	code_challenge TEXT NOT NULL,
+	expires_at     INTEGER NOT NULL,
+	created_at     INTEGER NOT NULL
+);
+CREATE INDEX oauth_authorization_codes_expires_at ON oauth_authorization_codes (expires_at);
+ALTER TABLE token_families ADD COLUMN client_id TEXT NOT NULL DEFAULT '';
+`),
+		Down: execSQL(`
+DROP TABLE oauth_clients;
+DROP TABLE oauth_consents;
+DROP TABLE oauth_authorization_codes;
+UPDATE token_families SET revoked = TRUE WHERE client_id != '';
+ALTER TABLE token_families DROP COLUMN client_id;
+`),
+	},
+}
+
+// convertRunTimes rewrites every run selected by query through convert.
+// Values convert cannot handle are logged and left at the column default.
+func convertRunTimes(tx *sql.Tx, query string, update string, convert func(string) (interface{}, bool)) error {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return err
+	}
+
+	converted := make(map[string]interface{})
+	for rows.Next() {
+		var runId, value string
+		if err := rows.Scan(&runId, &value); err != nil {
+			rows.Close()
+			return err
+		}
+
+		result, ok := convert(value)
+		if !ok {
+			log.Printf("run %s: cannot convert time %q, leaving it empty", runId, value)
+			continue
+		}
+		converted[runId] = result
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for runId, value := range converted {
+		if _, err := tx.Exec(update, value, runId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUnique fails when rows of table share a value of column, naming the
+// value and the id of those rows, as the unique index over column cannot be
+// built until they are resolved.
+func checkUnique(tx *sql.Tx, table string, id string, column string) error {
+	rows, err := tx.Query(fmt.Sprintf("SELECT %[3]s, COUNT(*), group_concat(%[2]s, ' ') FROM %[1]s GROUP BY %[3]s HAVING COUNT(*) > 1 LIMIT ?", table, id, column),
+		maxDuplicatesReported)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var value, ids string
+		var count int
+		if err := rows.Scan(&value, &count, &ids); err != nil {
+			return err
+		}
+		problems = append(problems, fmt.Sprintf("%s %s %q shared by %d rows [%s]", table, column, value, count, ids))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return errors.New("resolve these duplicates, the unique indexes cannot be built until then: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
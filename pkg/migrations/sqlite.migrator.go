@@ -0,0 +1,162 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type SQLiteMigration struct {
+	Version     int
+	Description string
+	Up          func(*sql.Tx) error
+	Down        func(*sql.Tx) error
+}
+
+// execSQL builds a migration step that only runs the given statements.
+func execSQL(statements string) func(*sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+type SQLiteMigrator struct {
+	db         *sql.DB
+	migrations []SQLiteMigration
+}
+
+func NewSQLiteMigrator(db *sql.DB) *SQLiteMigrator {
+	return &SQLiteMigrator{
+		db:         db,
+		migrations: SQLiteMigrations,
+	}
+}
+
+func (m *SQLiteMigrator) Up() ([]int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		err := m.inTx(func(tx *sql.Tx) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			_, err := tx.Exec("INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)",
+				migration.Version, migration.Description, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return versions, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+		}
+		versions = append(versions, migration.Version)
+	}
+	return versions, nil
+}
+
+func (m *SQLiteMigrator) Down() (int, error) {
+	if err := m.ensureTable(); err != nil {
+		return 0, err
+	}
+
+	var latest int
+	err := m.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&latest)
+	if err != nil {
+		return 0, err
+	}
+	if latest == 0 {
+		return 0, errors.New("no migrations have been applied")
+	}
+
+	migration, ok := m.find(latest)
+	if !ok {
+		return 0, fmt.Errorf("migration %d is applied but unknown to this binary", latest)
+	}
+
+	err = m.inTx(func(tx *sql.Tx) error {
+		if err := migration.Down(tx); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("migration %d (%s): %w", migration.Version, migration.Description, err)
+	}
+	return latest, nil
+}
+
+func (m *SQLiteMigrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses[i] = Status{migration.Version, migration.Description, ok, appliedAt}
+	}
+	return statuses, nil
+}
+
+func (m *SQLiteMigrator) ensureTable() error {
+	_, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	version     INTEGER PRIMARY KEY,
+	description TEXT NOT NULL,
+	applied_at  INTEGER NOT NULL
+)`)
+	return err
+}
+
+func (m *SQLiteMigrator) applied() (map[int]time.Time, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = time.Unix(appliedAt, 0).UTC()
+	}
+	return applied, rows.Err()
+}
+
+func (m *SQLiteMigrator) find(version int) (SQLiteMigration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return SQLiteMigration{}, false
+}
+
+func (m *SQLiteMigrator) inTx(fn func(*sql.Tx) error) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
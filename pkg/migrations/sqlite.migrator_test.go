@@ -0,0 +1,168 @@
+package migrations
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+func openTestSQLite(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLiteMigrator(t *testing.T) {
+	db := openTestSQLite(t)
+	migrator := NewSQLiteMigrator(db)
+
+	t.Run("status lists every migration as pending on a fresh database", func(t *testing.T) {
+		statuses, err := migrator.Status()
+
+		assert.Nil(t, err)
+		assert.Equal(t, len(SQLiteMigrations), len(Pending(statuses)))
+	})
+
+	t.Run("up applies pending migrations once", func(t *testing.T) {
+		applied, err := migrator.Up()
+		assert.Nil(t, err)
+		assert.Equal(t, len(SQLiteMigrations), len(applied))
+
+		applied, err = migrator.Up()
+		assert.Nil(t, err)
+		assert.Empty(t, applied)
+
+		statuses, _ := migrator.Status()
+		assert.Empty(t, Pending(statuses))
+	})
+
+	t.Run("down reverts the latest migration", func(t *testing.T) {
+		latest := SQLiteMigrations[len(SQLiteMigrations)-1].Version
+
+		reverted, err := migrator.Down()
+		assert.Nil(t, err)
+		assert.Equal(t, latest, reverted)
+
+		statuses, _ := migrator.Status()
+		assert.Equal(t, []Status{statuses[len(statuses)-1]}, Pending(statuses))
+	})
+
+	t.Run("every migration can be reverted and reapplied", func(t *testing.T) {
+		for {
+			if _, err := migrator.Down(); err != nil {
+				assert.ErrorContains(t, err, "no migrations have been applied")
+				break
+			}
+		}
+
+		applied, err := migrator.Up()
+		assert.Nil(t, err)
+		assert.Equal(t, len(SQLiteMigrations), len(applied))
+	})
+}
+
+func TestSQLiteUniqueEmailMigration(t *testing.T) {
+	db := openTestSQLite(t)
+
+	before := &SQLiteMigrator{db: db, migrations: SQLiteMigrations[:1]}
+	_, err := before.Up()
+	assert.Nil(t, err)
+
+	_, err = db.Exec(`INSERT INTO accounts (account_id, email, password, first_name, last_name)
+	VALUES ('1', 'user@example.com', '', '', ''), ('2', 'user@example.com', '', '', ''), ('3', 'other@example.com', '', '', '')`)
+	assert.Nil(t, err)
+
+	migrator := &SQLiteMigrator{db: db, migrations: SQLiteMigrations[:2]}
+	_, err = migrator.Up()
+	assert.ErrorContains(t, err, `accounts email "user@example.com" shared by 2 rows [1 2]`)
+	assert.NotContains(t, err.Error(), "other@example.com")
+
+	_, err = db.Exec("DELETE FROM accounts WHERE account_id = '2'")
+	assert.Nil(t, err)
+	_, err = migrator.Up()
+	assert.Nil(t, err)
+}
+
+func TestSQLiteRunTimeMigration(t *testing.T) {
+	db := openTestSQLite(t)
+
+	before := &SQLiteMigrator{db: db, migrations: SQLiteMigrations[:2]}
+	_, err := before.Up()
+	assert.Nil(t, err)
+
+	_, err = db.Exec(`INSERT INTO runs (run_id, account_id, time) VALUES ('a', '1', '1:02:03'), ('b', '1', 'a while'), ('c', '1', '')`)
+	assert.Nil(t, err)
+
+	migrator := &SQLiteMigrator{db: db, migrations: SQLiteMigrations[:3]}
+	_, err = migrator.Up()
+	assert.Nil(t, err)
+
+	var seconds float64
+	db.QueryRow("SELECT time FROM runs WHERE run_id = 'a'").Scan(&seconds)
+	assert.Equal(t, 3723.0, seconds)
+	db.QueryRow("SELECT time FROM runs WHERE run_id = 'b'").Scan(&seconds)
+	assert.Equal(t, 0.0, seconds)
+
+	_, err = migrator.Down()
+	assert.Nil(t, err)
+
+	var formatted string
+	db.QueryRow("SELECT time FROM runs WHERE run_id = 'a'").Scan(&formatted)
+	assert.Equal(t, "1:02:03", formatted)
+}
+
+func TestSQLiteAccountRolesMigration(t *testing.T) {
+	db := openTestSQLite(t)
+
+	before := &SQLiteMigrator{db: db, migrations: SQLiteMigrations[:10]}
+	_, err := before.Up()
+	assert.Nil(t, err)
+
+	_, err = db.Exec(`INSERT INTO accounts (account_id, email, password, first_name, last_name, account_group)
+	VALUES ('1', 'user@example.com', '', '', '', 'USER'), ('2', 'admin@example.com', '', '', '', 'ADMIN')`)
+	assert.Nil(t, err)
+
+	migrator := &SQLiteMigrator{db: db, migrations: SQLiteMigrations[:11]}
+	_, err = migrator.Up()
+	assert.Nil(t, err)
+
+	var roles string
+	db.QueryRow("SELECT roles FROM accounts WHERE account_id = '2'").Scan(&roles)
+	assert.Equal(t, `["ADMIN"]`, roles)
+
+	_, err = db.Exec(`UPDATE accounts SET roles = '["USER","ADMIN"]' WHERE account_id = '1'`)
+	assert.Nil(t, err)
+	_, err = migrator.Down()
+	assert.Nil(t, err)
+
+	var group string
+	db.QueryRow("SELECT account_group FROM accounts WHERE account_id = '1'").Scan(&group)
+	assert.Equal(t, "ADMIN", group)
+}
+
+func TestSQLiteEmailVerificationMigration(t *testing.T) {
+	db := openTestSQLite(t)
+
+	before := &SQLiteMigrator{db: db, migrations: SQLiteMigrations[:12]}
+	_, err := before.Up()
+	assert.Nil(t, err)
+
+	_, err = db.Exec(`INSERT INTO accounts (account_id, email, password, first_name, last_name)
+	VALUES ('1', 'user@example.com', '', '', '')`)
+	assert.Nil(t, err)
+
+	migrator := &SQLiteMigrator{db: db, migrations: SQLiteMigrations[:13]}
+	_, err = migrator.Up()
+	assert.Nil(t, err)
+
+	var verified bool
+	db.QueryRow("SELECT email_verified FROM accounts WHERE account_id = '1'").Scan(&verified)
+	assert.True(t, verified)
+}
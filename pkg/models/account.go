@@ -3,12 +3,18 @@ package models
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Account struct {
-	AccountId    string              `json:"accountId" bson:"accountId"`
-	Email        string              `json:"email" bson:"email" binding:"required"`
-	Password     string              `json:"password" bson:"password" binding:"required"`
-	FirstName    string              `json:"firstName" bson:"firstName" binding:"required"`
-	LastName     string              `json:"lastName" bson:"lastName" binding:"required"`
-	RefreshToken string              `json:"refreshToken" bson:"refreshToken"`
-	CreatedAt    primitive.Timestamp `json:"createdAt" bson:"createdAt,omitempty"`
-	UpdatedAt    primitive.Timestamp `json:"updatedAt" bson:"updatedAt,omitempty"`
+	AccountId     string              `json:"accountId" bson:"accountId"`
+	Email         string              `json:"email" bson:"email" binding:"required,email"`
+	Password      string              `json:"password" bson:"password" binding:"required"`
+	FirstName     string              `json:"firstName" bson:"firstName" binding:"required"`
+	LastName      string              `json:"lastName" bson:"lastName" binding:"required"`
+	Units         UnitSystem          `json:"units,omitempty" bson:"units,omitempty" binding:"omitempty,oneof=metric imperial"`
+	Roles         []string            `json:"roles,omitempty" bson:"roles"`
+	EmailVerified bool                `json:"emailVerified" bson:"emailVerified"`
+	TOTPEnabled   bool                `json:"totpEnabled" bson:"totpEnabled"`
+	TOTPSecret    string              `json:"-" bson:"totpSecret"`
+	TOTPLastStep  int64               `json:"-" bson:"totpLastStep"`
+	RecoveryCodes []string            `json:"-" bson:"recoveryCodes"`
+	CreatedAt     primitive.Timestamp `json:"createdAt" bson:"createdAt,omitempty"`
+	UpdatedAt     primitive.Timestamp `json:"updatedAt" bson:"updatedAt,omitempty"`
 }
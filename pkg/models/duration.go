@@ -0,0 +1,180 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Duration is the elapsed time of a run. It is written to JSON as "mm:ss" or
+// "h:mm:ss" and stored as seconds.
+type Duration time.Duration
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseDuration accepts "h:mm:ss", "mm:ss" and ISO-8601 durations such as
+// "PT1H2M3S". Seconds may carry a fraction.
+func ParseDuration(value string) (Duration, error) {
+	value = strings.TrimSpace(value)
+	invalid := fmt.Errorf("invalid duration %q: use h:mm:ss, mm:ss or ISO-8601", value)
+
+	if strings.HasPrefix(value, "P") {
+		return parseISODuration(value, invalid)
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, invalid
+	}
+
+	seconds, err := strconv.ParseFloat(parts[len(parts)-1], 64)
+	if err != nil || seconds < 0 || seconds >= 60 || !isDigits(strings.Replace(parts[len(parts)-1], ".", "", 1)) {
+		return 0, invalid
+	}
+
+	var whole []int
+	for _, part := range parts[:len(parts)-1] {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || !isDigits(part) {
+			return 0, invalid
+		}
+		whole = append(whole, n)
+	}
+
+	// "75:00" is a fine way to write a long run, only the hour form bounds minutes.
+	minutes := whole[len(whole)-1]
+	hours := 0
+	if len(whole) == 2 {
+		hours = whole[0]
+		if minutes >= 60 {
+			return 0, invalid
+		}
+	}
+
+	return DurationFromSeconds(float64(hours*3600+minutes*60) + seconds), nil
+}
+
+func parseISODuration(value string, invalid error) (Duration, error) {
+	match := isoDuration.FindStringSubmatch(value)
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, invalid
+	}
+
+	var total float64
+	for i, unit := range []float64{86400, 3600, 60, 1} {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(match[i+1], 64)
+		if err != nil {
+			return 0, invalid
+		}
+		total += n * unit
+	}
+	return DurationFromSeconds(total), nil
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func DurationFromSeconds(seconds float64) Duration {
+	return Duration(math.Round(seconds * float64(time.Second)))
+}
+
+func (d Duration) Seconds() float64 {
+	return time.Duration(d).Seconds()
+}
+
+func (d Duration) Hours() float64 {
+	return time.Duration(d).Hours()
+}
+
+func (d Duration) String() string {
+	total := time.Duration(d).Round(time.Millisecond)
+	hours := int(total / time.Hour)
+	minutes := int(total % time.Hour / time.Minute)
+	seconds := strconv.FormatFloat((total % time.Minute).Seconds(), 'f', -1, 64)
+	if len(strings.Split(seconds, ".")[0]) < 2 {
+		seconds = "0" + seconds
+	}
+
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%s", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%02d:%s", minutes, seconds)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts any format understood by ParseDuration, or a plain
+// number of seconds that is not negative.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		if seconds < 0 {
+			return fmt.Errorf("invalid duration %s: cannot be negative", data)
+		}
+		*d = DurationFromSeconds(seconds)
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("invalid duration %s: use h:mm:ss, mm:ss or ISO-8601", data)
+	}
+
+	parsed, err := ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Duration) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bsontype.Double, bsoncore.AppendDouble(nil, d.Seconds()), nil
+}
+
+// UnmarshalBSONValue reads seconds, and still understands the free-form
+// strings runs were stored with before migration 2.
+func (d *Duration) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bsoncore.Value{Type: t, Data: data}
+
+	switch t {
+	case bsontype.Double:
+		*d = DurationFromSeconds(value.Double())
+	case bsontype.Int32:
+		*d = DurationFromSeconds(float64(value.Int32()))
+	case bsontype.Int64:
+		*d = DurationFromSeconds(float64(value.Int64()))
+	case bsontype.String:
+		parsed, err := ParseDuration(value.StringValue())
+		if err != nil {
+			return err
+		}
+		*d = parsed
+	case bsontype.Null:
+		*d = 0
+	default:
+		return fmt.Errorf("cannot decode %v into a duration", t)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseDuration(t *testing.T) {
+	valid := map[string]time.Duration{
+		"30:00":       30 * time.Minute,
+		"75:30":       75*time.Minute + 30*time.Second,
+		"1:02:03":     time.Hour + 2*time.Minute + 3*time.Second,
+		"00:45.5":     45*time.Second + 500*time.Millisecond,
+		"PT30M":       30 * time.Minute,
+		"PT1H2M3S":    time.Hour + 2*time.Minute + 3*time.Second,
+		"PT90.25S":    90*time.Second + 250*time.Millisecond,
+		"P1DT1H":      25 * time.Hour,
+		" 1:00:00 ":   time.Hour,
+		"PT0S":        0,
+		"0:00:00.001": time.Millisecond,
+	}
+	for input, want := range valid {
+		got, err := ParseDuration(input)
+		assert.Nil(t, err, input)
+		assert.Equal(t, Duration(want), got, input)
+	}
+
+	invalid := []string{"", "30", "thirty minutes", "1:60:00", "30:60", "-1:00", "1:2:3:4", "P", "PT", "P1H", "30:1e1"}
+	for _, input := range invalid {
+		_, err := ParseDuration(input)
+		assert.NotNil(t, err, input)
+	}
+}
+
+func TestDurationString(t *testing.T) {
+	assert.Equal(t, "30:00", Duration(30*time.Minute).String())
+	assert.Equal(t, "05:07", Duration(5*time.Minute+7*time.Second).String())
+	assert.Equal(t, "1:02:03", Duration(time.Hour+2*time.Minute+3*time.Second).String())
+	assert.Equal(t, "00:45.5", Duration(45*time.Second+500*time.Millisecond).String())
+}
+
+func TestDurationEncoding(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		var run Run
+		err := json.Unmarshal([]byte(`{"time": "PT1H"}`), &run)
+		assert.Nil(t, err)
+		assert.Equal(t, Duration(time.Hour), run.Time)
+
+		err = json.Unmarshal([]byte(`{"time": 90}`), &run)
+		assert.Nil(t, err)
+		assert.Equal(t, Duration(90*time.Second), run.Time)
+
+		out, _ := json.Marshal(Run{Time: Duration(30 * time.Minute)})
+		assert.JSONEq(t, `{"time": "30:00", "createdAt": {"T": 0, "I": 0}, "updatedAt": {"T": 0, "I": 0}}`, string(out))
+
+		err = json.Unmarshal([]byte(`{"time": "soon"}`), &run)
+		assert.ErrorContains(t, err, "invalid duration")
+
+		err = json.Unmarshal([]byte(`{"time": -1800}`), &run)
+		assert.ErrorContains(t, err, "invalid duration")
+	})
+
+	t.Run("bson", func(t *testing.T) {
+		data, err := bson.Marshal(Run{Time: Duration(30 * time.Minute)})
+		assert.Nil(t, err)
+		assert.Equal(t, 1800.0, bson.Raw(data).Lookup("time").Double())
+
+		var run Run
+		assert.Nil(t, bson.Unmarshal(data, &run))
+		assert.Equal(t, Duration(30*time.Minute), run.Time)
+
+		legacy, _ := bson.Marshal(bson.M{"time": "30:00"})
+		assert.Nil(t, bson.Unmarshal(legacy, &run))
+		assert.Equal(t, Duration(30*time.Minute), run.Time)
+	})
+}
@@ -0,0 +1,12 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// EmailVerificationToken proves that whoever presents it receives mail at the
+// email of the account it was sent for. Only a hash of the token is stored.
+type EmailVerificationToken struct {
+	TokenHash string              `json:"-" bson:"tokenHash"`
+	AccountId string              `json:"accountId" bson:"accountId"`
+	ExpiresAt primitive.Timestamp `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt primitive.Timestamp `json:"createdAt" bson:"createdAt,omitempty"`
+}
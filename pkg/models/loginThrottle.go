@@ -0,0 +1,21 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// What failed logins are counted by: the email logged in to, whether or not
+// it is registered, and the address of the client.
+const (
+	ThrottleEmail = "email"
+	ThrottleIP    = "ip"
+)
+
+// LoginThrottle counts the failed logins of an email or a client address.
+// Past a number of free attempts, logins are locked until LockedUntil, twice
+// as long on every further failure. The record is forgotten at ExpiresAt.
+type LoginThrottle struct {
+	Kind        string              `json:"kind" bson:"kind"`
+	Value       string              `json:"value" bson:"value"`
+	Failures    int                 `json:"failures" bson:"failures"`
+	LockedUntil primitive.Timestamp `json:"lockedUntil" bson:"lockedUntil"`
+	ExpiresAt   primitive.Timestamp `json:"expiresAt" bson:"expiresAt"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// OAuthScopes are the scopes third-party apps may ask for. Changing the
+// account itself stays with its owner.
+var OAuthScopes = []string{ScopeAccountRead, ScopeRunsRead, ScopeRunsWrite}
+
+// IsOAuthScope reports whether third-party apps may be granted scope.
+func IsOAuthScope(scope string) bool {
+	return hasScope(OAuthScopes, scope)
+}
+
+// OAuthClient is a third-party app registered by the account OwnerId. It may
+// send users back to its RedirectURIs only and ask them for its Scopes only.
+// Confidential clients authenticate with a secret, of which only the hash is
+// stored; public clients, such as mobile apps, cannot keep one and rely on
+// PKCE alone.
+type OAuthClient struct {
+	ClientId     string              `json:"clientId" bson:"clientId"`
+	OwnerId      string              `json:"ownerId" bson:"ownerId"`
+	Name         string              `json:"name" bson:"name"`
+	RedirectURIs []string            `json:"redirectUris" bson:"redirectUris"`
+	Scopes       []string            `json:"scopes" bson:"scopes"`
+	SecretHash   string              `json:"-" bson:"secretHash"`
+	CreatedAt    primitive.Timestamp `json:"createdAt" bson:"createdAt"`
+}
+
+// Confidential tells whether the client authenticates with a secret.
+func (c *OAuthClient) Confidential() bool {
+	return c.SecretHash != ""
+}
+
+// OAuthConsent records that an account let a client act for it within
+// Scopes. Apps the account consented to are not asked about again.
+type OAuthConsent struct {
+	AccountId string              `json:"accountId" bson:"accountId"`
+	ClientId  string              `json:"clientId" bson:"clientId"`
+	Scopes    []string            `json:"scopes" bson:"scopes"`
+	CreatedAt primitive.Timestamp `json:"createdAt" bson:"createdAt"`
+	UpdatedAt primitive.Timestamp `json:"updatedAt" bson:"updatedAt"`
+}
+
+// OAuthAuthorizationCode is handed to a client through its redirect URI once
+// an account approved its request. The client trades it for tokens, once and
+// until ExpiresAt, by proving it knows the verifier of CodeChallenge. Only the
+// hash of the code is stored.
+type OAuthAuthorizationCode struct {
+	CodeHash      string              `json:"-" bson:"codeHash"`
+	ClientId      string              `json:"clientId" bson:"clientId"`
+	AccountId     string              `json:"accountId" bson:"accountId"`
+	RedirectURI   string              `json:"redirectUri" bson:"redirectUri"`
+	Scopes        []string            `json:"scopes" bson:"scopes"`
+	CodeChallenge string              `json:"-" bson:"codeChallenge"`
+	ExpiresAt     primitive.Timestamp `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt     primitive.Timestamp `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// PasswordResetToken lets whoever received it choose a new password for the
+// account, once and until ExpiresAt. Only a hash of the token is stored.
+type PasswordResetToken struct {
+	TokenHash string              `json:"-" bson:"tokenHash"`
+	AccountId string              `json:"accountId" bson:"accountId"`
+	ExpiresAt primitive.Timestamp `json:"expiresAt" bson:"expiresAt"`
+	CreatedAt primitive.Timestamp `json:"createdAt" bson:"createdAt,omitempty"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// PersonalAccessTokenPrefix starts every personal access token, telling them
+// apart from JWTs and making leaked ones easy to search for.
+const PersonalAccessTokenPrefix = "cyr_pat_"
+
+// PersonalAccessToken lets scripts act for an account without logging in. It
+// grants Scopes, as far as the roles of the account still do, until ExpiresAt
+// or, when ExpiresAt is zero, until it is revoked. Only the hash of the token
+// is stored, it is shown once when created.
+type PersonalAccessToken struct {
+	TokenId    string              `json:"tokenId" bson:"tokenId"`
+	AccountId  string              `json:"accountId" bson:"accountId"`
+	Name       string              `json:"name" bson:"name"`
+	Scopes     []string            `json:"scopes" bson:"scopes"`
+	TokenHash  string              `json:"-" bson:"tokenHash"`
+	CreatedAt  primitive.Timestamp `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  primitive.Timestamp `json:"expiresAt" bson:"expiresAt"`
+	LastUsedAt primitive.Timestamp `json:"lastUsedAt" bson:"lastUsedAt"`
+}
+
+// Expired tells whether the token has expired at the unix time now.
+func (t *PersonalAccessToken) Expired(now int64) bool {
+	return t.ExpiresAt.T != 0 && now >= int64(t.ExpiresAt.T)
+}
@@ -0,0 +1,11 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// RevokedToken is an access token refused before it expires. It is kept
+// until ExpiresAt, after which the token is refused anyway.
+type RevokedToken struct {
+	TokenId   string              `json:"tokenId" bson:"tokenId"`
+	AccountId string              `json:"accountId" bson:"accountId"`
+	ExpiresAt primitive.Timestamp `json:"expiresAt" bson:"expiresAt"`
+}
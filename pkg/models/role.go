@@ -0,0 +1,78 @@
+package models
+
+import "sort"
+
+// Scopes are the permissions a token grants. Routes declare the scopes they
+// require, accounts are granted them through their roles.
+const (
+	ScopeAccountRead   = "account:read"
+	ScopeAccountWrite  = "account:write"
+	ScopeRunsRead      = "runs:read"
+	ScopeRunsWrite     = "runs:write"
+	ScopeAccountsAdmin = "accounts:admin"
+	// ScopeCoachReadAthletes lets coaches read the runs of the athletes
+	// they coach.
+	ScopeCoachReadAthletes = "coach:read-athletes"
+)
+
+// Roles an account can hold. Every account is a user, coaches may read
+// their athletes and admins may act on every account.
+const (
+	RoleUser  = "USER"
+	RoleCoach = "COACH"
+	RoleAdmin = "ADMIN"
+)
+
+// RoleScopes lists the scopes every role grants.
+var RoleScopes = map[string][]string{
+	RoleUser:  {ScopeAccountRead, ScopeAccountWrite, ScopeRunsRead, ScopeRunsWrite},
+	RoleCoach: {ScopeCoachReadAthletes},
+	RoleAdmin: {ScopeAccountRead, ScopeAccountWrite, ScopeRunsRead, ScopeRunsWrite, ScopeCoachReadAthletes, ScopeAccountsAdmin},
+}
+
+// IsRole reports whether role is one of the known roles.
+func IsRole(role string) bool {
+	_, ok := RoleScopes[role]
+	return ok
+}
+
+// ScopesFor returns the scopes granted by roles, sorted and without
+// duplicates. Unknown roles grant nothing.
+func ScopesFor(roles []string) []string {
+	granted := make(map[string]bool)
+	for _, role := range roles {
+		for _, scope := range RoleScopes[role] {
+			granted[scope] = true
+		}
+	}
+
+	scopes := make([]string, 0, len(granted))
+	for scope := range granted {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// GrantedScopes returns those of scopes that roles grant, in their order.
+func GrantedScopes(roles []string, scopes []string) []string {
+	granted := []string{}
+	for _, scope := range scopes {
+		for _, role := range roles {
+			if hasScope(RoleScopes[role], scope) {
+				granted = append(granted, scope)
+				break
+			}
+		}
+	}
+	return granted
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
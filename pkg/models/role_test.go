@@ -0,0 +1,25 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopesFor(t *testing.T) {
+	assert.Equal(t, []string{"account:read", "account:write", "runs:read", "runs:write"}, ScopesFor([]string{RoleUser}))
+	assert.Equal(t, ScopesFor([]string{RoleAdmin}), ScopesFor([]string{RoleUser, RoleAdmin}))
+	assert.Contains(t, ScopesFor([]string{RoleAdmin}), ScopeAccountsAdmin)
+	assert.Equal(t, []string{"account:read", "account:write", "coach:read-athletes", "runs:read", "runs:write"}, ScopesFor([]string{RoleUser, RoleCoach}))
+	assert.NotContains(t, ScopesFor([]string{RoleUser, RoleCoach}), ScopeAccountsAdmin)
+	assert.Empty(t, ScopesFor([]string{"UNKNOWN"}))
+	assert.Empty(t, ScopesFor(nil))
+}
+
+func TestGrantedScopes(t *testing.T) {
+	requested := []string{ScopeRunsWrite, ScopeAccountsAdmin, ScopeRunsRead, "unknown"}
+
+	assert.Equal(t, []string{ScopeRunsWrite, ScopeRunsRead}, GrantedScopes([]string{RoleUser}, requested))
+	assert.Equal(t, []string{ScopeRunsWrite, ScopeAccountsAdmin, ScopeRunsRead}, GrantedScopes([]string{RoleUser, RoleAdmin}, requested))
+	assert.Empty(t, GrantedScopes(nil, requested))
+}
@@ -5,13 +5,68 @@ import (
 )
 
 type Run struct {
-	Pace      float32             `json:"pace,omitempty" bson:"pace,omitempty"`
-	Time      string              `json:"time,omitempty" bson:"time,omitempty"`
-	Distance  float32             `json:"distance,omitempty" bson:"distance,omitempty"`
-	Lap       int                 `json:"lap,omitempty" bson:"lap,omitempty"`
-	Incline   float32             `json:"incline,omitempty" bson:"incline,omitempty"`
-	RunId     string              `json:"runId,omitempty" bson:"runId,omitempty"`
-	AccountId string              `json:"accountId,omitempty" bson:"accountId,omitempty"`
-	CreatedAt primitive.Timestamp `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
-	UpdatedAt primitive.Timestamp `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	Pace          float32             `json:"pace,omitempty" bson:"pace,omitempty"`
+	Time          Duration            `json:"time,omitempty" bson:"time,omitempty"`
+	Distance      float32             `json:"distance,omitempty" bson:"distance,omitempty"`
+	Incline       float32             `json:"incline,omitempty" bson:"incline,omitempty"`
+	ElevationGain float32             `json:"elevationGain,omitempty" bson:"elevationGain,omitempty"`
+	Splits        []Split             `json:"splits,omitempty" bson:"splits,omitempty" binding:"dive"`
+	Track         []TrackPoint        `json:"track,omitempty" bson:"track,omitempty"`
+	RunId         string              `json:"runId,omitempty" bson:"runId,omitempty"`
+	AccountId     string              `json:"accountId,omitempty" bson:"accountId,omitempty"`
+	Units         UnitSystem          `json:"units,omitempty" bson:"-"`
+	CreatedAt     primitive.Timestamp `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	UpdatedAt     primitive.Timestamp `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// Split is one lap or interval of a run. Any two of distance, time and pace
+// are enough, the third is derived.
+type Split struct {
+	Distance  float32  `json:"distance,omitempty" bson:"distance,omitempty"`
+	Time      Duration `json:"time,omitempty" bson:"time,omitempty"`
+	Pace      float32  `json:"pace,omitempty" bson:"pace,omitempty"`
+	Incline   float32  `json:"incline,omitempty" bson:"incline,omitempty"`
+	HeartRate int      `json:"heartRate,omitempty" bson:"heartRate,omitempty" binding:"omitempty,gte=20,lte=250"`
+}
+
+// ToCanonical converts a run submitted in units to metres and metres per second.
+func (r *Run) ToCanonical(units UnitSystem) {
+	r.Distance = units.ToMetres(r.Distance)
+	r.Pace = units.ToMetresPerSecond(r.Pace)
+	r.ElevationGain = units.ElevationToMetres(r.ElevationGain)
+	for i := range r.Splits {
+		r.Splits[i].ToCanonical(units)
+	}
+	r.Units = ""
+}
+
+// InUnits returns a copy of a stored run with distance and pace expressed in units.
+func (r Run) InUnits(units UnitSystem) *Run {
+	r.Distance = units.FromMetres(r.Distance)
+	r.Pace = units.FromMetresPerSecond(r.Pace)
+	r.ElevationGain = units.ElevationFromMetres(r.ElevationGain)
+
+	if r.Splits != nil {
+		splits := r.Splits
+		r.Splits = make([]Split, len(splits))
+		for i, split := range splits {
+			r.Splits[i] = split.InUnits(units)
+		}
+	}
+
+	r.Units = units
+	return &r
+}
+
+// ToCanonical converts a split submitted in units to metres and metres per second.
+func (s *Split) ToCanonical(units UnitSystem) {
+	s.Distance = units.ToMetres(s.Distance)
+	s.Pace = units.ToMetresPerSecond(s.Pace)
+}
+
+// InUnits returns a copy of a stored split with distance and pace expressed in units.
+func (s Split) InUnits(units UnitSystem) Split {
+	s.Distance = units.FromMetres(s.Distance)
+	s.Pace = units.FromMetresPerSecond(s.Pace)
+	return s
 }
@@ -0,0 +1,18 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// TokenFamily is the chain of refresh tokens issued to one device since it
+// logged in. Every refresh replaces CurrentTokenId; presenting any earlier
+// token of the family means it was stolen, and the family is revoked.
+// Families issued to a third-party app name it by ClientId.
+type TokenFamily struct {
+	FamilyId       string              `json:"familyId" bson:"familyId"`
+	AccountId      string              `json:"accountId" bson:"accountId"`
+	Device         string              `json:"device,omitempty" bson:"device,omitempty"`
+	ClientId       string              `json:"clientId,omitempty" bson:"clientId,omitempty"`
+	CurrentTokenId string              `json:"-" bson:"currentTokenId"`
+	Revoked        bool                `json:"revoked" bson:"revoked"`
+	CreatedAt      primitive.Timestamp `json:"createdAt" bson:"createdAt,omitempty"`
+	UpdatedAt      primitive.Timestamp `json:"updatedAt" bson:"updatedAt,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Algorithms tokens can be signed with.
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// SigningKey is a private key tokens are signed with, identified in token
+// headers and the published key set by its KeyId.
+type SigningKey struct {
+	KeyId     string `json:"kid" bson:"kid"`
+	Algorithm string `json:"alg" bson:"alg"`
+	// PrivateKey is the PKCS #8, DER encoded private key.
+	PrivateKey []byte              `json:"-" bson:"privateKey"`
+	CreatedAt  primitive.Timestamp `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+const earthRadius = 6371000.0
+
+// TrackPoint is one recorded sample of a run. Indoor recordings have no
+// position, their latitude and longitude are left at zero.
+type TrackPoint struct {
+	Time      time.Time `json:"time" bson:"time"`
+	Latitude  float64   `json:"lat,omitempty" bson:"lat,omitempty"`
+	Longitude float64   `json:"lon,omitempty" bson:"lon,omitempty"`
+	Elevation float32   `json:"ele,omitempty" bson:"ele,omitempty"`
+	HeartRate int       `json:"heartRate,omitempty" bson:"heartRate,omitempty"`
+	Cadence   int       `json:"cadence,omitempty" bson:"cadence,omitempty"`
+}
+
+func (p TrackPoint) HasPosition() bool {
+	return p.Latitude != 0 || p.Longitude != 0
+}
+
+// TrackDistance is the length in metres of the path through the positioned
+// points of track.
+func TrackDistance(track []TrackPoint) float64 {
+	var distance float64
+	var previous *TrackPoint
+	for i := range track {
+		if !track[i].HasPosition() {
+			continue
+		}
+		if previous != nil {
+			distance += haversine(*previous, track[i])
+		}
+		previous = &track[i]
+	}
+	return distance
+}
+
+// TrackDuration is the time between the first and the last timed point of track.
+func TrackDuration(track []TrackPoint) Duration {
+	var first, last time.Time
+	for _, point := range track {
+		if point.Time.IsZero() {
+			continue
+		}
+		if first.IsZero() {
+			first = point.Time
+		}
+		last = point.Time
+	}
+	return Duration(last.Sub(first))
+}
+
+// ElevationGain sums every climb between consecutive points of track that
+// carry an elevation.
+func ElevationGain(track []TrackPoint) float64 {
+	var gain float64
+	var previous *TrackPoint
+	for i := range track {
+		if track[i].Elevation == 0 {
+			continue
+		}
+		if previous != nil && track[i].Elevation > previous.Elevation {
+			gain += float64(track[i].Elevation - previous.Elevation)
+		}
+		previous = &track[i]
+	}
+	return gain
+}
+
+func haversine(from TrackPoint, to TrackPoint) float64 {
+	lat1 := from.Latitude * math.Pi / 180
+	lat2 := to.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (to.Longitude - from.Longitude) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
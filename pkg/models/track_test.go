@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrack(t *testing.T) {
+	start := time.Date(2022, 5, 1, 7, 0, 0, 0, time.UTC)
+	track := []TrackPoint{
+		{Time: start, Latitude: 51.5, Longitude: -0.12, Elevation: 10},
+		{Time: start.Add(time.Minute), HeartRate: 140},
+		{Time: start.Add(2 * time.Minute), Latitude: 51.501, Longitude: -0.12, Elevation: 8},
+		{Time: start.Add(3 * time.Minute), Latitude: 51.502, Longitude: -0.12, Elevation: 12},
+	}
+
+	assert.InDelta(t, 222.4, TrackDistance(track), 0.1)
+	assert.Equal(t, Duration(3*time.Minute), TrackDuration(track))
+	assert.Equal(t, 4.0, ElevationGain(track))
+
+	assert.Equal(t, 0.0, TrackDistance(nil))
+	assert.Equal(t, Duration(0), TrackDuration(nil))
+}
+
+func TestElevationUnits(t *testing.T) {
+	assert.Equal(t, float32(100.0), Metric.ElevationFromMetres(100))
+	assert.Equal(t, float32(328.084), Imperial.ElevationFromMetres(100))
+	assert.InDelta(t, 100.0, Imperial.ElevationToMetres(328.084), 0.001)
+}
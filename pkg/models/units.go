@@ -0,0 +1,81 @@
+package models
+
+import "math"
+
+// UnitSystem decides how distances and paces are presented to a caller. Runs
+// are always stored in metres, seconds and metres per second.
+type UnitSystem string
+
+const (
+	Metric   UnitSystem = "metric"
+	Imperial UnitSystem = "imperial"
+)
+
+const (
+	metresPerKilometre = 1000.0
+	metresPerMile      = 1609.344
+	metresPerFoot      = 0.3048
+	secondsPerHour     = 3600.0
+)
+
+func (u UnitSystem) Valid() bool {
+	return u == Metric || u == Imperial
+}
+
+// OrDefault returns u, or Metric when u is unset. Accounts created before
+// units existed have no preference stored.
+func (u UnitSystem) OrDefault() UnitSystem {
+	if u == "" {
+		return Metric
+	}
+	return u
+}
+
+// metres is the length of the unit distances are given in, kilometres or miles.
+func (u UnitSystem) metres() float64 {
+	if u == Imperial {
+		return metresPerMile
+	}
+	return metresPerKilometre
+}
+
+// ToMetres converts a distance in kilometres or miles to metres.
+func (u UnitSystem) ToMetres(distance float32) float32 {
+	return float32(float64(distance) * u.metres())
+}
+
+// FromMetres converts metres to kilometres or miles.
+func (u UnitSystem) FromMetres(metres float32) float32 {
+	return round(float64(metres) / u.metres())
+}
+
+// ToMetresPerSecond converts a pace in km/h or mph to metres per second.
+func (u UnitSystem) ToMetresPerSecond(pace float32) float32 {
+	return float32(float64(pace) * u.metres() / secondsPerHour)
+}
+
+// FromMetresPerSecond converts metres per second to km/h or mph.
+func (u UnitSystem) FromMetresPerSecond(speed float32) float32 {
+	return round(float64(speed) * secondsPerHour / u.metres())
+}
+
+// ElevationToMetres converts an elevation in metres or feet to metres.
+func (u UnitSystem) ElevationToMetres(elevation float32) float32 {
+	if u == Imperial {
+		return float32(float64(elevation) * metresPerFoot)
+	}
+	return elevation
+}
+
+// ElevationFromMetres converts metres to metres or feet.
+func (u UnitSystem) ElevationFromMetres(metres float32) float32 {
+	if u == Imperial {
+		return round(float64(metres) / metresPerFoot)
+	}
+	return round(float64(metres))
+}
+
+// round trims the noise float32 conversions leave behind.
+func round(value float64) float32 {
+	return float32(math.Round(value*1000) / 1000)
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnitSystem(t *testing.T) {
+	assert.Equal(t, float32(5000), Metric.ToMetres(5))
+	assert.Equal(t, float32(1609.344), Imperial.ToMetres(1))
+	assert.Equal(t, float32(3.107), Imperial.FromMetres(5000))
+
+	assert.Equal(t, float32(6.0), Metric.FromMetresPerSecond(Metric.ToMetresPerSecond(6.0)))
+	assert.Equal(t, float32(6.0), Imperial.FromMetresPerSecond(Imperial.ToMetresPerSecond(6.0)))
+	assert.Equal(t, float32(9.656), Metric.FromMetresPerSecond(Imperial.ToMetresPerSecond(6.0)))
+
+	assert.Equal(t, Metric, UnitSystem("").OrDefault())
+	assert.False(t, UnitSystem("furlongs").Valid())
+}
+
+func TestRunUnits(t *testing.T) {
+	run := &Run{Distance: 3.0, Pace: 6.0}
+	run.ToCanonical(Imperial)
+
+	assert.Equal(t, float32(4828.032), run.Distance)
+
+	metric := run.InUnits(Metric)
+	assert.Equal(t, float32(4.828), metric.Distance)
+	assert.Equal(t, float32(9.656), metric.Pace)
+	assert.Equal(t, Metric, metric.Units)
+	assert.Equal(t, float32(4828.032), run.Distance)
+}
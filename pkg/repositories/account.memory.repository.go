@@ -0,0 +1,110 @@
+package repositories
+
+import (
+	"sync"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+// MemoryAccountRepository keeps accounts in process memory. It is meant for
+// development and tests; nothing survives a restart.
+type MemoryAccountRepository struct {
+	mu       sync.RWMutex
+	accounts []models.Account
+}
+
+func NewMemoryAccountRepository() *MemoryAccountRepository {
+	return &MemoryAccountRepository{}
+}
+
+func (r *MemoryAccountRepository) Insert(account *models.Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.accounts {
+		if r.accounts[i].AccountId == account.AccountId || r.accounts[i].Email == account.Email {
+			return ErrDuplicate
+		}
+	}
+
+	r.accounts = append(r.accounts, cloneAccount(account))
+	return nil
+}
+
+func (r *MemoryAccountRepository) FindById(accountId string) (*models.Account, error) {
+	return r.findOne(func(account *models.Account) bool { return account.AccountId == accountId })
+}
+
+func (r *MemoryAccountRepository) FindByEmail(email string) (*models.Account, error) {
+	return r.findOne(func(account *models.Account) bool { return account.Email == email })
+}
+
+func (r *MemoryAccountRepository) FindAll() ([]*models.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := make([]*models.Account, len(r.accounts))
+	for i := range r.accounts {
+		account := cloneAccount(&r.accounts[i])
+		results[i] = &account
+	}
+	return results, nil
+}
+
+func (r *MemoryAccountRepository) Update(account *models.Account) (*models.Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.accounts {
+		if r.accounts[i].AccountId != account.AccountId && r.accounts[i].Email == account.Email {
+			return nil, ErrDuplicate
+		}
+	}
+
+	for i := range r.accounts {
+		if r.accounts[i].AccountId == account.AccountId {
+			r.accounts[i] = cloneAccount(account)
+			result := cloneAccount(account)
+			return &result, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryAccountRepository) Delete(accountId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.accounts {
+		if r.accounts[i].AccountId == accountId {
+			r.accounts = append(r.accounts[:i], r.accounts[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryAccountRepository) findOne(match func(*models.Account) bool) (*models.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := range r.accounts {
+		if match(&r.accounts[i]) {
+			result := cloneAccount(&r.accounts[i])
+			return &result, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// cloneAccount copies account so callers never share slices with the stored value.
+func cloneAccount(account *models.Account) models.Account {
+	clone := *account
+	if account.Roles != nil {
+		clone.Roles = append([]string(nil), account.Roles...)
+	}
+	if account.RecoveryCodes != nil {
+		clone.RecoveryCodes = append([]string(nil), account.RecoveryCodes...)
+	}
+	return clone
+}
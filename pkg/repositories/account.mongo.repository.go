@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoAccountRepository struct {
+	accountcollection *mongo.Collection
+	ctx               context.Context
+}
+
+func NewMongoAccountRepository(accountcollection *mongo.Collection, ctx context.Context) *MongoAccountRepository {
+	return &MongoAccountRepository{
+		accountcollection: accountcollection,
+		ctx:               ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes account lookups and uniqueness rely on.
+// It is safe to call on every startup.
+func (r *MongoAccountRepository) EnsureIndexes() error {
+	_, err := r.accountcollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("email_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "accountId", Value: 1}}, Options: options.Index().SetName("accountId_unique").SetUnique(true)},
+	})
+	return err
+}
+
+func (r *MongoAccountRepository) Insert(account *models.Account) error {
+	_, err := r.accountcollection.InsertOne(r.ctx, account)
+	return mongoError(err)
+}
+
+func (r *MongoAccountRepository) FindById(accountId string) (*models.Account, error) {
+	return r.findOne(bson.M{"accountId": accountId})
+}
+
+func (r *MongoAccountRepository) FindByEmail(email string) (*models.Account, error) {
+	return r.findOne(bson.M{"email": email})
+}
+
+func (r *MongoAccountRepository) FindAll() ([]*models.Account, error) {
+	var results []*models.Account
+
+	cursor, err := r.accountcollection.Find(r.ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(r.ctx, &results)
+	return results, err
+}
+
+func (r *MongoAccountRepository) Update(account *models.Account) (*models.Account, error) {
+	var result *models.Account
+	filter := bson.M{"accountId": account.AccountId}
+
+	upsert := false
+	after := options.After
+	opt := options.FindOneAndUpdateOptions{
+		ReturnDocument: &after,
+		Upsert:         &upsert,
+	}
+
+	updatedAccount := r.accountcollection.FindOneAndUpdate(r.ctx, filter, bson.M{"$set": account}, &opt)
+	if err := updatedAccount.Err(); err != nil {
+		return nil, mongoError(err)
+	}
+
+	err := updatedAccount.Decode(&result)
+	return result, err
+}
+
+func (r *MongoAccountRepository) Delete(accountId string) error {
+	result, err := r.accountcollection.DeleteOne(r.ctx, bson.M{"accountId": accountId})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoAccountRepository) findOne(filter bson.M) (*models.Account, error) {
+	var result *models.Account
+
+	err := r.accountcollection.FindOne(r.ctx, filter).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+// mongoError translates driver errors into the storage-agnostic errors of this package.
+func mongoError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
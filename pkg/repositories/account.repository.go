@@ -0,0 +1,12 @@
+package repositories
+
+import "github.com/croisade/chimichanga/pkg/models"
+
+type AccountRepository interface {
+	Insert(*models.Account) error
+	FindById(string) (*models.Account, error)
+	FindByEmail(string) (*models.Account, error)
+	FindAll() ([]*models.Account, error)
+	Update(*models.Account) (*models.Account, error)
+	Delete(string) error
+}
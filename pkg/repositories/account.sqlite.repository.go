@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sqliteAccountColumns = "account_id, email, password, first_name, last_name, units, roles, email_verified, " +
+	"totp_enabled, totp_secret, totp_last_step, recovery_codes, created_at, updated_at"
+
+type SQLiteAccountRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteAccountRepository(db *sql.DB) *SQLiteAccountRepository {
+	return &SQLiteAccountRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteAccountRepository) Insert(account *models.Account) error {
+	roles, err := marshalArray(account.Roles)
+	if err != nil {
+		return err
+	}
+	recoveryCodes, err := marshalArray(account.RecoveryCodes)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("INSERT INTO accounts ("+sqliteAccountColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		account.AccountId, account.Email, account.Password, account.FirstName, account.LastName,
+		account.Units.OrDefault(), roles, account.EmailVerified,
+		account.TOTPEnabled, account.TOTPSecret, account.TOTPLastStep, recoveryCodes, account.CreatedAt.T, account.UpdatedAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLiteAccountRepository) FindById(accountId string) (*models.Account, error) {
+	return r.findOne("account_id = ?", accountId)
+}
+
+func (r *SQLiteAccountRepository) FindByEmail(email string) (*models.Account, error) {
+	return r.findOne("email = ?", email)
+}
+
+func (r *SQLiteAccountRepository) FindAll() ([]*models.Account, error) {
+	rows, err := r.db.Query("SELECT " + sqliteAccountColumns + " FROM accounts ORDER BY rowid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.Account
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, account)
+	}
+	return results, rows.Err()
+}
+
+func (r *SQLiteAccountRepository) Update(account *models.Account) (*models.Account, error) {
+	roles, err := marshalArray(account.Roles)
+	if err != nil {
+		return nil, err
+	}
+	recoveryCodes, err := marshalArray(account.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.db.Exec(`UPDATE accounts SET email = ?, password = ?, first_name = ?, last_name = ?,
+	units = ?, roles = ?, email_verified = ?, totp_enabled = ?, totp_secret = ?, totp_last_step = ?,
+	recovery_codes = ?, updated_at = ? WHERE account_id = ?`,
+		account.Email, account.Password, account.FirstName, account.LastName,
+		account.Units.OrDefault(), roles, account.EmailVerified, account.TOTPEnabled, account.TOTPSecret,
+		account.TOTPLastStep, recoveryCodes, account.UpdatedAt.T, account.AccountId)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+
+	if updated, _ := result.RowsAffected(); updated != 1 {
+		return nil, ErrNotFound
+	}
+	return r.FindById(account.AccountId)
+}
+
+func (r *SQLiteAccountRepository) Delete(accountId string) error {
+	result, err := r.db.Exec("DELETE FROM accounts WHERE account_id = ?", accountId)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteAccountRepository) findOne(where string, args ...interface{}) (*models.Account, error) {
+	row := r.db.QueryRow("SELECT "+sqliteAccountColumns+" FROM accounts WHERE "+where+" LIMIT 1", args...)
+
+	account, err := scanAccount(row)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return account, nil
+}
+
+func scanAccount(row rowScanner) (*models.Account, error) {
+	var account models.Account
+	var roles, recoveryCodes string
+	var createdAt, updatedAt uint32
+
+	err := row.Scan(&account.AccountId, &account.Email, &account.Password, &account.FirstName, &account.LastName,
+		&account.Units, &roles, &account.EmailVerified,
+		&account.TOTPEnabled, &account.TOTPSecret, &account.TOTPLastStep, &recoveryCodes, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(roles), &account.Roles); err != nil {
+		return nil, err
+	}
+	if len(account.Roles) == 0 {
+		account.Roles = nil
+	}
+	if err := json.Unmarshal([]byte(recoveryCodes), &account.RecoveryCodes); err != nil {
+		return nil, err
+	}
+	if len(account.RecoveryCodes) == 0 {
+		account.RecoveryCodes = nil
+	}
+
+	account.CreatedAt = primitive.Timestamp{T: createdAt}
+	account.UpdatedAt = primitive.Timestamp{T: updatedAt}
+	return &account, nil
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"sync"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+// MemoryEmailVerificationTokenRepository keeps verification tokens in process
+// memory. It is meant for development and tests; nothing survives a restart.
+type MemoryEmailVerificationTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]models.EmailVerificationToken
+}
+
+func NewMemoryEmailVerificationTokenRepository() *MemoryEmailVerificationTokenRepository {
+	return &MemoryEmailVerificationTokenRepository{tokens: make(map[string]models.EmailVerificationToken)}
+}
+
+func (r *MemoryEmailVerificationTokenRepository) Insert(token *models.EmailVerificationToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tokens[token.TokenHash]; ok {
+		return ErrDuplicate
+	}
+	r.tokens[token.TokenHash] = *token
+	return nil
+}
+
+func (r *MemoryEmailVerificationTokenRepository) FindByAccount(accountId string) (*models.EmailVerificationToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var latest *models.EmailVerificationToken
+	for _, token := range r.tokens {
+		if token.AccountId == accountId && (latest == nil || token.CreatedAt.T > latest.CreatedAt.T) {
+			token := token
+			latest = &token
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (r *MemoryEmailVerificationTokenRepository) Consume(tokenHash string) (*models.EmailVerificationToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(r.tokens, tokenHash)
+	return &token, nil
+}
+
+func (r *MemoryEmailVerificationTokenRepository) DeleteByAccount(accountId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for tokenHash, token := range r.tokens {
+		if token.AccountId == accountId {
+			delete(r.tokens, tokenHash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoEmailVerificationTokenRepository struct {
+	tokenCollection *mongo.Collection
+	ctx             context.Context
+}
+
+func NewMongoEmailVerificationTokenRepository(tokenCollection *mongo.Collection, ctx context.Context) *MongoEmailVerificationTokenRepository {
+	return &MongoEmailVerificationTokenRepository{
+		tokenCollection: tokenCollection,
+		ctx:             ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes verification token lookups rely on.
+// It is safe to call on every startup.
+func (r *MongoEmailVerificationTokenRepository) EnsureIndexes() error {
+	_, err := r.tokenCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetName("tokenHash_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "accountId", Value: 1}, {Key: "createdAt", Value: -1}}, Options: options.Index().SetName("accountId_createdAt")},
+	})
+	return err
+}
+
+func (r *MongoEmailVerificationTokenRepository) Insert(token *models.EmailVerificationToken) error {
+	_, err := r.tokenCollection.InsertOne(r.ctx, token)
+	return mongoError(err)
+}
+
+func (r *MongoEmailVerificationTokenRepository) FindByAccount(accountId string) (*models.EmailVerificationToken, error) {
+	var result *models.EmailVerificationToken
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	err := r.tokenCollection.FindOne(r.ctx, bson.M{"accountId": accountId}, opts).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+func (r *MongoEmailVerificationTokenRepository) Consume(tokenHash string) (*models.EmailVerificationToken, error) {
+	var result *models.EmailVerificationToken
+
+	err := r.tokenCollection.FindOneAndDelete(r.ctx, bson.M{"tokenHash": tokenHash}).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+func (r *MongoEmailVerificationTokenRepository) DeleteByAccount(accountId string) error {
+	_, err := r.tokenCollection.DeleteMany(r.ctx, bson.M{"accountId": accountId})
+	return err
+}
@@ -0,0 +1,13 @@
+package repositories
+
+import "github.com/croisade/chimichanga/pkg/models"
+
+type EmailVerificationTokenRepository interface {
+	Insert(*models.EmailVerificationToken) error
+	// FindByAccount returns the token most recently sent for the account.
+	FindByAccount(accountId string) (*models.EmailVerificationToken, error)
+	// Consume removes the token with the given hash and returns it, so that
+	// it can be used only once. It returns ErrNotFound for unknown tokens.
+	Consume(tokenHash string) (*models.EmailVerificationToken, error)
+	DeleteByAccount(accountId string) error
+}
@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+type SQLiteEmailVerificationTokenRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteEmailVerificationTokenRepository(db *sql.DB) *SQLiteEmailVerificationTokenRepository {
+	return &SQLiteEmailVerificationTokenRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteEmailVerificationTokenRepository) Insert(token *models.EmailVerificationToken) error {
+	_, err := r.db.Exec("INSERT INTO email_verification_tokens (token_hash, account_id, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		token.TokenHash, token.AccountId, token.ExpiresAt.T, token.CreatedAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLiteEmailVerificationTokenRepository) FindByAccount(accountId string) (*models.EmailVerificationToken, error) {
+	token := models.EmailVerificationToken{AccountId: accountId}
+
+	err := r.db.QueryRow("SELECT token_hash, expires_at, created_at FROM email_verification_tokens WHERE account_id = ? ORDER BY created_at DESC LIMIT 1", accountId).
+		Scan(&token.TokenHash, &token.ExpiresAt.T, &token.CreatedAt.T)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return &token, nil
+}
+
+func (r *SQLiteEmailVerificationTokenRepository) Consume(tokenHash string) (*models.EmailVerificationToken, error) {
+	token := models.EmailVerificationToken{TokenHash: tokenHash}
+
+	err := r.db.QueryRow("DELETE FROM email_verification_tokens WHERE token_hash = ? RETURNING account_id, expires_at, created_at", tokenHash).
+		Scan(&token.AccountId, &token.ExpiresAt.T, &token.CreatedAt.T)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return &token, nil
+}
+
+func (r *SQLiteEmailVerificationTokenRepository) DeleteByAccount(accountId string) error {
+	_, err := r.db.Exec("DELETE FROM email_verification_tokens WHERE account_id = ?", accountId)
+	return err
+}
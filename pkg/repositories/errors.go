@@ -0,0 +1,8 @@
+package repositories
+
+import "errors"
+
+var (
+	ErrNotFound  = errors.New("no documents in result")
+	ErrDuplicate = errors.New("duplicate key")
+)
@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryLoginThrottleRepository keeps login throttles in process memory. It
+// is meant for development and tests; nothing survives a restart.
+type MemoryLoginThrottleRepository struct {
+	mu        sync.Mutex
+	throttles map[string]models.LoginThrottle
+}
+
+func NewMemoryLoginThrottleRepository() *MemoryLoginThrottleRepository {
+	return &MemoryLoginThrottleRepository{throttles: make(map[string]models.LoginThrottle)}
+}
+
+func (r *MemoryLoginThrottleRepository) Find(kind string, value string) (*models.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	throttle, ok := r.throttles[throttleKey(kind, value)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &throttle, nil
+}
+
+func (r *MemoryLoginThrottleRepository) Save(throttle *models.LoginThrottle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.throttles[throttleKey(throttle.Kind, throttle.Value)] = *throttle
+	return nil
+}
+
+func (r *MemoryLoginThrottleRepository) FindAll() ([]*models.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := make([]*models.LoginThrottle, 0, len(r.throttles))
+	for _, throttle := range r.throttles {
+		throttle := throttle
+		results = append(results, &throttle)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return throttleKey(results[i].Kind, results[i].Value) < throttleKey(results[j].Kind, results[j].Value)
+	})
+	return results, nil
+}
+
+func (r *MemoryLoginThrottleRepository) Delete(kind string, value string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := throttleKey(kind, value)
+	if _, ok := r.throttles[key]; !ok {
+		return ErrNotFound
+	}
+	delete(r.throttles, key)
+	return nil
+}
+
+func (r *MemoryLoginThrottleRepository) DeleteExpired(before primitive.Timestamp) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, throttle := range r.throttles {
+		if throttle.ExpiresAt.T < before.T {
+			delete(r.throttles, key)
+		}
+	}
+	return nil
+}
+
+func throttleKey(kind string, value string) string {
+	return kind + "\x00" + value
+}
@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoLoginThrottleRepository struct {
+	throttleCollection *mongo.Collection
+	ctx                context.Context
+}
+
+func NewMongoLoginThrottleRepository(throttleCollection *mongo.Collection, ctx context.Context) *MongoLoginThrottleRepository {
+	return &MongoLoginThrottleRepository{
+		throttleCollection: throttleCollection,
+		ctx:                ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes throttle lookups rely on.
+// It is safe to call on every startup.
+func (r *MongoLoginThrottleRepository) EnsureIndexes() error {
+	_, err := r.throttleCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "kind", Value: 1}, {Key: "value", Value: 1}}, Options: options.Index().SetName("kind_value_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetName("expiresAt")},
+	})
+	return err
+}
+
+func (r *MongoLoginThrottleRepository) Find(kind string, value string) (*models.LoginThrottle, error) {
+	var result *models.LoginThrottle
+
+	err := r.throttleCollection.FindOne(r.ctx, bson.M{"kind": kind, "value": value}).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+func (r *MongoLoginThrottleRepository) Save(throttle *models.LoginThrottle) error {
+	filter := bson.M{"kind": throttle.Kind, "value": throttle.Value}
+	_, err := r.throttleCollection.ReplaceOne(r.ctx, filter, throttle, options.Replace().SetUpsert(true))
+	return mongoError(err)
+}
+
+func (r *MongoLoginThrottleRepository) FindAll() ([]*models.LoginThrottle, error) {
+	var results []*models.LoginThrottle
+
+	opts := options.Find().SetSort(bson.D{{Key: "kind", Value: 1}, {Key: "value", Value: 1}})
+	cursor, err := r.throttleCollection.Find(r.ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(r.ctx, &results)
+	return results, err
+}
+
+func (r *MongoLoginThrottleRepository) Delete(kind string, value string) error {
+	result, err := r.throttleCollection.DeleteOne(r.ctx, bson.M{"kind": kind, "value": value})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoLoginThrottleRepository) DeleteExpired(before primitive.Timestamp) error {
+	_, err := r.throttleCollection.DeleteMany(r.ctx, bson.M{"expiresAt": bson.M{"$lt": before}})
+	return err
+}
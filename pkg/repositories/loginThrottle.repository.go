@@ -0,0 +1,16 @@
+package repositories
+
+import (
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LoginThrottleRepository interface {
+	Find(kind string, value string) (*models.LoginThrottle, error)
+	// Save inserts the throttle or replaces the one of the same kind and value.
+	Save(*models.LoginThrottle) error
+	FindAll() ([]*models.LoginThrottle, error)
+	Delete(kind string, value string) error
+	// DeleteExpired forgets every throttle that expired before the given time.
+	DeleteExpired(primitive.Timestamp) error
+}
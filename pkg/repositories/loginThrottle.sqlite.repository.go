@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sqliteLoginThrottleColumns = "kind, value, failures, locked_until, expires_at"
+
+type SQLiteLoginThrottleRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteLoginThrottleRepository(db *sql.DB) *SQLiteLoginThrottleRepository {
+	return &SQLiteLoginThrottleRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteLoginThrottleRepository) Find(kind string, value string) (*models.LoginThrottle, error) {
+	row := r.db.QueryRow("SELECT "+sqliteLoginThrottleColumns+" FROM login_throttles WHERE kind = ? AND value = ?", kind, value)
+
+	throttle, err := scanLoginThrottle(row)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return throttle, nil
+}
+
+func (r *SQLiteLoginThrottleRepository) Save(throttle *models.LoginThrottle) error {
+	_, err := r.db.Exec("INSERT OR REPLACE INTO login_throttles ("+sqliteLoginThrottleColumns+") VALUES (?, ?, ?, ?, ?)",
+		throttle.Kind, throttle.Value, throttle.Failures, throttle.LockedUntil.T, throttle.ExpiresAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLiteLoginThrottleRepository) FindAll() ([]*models.LoginThrottle, error) {
+	rows, err := r.db.Query("SELECT " + sqliteLoginThrottleColumns + " FROM login_throttles ORDER BY kind, value")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.LoginThrottle
+	for rows.Next() {
+		throttle, err := scanLoginThrottle(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, throttle)
+	}
+	return results, rows.Err()
+}
+
+func (r *SQLiteLoginThrottleRepository) Delete(kind string, value string) error {
+	result, err := r.db.Exec("DELETE FROM login_throttles WHERE kind = ? AND value = ?", kind, value)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteLoginThrottleRepository) DeleteExpired(before primitive.Timestamp) error {
+	_, err := r.db.Exec("DELETE FROM login_throttles WHERE expires_at < ?", before.T)
+	return err
+}
+
+func scanLoginThrottle(row rowScanner) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+
+	err := row.Scan(&throttle.Kind, &throttle.Value, &throttle.Failures, &throttle.LockedUntil.T, &throttle.ExpiresAt.T)
+	if err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
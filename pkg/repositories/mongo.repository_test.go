@@ -0,0 +1,41 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// openTestMongo returns a database of its own on the server at MONGO_TEST_URI,
+// dropped once the test is over. Tests are skipped when it is not set.
+func openTestMongo(t *testing.T) *mongo.Database {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	db := client.Database(fmt.Sprintf("test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		db.Drop(ctx)
+		client.Disconnect(ctx)
+	})
+	return db
+}
+
+func TestMongoAccountRepository(t *testing.T) {
+	repository := NewMongoAccountRepository(openTestMongo(t).Collection("accounts"), context.Background())
+	if err := repository.EnsureIndexes(); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	testAccountRepository(t, repository)
+}
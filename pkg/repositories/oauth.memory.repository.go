@@ -0,0 +1,216 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryOAuthClientRepository keeps OAuth clients in process memory. It is
+// meant for development and tests; nothing survives a restart.
+type MemoryOAuthClientRepository struct {
+	mu      sync.RWMutex
+	clients []models.OAuthClient
+}
+
+func NewMemoryOAuthClientRepository() *MemoryOAuthClientRepository {
+	return &MemoryOAuthClientRepository{}
+}
+
+func (r *MemoryOAuthClientRepository) Insert(client *models.OAuthClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.clients {
+		if existing.ClientId == client.ClientId {
+			return ErrDuplicate
+		}
+	}
+	r.clients = append(r.clients, copyOAuthClient(*client))
+	return nil
+}
+
+func (r *MemoryOAuthClientRepository) FindById(clientId string) (*models.OAuthClient, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, client := range r.clients {
+		if client.ClientId == clientId {
+			found := copyOAuthClient(client)
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryOAuthClientRepository) FindByOwner(ownerId string) ([]*models.OAuthClient, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []*models.OAuthClient{}
+	for _, client := range r.clients {
+		if client.OwnerId == ownerId {
+			found := copyOAuthClient(client)
+			results = append(results, &found)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].CreatedAt.T < results[j].CreatedAt.T
+	})
+	return results, nil
+}
+
+func (r *MemoryOAuthClientRepository) Delete(ownerId string, clientId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, client := range r.clients {
+		if client.OwnerId == ownerId && client.ClientId == clientId {
+			r.clients = append(r.clients[:i], r.clients[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func copyOAuthClient(client models.OAuthClient) models.OAuthClient {
+	client.RedirectURIs = append([]string(nil), client.RedirectURIs...)
+	client.Scopes = append([]string(nil), client.Scopes...)
+	return client
+}
+
+// MemoryOAuthConsentRepository keeps OAuth consents in process memory. It is
+// meant for development and tests; nothing survives a restart.
+type MemoryOAuthConsentRepository struct {
+	mu       sync.RWMutex
+	consents []models.OAuthConsent
+}
+
+func NewMemoryOAuthConsentRepository() *MemoryOAuthConsentRepository {
+	return &MemoryOAuthConsentRepository{}
+}
+
+func (r *MemoryOAuthConsentRepository) Save(consent *models.OAuthConsent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	saved := *consent
+	saved.Scopes = append([]string(nil), consent.Scopes...)
+	for i := range r.consents {
+		if r.consents[i].AccountId == consent.AccountId && r.consents[i].ClientId == consent.ClientId {
+			r.consents[i] = saved
+			return nil
+		}
+	}
+	r.consents = append(r.consents, saved)
+	return nil
+}
+
+func (r *MemoryOAuthConsentRepository) Find(accountId string, clientId string) (*models.OAuthConsent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, consent := range r.consents {
+		if consent.AccountId == accountId && consent.ClientId == clientId {
+			consent.Scopes = append([]string(nil), consent.Scopes...)
+			return &consent, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryOAuthConsentRepository) FindByAccount(accountId string) ([]*models.OAuthConsent, error) {
+	consents := r.filter(func(consent models.OAuthConsent) bool {
+		return consent.AccountId == accountId
+	})
+	sort.SliceStable(consents, func(i, j int) bool {
+		return consents[i].CreatedAt.T < consents[j].CreatedAt.T
+	})
+	return consents, nil
+}
+
+func (r *MemoryOAuthConsentRepository) FindByClient(clientId string) ([]*models.OAuthConsent, error) {
+	return r.filter(func(consent models.OAuthConsent) bool {
+		return consent.ClientId == clientId
+	}), nil
+}
+
+func (r *MemoryOAuthConsentRepository) Delete(accountId string, clientId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, consent := range r.consents {
+		if consent.AccountId == accountId && consent.ClientId == clientId {
+			r.consents = append(r.consents[:i], r.consents[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryOAuthConsentRepository) filter(match func(models.OAuthConsent) bool) []*models.OAuthConsent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []*models.OAuthConsent{}
+	for _, consent := range r.consents {
+		if match(consent) {
+			found := consent
+			found.Scopes = append([]string(nil), consent.Scopes...)
+			results = append(results, &found)
+		}
+	}
+	return results
+}
+
+// MemoryOAuthAuthorizationCodeRepository keeps authorization codes in process
+// memory. It is meant for development and tests; nothing survives a restart.
+type MemoryOAuthAuthorizationCodeRepository struct {
+	mu    sync.Mutex
+	codes map[string]models.OAuthAuthorizationCode
+}
+
+func NewMemoryOAuthAuthorizationCodeRepository() *MemoryOAuthAuthorizationCodeRepository {
+	return &MemoryOAuthAuthorizationCodeRepository{
+		codes: make(map[string]models.OAuthAuthorizationCode),
+	}
+}
+
+func (r *MemoryOAuthAuthorizationCodeRepository) Insert(code *models.OAuthAuthorizationCode) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.codes[code.CodeHash]; ok {
+		return ErrDuplicate
+	}
+	inserted := *code
+	inserted.Scopes = append([]string(nil), code.Scopes...)
+	r.codes[code.CodeHash] = inserted
+	return nil
+}
+
+func (r *MemoryOAuthAuthorizationCodeRepository) Consume(codeHash string) (*models.OAuthAuthorizationCode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	code, ok := r.codes[codeHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(r.codes, codeHash)
+	return &code, nil
+}
+
+func (r *MemoryOAuthAuthorizationCodeRepository) DeleteExpired(before primitive.Timestamp) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for codeHash, code := range r.codes {
+		if code.ExpiresAt.T < before.T {
+			delete(r.codes, codeHash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoOAuthClientRepository struct {
+	clientCollection *mongo.Collection
+	ctx              context.Context
+}
+
+func NewMongoOAuthClientRepository(clientCollection *mongo.Collection, ctx context.Context) *MongoOAuthClientRepository {
+	return &MongoOAuthClientRepository{
+		clientCollection: clientCollection,
+		ctx:              ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes client lookups rely on. It is safe to
+// call on every startup.
+func (r *MongoOAuthClientRepository) EnsureIndexes() error {
+	_, err := r.clientCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "clientId", Value: 1}}, Options: options.Index().SetName("clientId_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "ownerId", Value: 1}}, Options: options.Index().SetName("ownerId")},
+	})
+	return err
+}
+
+func (r *MongoOAuthClientRepository) Insert(client *models.OAuthClient) error {
+	_, err := r.clientCollection.InsertOne(r.ctx, client)
+	return mongoError(err)
+}
+
+func (r *MongoOAuthClientRepository) FindById(clientId string) (*models.OAuthClient, error) {
+	var result *models.OAuthClient
+
+	err := r.clientCollection.FindOne(r.ctx, bson.M{"clientId": clientId}).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+func (r *MongoOAuthClientRepository) FindByOwner(ownerId string) ([]*models.OAuthClient, error) {
+	results := []*models.OAuthClient{}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.clientCollection.Find(r.ctx, bson.M{"ownerId": ownerId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(r.ctx, &results)
+	return results, err
+}
+
+func (r *MongoOAuthClientRepository) Delete(ownerId string, clientId string) error {
+	result, err := r.clientCollection.DeleteOne(r.ctx, bson.M{"ownerId": ownerId, "clientId": clientId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type MongoOAuthConsentRepository struct {
+	consentCollection *mongo.Collection
+	ctx               context.Context
+}
+
+func NewMongoOAuthConsentRepository(consentCollection *mongo.Collection, ctx context.Context) *MongoOAuthConsentRepository {
+	return &MongoOAuthConsentRepository{
+		consentCollection: consentCollection,
+		ctx:               ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes consent lookups and the one consent per
+// account and client rely on. It is safe to call on every startup.
+func (r *MongoOAuthConsentRepository) EnsureIndexes() error {
+	_, err := r.consentCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "accountId", Value: 1}, {Key: "clientId", Value: 1}}, Options: options.Index().SetName("accountId_clientId_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "clientId", Value: 1}}, Options: options.Index().SetName("clientId")},
+	})
+	return err
+}
+
+func (r *MongoOAuthConsentRepository) Save(consent *models.OAuthConsent) error {
+	filter := bson.M{"accountId": consent.AccountId, "clientId": consent.ClientId}
+
+	_, err := r.consentCollection.ReplaceOne(r.ctx, filter, consent, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *MongoOAuthConsentRepository) Find(accountId string, clientId string) (*models.OAuthConsent, error) {
+	var result *models.OAuthConsent
+
+	err := r.consentCollection.FindOne(r.ctx, bson.M{"accountId": accountId, "clientId": clientId}).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+func (r *MongoOAuthConsentRepository) FindByAccount(accountId string) ([]*models.OAuthConsent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	return r.find(bson.M{"accountId": accountId}, opts)
+}
+
+func (r *MongoOAuthConsentRepository) FindByClient(clientId string) ([]*models.OAuthConsent, error) {
+	return r.find(bson.M{"clientId": clientId})
+}
+
+func (r *MongoOAuthConsentRepository) Delete(accountId string, clientId string) error {
+	result, err := r.consentCollection.DeleteOne(r.ctx, bson.M{"accountId": accountId, "clientId": clientId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoOAuthConsentRepository) find(filter bson.M, opts ...*options.FindOptions) ([]*models.OAuthConsent, error) {
+	results := []*models.OAuthConsent{}
+
+	cursor, err := r.consentCollection.Find(r.ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(r.ctx, &results)
+	return results, err
+}
+
+type MongoOAuthAuthorizationCodeRepository struct {
+	codeCollection *mongo.Collection
+	ctx            context.Context
+}
+
+func NewMongoOAuthAuthorizationCodeRepository(codeCollection *mongo.Collection, ctx context.Context) *MongoOAuthAuthorizationCodeRepository {
+	return &MongoOAuthAuthorizationCodeRepository{
+		codeCollection: codeCollection,
+		ctx:            ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes code lookups and expiry rely on. It is
+// safe to call on every startup.
+func (r *MongoOAuthAuthorizationCodeRepository) EnsureIndexes() error {
+	_, err := r.codeCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "codeHash", Value: 1}}, Options: options.Index().SetName("codeHash_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetName("expiresAt")},
+	})
+	return err
+}
+
+func (r *MongoOAuthAuthorizationCodeRepository) Insert(code *models.OAuthAuthorizationCode) error {
+	_, err := r.codeCollection.InsertOne(r.ctx, code)
+	return mongoError(err)
+}
+
+func (r *MongoOAuthAuthorizationCodeRepository) Consume(codeHash string) (*models.OAuthAuthorizationCode, error) {
+	var result *models.OAuthAuthorizationCode
+
+	err := r.codeCollection.FindOneAndDelete(r.ctx, bson.M{"codeHash": codeHash}).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+func (r *MongoOAuthAuthorizationCodeRepository) DeleteExpired(before primitive.Timestamp) error {
+	_, err := r.codeCollection.DeleteMany(r.ctx, bson.M{"expiresAt": bson.M{"$lt": before}})
+	return err
+}
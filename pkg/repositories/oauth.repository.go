@@ -0,0 +1,43 @@
+package repositories
+
+import (
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OAuthClientRepository stores the third-party apps accounts registered.
+type OAuthClientRepository interface {
+	Insert(*models.OAuthClient) error
+	FindById(clientId string) (*models.OAuthClient, error)
+	// FindByOwner returns the clients an account registered, oldest first.
+	FindByOwner(ownerId string) ([]*models.OAuthClient, error)
+	// Delete removes a client of the owner. It returns ErrNotFound when the
+	// owner has no client clientId.
+	Delete(ownerId string, clientId string) error
+}
+
+// OAuthConsentRepository stores which clients accounts let act for them. An
+// account has at most one consent per client.
+type OAuthConsentRepository interface {
+	// Save records a consent, replacing the one the account gave the client
+	// before.
+	Save(*models.OAuthConsent) error
+	Find(accountId string, clientId string) (*models.OAuthConsent, error)
+	// FindByAccount returns the consents of an account, oldest first.
+	FindByAccount(accountId string) ([]*models.OAuthConsent, error)
+	FindByClient(clientId string) ([]*models.OAuthConsent, error)
+	// Delete removes a consent. It returns ErrNotFound when the account did
+	// not consent to the client.
+	Delete(accountId string, clientId string) error
+}
+
+// OAuthAuthorizationCodeRepository stores authorization codes until they are
+// traded for tokens.
+type OAuthAuthorizationCodeRepository interface {
+	Insert(*models.OAuthAuthorizationCode) error
+	// Consume removes the code with the given hash and returns it, so that
+	// it can be used only once. It returns ErrNotFound for unknown codes.
+	Consume(codeHash string) (*models.OAuthAuthorizationCode, error)
+	// DeleteExpired removes the codes that expired before the given time.
+	DeleteExpired(before primitive.Timestamp) error
+}
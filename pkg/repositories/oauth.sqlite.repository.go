@@ -0,0 +1,239 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sqliteOAuthClientColumns = "client_id, owner_id, name, redirect_uris, scopes, secret_hash, created_at"
+
+type SQLiteOAuthClientRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteOAuthClientRepository(db *sql.DB) *SQLiteOAuthClientRepository {
+	return &SQLiteOAuthClientRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteOAuthClientRepository) Insert(client *models.OAuthClient) error {
+	redirectURIs, err := marshalArray(client.RedirectURIs)
+	if err != nil {
+		return err
+	}
+	scopes, err := marshalArray(client.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("INSERT INTO oauth_clients ("+sqliteOAuthClientColumns+") VALUES (?, ?, ?, ?, ?, ?, ?)",
+		client.ClientId, client.OwnerId, client.Name, redirectURIs, scopes, client.SecretHash, client.CreatedAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLiteOAuthClientRepository) FindById(clientId string) (*models.OAuthClient, error) {
+	row := r.db.QueryRow("SELECT "+sqliteOAuthClientColumns+" FROM oauth_clients WHERE client_id = ?", clientId)
+
+	client, err := scanOAuthClient(row)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return client, nil
+}
+
+func (r *SQLiteOAuthClientRepository) FindByOwner(ownerId string) ([]*models.OAuthClient, error) {
+	rows, err := r.db.Query("SELECT "+sqliteOAuthClientColumns+" FROM oauth_clients WHERE owner_id = ? ORDER BY created_at, rowid", ownerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*models.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, client)
+	}
+	return results, rows.Err()
+}
+
+func (r *SQLiteOAuthClientRepository) Delete(ownerId string, clientId string) error {
+	result, err := r.db.Exec("DELETE FROM oauth_clients WHERE owner_id = ? AND client_id = ?", ownerId, clientId)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanOAuthClient(row rowScanner) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	var redirectURIs, scopes string
+
+	err := row.Scan(&client.ClientId, &client.OwnerId, &client.Name, &redirectURIs, &scopes,
+		&client.SecretHash, &client.CreatedAt.T)
+	if err != nil {
+		return nil, err
+	}
+	if client.RedirectURIs, err = unmarshalArray(redirectURIs); err != nil {
+		return nil, err
+	}
+	if client.Scopes, err = unmarshalArray(scopes); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+const sqliteOAuthConsentColumns = "account_id, client_id, scopes, created_at, updated_at"
+
+type SQLiteOAuthConsentRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteOAuthConsentRepository(db *sql.DB) *SQLiteOAuthConsentRepository {
+	return &SQLiteOAuthConsentRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteOAuthConsentRepository) Save(consent *models.OAuthConsent) error {
+	scopes, err := marshalArray(consent.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`INSERT INTO oauth_consents (`+sqliteOAuthConsentColumns+`) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (account_id, client_id) DO UPDATE SET scopes = excluded.scopes, created_at = excluded.created_at, updated_at = excluded.updated_at`,
+		consent.AccountId, consent.ClientId, scopes, consent.CreatedAt.T, consent.UpdatedAt.T)
+	return err
+}
+
+func (r *SQLiteOAuthConsentRepository) Find(accountId string, clientId string) (*models.OAuthConsent, error) {
+	row := r.db.QueryRow("SELECT "+sqliteOAuthConsentColumns+" FROM oauth_consents WHERE account_id = ? AND client_id = ?", accountId, clientId)
+
+	consent, err := scanOAuthConsent(row)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return consent, nil
+}
+
+func (r *SQLiteOAuthConsentRepository) FindByAccount(accountId string) ([]*models.OAuthConsent, error) {
+	return r.query("SELECT "+sqliteOAuthConsentColumns+" FROM oauth_consents WHERE account_id = ? ORDER BY created_at, rowid", accountId)
+}
+
+func (r *SQLiteOAuthConsentRepository) FindByClient(clientId string) ([]*models.OAuthConsent, error) {
+	return r.query("SELECT "+sqliteOAuthConsentColumns+" FROM oauth_consents WHERE client_id = ?", clientId)
+}
+
+func (r *SQLiteOAuthConsentRepository) Delete(accountId string, clientId string) error {
+	result, err := r.db.Exec("DELETE FROM oauth_consents WHERE account_id = ? AND client_id = ?", accountId, clientId)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteOAuthConsentRepository) query(query string, args ...interface{}) ([]*models.OAuthConsent, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*models.OAuthConsent{}
+	for rows.Next() {
+		consent, err := scanOAuthConsent(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, consent)
+	}
+	return results, rows.Err()
+}
+
+func scanOAuthConsent(row rowScanner) (*models.OAuthConsent, error) {
+	var consent models.OAuthConsent
+	var scopes string
+
+	err := row.Scan(&consent.AccountId, &consent.ClientId, &scopes, &consent.CreatedAt.T, &consent.UpdatedAt.T)
+	if err != nil {
+		return nil, err
+	}
+	if consent.Scopes, err = unmarshalArray(scopes); err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+type SQLiteOAuthAuthorizationCodeRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteOAuthAuthorizationCodeRepository(db *sql.DB) *SQLiteOAuthAuthorizationCodeRepository {
+	return &SQLiteOAuthAuthorizationCodeRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteOAuthAuthorizationCodeRepository) Insert(code *models.OAuthAuthorizationCode) error {
+	scopes, err := marshalArray(code.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(`INSERT INTO oauth_authorization_codes
+	(code_hash, client_id, account_id, redirect_uri, scopes, code_challenge, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		code.CodeHash, code.ClientId, code.AccountId, code.RedirectURI, scopes, code.CodeChallenge,
+		code.ExpiresAt.T, code.CreatedAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLiteOAuthAuthorizationCodeRepository) Consume(codeHash string) (*models.OAuthAuthorizationCode, error) {
+	code := models.OAuthAuthorizationCode{CodeHash: codeHash}
+	var scopes string
+
+	err := r.db.QueryRow(`DELETE FROM oauth_authorization_codes WHERE code_hash = ?
+	RETURNING client_id, account_id, redirect_uri, scopes, code_challenge, expires_at, created_at`, codeHash).
+		Scan(&code.ClientId, &code.AccountId, &code.RedirectURI, &scopes, &code.CodeChallenge,
+			&code.ExpiresAt.T, &code.CreatedAt.T)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	if code.Scopes, err = unmarshalArray(scopes); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (r *SQLiteOAuthAuthorizationCodeRepository) DeleteExpired(before primitive.Timestamp) error {
+	_, err := r.db.Exec("DELETE FROM oauth_authorization_codes WHERE expires_at < ?", before.T)
+	return err
+}
+
+// unmarshalArray reads a JSON array column written by marshalArray. Empty
+// arrays read back as nil, like the other backends return them.
+func unmarshalArray(column string) ([]string, error) {
+	var values []string
+	if err := json.Unmarshal([]byte(column), &values); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values, nil
+}
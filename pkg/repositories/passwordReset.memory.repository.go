@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"sync"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+// MemoryPasswordResetTokenRepository keeps reset tokens in process memory. It
+// is meant for development and tests; nothing survives a restart.
+type MemoryPasswordResetTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]models.PasswordResetToken
+}
+
+func NewMemoryPasswordResetTokenRepository() *MemoryPasswordResetTokenRepository {
+	return &MemoryPasswordResetTokenRepository{tokens: make(map[string]models.PasswordResetToken)}
+}
+
+func (r *MemoryPasswordResetTokenRepository) Insert(token *models.PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tokens[token.TokenHash]; ok {
+		return ErrDuplicate
+	}
+	r.tokens[token.TokenHash] = *token
+	return nil
+}
+
+func (r *MemoryPasswordResetTokenRepository) Find(tokenHash string) (*models.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &token, nil
+}
+
+func (r *MemoryPasswordResetTokenRepository) FindByAccount(accountId string) (*models.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var latest *models.PasswordResetToken
+	for _, token := range r.tokens {
+		if token.AccountId == accountId && (latest == nil || token.CreatedAt.T > latest.CreatedAt.T) {
+			token := token
+			latest = &token
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (r *MemoryPasswordResetTokenRepository) Consume(tokenHash string) (*models.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	delete(r.tokens, tokenHash)
+	return &token, nil
+}
+
+func (r *MemoryPasswordResetTokenRepository) DeleteByAccount(accountId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for tokenHash, token := range r.tokens {
+		if token.AccountId == accountId {
+			delete(r.tokens, tokenHash)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoPasswordResetTokenRepository struct {
+	tokenCollection *mongo.Collection
+	ctx             context.Context
+}
+
+func NewMongoPasswordResetTokenRepository(tokenCollection *mongo.Collection, ctx context.Context) *MongoPasswordResetTokenRepository {
+	return &MongoPasswordResetTokenRepository{
+		tokenCollection: tokenCollection,
+		ctx:             ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes reset token lookups rely on.
+// It is safe to call on every startup.
+func (r *MongoPasswordResetTokenRepository) EnsureIndexes() error {
+	_, err := r.tokenCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetName("tokenHash_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "accountId", Value: 1}}, Options: options.Index().SetName("accountId")},
+	})
+	return err
+}
+
+func (r *MongoPasswordResetTokenRepository) Insert(token *models.PasswordResetToken) error {
+	_, err := r.tokenCollection.InsertOne(r.ctx, token)
+	return mongoError(err)
+}
+
+func (r *MongoPasswordResetTokenRepository) Find(tokenHash string) (*models.PasswordResetToken, error) {
+	var result *models.PasswordResetToken
+
+	err := r.tokenCollection.FindOne(r.ctx, bson.M{"tokenHash": tokenHash}).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+func (r *MongoPasswordResetTokenRepository) FindByAccount(accountId string) (*models.PasswordResetToken, error) {
+	var result *models.PasswordResetToken
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	err := r.tokenCollection.FindOne(r.ctx, bson.M{"accountId": accountId}, opts).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+func (r *MongoPasswordResetTokenRepository) Consume(tokenHash string) (*models.PasswordResetToken, error) {
+	var result *models.PasswordResetToken
+
+	err := r.tokenCollection.FindOneAndDelete(r.ctx, bson.M{"tokenHash": tokenHash}).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+func (r *MongoPasswordResetTokenRepository) DeleteByAccount(accountId string) error {
+	_, err := r.tokenCollection.DeleteMany(r.ctx, bson.M{"accountId": accountId})
+	return err
+}
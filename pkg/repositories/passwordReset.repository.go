@@ -0,0 +1,15 @@
+package repositories
+
+import "github.com/croisade/chimichanga/pkg/models"
+
+type PasswordResetTokenRepository interface {
+	Insert(*models.PasswordResetToken) error
+	// Find returns the token with the given hash, or ErrNotFound.
+	Find(tokenHash string) (*models.PasswordResetToken, error)
+	// FindByAccount returns the token most recently mailed for the account.
+	FindByAccount(accountId string) (*models.PasswordResetToken, error)
+	// Consume removes the token with the given hash and returns it, so that
+	// it can be used only once. It returns ErrNotFound for unknown tokens.
+	Consume(tokenHash string) (*models.PasswordResetToken, error)
+	DeleteByAccount(accountId string) error
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+type SQLitePasswordResetTokenRepository struct {
+	db *sql.DB
+}
+
+func NewSQLitePasswordResetTokenRepository(db *sql.DB) *SQLitePasswordResetTokenRepository {
+	return &SQLitePasswordResetTokenRepository{
+		db: db,
+	}
+}
+
+func (r *SQLitePasswordResetTokenRepository) Insert(token *models.PasswordResetToken) error {
+	_, err := r.db.Exec("INSERT INTO password_reset_tokens (token_hash, account_id, expires_at, created_at) VALUES (?, ?, ?, ?)",
+		token.TokenHash, token.AccountId, token.ExpiresAt.T, token.CreatedAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLitePasswordResetTokenRepository) Find(tokenHash string) (*models.PasswordResetToken, error) {
+	token := models.PasswordResetToken{TokenHash: tokenHash}
+
+	err := r.db.QueryRow("SELECT account_id, expires_at, created_at FROM password_reset_tokens WHERE token_hash = ?", tokenHash).
+		Scan(&token.AccountId, &token.ExpiresAt.T, &token.CreatedAt.T)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return &token, nil
+}
+
+func (r *SQLitePasswordResetTokenRepository) FindByAccount(accountId string) (*models.PasswordResetToken, error) {
+	token := models.PasswordResetToken{AccountId: accountId}
+
+	err := r.db.QueryRow("SELECT token_hash, expires_at, created_at FROM password_reset_tokens WHERE account_id = ? ORDER BY created_at DESC LIMIT 1", accountId).
+		Scan(&token.TokenHash, &token.ExpiresAt.T, &token.CreatedAt.T)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return &token, nil
+}
+
+func (r *SQLitePasswordResetTokenRepository) Consume(tokenHash string) (*models.PasswordResetToken, error) {
+	token := models.PasswordResetToken{TokenHash: tokenHash}
+
+	err := r.db.QueryRow("DELETE FROM password_reset_tokens WHERE token_hash = ? RETURNING account_id, expires_at, created_at", tokenHash).
+		Scan(&token.AccountId, &token.ExpiresAt.T, &token.CreatedAt.T)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return &token, nil
+}
+
+func (r *SQLitePasswordResetTokenRepository) DeleteByAccount(accountId string) error {
+	_, err := r.db.Exec("DELETE FROM password_reset_tokens WHERE account_id = ?", accountId)
+	return err
+}
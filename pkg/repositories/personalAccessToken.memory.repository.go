@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryPersonalAccessTokenRepository keeps personal access tokens in process
+// memory. It is meant for development and tests; nothing survives a restart.
+type MemoryPersonalAccessTokenRepository struct {
+	mu     sync.RWMutex
+	tokens []models.PersonalAccessToken
+}
+
+func NewMemoryPersonalAccessTokenRepository() *MemoryPersonalAccessTokenRepository {
+	return &MemoryPersonalAccessTokenRepository{}
+}
+
+func (r *MemoryPersonalAccessTokenRepository) Insert(token *models.PersonalAccessToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.tokens {
+		if existing.TokenId == token.TokenId || existing.TokenHash == token.TokenHash ||
+			(existing.AccountId == token.AccountId && existing.Name == token.Name) {
+			return ErrDuplicate
+		}
+	}
+	inserted := *token
+	inserted.Scopes = append([]string(nil), token.Scopes...)
+	r.tokens = append(r.tokens, inserted)
+	return nil
+}
+
+func (r *MemoryPersonalAccessTokenRepository) FindByHash(tokenHash string) (*models.PersonalAccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			token.Scopes = append([]string(nil), token.Scopes...)
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryPersonalAccessTokenRepository) FindByAccount(accountId string) ([]*models.PersonalAccessToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []*models.PersonalAccessToken{}
+	for _, token := range r.tokens {
+		if token.AccountId == accountId {
+			found := token
+			found.Scopes = append([]string(nil), token.Scopes...)
+			results = append(results, &found)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].CreatedAt.T < results[j].CreatedAt.T
+	})
+	return results, nil
+}
+
+func (r *MemoryPersonalAccessTokenRepository) Touch(tokenId string, at primitive.Timestamp) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.tokens {
+		if r.tokens[i].TokenId == tokenId {
+			r.tokens[i].LastUsedAt = at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryPersonalAccessTokenRepository) Delete(accountId string, tokenId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, token := range r.tokens {
+		if token.AccountId == accountId && token.TokenId == tokenId {
+			r.tokens = append(r.tokens[:i], r.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryPersonalAccessTokenRepository) DeleteByAccount(accountId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.tokens[:0]
+	for _, token := range r.tokens {
+		if token.AccountId != accountId {
+			kept = append(kept, token)
+		}
+	}
+	r.tokens = kept
+	return nil
+}
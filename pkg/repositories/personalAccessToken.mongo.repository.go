@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoPersonalAccessTokenRepository struct {
+	tokenCollection *mongo.Collection
+	ctx             context.Context
+}
+
+func NewMongoPersonalAccessTokenRepository(tokenCollection *mongo.Collection, ctx context.Context) *MongoPersonalAccessTokenRepository {
+	return &MongoPersonalAccessTokenRepository{
+		tokenCollection: tokenCollection,
+		ctx:             ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes token lookups and unique names rely on.
+// It is safe to call on every startup.
+func (r *MongoPersonalAccessTokenRepository) EnsureIndexes() error {
+	_, err := r.tokenCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenId", Value: 1}}, Options: options.Index().SetName("tokenId_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetName("tokenHash_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "accountId", Value: 1}, {Key: "name", Value: 1}}, Options: options.Index().SetName("accountId_name_unique").SetUnique(true)},
+	})
+	return err
+}
+
+func (r *MongoPersonalAccessTokenRepository) Insert(token *models.PersonalAccessToken) error {
+	_, err := r.tokenCollection.InsertOne(r.ctx, token)
+	return mongoError(err)
+}
+
+func (r *MongoPersonalAccessTokenRepository) FindByHash(tokenHash string) (*models.PersonalAccessToken, error) {
+	var result *models.PersonalAccessToken
+
+	err := r.tokenCollection.FindOne(r.ctx, bson.M{"tokenHash": tokenHash}).Decode(&result)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return result, nil
+}
+
+func (r *MongoPersonalAccessTokenRepository) FindByAccount(accountId string) ([]*models.PersonalAccessToken, error) {
+	results := []*models.PersonalAccessToken{}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.tokenCollection.Find(r.ctx, bson.M{"accountId": accountId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(r.ctx, &results)
+	return results, err
+}
+
+func (r *MongoPersonalAccessTokenRepository) Touch(tokenId string, at primitive.Timestamp) error {
+	result, err := r.tokenCollection.UpdateOne(r.ctx, bson.M{"tokenId": tokenId}, bson.M{"$set": bson.M{"lastUsedAt": at}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoPersonalAccessTokenRepository) Delete(accountId string, tokenId string) error {
+	result, err := r.tokenCollection.DeleteOne(r.ctx, bson.M{"accountId": accountId, "tokenId": tokenId})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoPersonalAccessTokenRepository) DeleteByAccount(accountId string) error {
+	_, err := r.tokenCollection.DeleteMany(r.ctx, bson.M{"accountId": accountId})
+	return err
+}
@@ -0,0 +1,22 @@
+package repositories
+
+import (
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PersonalAccessTokenRepository stores personal access tokens. Token names
+// are unique per account, inserting a taken one returns ErrDuplicate.
+type PersonalAccessTokenRepository interface {
+	Insert(*models.PersonalAccessToken) error
+	FindByHash(tokenHash string) (*models.PersonalAccessToken, error)
+	// FindByAccount returns the tokens of an account, oldest first.
+	FindByAccount(accountId string) ([]*models.PersonalAccessToken, error)
+	// Touch records that the token was used at the given time.
+	Touch(tokenId string, at primitive.Timestamp) error
+	// Delete removes a token of the account. It returns ErrNotFound when the
+	// account has no token tokenId.
+	Delete(accountId string, tokenId string) error
+	// DeleteByAccount removes every token of the account.
+	DeleteByAccount(accountId string) error
+}
@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sqlitePersonalAccessTokenColumns = "token_id, account_id, name, scopes, token_hash, created_at, expires_at, last_used_at"
+
+type SQLitePersonalAccessTokenRepository struct {
+	db *sql.DB
+}
+
+func NewSQLitePersonalAccessTokenRepository(db *sql.DB) *SQLitePersonalAccessTokenRepository {
+	return &SQLitePersonalAccessTokenRepository{
+		db: db,
+	}
+}
+
+func (r *SQLitePersonalAccessTokenRepository) Insert(token *models.PersonalAccessToken) error {
+	scopes, err := marshalArray(token.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("INSERT INTO personal_access_tokens ("+sqlitePersonalAccessTokenColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		token.TokenId, token.AccountId, token.Name, scopes, token.TokenHash,
+		token.CreatedAt.T, token.ExpiresAt.T, token.LastUsedAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLitePersonalAccessTokenRepository) FindByHash(tokenHash string) (*models.PersonalAccessToken, error) {
+	row := r.db.QueryRow("SELECT "+sqlitePersonalAccessTokenColumns+" FROM personal_access_tokens WHERE token_hash = ?", tokenHash)
+
+	token, err := scanPersonalAccessToken(row)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return token, nil
+}
+
+func (r *SQLitePersonalAccessTokenRepository) FindByAccount(accountId string) ([]*models.PersonalAccessToken, error) {
+	rows, err := r.db.Query("SELECT "+sqlitePersonalAccessTokenColumns+" FROM personal_access_tokens WHERE account_id = ? ORDER BY created_at, rowid", accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []*models.PersonalAccessToken{}
+	for rows.Next() {
+		token, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, token)
+	}
+	return results, rows.Err()
+}
+
+func (r *SQLitePersonalAccessTokenRepository) Touch(tokenId string, at primitive.Timestamp) error {
+	result, err := r.db.Exec("UPDATE personal_access_tokens SET last_used_at = ? WHERE token_id = ?", at.T, tokenId)
+	if err != nil {
+		return err
+	}
+
+	if updated, _ := result.RowsAffected(); updated != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLitePersonalAccessTokenRepository) Delete(accountId string, tokenId string) error {
+	result, err := r.db.Exec("DELETE FROM personal_access_tokens WHERE account_id = ? AND token_id = ?", accountId, tokenId)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLitePersonalAccessTokenRepository) DeleteByAccount(accountId string) error {
+	_, err := r.db.Exec("DELETE FROM personal_access_tokens WHERE account_id = ?", accountId)
+	return err
+}
+
+func scanPersonalAccessToken(row rowScanner) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	var scopes string
+
+	err := row.Scan(&token.TokenId, &token.AccountId, &token.Name, &scopes, &token.TokenHash,
+		&token.CreatedAt.T, &token.ExpiresAt.T, &token.LastUsedAt.T)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &token.Scopes); err != nil {
+		return nil, err
+	}
+	if len(token.Scopes) == 0 {
+		token.Scopes = nil
+	}
+	return &token, nil
+}
@@ -0,0 +1,605 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testAccountRepository runs the behaviour every AccountRepository
+// implementation has to provide against an empty repository.
+func testAccountRepository(t *testing.T, repository AccountRepository) {
+	account := &models.Account{AccountId: "1", Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last", Units: models.Metric, Roles: []string{models.RoleUser}}
+
+	t.Run("insert and find", func(t *testing.T) {
+		assert.Nil(t, repository.Insert(account))
+
+		byId, err := repository.FindById("1")
+		assert.Nil(t, err)
+		assert.Equal(t, account, byId)
+
+		byEmail, err := repository.FindByEmail("test@example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, "1", byEmail.AccountId)
+	})
+
+	t.Run("email and id are unique", func(t *testing.T) {
+		sameEmail := &models.Account{AccountId: "2", Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"}
+		assert.ErrorIs(t, repository.Insert(sameEmail), ErrDuplicate)
+
+		sameId := &models.Account{AccountId: "1", Email: "other@example.com", Password: "password", FirstName: "first", LastName: "last"}
+		assert.ErrorIs(t, repository.Insert(sameId), ErrDuplicate)
+	})
+
+	t.Run("returned accounts are copies", func(t *testing.T) {
+		got, _ := repository.FindById("1")
+		got.FirstName = "changed"
+
+		stored, _ := repository.FindById("1")
+		assert.Equal(t, "first", stored.FirstName)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		updated, err := repository.Update(&models.Account{AccountId: "1", Email: "test@example.com", Password: "password", FirstName: "Middle", LastName: "last", EmailVerified: true,
+			TOTPEnabled: true, TOTPSecret: "SECRET", TOTPLastStep: 42, RecoveryCodes: []string{"a", "b"}})
+		assert.Nil(t, err)
+		assert.Equal(t, "Middle", updated.FirstName)
+		assert.True(t, updated.EmailVerified)
+		assert.True(t, updated.TOTPEnabled)
+		assert.Equal(t, "SECRET", updated.TOTPSecret)
+		assert.Equal(t, int64(42), updated.TOTPLastStep)
+		assert.Equal(t, []string{"a", "b"}, updated.RecoveryCodes)
+
+		_, err = repository.Update(&models.Account{AccountId: "missing"})
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("update replaces roles", func(t *testing.T) {
+		withRoles := &models.Account{AccountId: "1", Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last", Roles: []string{models.RoleUser, models.RoleAdmin}}
+		updated, err := repository.Update(withRoles)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{models.RoleUser, models.RoleAdmin}, updated.Roles)
+
+		withRoles.Roles = nil
+		_, err = repository.Update(withRoles)
+		assert.Nil(t, err)
+		stored, _ := repository.FindById("1")
+		assert.Empty(t, stored.Roles)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Nil(t, repository.Delete("1"))
+		assert.ErrorIs(t, repository.Delete("1"), ErrNotFound)
+
+		_, err := repository.FindById("1")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		all, err := repository.FindAll()
+		assert.Nil(t, err)
+		assert.Empty(t, all)
+	})
+}
+
+// testRunRepository runs the behaviour every RunRepository implementation has
+// to provide against an empty repository.
+func testRunRepository(t *testing.T, repository RunRepository) {
+	repository.Insert(&models.Run{AccountId: "1", RunId: "a", Distance: 3.0})
+	repository.Insert(&models.Run{AccountId: "1", RunId: "b", Distance: 4.0})
+	repository.Insert(&models.Run{AccountId: "2", RunId: "c", Distance: 5.0})
+
+	t.Run("find by account", func(t *testing.T) {
+		runs, err := repository.FindByAccount("1")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(runs))
+		assert.Equal(t, "a", runs[0].RunId)
+	})
+
+	t.Run("run ids are unique per account", func(t *testing.T) {
+		assert.ErrorIs(t, repository.Insert(&models.Run{AccountId: "1", RunId: "a"}), ErrDuplicate)
+	})
+
+	t.Run("find one is scoped to the account", func(t *testing.T) {
+		_, err := repository.FindOne("2", "a")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		updated, err := repository.Update(&models.Run{AccountId: "1", RunId: "b", Distance: 10.0})
+		assert.Nil(t, err)
+		assert.Equal(t, float32(10.0), updated.Distance)
+
+		untouched, _ := repository.FindOne("1", "a")
+		assert.Equal(t, float32(3.0), untouched.Distance)
+	})
+
+	t.Run("splits are stored with their run", func(t *testing.T) {
+		splits := []models.Split{{Distance: 400.0, Time: models.Duration(90 * time.Second), HeartRate: 150}, {Distance: 400.0, Pace: 5.0}}
+		repository.Insert(&models.Run{AccountId: "3", RunId: "d", Splits: splits})
+
+		got, err := repository.FindOne("3", "d")
+		assert.Nil(t, err)
+		assert.Equal(t, splits, got.Splits)
+
+		got.Splits[0].Distance = 1.0
+		got.Splits = got.Splits[:1]
+		updated, err := repository.Update(got)
+		assert.Nil(t, err)
+		assert.Equal(t, []models.Split{{Distance: 1.0, Time: models.Duration(90 * time.Second), HeartRate: 150}}, updated.Splits)
+
+		got.Splits[0].Distance = 2.0
+		stored, _ := repository.FindOne("3", "d")
+		assert.Equal(t, float32(1.0), stored.Splits[0].Distance)
+	})
+
+	t.Run("track points are stored with their run", func(t *testing.T) {
+		start := time.Date(2022, 5, 1, 7, 0, 0, 0, time.UTC)
+		track := []models.TrackPoint{
+			{Time: start, Latitude: 51.5, Longitude: -0.12, Elevation: 11.5, HeartRate: 120},
+			{Time: start.Add(5 * time.Second), Latitude: 51.5001, Longitude: -0.12, Elevation: 12.0, Cadence: 84},
+		}
+		repository.Insert(&models.Run{AccountId: "3", RunId: "e", ElevationGain: 0.5, Track: track})
+
+		got, err := repository.FindOne("3", "e")
+		assert.Nil(t, err)
+		assert.Equal(t, track, got.Track)
+		assert.Equal(t, float32(0.5), got.ElevationGain)
+
+		got.Track[0].HeartRate = 0
+		stored, _ := repository.FindOne("3", "e")
+		assert.Equal(t, 120, stored.Track[0].HeartRate)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Nil(t, repository.Delete("1", "a"))
+		assert.ErrorIs(t, repository.Delete("1", "a"), ErrNotFound)
+	})
+}
+
+// testTokenFamilyRepository runs the behaviour every TokenFamilyRepository
+// implementation has to provide against an empty repository.
+func testTokenFamilyRepository(t *testing.T, repository TokenFamilyRepository) {
+	family := &models.TokenFamily{FamilyId: "f1", AccountId: "1", Device: "phone", CurrentTokenId: "t1"}
+	assert.Nil(t, repository.Insert(family))
+	assert.Nil(t, repository.Insert(&models.TokenFamily{FamilyId: "f2", AccountId: "1", CurrentTokenId: "u1"}))
+	assert.Nil(t, repository.Insert(&models.TokenFamily{FamilyId: "f3", AccountId: "2", CurrentTokenId: "v1"}))
+	assert.Nil(t, repository.Insert(&models.TokenFamily{FamilyId: "f4", AccountId: "2", ClientId: "app", CurrentTokenId: "w1"}))
+
+	t.Run("insert and find", func(t *testing.T) {
+		got, err := repository.FindById("f1")
+		assert.Nil(t, err)
+		assert.Equal(t, family, got)
+
+		_, err = repository.FindById("missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, repository.Insert(family), ErrDuplicate)
+	})
+
+	t.Run("rotate only moves on from the current token", func(t *testing.T) {
+		assert.Nil(t, repository.Rotate("f1", "t1", "t2"))
+		assert.ErrorIs(t, repository.Rotate("f1", "t1", "t3"), ErrNotFound)
+
+		got, _ := repository.FindById("f1")
+		assert.Equal(t, "t2", got.CurrentTokenId)
+	})
+
+	t.Run("revoked families cannot rotate", func(t *testing.T) {
+		assert.Nil(t, repository.Revoke("f1"))
+		assert.ErrorIs(t, repository.Rotate("f1", "t2", "t3"), ErrNotFound)
+		assert.ErrorIs(t, repository.Revoke("missing"), ErrNotFound)
+
+		got, _ := repository.FindById("f1")
+		assert.True(t, got.Revoked)
+	})
+
+	t.Run("revoke by account", func(t *testing.T) {
+		assert.Nil(t, repository.RevokeByAccount("1"))
+
+		got, _ := repository.FindById("f2")
+		assert.True(t, got.Revoked)
+		other, _ := repository.FindById("f3")
+		assert.False(t, other.Revoked)
+	})
+
+	t.Run("revoke by client", func(t *testing.T) {
+		assert.Nil(t, repository.RevokeByClient("2", "app"))
+
+		got, _ := repository.FindById("f4")
+		assert.True(t, got.Revoked)
+		assert.Equal(t, "app", got.ClientId)
+		other, _ := repository.FindById("f3")
+		assert.False(t, other.Revoked)
+	})
+}
+
+// testRevokedTokenRepository runs the behaviour every RevokedTokenRepository
+// implementation has to provide against an empty repository.
+func testRevokedTokenRepository(t *testing.T, repository RevokedTokenRepository) {
+	assert.Nil(t, repository.Insert(&models.RevokedToken{TokenId: "early", AccountId: "1", ExpiresAt: primitive.Timestamp{T: 100}}))
+	assert.Nil(t, repository.Insert(&models.RevokedToken{TokenId: "late", AccountId: "1", ExpiresAt: primitive.Timestamp{T: 200}}))
+
+	t.Run("insert and exists", func(t *testing.T) {
+		exists, err := repository.Exists("early")
+		assert.Nil(t, err)
+		assert.True(t, exists)
+
+		exists, err = repository.Exists("other")
+		assert.Nil(t, err)
+		assert.False(t, exists)
+
+		assert.ErrorIs(t, repository.Insert(&models.RevokedToken{TokenId: "early", AccountId: "1"}), ErrDuplicate)
+	})
+
+	t.Run("delete expired", func(t *testing.T) {
+		assert.Nil(t, repository.DeleteExpired(primitive.Timestamp{T: 150}))
+
+		early, _ := repository.Exists("early")
+		assert.False(t, early)
+		late, _ := repository.Exists("late")
+		assert.True(t, late)
+	})
+}
+
+// testSigningKeyRepository runs the behaviour every SigningKeyRepository
+// implementation has to provide against an empty repository.
+func testSigningKeyRepository(t *testing.T, repository SigningKeyRepository) {
+	newer := &models.SigningKey{KeyId: "b", Algorithm: models.AlgorithmEdDSA, PrivateKey: []byte{4, 5, 6}, CreatedAt: primitive.Timestamp{T: 200}}
+	older := &models.SigningKey{KeyId: "a", Algorithm: models.AlgorithmRS256, PrivateKey: []byte{1, 2, 3}, CreatedAt: primitive.Timestamp{T: 100}}
+
+	t.Run("insert and find all oldest first", func(t *testing.T) {
+		assert.Nil(t, repository.Insert(newer))
+		assert.Nil(t, repository.Insert(older))
+		assert.ErrorIs(t, repository.Insert(older), ErrDuplicate)
+
+		keys, err := repository.FindAll()
+		assert.Nil(t, err)
+		assert.Equal(t, []*models.SigningKey{older, newer}, keys)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Nil(t, repository.Delete("a"))
+		assert.ErrorIs(t, repository.Delete("a"), ErrNotFound)
+
+		keys, _ := repository.FindAll()
+		assert.Equal(t, []*models.SigningKey{newer}, keys)
+	})
+}
+
+// testPasswordResetTokenRepository runs the behaviour every
+// PasswordResetTokenRepository implementation has to provide against an
+// empty repository.
+func testPasswordResetTokenRepository(t *testing.T, repository PasswordResetTokenRepository) {
+	token := &models.PasswordResetToken{TokenHash: "hash", AccountId: "1", ExpiresAt: primitive.Timestamp{T: 200}, CreatedAt: primitive.Timestamp{T: 100}}
+
+	t.Run("consume once", func(t *testing.T) {
+		assert.Nil(t, repository.Insert(token))
+		assert.ErrorIs(t, repository.Insert(token), ErrDuplicate)
+
+		found, err := repository.Find("hash")
+		assert.Nil(t, err)
+		assert.Equal(t, token, found)
+
+		got, err := repository.Consume("hash")
+		assert.Nil(t, err)
+		assert.Equal(t, token, got)
+
+		_, err = repository.Consume("hash")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = repository.Find("hash")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("delete by account", func(t *testing.T) {
+		assert.Nil(t, repository.Insert(&models.PasswordResetToken{TokenHash: "a", AccountId: "1"}))
+		assert.Nil(t, repository.Insert(&models.PasswordResetToken{TokenHash: "b", AccountId: "2"}))
+		assert.Nil(t, repository.DeleteByAccount("1"))
+
+		_, err := repository.Consume("a")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = repository.Consume("b")
+		assert.Nil(t, err)
+	})
+
+	t.Run("find the latest token of an account", func(t *testing.T) {
+		older := &models.PasswordResetToken{TokenHash: "older", AccountId: "3", ExpiresAt: primitive.Timestamp{T: 200}, CreatedAt: primitive.Timestamp{T: 100}}
+		newer := &models.PasswordResetToken{TokenHash: "newer", AccountId: "3", ExpiresAt: primitive.Timestamp{T: 300}, CreatedAt: primitive.Timestamp{T: 200}}
+		assert.Nil(t, repository.Insert(older))
+		assert.Nil(t, repository.Insert(newer))
+
+		got, err := repository.FindByAccount("3")
+		assert.Nil(t, err)
+		assert.Equal(t, newer, got)
+
+		_, err = repository.FindByAccount("4")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+// testEmailVerificationTokenRepository runs the behaviour every
+// EmailVerificationTokenRepository implementation has to provide against an
+// empty repository.
+func testEmailVerificationTokenRepository(t *testing.T, repository EmailVerificationTokenRepository) {
+	older := &models.EmailVerificationToken{TokenHash: "older", AccountId: "1", ExpiresAt: primitive.Timestamp{T: 200}, CreatedAt: primitive.Timestamp{T: 100}}
+	newer := &models.EmailVerificationToken{TokenHash: "newer", AccountId: "1", ExpiresAt: primitive.Timestamp{T: 300}, CreatedAt: primitive.Timestamp{T: 200}}
+
+	t.Run("find the latest token of an account", func(t *testing.T) {
+		assert.Nil(t, repository.Insert(older))
+		assert.Nil(t, repository.Insert(newer))
+		assert.ErrorIs(t, repository.Insert(older), ErrDuplicate)
+
+		got, err := repository.FindByAccount("1")
+		assert.Nil(t, err)
+		assert.Equal(t, newer, got)
+
+		_, err = repository.FindByAccount("2")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("consume once", func(t *testing.T) {
+		got, err := repository.Consume("older")
+		assert.Nil(t, err)
+		assert.Equal(t, older, got)
+
+		_, err = repository.Consume("older")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("delete by account", func(t *testing.T) {
+		assert.Nil(t, repository.DeleteByAccount("1"))
+
+		_, err := repository.FindByAccount("1")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+// testLoginThrottleRepository runs the behaviour every LoginThrottleRepository
+// implementation has to provide against an empty repository.
+func testLoginThrottleRepository(t *testing.T, repository LoginThrottleRepository) {
+	email := &models.LoginThrottle{Kind: models.ThrottleEmail, Value: "test@example.com", Failures: 1, ExpiresAt: primitive.Timestamp{T: 100}}
+	ip := &models.LoginThrottle{Kind: models.ThrottleIP, Value: "192.0.2.1", Failures: 6, LockedUntil: primitive.Timestamp{T: 150}, ExpiresAt: primitive.Timestamp{T: 200}}
+
+	t.Run("save and find", func(t *testing.T) {
+		assert.Nil(t, repository.Save(email))
+		assert.Nil(t, repository.Save(ip))
+
+		email.Failures = 2
+		assert.Nil(t, repository.Save(email))
+
+		got, err := repository.Find(models.ThrottleEmail, "test@example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, email, got)
+
+		_, err = repository.Find(models.ThrottleIP, "test@example.com")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		all, err := repository.FindAll()
+		assert.Nil(t, err)
+		assert.Equal(t, []*models.LoginThrottle{email, ip}, all)
+	})
+
+	t.Run("delete expired", func(t *testing.T) {
+		assert.Nil(t, repository.DeleteExpired(primitive.Timestamp{T: 150}))
+
+		all, _ := repository.FindAll()
+		assert.Equal(t, []*models.LoginThrottle{ip}, all)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Nil(t, repository.Delete(models.ThrottleIP, "192.0.2.1"))
+		assert.ErrorIs(t, repository.Delete(models.ThrottleIP, "192.0.2.1"), ErrNotFound)
+	})
+}
+
+// testPersonalAccessTokenRepository runs the behaviour every
+// PersonalAccessTokenRepository implementation has to provide against an
+// empty repository.
+func testPersonalAccessTokenRepository(t *testing.T, repository PersonalAccessTokenRepository) {
+	ci := &models.PersonalAccessToken{TokenId: "1", AccountId: "a", Name: "ci", Scopes: []string{models.ScopeRunsRead}, TokenHash: "hash1", CreatedAt: primitive.Timestamp{T: 100}}
+	backup := &models.PersonalAccessToken{TokenId: "2", AccountId: "a", Name: "backup", Scopes: []string{models.ScopeRunsRead, models.ScopeRunsWrite}, TokenHash: "hash2", CreatedAt: primitive.Timestamp{T: 200}, ExpiresAt: primitive.Timestamp{T: 300}}
+	other := &models.PersonalAccessToken{TokenId: "3", AccountId: "b", Name: "ci", TokenHash: "hash3", CreatedAt: primitive.Timestamp{T: 50}}
+
+	t.Run("insert and find", func(t *testing.T) {
+		assert.Nil(t, repository.Insert(backup))
+		assert.Nil(t, repository.Insert(ci))
+		assert.Nil(t, repository.Insert(other))
+		assert.ErrorIs(t, repository.Insert(&models.PersonalAccessToken{TokenId: "4", AccountId: "a", Name: "ci", TokenHash: "hash4"}), ErrDuplicate)
+
+		got, err := repository.FindByHash("hash2")
+		assert.Nil(t, err)
+		assert.Equal(t, backup, got)
+
+		_, err = repository.FindByHash("missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		all, err := repository.FindByAccount("a")
+		assert.Nil(t, err)
+		assert.Equal(t, []*models.PersonalAccessToken{ci, backup}, all)
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		assert.Nil(t, repository.Touch("1", primitive.Timestamp{T: 150}))
+		assert.ErrorIs(t, repository.Touch("missing", primitive.Timestamp{T: 150}), ErrNotFound)
+
+		got, _ := repository.FindByHash("hash1")
+		assert.Equal(t, primitive.Timestamp{T: 150}, got.LastUsedAt)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.ErrorIs(t, repository.Delete("b", "1"), ErrNotFound)
+		assert.Nil(t, repository.Delete("a", "1"))
+		assert.ErrorIs(t, repository.Delete("a", "1"), ErrNotFound)
+
+		all, _ := repository.FindByAccount("a")
+		assert.Equal(t, []*models.PersonalAccessToken{backup}, all)
+	})
+
+	t.Run("delete by account", func(t *testing.T) {
+		assert.Nil(t, repository.DeleteByAccount("a"))
+
+		all, err := repository.FindByAccount("a")
+		assert.Nil(t, err)
+		assert.Empty(t, all)
+		_, err = repository.FindByHash("hash3")
+		assert.Nil(t, err)
+	})
+}
+
+// testOAuthClientRepository runs the behaviour every OAuthClientRepository
+// implementation has to provide against an empty repository.
+func testOAuthClientRepository(t *testing.T, repository OAuthClientRepository) {
+	coach := &models.OAuthClient{ClientId: "c1", OwnerId: "a", Name: "Coach", RedirectURIs: []string{"https://coach.example/callback"}, Scopes: []string{models.ScopeRunsRead}, SecretHash: "hash", CreatedAt: primitive.Timestamp{T: 200}}
+	treadmill := &models.OAuthClient{ClientId: "c2", OwnerId: "a", Name: "Treadmill", RedirectURIs: []string{"com.example.treadmill:/callback"}, Scopes: []string{models.ScopeRunsWrite}, CreatedAt: primitive.Timestamp{T: 100}}
+
+	t.Run("insert and find", func(t *testing.T) {
+		assert.Nil(t, repository.Insert(coach))
+		assert.Nil(t, repository.Insert(treadmill))
+		assert.ErrorIs(t, repository.Insert(coach), ErrDuplicate)
+
+		got, err := repository.FindById("c1")
+		assert.Nil(t, err)
+		assert.Equal(t, coach, got)
+
+		_, err = repository.FindById("missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		all, err := repository.FindByOwner("a")
+		assert.Nil(t, err)
+		assert.Equal(t, []*models.OAuthClient{treadmill, coach}, all)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.ErrorIs(t, repository.Delete("b", "c1"), ErrNotFound)
+		assert.Nil(t, repository.Delete("a", "c1"))
+
+		_, err := repository.FindById("c1")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+// testOAuthConsentRepository runs the behaviour every OAuthConsentRepository
+// implementation has to provide against an empty repository.
+func testOAuthConsentRepository(t *testing.T, repository OAuthConsentRepository) {
+	coach := &models.OAuthConsent{AccountId: "a", ClientId: "c1", Scopes: []string{models.ScopeRunsRead}, CreatedAt: primitive.Timestamp{T: 200}, UpdatedAt: primitive.Timestamp{T: 200}}
+	treadmill := &models.OAuthConsent{AccountId: "a", ClientId: "c2", Scopes: []string{models.ScopeRunsWrite}, CreatedAt: primitive.Timestamp{T: 100}, UpdatedAt: primitive.Timestamp{T: 100}}
+	other := &models.OAuthConsent{AccountId: "b", ClientId: "c1", Scopes: []string{models.ScopeRunsRead}, CreatedAt: primitive.Timestamp{T: 300}, UpdatedAt: primitive.Timestamp{T: 300}}
+
+	t.Run("save and find", func(t *testing.T) {
+		assert.Nil(t, repository.Save(coach))
+		assert.Nil(t, repository.Save(treadmill))
+		assert.Nil(t, repository.Save(other))
+
+		got, err := repository.Find("a", "c1")
+		assert.Nil(t, err)
+		assert.Equal(t, coach, got)
+
+		_, err = repository.Find("b", "c2")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		all, err := repository.FindByAccount("a")
+		assert.Nil(t, err)
+		assert.Equal(t, []*models.OAuthConsent{treadmill, coach}, all)
+
+		byClient, err := repository.FindByClient("c1")
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []*models.OAuthConsent{coach, other}, byClient)
+	})
+
+	t.Run("save replaces", func(t *testing.T) {
+		coach.Scopes = []string{models.ScopeRunsRead, models.ScopeAccountRead}
+		coach.UpdatedAt = primitive.Timestamp{T: 400}
+		assert.Nil(t, repository.Save(coach))
+
+		got, _ := repository.Find("a", "c1")
+		assert.Equal(t, coach, got)
+		all, _ := repository.FindByAccount("a")
+		assert.Len(t, all, 2)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		assert.Nil(t, repository.Delete("a", "c1"))
+		assert.ErrorIs(t, repository.Delete("a", "c1"), ErrNotFound)
+
+		all, _ := repository.FindByAccount("a")
+		assert.Equal(t, []*models.OAuthConsent{treadmill}, all)
+	})
+}
+
+// testOAuthAuthorizationCodeRepository runs the behaviour every
+// OAuthAuthorizationCodeRepository implementation has to provide against an
+// empty repository.
+func testOAuthAuthorizationCodeRepository(t *testing.T, repository OAuthAuthorizationCodeRepository) {
+	code := &models.OAuthAuthorizationCode{CodeHash: "hash", ClientId: "c1", AccountId: "a", RedirectURI: "https://coach.example/callback", Scopes: []string{models.ScopeRunsRead}, CodeChallenge: "challenge", ExpiresAt: primitive.Timestamp{T: 200}, CreatedAt: primitive.Timestamp{T: 100}}
+
+	t.Run("consume once", func(t *testing.T) {
+		assert.Nil(t, repository.Insert(code))
+		assert.ErrorIs(t, repository.Insert(code), ErrDuplicate)
+
+		got, err := repository.Consume("hash")
+		assert.Nil(t, err)
+		assert.Equal(t, code, got)
+
+		_, err = repository.Consume("hash")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("delete expired", func(t *testing.T) {
+		assert.Nil(t, repository.Insert(&models.OAuthAuthorizationCode{CodeHash: "old", ExpiresAt: primitive.Timestamp{T: 100}}))
+		assert.Nil(t, repository.Insert(&models.OAuthAuthorizationCode{CodeHash: "new", ExpiresAt: primitive.Timestamp{T: 300}}))
+		assert.Nil(t, repository.DeleteExpired(primitive.Timestamp{T: 200}))
+
+		_, err := repository.Consume("old")
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = repository.Consume("new")
+		assert.Nil(t, err)
+	})
+}
+
+func TestMemoryAccountRepository(t *testing.T) {
+	testAccountRepository(t, NewMemoryAccountRepository())
+}
+
+func TestMemoryRunRepository(t *testing.T) {
+	testRunRepository(t, NewMemoryRunRepository())
+}
+
+func TestMemoryTokenFamilyRepository(t *testing.T) {
+	testTokenFamilyRepository(t, NewMemoryTokenFamilyRepository())
+}
+
+func TestMemoryRevokedTokenRepository(t *testing.T) {
+	testRevokedTokenRepository(t, NewMemoryRevokedTokenRepository())
+}
+
+func TestMemorySigningKeyRepository(t *testing.T) {
+	testSigningKeyRepository(t, NewMemorySigningKeyRepository())
+}
+
+func TestMemoryPasswordResetTokenRepository(t *testing.T) {
+	testPasswordResetTokenRepository(t, NewMemoryPasswordResetTokenRepository())
+}
+
+func TestMemoryEmailVerificationTokenRepository(t *testing.T) {
+	testEmailVerificationTokenRepository(t, NewMemoryEmailVerificationTokenRepository())
+}
+
+func TestMemoryLoginThrottleRepository(t *testing.T) {
+	testLoginThrottleRepository(t, NewMemoryLoginThrottleRepository())
+}
+
+func TestMemoryPersonalAccessTokenRepository(t *testing.T) {
+	testPersonalAccessTokenRepository(t, NewMemoryPersonalAccessTokenRepository())
+}
+
+func TestMemoryOAuthClientRepository(t *testing.T) {
+	testOAuthClientRepository(t, NewMemoryOAuthClientRepository())
+}
+
+func TestMemoryOAuthConsentRepository(t *testing.T) {
+	testOAuthConsentRepository(t, NewMemoryOAuthConsentRepository())
+}
+
+func TestMemoryOAuthAuthorizationCodeRepository(t *testing.T) {
+	testOAuthAuthorizationCodeRepository(t, NewMemoryOAuthAuthorizationCodeRepository())
+}
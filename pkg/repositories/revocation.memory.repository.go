@@ -0,0 +1,50 @@
+package repositories
+
+import (
+	"sync"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryRevokedTokenRepository keeps revoked tokens in process memory. It is
+// meant for development and tests; nothing survives a restart.
+type MemoryRevokedTokenRepository struct {
+	mu     sync.RWMutex
+	tokens map[string]models.RevokedToken
+}
+
+func NewMemoryRevokedTokenRepository() *MemoryRevokedTokenRepository {
+	return &MemoryRevokedTokenRepository{tokens: make(map[string]models.RevokedToken)}
+}
+
+func (r *MemoryRevokedTokenRepository) Insert(token *models.RevokedToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.tokens[token.TokenId]; ok {
+		return ErrDuplicate
+	}
+	r.tokens[token.TokenId] = *token
+	return nil
+}
+
+func (r *MemoryRevokedTokenRepository) Exists(tokenId string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.tokens[tokenId]
+	return ok, nil
+}
+
+func (r *MemoryRevokedTokenRepository) DeleteExpired(before primitive.Timestamp) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for tokenId, token := range r.tokens {
+		if token.ExpiresAt.T < before.T {
+			delete(r.tokens, tokenId)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoRevokedTokenRepository struct {
+	tokenCollection *mongo.Collection
+	ctx             context.Context
+}
+
+func NewMongoRevokedTokenRepository(tokenCollection *mongo.Collection, ctx context.Context) *MongoRevokedTokenRepository {
+	return &MongoRevokedTokenRepository{
+		tokenCollection: tokenCollection,
+		ctx:             ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes revocation lookups rely on.
+// It is safe to call on every startup.
+func (r *MongoRevokedTokenRepository) EnsureIndexes() error {
+	_, err := r.tokenCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenId", Value: 1}}, Options: options.Index().SetName("tokenId_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetName("expiresAt")},
+	})
+	return err
+}
+
+func (r *MongoRevokedTokenRepository) Insert(token *models.RevokedToken) error {
+	_, err := r.tokenCollection.InsertOne(r.ctx, token)
+	return mongoError(err)
+}
+
+func (r *MongoRevokedTokenRepository) Exists(tokenId string) (bool, error) {
+	count, err := r.tokenCollection.CountDocuments(r.ctx, bson.M{"tokenId": tokenId}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+func (r *MongoRevokedTokenRepository) DeleteExpired(before primitive.Timestamp) error {
+	_, err := r.tokenCollection.DeleteMany(r.ctx, bson.M{"expiresAt": bson.M{"$lt": before}})
+	return err
+}
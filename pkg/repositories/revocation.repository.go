@@ -0,0 +1,13 @@
+package repositories
+
+import (
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RevokedTokenRepository interface {
+	Insert(*models.RevokedToken) error
+	Exists(tokenId string) (bool, error)
+	// DeleteExpired forgets every token that expired before the given time.
+	DeleteExpired(primitive.Timestamp) error
+}
@@ -0,0 +1,35 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SQLiteRevokedTokenRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRevokedTokenRepository(db *sql.DB) *SQLiteRevokedTokenRepository {
+	return &SQLiteRevokedTokenRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteRevokedTokenRepository) Insert(token *models.RevokedToken) error {
+	_, err := r.db.Exec("INSERT INTO revoked_tokens (token_id, account_id, expires_at) VALUES (?, ?, ?)",
+		token.TokenId, token.AccountId, token.ExpiresAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLiteRevokedTokenRepository) Exists(tokenId string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow("SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE token_id = ?)", tokenId).Scan(&exists)
+	return exists, err
+}
+
+func (r *SQLiteRevokedTokenRepository) DeleteExpired(before primitive.Timestamp) error {
+	_, err := r.db.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", before.T)
+	return err
+}
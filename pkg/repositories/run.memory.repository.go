@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"sync"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+// MemoryRunRepository keeps runs in process memory. It is meant for
+// development and tests; nothing survives a restart.
+type MemoryRunRepository struct {
+	mu   sync.RWMutex
+	runs []models.Run
+}
+
+func NewMemoryRunRepository() *MemoryRunRepository {
+	return &MemoryRunRepository{}
+}
+
+func (r *MemoryRunRepository) Insert(run *models.Run) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.indexOf(run.AccountId, run.RunId) >= 0 {
+		return ErrDuplicate
+	}
+
+	r.runs = append(r.runs, cloneRun(run))
+	return nil
+}
+
+func (r *MemoryRunRepository) FindOne(accountId string, runId string) (*models.Run, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.indexOf(accountId, runId)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	run := cloneRun(&r.runs[i])
+	return &run, nil
+}
+
+func (r *MemoryRunRepository) FindByAccount(accountId string) ([]*models.Run, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var runs []*models.Run
+	for i := range r.runs {
+		if r.runs[i].AccountId == accountId {
+			run := cloneRun(&r.runs[i])
+			runs = append(runs, &run)
+		}
+	}
+	return runs, nil
+}
+
+func (r *MemoryRunRepository) Update(run *models.Run) (*models.Run, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(run.AccountId, run.RunId)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	r.runs[i] = cloneRun(run)
+	result := cloneRun(run)
+	return &result, nil
+}
+
+func (r *MemoryRunRepository) Delete(accountId string, runId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(accountId, runId)
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.runs = append(r.runs[:i], r.runs[i+1:]...)
+	return nil
+}
+
+func (r *MemoryRunRepository) indexOf(accountId string, runId string) int {
+	for i := range r.runs {
+		if r.runs[i].AccountId == accountId && r.runs[i].RunId == runId {
+			return i
+		}
+	}
+	return -1
+}
+
+// cloneRun copies run so callers never share slices with the stored value.
+func cloneRun(run *models.Run) models.Run {
+	clone := *run
+	if run.Splits != nil {
+		clone.Splits = append([]models.Split(nil), run.Splits...)
+	}
+	if run.Track != nil {
+		clone.Track = append([]models.TrackPoint(nil), run.Track...)
+	}
+	return clone
+}
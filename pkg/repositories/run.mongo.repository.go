@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoRunRepository struct {
+	runCollection *mongo.Collection
+	ctx           context.Context
+}
+
+func NewMongoRunRepository(runCollection *mongo.Collection, ctx context.Context) *MongoRunRepository {
+	return &MongoRunRepository{
+		runCollection: runCollection,
+		ctx:           ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes run lookups and listings rely on. It is
+// safe to call on every startup.
+func (r *MongoRunRepository) EnsureIndexes() error {
+	_, err := r.runCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "accountId", Value: 1}, {Key: "runId", Value: 1}},
+			Options: options.Index().SetName("accountId_runId_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "accountId", Value: 1}, {Key: "createdAt", Value: 1}},
+			Options: options.Index().SetName("accountId_createdAt"),
+		},
+	})
+	return err
+}
+
+func (r *MongoRunRepository) Insert(run *models.Run) error {
+	_, err := r.runCollection.InsertOne(r.ctx, run)
+	return mongoError(err)
+}
+
+func (r *MongoRunRepository) FindOne(accountId string, runId string) (*models.Run, error) {
+	var run *models.Run
+	query := bson.M{"accountId": accountId, "runId": runId}
+
+	err := r.runCollection.FindOne(r.ctx, query).Decode(&run)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return run, nil
+}
+
+func (r *MongoRunRepository) FindByAccount(accountId string) ([]*models.Run, error) {
+	var runs []*models.Run
+	filter := bson.M{"accountId": accountId}
+
+	opt := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+
+	cursor, err := r.runCollection.Find(r.ctx, filter, opt)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(r.ctx)
+
+	for cursor.Next(r.ctx) {
+		var run models.Run
+		if err := cursor.Decode(&run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, &run)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+func (r *MongoRunRepository) Update(run *models.Run) (*models.Run, error) {
+	var result *models.Run
+	filter := bson.M{"accountId": run.AccountId, "runId": run.RunId}
+
+	// The whole document is replaced so fields the run no longer has, such as
+	// removed splits, do not linger.
+	upsert := false
+	after := options.After
+	opt := options.FindOneAndReplaceOptions{
+		ReturnDocument: &after,
+		Upsert:         &upsert,
+	}
+
+	updatedRun := r.runCollection.FindOneAndReplace(r.ctx, filter, run, &opt)
+	if err := updatedRun.Err(); err != nil {
+		return nil, mongoError(err)
+	}
+
+	err := updatedRun.Decode(&result)
+	return result, err
+}
+
+func (r *MongoRunRepository) Delete(accountId string, runId string) error {
+	filter := bson.M{"accountId": accountId, "runId": runId}
+
+	result, err := r.runCollection.DeleteOne(r.ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package repositories
+
+import "github.com/croisade/chimichanga/pkg/models"
+
+type RunRepository interface {
+	Insert(*models.Run) error
+	FindOne(accountId string, runId string) (*models.Run, error)
+	FindByAccount(string) ([]*models.Run, error)
+	Update(*models.Run) (*models.Run, error)
+	Delete(accountId string, runId string) error
+}
@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sqliteRunColumns = "run_id, account_id, pace, time, distance, incline, elevation_gain, splits, track, created_at, updated_at"
+
+type SQLiteRunRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteRunRepository(db *sql.DB) *SQLiteRunRepository {
+	return &SQLiteRunRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteRunRepository) Insert(run *models.Run) error {
+	splits, err := marshalArray(run.Splits)
+	if err != nil {
+		return err
+	}
+	track, err := marshalArray(run.Track)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec("INSERT INTO runs ("+sqliteRunColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		run.RunId, run.AccountId, run.Pace, run.Time.Seconds(), run.Distance, run.Incline, run.ElevationGain,
+		splits, track, run.CreatedAt.T, run.UpdatedAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLiteRunRepository) FindOne(accountId string, runId string) (*models.Run, error) {
+	row := r.db.QueryRow("SELECT "+sqliteRunColumns+" FROM runs WHERE account_id = ? AND run_id = ?", accountId, runId)
+
+	run, err := scanRun(row)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+	return run, nil
+}
+
+func (r *SQLiteRunRepository) FindByAccount(accountId string) ([]*models.Run, error) {
+	rows, err := r.db.Query("SELECT "+sqliteRunColumns+" FROM runs WHERE account_id = ? ORDER BY created_at, rowid", accountId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*models.Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (r *SQLiteRunRepository) Update(run *models.Run) (*models.Run, error) {
+	splits, err := marshalArray(run.Splits)
+	if err != nil {
+		return nil, err
+	}
+	track, err := marshalArray(run.Track)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.db.Exec(`UPDATE runs SET pace = ?, time = ?, distance = ?, incline = ?, elevation_gain = ?,
+	splits = ?, track = ?, updated_at = ?
+	WHERE account_id = ? AND run_id = ?`,
+		run.Pace, run.Time.Seconds(), run.Distance, run.Incline, run.ElevationGain, splits, track, run.UpdatedAt.T,
+		run.AccountId, run.RunId)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated, _ := result.RowsAffected(); updated != 1 {
+		return nil, ErrNotFound
+	}
+	return r.FindOne(run.AccountId, run.RunId)
+}
+
+func (r *SQLiteRunRepository) Delete(accountId string, runId string) error {
+	result, err := r.db.Exec("DELETE FROM runs WHERE account_id = ? AND run_id = ?", accountId, runId)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanRun(row rowScanner) (*models.Run, error) {
+	var run models.Run
+	var seconds float64
+	var splits, track string
+	var createdAt, updatedAt uint32
+
+	err := row.Scan(&run.RunId, &run.AccountId, &run.Pace, &seconds, &run.Distance, &run.Incline, &run.ElevationGain,
+		&splits, &track, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(splits), &run.Splits); err != nil {
+		return nil, err
+	}
+	if len(run.Splits) == 0 {
+		run.Splits = nil
+	}
+	if err := json.Unmarshal([]byte(track), &run.Track); err != nil {
+		return nil, err
+	}
+	if len(run.Track) == 0 {
+		run.Track = nil
+	}
+
+	run.Time = models.DurationFromSeconds(seconds)
+	run.CreatedAt = primitive.Timestamp{T: createdAt}
+	run.UpdatedAt = primitive.Timestamp{T: updatedAt}
+	return &run, nil
+}
+
+// marshalArray stores the splits or track of a run as a JSON array, they are
+// only ever read together with their run.
+func marshalArray(values interface{}) (string, error) {
+	data, err := json.Marshal(values)
+	if string(data) == "null" {
+		return "[]", err
+	}
+	return string(data), err
+}
@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"sync"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryTokenFamilyRepository keeps refresh token families in process memory.
+// It is meant for development and tests; nothing survives a restart.
+type MemoryTokenFamilyRepository struct {
+	mu       sync.RWMutex
+	families []models.TokenFamily
+}
+
+func NewMemoryTokenFamilyRepository() *MemoryTokenFamilyRepository {
+	return &MemoryTokenFamilyRepository{}
+}
+
+func (r *MemoryTokenFamilyRepository) Insert(family *models.TokenFamily) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.indexOf(family.FamilyId) >= 0 {
+		return ErrDuplicate
+	}
+	r.families = append(r.families, *family)
+	return nil
+}
+
+func (r *MemoryTokenFamilyRepository) FindById(familyId string) (*models.TokenFamily, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.indexOf(familyId)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	family := r.families[i]
+	return &family, nil
+}
+
+func (r *MemoryTokenFamilyRepository) Rotate(familyId string, currentTokenId string, nextTokenId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(familyId)
+	if i < 0 || r.families[i].Revoked || r.families[i].CurrentTokenId != currentTokenId {
+		return ErrNotFound
+	}
+	r.families[i].CurrentTokenId = nextTokenId
+	r.families[i].UpdatedAt = now()
+	return nil
+}
+
+func (r *MemoryTokenFamilyRepository) Revoke(familyId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(familyId)
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.families[i].Revoked = true
+	r.families[i].UpdatedAt = now()
+	return nil
+}
+
+func (r *MemoryTokenFamilyRepository) RevokeByAccount(accountId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.families {
+		if r.families[i].AccountId == accountId {
+			r.families[i].Revoked = true
+			r.families[i].UpdatedAt = now()
+		}
+	}
+	return nil
+}
+
+func (r *MemoryTokenFamilyRepository) RevokeByClient(accountId string, clientId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.families {
+		if r.families[i].AccountId == accountId && r.families[i].ClientId == clientId {
+			r.families[i].Revoked = true
+			r.families[i].UpdatedAt = now()
+		}
+	}
+	return nil
+}
+
+func (r *MemoryTokenFamilyRepository) indexOf(familyId string) int {
+	for i := range r.families {
+		if r.families[i].FamilyId == familyId {
+			return i
+		}
+	}
+	return -1
+}
+
+func now() primitive.Timestamp {
+	return primitive.Timestamp{T: uint32(time.Now().Unix())}
+}
@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoTokenFamilyRepository struct {
+	familyCollection *mongo.Collection
+	ctx              context.Context
+}
+
+func NewMongoTokenFamilyRepository(familyCollection *mongo.Collection, ctx context.Context) *MongoTokenFamilyRepository {
+	return &MongoTokenFamilyRepository{
+		familyCollection: familyCollection,
+		ctx:              ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes family lookups and revocations rely on.
+// It is safe to call on every startup.
+func (r *MongoTokenFamilyRepository) EnsureIndexes() error {
+	_, err := r.familyCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "familyId", Value: 1}}, Options: options.Index().SetName("familyId_unique").SetUnique(true)},
+		{Keys: bson.D{{Key: "accountId", Value: 1}}, Options: options.Index().SetName("accountId")},
+	})
+	return err
+}
+
+func (r *MongoTokenFamilyRepository) Insert(family *models.TokenFamily) error {
+	_, err := r.familyCollection.InsertOne(r.ctx, family)
+	return mongoError(err)
+}
+
+func (r *MongoTokenFamilyRepository) FindById(familyId string) (*models.TokenFamily, error) {
+	var family *models.TokenFamily
+	err := r.familyCollection.FindOne(r.ctx, bson.M{"familyId": familyId}).Decode(&family)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return family, nil
+}
+
+func (r *MongoTokenFamilyRepository) Rotate(familyId string, currentTokenId string, nextTokenId string) error {
+	// Matching on the current token makes concurrent refreshes with the same
+	// token race for a single winner.
+	filter := bson.M{"familyId": familyId, "currentTokenId": currentTokenId, "revoked": false}
+	update := bson.M{"$set": bson.M{"currentTokenId": nextTokenId, "updatedAt": now()}}
+
+	result, err := r.familyCollection.UpdateOne(r.ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoTokenFamilyRepository) Revoke(familyId string) error {
+	update := bson.M{"$set": bson.M{"revoked": true, "updatedAt": now()}}
+
+	result, err := r.familyCollection.UpdateOne(r.ctx, bson.M{"familyId": familyId}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoTokenFamilyRepository) RevokeByAccount(accountId string) error {
+	update := bson.M{"$set": bson.M{"revoked": true, "updatedAt": now()}}
+
+	_, err := r.familyCollection.UpdateMany(r.ctx, bson.M{"accountId": accountId, "revoked": false}, update)
+	return err
+}
+
+func (r *MongoTokenFamilyRepository) RevokeByClient(accountId string, clientId string) error {
+	update := bson.M{"$set": bson.M{"revoked": true, "updatedAt": now()}}
+
+	_, err := r.familyCollection.UpdateMany(r.ctx, bson.M{"accountId": accountId, "clientId": clientId, "revoked": false}, update)
+	return err
+}
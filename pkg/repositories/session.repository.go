@@ -0,0 +1,15 @@
+package repositories
+
+import "github.com/croisade/chimichanga/pkg/models"
+
+type TokenFamilyRepository interface {
+	Insert(*models.TokenFamily) error
+	FindById(string) (*models.TokenFamily, error)
+	// Rotate moves a live family from its current token to the next one. It
+	// returns ErrNotFound when the family is revoked or has already moved on.
+	Rotate(familyId string, currentTokenId string, nextTokenId string) error
+	Revoke(familyId string) error
+	RevokeByAccount(accountId string) error
+	// RevokeByClient revokes the families a client was issued for an account.
+	RevokeByClient(accountId string, clientId string) error
+}
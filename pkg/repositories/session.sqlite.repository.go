@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const sqliteTokenFamilyColumns = "family_id, account_id, device, client_id, current_token_id, revoked, created_at, updated_at"
+
+type SQLiteTokenFamilyRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteTokenFamilyRepository(db *sql.DB) *SQLiteTokenFamilyRepository {
+	return &SQLiteTokenFamilyRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteTokenFamilyRepository) Insert(family *models.TokenFamily) error {
+	_, err := r.db.Exec("INSERT INTO token_families ("+sqliteTokenFamilyColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		family.FamilyId, family.AccountId, family.Device, family.ClientId, family.CurrentTokenId, family.Revoked,
+		family.CreatedAt.T, family.UpdatedAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLiteTokenFamilyRepository) FindById(familyId string) (*models.TokenFamily, error) {
+	row := r.db.QueryRow("SELECT "+sqliteTokenFamilyColumns+" FROM token_families WHERE family_id = ?", familyId)
+
+	var family models.TokenFamily
+	var createdAt, updatedAt uint32
+	err := row.Scan(&family.FamilyId, &family.AccountId, &family.Device, &family.ClientId, &family.CurrentTokenId, &family.Revoked,
+		&createdAt, &updatedAt)
+	if err != nil {
+		return nil, sqliteError(err)
+	}
+
+	family.CreatedAt = primitive.Timestamp{T: createdAt}
+	family.UpdatedAt = primitive.Timestamp{T: updatedAt}
+	return &family, nil
+}
+
+func (r *SQLiteTokenFamilyRepository) Rotate(familyId string, currentTokenId string, nextTokenId string) error {
+	result, err := r.db.Exec(`UPDATE token_families SET current_token_id = ?, updated_at = ?
+	WHERE family_id = ? AND current_token_id = ? AND NOT revoked`,
+		nextTokenId, now().T, familyId, currentTokenId)
+	if err != nil {
+		return err
+	}
+
+	if updated, _ := result.RowsAffected(); updated != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteTokenFamilyRepository) Revoke(familyId string) error {
+	result, err := r.db.Exec("UPDATE token_families SET revoked = TRUE, updated_at = ? WHERE family_id = ?", now().T, familyId)
+	if err != nil {
+		return err
+	}
+
+	if updated, _ := result.RowsAffected(); updated != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteTokenFamilyRepository) RevokeByAccount(accountId string) error {
+	_, err := r.db.Exec("UPDATE token_families SET revoked = TRUE, updated_at = ? WHERE account_id = ? AND NOT revoked",
+		now().T, accountId)
+	return err
+}
+
+func (r *SQLiteTokenFamilyRepository) RevokeByClient(accountId string, clientId string) error {
+	_, err := r.db.Exec("UPDATE token_families SET revoked = TRUE, updated_at = ? WHERE account_id = ? AND client_id = ? AND NOT revoked",
+		now().T, accountId, clientId)
+	return err
+}
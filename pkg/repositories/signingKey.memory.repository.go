@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+// MemorySigningKeyRepository keeps signing keys in process memory. It is
+// meant for development and tests; every restart signs with new keys.
+type MemorySigningKeyRepository struct {
+	mu   sync.RWMutex
+	keys []models.SigningKey
+}
+
+func NewMemorySigningKeyRepository() *MemorySigningKeyRepository {
+	return &MemorySigningKeyRepository{}
+}
+
+func (r *MemorySigningKeyRepository) Insert(key *models.SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		if r.keys[i].KeyId == key.KeyId {
+			return ErrDuplicate
+		}
+	}
+	r.keys = append(r.keys, *key)
+	sort.SliceStable(r.keys, func(i, j int) bool { return r.keys[i].CreatedAt.T < r.keys[j].CreatedAt.T })
+	return nil
+}
+
+func (r *MemorySigningKeyRepository) FindAll() ([]*models.SigningKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := make([]*models.SigningKey, len(r.keys))
+	for i := range r.keys {
+		key := r.keys[i]
+		results[i] = &key
+	}
+	return results, nil
+}
+
+func (r *MemorySigningKeyRepository) Delete(keyId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		if r.keys[i].KeyId == keyId {
+			r.keys = append(r.keys[:i], r.keys[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
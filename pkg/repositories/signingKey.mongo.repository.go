@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoSigningKeyRepository struct {
+	keyCollection *mongo.Collection
+	ctx           context.Context
+}
+
+func NewMongoSigningKeyRepository(keyCollection *mongo.Collection, ctx context.Context) *MongoSigningKeyRepository {
+	return &MongoSigningKeyRepository{
+		keyCollection: keyCollection,
+		ctx:           ctx,
+	}
+}
+
+// EnsureIndexes creates the indexes key lookups rely on.
+// It is safe to call on every startup.
+func (r *MongoSigningKeyRepository) EnsureIndexes() error {
+	_, err := r.keyCollection.Indexes().CreateMany(r.ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "kid", Value: 1}}, Options: options.Index().SetName("kid_unique").SetUnique(true)},
+	})
+	return err
+}
+
+func (r *MongoSigningKeyRepository) Insert(key *models.SigningKey) error {
+	_, err := r.keyCollection.InsertOne(r.ctx, key)
+	return mongoError(err)
+}
+
+func (r *MongoSigningKeyRepository) FindAll() ([]*models.SigningKey, error) {
+	var results []*models.SigningKey
+
+	cursor, err := r.keyCollection.Find(r.ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(r.ctx, &results)
+	return results, err
+}
+
+func (r *MongoSigningKeyRepository) Delete(keyId string) error {
+	result, err := r.keyCollection.DeleteOne(r.ctx, bson.M{"kid": keyId})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
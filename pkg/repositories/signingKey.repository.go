@@ -0,0 +1,10 @@
+package repositories
+
+import "github.com/croisade/chimichanga/pkg/models"
+
+type SigningKeyRepository interface {
+	Insert(*models.SigningKey) error
+	// FindAll returns every key, oldest first.
+	FindAll() ([]*models.SigningKey, error)
+	Delete(keyId string) error
+}
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"database/sql"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SQLiteSigningKeyRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteSigningKeyRepository(db *sql.DB) *SQLiteSigningKeyRepository {
+	return &SQLiteSigningKeyRepository{
+		db: db,
+	}
+}
+
+func (r *SQLiteSigningKeyRepository) Insert(key *models.SigningKey) error {
+	_, err := r.db.Exec("INSERT INTO signing_keys (key_id, algorithm, private_key, created_at) VALUES (?, ?, ?, ?)",
+		key.KeyId, key.Algorithm, key.PrivateKey, key.CreatedAt.T)
+	return sqliteError(err)
+}
+
+func (r *SQLiteSigningKeyRepository) FindAll() ([]*models.SigningKey, error) {
+	rows, err := r.db.Query("SELECT key_id, algorithm, private_key, created_at FROM signing_keys ORDER BY created_at, rowid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*models.SigningKey
+	for rows.Next() {
+		var key models.SigningKey
+		var createdAt uint32
+		if err := rows.Scan(&key.KeyId, &key.Algorithm, &key.PrivateKey, &createdAt); err != nil {
+			return nil, err
+		}
+		key.CreatedAt = primitive.Timestamp{T: createdAt}
+		results = append(results, &key)
+	}
+	return results, rows.Err()
+}
+
+func (r *SQLiteSigningKeyRepository) Delete(keyId string) error {
+	result, err := r.db.Exec("DELETE FROM signing_keys WHERE key_id = ?", keyId)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/croisade/chimichanga/pkg/migrations"
+)
+
+func openTestSQLite(t *testing.T) *sql.DB {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := migrations.NewSQLiteMigrator(db).Up(); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	return db
+}
+
+func TestSQLiteAccountRepository(t *testing.T) {
+	testAccountRepository(t, NewSQLiteAccountRepository(openTestSQLite(t)))
+}
+
+func TestSQLiteRunRepository(t *testing.T) {
+	testRunRepository(t, NewSQLiteRunRepository(openTestSQLite(t)))
+}
+
+func TestSQLiteTokenFamilyRepository(t *testing.T) {
+	testTokenFamilyRepository(t, NewSQLiteTokenFamilyRepository(openTestSQLite(t)))
+}
+
+func TestSQLiteRevokedTokenRepository(t *testing.T) {
+	testRevokedTokenRepository(t, NewSQLiteRevokedTokenRepository(openTestSQLite(t)))
+}
+
+func TestSQLiteSigningKeyRepository(t *testing.T) {
+	testSigningKeyRepository(t, NewSQLiteSigningKeyRepository(openTestSQLite(t)))
+}
+
+func TestSQLitePasswordResetTokenRepository(t *testing.T) {
+	testPasswordResetTokenRepository(t, NewSQLitePasswordResetTokenRepository(openTestSQLite(t)))
+}
+
+func TestSQLiteEmailVerificationTokenRepository(t *testing.T) {
+	testEmailVerificationTokenRepository(t, NewSQLiteEmailVerificationTokenRepository(openTestSQLite(t)))
+}
+
+func TestSQLiteLoginThrottleRepository(t *testing.T) {
+	testLoginThrottleRepository(t, NewSQLiteLoginThrottleRepository(openTestSQLite(t)))
+}
+
+func TestSQLitePersonalAccessTokenRepository(t *testing.T) {
+	testPersonalAccessTokenRepository(t, NewSQLitePersonalAccessTokenRepository(openTestSQLite(t)))
+}
+
+func TestSQLiteOAuthClientRepository(t *testing.T) {
+	testOAuthClientRepository(t, NewSQLiteOAuthClientRepository(openTestSQLite(t)))
+}
+
+func TestSQLiteOAuthConsentRepository(t *testing.T) {
+	testOAuthConsentRepository(t, NewSQLiteOAuthConsentRepository(openTestSQLite(t)))
+}
+
+func TestSQLiteOAuthAuthorizationCodeRepository(t *testing.T) {
+	testOAuthAuthorizationCodeRepository(t, NewSQLiteOAuthAuthorizationCodeRepository(openTestSQLite(t)))
+}
@@ -1,16 +1,13 @@
 package services
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/croisade/chimichanga/pkg/models"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/croisade/chimichanga/pkg/repositories"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,16 +15,30 @@ type AccountService interface {
 	CreateAccount(*models.Account) (*models.Account, error)
 	GetAccount(string) (*models.Account, error)
 	GetAccounts() ([]*models.Account, error)
-	FindByRefreshToken(string) (*models.Account, error)
 	DeleteAccount(string) error
+	// UpdateAccount changes the profile of an account, not its password.
 	UpdateAccount(*models.Account) (*models.Account, error)
+	// ChangePassword sets a new password once the current one is given.
+	ChangePassword(accountId string, currentPassword string, newPassword string) (*models.Account, error)
+	SetRoles(accountId string, roles []string) (*models.Account, error)
 	Login(*LoginValidation) (*models.Account, error)
-	Logout(*LogoutValidation) error
 }
 
+var (
+	ErrAccountExists      = errors.New("account already exists")
+	ErrUnknownRole        = errors.New("unknown role")
+	ErrNoRoles            = errors.New("an account needs at least one role")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrWrongPassword      = errors.New("current password is wrong")
+)
+
+// unknownAccountHash is checked against when no account has the email logged
+// in to, taking as long as checking a real password.
+var unknownAccountHash, _ = hashPassword("unknown account")
+
 type AccountServiceImpl struct {
-	accountcollection *mongo.Collection
-	ctx               context.Context
+	accountRepository repositories.AccountRepository
+	passwordPolicy    PasswordPolicy
 }
 
 type LoginValidation struct {
@@ -35,79 +46,64 @@ type LoginValidation struct {
 	Password string `json:"password" bson:"password" binding:"required"`
 }
 
+// LogoutValidation ends the session of RefreshToken, or every session of
+// the account when it is left out.
 type LogoutValidation struct {
-	AccountId string `json:"accountId" binding:"required"`
+	AccountId    string `json:"accountId" binding:"required"`
+	RefreshToken string `json:"refreshToken"`
 }
 
-func NewAccountServiceImpl(accountcollection *mongo.Collection, ctx context.Context) *AccountServiceImpl {
+func NewAccountServiceImpl(accountRepository repositories.AccountRepository, passwordPolicy PasswordPolicy) *AccountServiceImpl {
 	return &AccountServiceImpl{
-		accountcollection: accountcollection,
-		ctx:               ctx,
+		accountRepository: accountRepository,
+		passwordPolicy:    passwordPolicy,
 	}
 }
 
 func (s *AccountServiceImpl) CreateAccount(account *models.Account) (*models.Account, error) {
-	var result *models.Account
-
-	insertFilter := bson.M{"email": account.Email}
-	err := s.accountcollection.FindOne(s.ctx, insertFilter).Decode(&result)
-	if err == nil {
-		return nil, errors.New("account already exists")
+	if err := s.passwordPolicy.Check(account.Password, account); err != nil {
+		return nil, err
 	}
-
 	hashedPassword, err := s.HashPassword(account.Password)
 	if err != nil {
 		return nil, err
 	}
 	account.Password = hashedPassword
+	account.Units = account.Units.OrDefault()
+	account.Roles = []string{models.RoleUser}
+	account.EmailVerified = false
+	account.TOTPEnabled = false
 	account.AccountId = primitive.NewObjectID().Hex()
 	account.CreatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
 	account.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
 
-	_, err = s.accountcollection.InsertOne(s.ctx, account)
+	// Uniqueness of the email is enforced by the repository, checking first
+	// and inserting afterwards would race with concurrent signups.
+	err = s.accountRepository.Insert(account)
 
+	if errors.Is(err, repositories.ErrDuplicate) {
+		return nil, ErrAccountExists
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	filter := bson.M{"accountId": account.AccountId}
-	err = s.accountcollection.FindOne(s.ctx, filter).Decode(&result)
-	return result, err
+	return s.accountRepository.FindById(account.AccountId)
 }
 
 func (s *AccountServiceImpl) GetAccount(accountId string) (*models.Account, error) {
-	var result *models.Account
-	var err error
-
-	filter := bson.M{"accountId": accountId}
-	err = s.accountcollection.FindOne(s.ctx, filter).Decode(&result)
-
-	return result, err
+	return s.accountRepository.FindById(accountId)
 }
 
 func (s *AccountServiceImpl) GetAccounts() ([]*models.Account, error) {
-	var results []*models.Account
-	var err error
-	var cursor *mongo.Cursor
-	cursor, err = s.accountcollection.Find(s.ctx, bson.M{})
-
-	if err != nil {
-		return nil, err
-	}
-
-	err = cursor.All(s.ctx, &results)
-	return results, err
+	return s.accountRepository.FindAll()
 }
 
 func (s *AccountServiceImpl) DeleteAccount(accountId string) error {
-	_, err := s.accountcollection.DeleteOne(s.ctx, bson.M{"accountId": accountId})
-	return err
+	return s.accountRepository.Delete(accountId)
 }
 
 func (s *AccountServiceImpl) UpdateAccount(account *models.Account) (*models.Account, error) {
-	filter := bson.M{"accountId": account.AccountId}
-	var result *models.Account
-
 	existingAccount, err := s.GetAccount(account.AccountId)
 
 	if err != nil {
@@ -118,84 +114,90 @@ func (s *AccountServiceImpl) UpdateAccount(account *models.Account) (*models.Acc
 	// if account.Email != "" {
 	// 	existingAccount.Email = account.Email
 	// }
-	if account.Password != "" {
-		existingAccount.Password = account.Password
-	}
 	if account.FirstName != "" {
 		existingAccount.FirstName = account.FirstName
 	}
 	if account.LastName != "" {
 		existingAccount.LastName = account.LastName
 	}
-	if account.RefreshToken != "" {
-		existingAccount.RefreshToken = account.RefreshToken
+	if account.Units != "" {
+		existingAccount.Units = account.Units
 	}
 
 	existingAccount.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
 
-	// updatedAccount, err := s.accountcollection.UpdateOne(s.ctx, filter, bson.M{"$set": existingAccount})
+	return s.accountRepository.Update(existingAccount)
+}
 
-	upsert := false
-	after := options.After
-	opt := options.FindOneAndUpdateOptions{
-		ReturnDocument: &after,
-		Upsert:         &upsert,
+func (s *AccountServiceImpl) ChangePassword(accountId string, currentPassword string, newPassword string) (*models.Account, error) {
+	account, err := s.GetAccount(accountId)
+	if err != nil {
+		return nil, err
 	}
-
-	updatedAccount := s.accountcollection.FindOneAndUpdate(s.ctx, filter, bson.M{"$set": existingAccount}, &opt)
-	if updatedAccount.Err() != nil {
-		return nil, updatedAccount.Err()
+	if !s.CheckPasswordHash(currentPassword, account.Password) {
+		return nil, ErrWrongPassword
+	}
+	if err := s.passwordPolicy.Check(newPassword, account); err != nil {
+		return nil, err
 	}
 
-	decodeErr := updatedAccount.Decode(&result)
-
-	return result, decodeErr
-}
-
-func (s *AccountServiceImpl) FindByRefreshToken(refreshToken string) (*models.Account, error) {
-	var result *models.Account
-	var err error
-
-	filter := bson.M{"refreshToken": refreshToken}
-	err = s.accountcollection.FindOne(s.ctx, filter).Decode(&result)
+	hashedPassword, err := s.HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	account.Password = hashedPassword
+	account.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
 
-	return result, err
+	return s.accountRepository.Update(account)
 }
 
-func (s *AccountServiceImpl) Login(login *LoginValidation) (*models.Account, error) {
-	var result *models.Account
-	var err error
+// SetRoles replaces the roles of an account. They apply to the tokens issued
+// from then on, including on the next refresh. An account keeps at least one
+// role, deleting it is the way to shut it out.
+func (s *AccountServiceImpl) SetRoles(accountId string, roles []string) (*models.Account, error) {
+	if len(roles) == 0 {
+		return nil, ErrNoRoles
+	}
+	for _, role := range roles {
+		if !models.IsRole(role) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRole, role)
+		}
+	}
 
-	hashedPassword, err := s.HashPassword(login.Password)
+	account, err := s.GetAccount(accountId)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(hashedPassword)
+	account.Roles = roles
+	account.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
 
-	filter := bson.M{"email": login.Email}
-	err = s.accountcollection.FindOne(s.ctx, filter).Decode(&result)
+	return s.accountRepository.Update(account)
+}
 
+// Login returns the account registered with the email when the password
+// matches. Unknown emails and wrong passwords fail alike, in about the same
+// time, so that callers cannot tell which emails are registered.
+func (s *AccountServiceImpl) Login(login *LoginValidation) (*models.Account, error) {
+	result, err := s.accountRepository.FindByEmail(login.Email)
+	if errors.Is(err, repositories.ErrNotFound) {
+		s.CheckPasswordHash(login.Password, unknownAccountHash)
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	isValid := s.CheckPasswordHash(login.Password, result.Password)
-
-	if isValid != true {
-		return nil, errors.New("Invalid password")
+	if !s.CheckPasswordHash(login.Password, result.Password) {
+		return nil, ErrInvalidCredentials
 	}
-
-	return result, err
+	return result, nil
 }
 
-func (s *AccountServiceImpl) Logout(login *LogoutValidation) error {
-	account := &models.Account{AccountId: login.AccountId, RefreshToken: "loggedOut"}
-	_, err := s.UpdateAccount(account)
-
-	return err
+func (s *AccountServiceImpl) HashPassword(password string) (string, error) {
+	return hashPassword(password)
 }
 
-func (s *AccountServiceImpl) HashPassword(password string) (string, error) {
+func hashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
 }
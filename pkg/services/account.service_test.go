@@ -4,8 +4,8 @@ import (
 	"testing"
 
 	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 func createAccountRoutine(f *AccountServiceImpl, list []*models.Account, out chan<- []*models.Account) {
@@ -17,16 +17,20 @@ func createAccountRoutine(f *AccountServiceImpl, list []*models.Account, out cha
 	out <- result
 }
 
+func resetAccountService() *AccountServiceImpl {
+	accountRepository = repositories.NewMemoryAccountRepository()
+	return NewAccountServiceImpl(accountRepository, testPasswordPolicy)
+}
+
 func TestAccountService(t *testing.T) {
-	accountService := NewAccountServiceImpl(accountCollection, ctx)
+	accountService := NewAccountServiceImpl(accountRepository, testPasswordPolicy)
 	want := &models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"}
 
 	t.Run("create Account", func(t *testing.T) {
-		accountCollection.DeleteMany(ctx, bson.D{{}})
-		var got *models.Account
+		accountService = resetAccountService()
 		accountService.CreateAccount(want)
 
-		err := accountCollection.FindOne(ctx, bson.M{"firstName": "first"}).Decode(&got)
+		got, err := accountRepository.FindByEmail(want.Email)
 
 		want.AccountId = got.AccountId
 
@@ -35,7 +39,7 @@ func TestAccountService(t *testing.T) {
 	})
 
 	t.Run("Should error out if account already exists", func(t *testing.T) {
-		accountCollection.DeleteMany(ctx, bson.D{{}})
+		accountService = resetAccountService()
 		accountService.CreateAccount(want)
 		_, err := accountService.CreateAccount(want)
 
@@ -43,7 +47,7 @@ func TestAccountService(t *testing.T) {
 	})
 
 	t.Run("get Account", func(t *testing.T) {
-		accountCollection.DeleteMany(ctx, bson.D{{}})
+		accountService = resetAccountService()
 		_, err := accountService.CreateAccount(want)
 		var got *models.Account
 		got, err = accountService.GetAccount(want.AccountId)
@@ -53,7 +57,7 @@ func TestAccountService(t *testing.T) {
 	})
 
 	t.Run("Update Account", func(t *testing.T) {
-		accountCollection.DeleteMany(ctx, bson.D{{}})
+		accountService = resetAccountService()
 		_, err := accountService.CreateAccount(want)
 		input := &models.Account{AccountId: want.AccountId, FirstName: "Middle"}
 
@@ -63,6 +67,40 @@ func TestAccountService(t *testing.T) {
 		assert.NotEqual(t, want.FirstName, got.FirstName)
 	})
 
+	t.Run("Update Account leaves the password alone", func(t *testing.T) {
+		accountService = resetAccountService()
+		accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+		created, _ := accountRepository.FindByEmail("test@example.com")
+
+		got, err := accountService.UpdateAccount(&models.Account{AccountId: created.AccountId, Password: "raw password"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, created.Password, got.Password)
+	})
+
+	t.Run("Change Password takes the current one and hashes the new one", func(t *testing.T) {
+		accountService = resetAccountService()
+		created, _ := accountService.CreateAccount(&models.Account{Email: "test@example.com", Password: "password", FirstName: "first", LastName: "last"})
+
+		_, err := accountService.ChangePassword(created.AccountId, "wrong", "new password")
+		assert.ErrorIs(t, err, ErrWrongPassword)
+
+		_, err = accountService.ChangePassword(created.AccountId, "password", "short")
+		assert.ErrorIs(t, err, ErrWeakPassword)
+
+		got, err := accountService.ChangePassword(created.AccountId, "password", "new password")
+		assert.Nil(t, err)
+		assert.NotEqual(t, "new password", got.Password)
+		assert.True(t, accountService.CheckPasswordHash("new password", got.Password))
+	})
+
+	t.Run("Create Account checks the password policy", func(t *testing.T) {
+		accountService = resetAccountService()
+
+		_, err := accountService.CreateAccount(&models.Account{Email: "first@example.com", Password: "First Last", FirstName: "first", LastName: "last"})
+		assert.ErrorIs(t, err, ErrWeakPassword)
+	})
+
 	t.Run("Delete Account", func(t *testing.T) {
 		accountService.DeleteAccount(want.AccountId)
 		_, err := accountService.GetAccount("123")
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/mail"
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EmailVerificationService proves that account holders receive mail at the
+// email they signed up with, through a token mailed to them.
+type EmailVerificationService interface {
+	// SendVerification mails a new verification token for account.
+	SendVerification(account *models.Account) error
+	// Resend mails a new verification token to the unverified account
+	// registered with email, at most once every resend interval. It succeeds
+	// without sending anything for unknown and verified emails and within the
+	// interval, so that callers cannot tell which emails are registered.
+	Resend(email string) error
+	Verify(token string) (*models.Account, error)
+	// CheckLogin refuses unverified accounts when verification is required.
+	CheckLogin(account *models.Account) error
+}
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailNotVerified         = errors.New("email address has not been verified")
+)
+
+// EmailVerificationConfig sets how long a verification token can be used,
+// how often it can be sent again and the link mailed with it. With
+// RequireVerified, unverified accounts cannot log in.
+type EmailVerificationConfig struct {
+	TokenLifetime   time.Duration
+	ResendInterval  time.Duration
+	URL             string
+	RequireVerified bool
+}
+
+type EmailVerificationServiceImpl struct {
+	tokenRepository   repositories.EmailVerificationTokenRepository
+	accountRepository repositories.AccountRepository
+	sender            mail.Sender
+	config            EmailVerificationConfig
+	now               func() time.Time
+}
+
+func NewEmailVerificationServiceImpl(tokenRepository repositories.EmailVerificationTokenRepository, accountRepository repositories.AccountRepository, sender mail.Sender, config EmailVerificationConfig) *EmailVerificationServiceImpl {
+	return &EmailVerificationServiceImpl{
+		tokenRepository:   tokenRepository,
+		accountRepository: accountRepository,
+		sender:            sender,
+		config:            config,
+		now:               time.Now,
+	}
+}
+
+func (s *EmailVerificationServiceImpl) SendVerification(account *models.Account) error {
+	token, err := newMailedToken()
+	if err != nil {
+		return err
+	}
+	body, err := mailedTokenBody("verify your email address", s.config.URL, token, s.config.TokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	// Only the latest token sent for an account can be used.
+	if err := s.tokenRepository.DeleteByAccount(account.AccountId); err != nil {
+		return err
+	}
+	now := s.now()
+	err = s.tokenRepository.Insert(&models.EmailVerificationToken{
+		TokenHash: hashSecret(token),
+		AccountId: account.AccountId,
+		ExpiresAt: primitive.Timestamp{T: uint32(now.Add(s.config.TokenLifetime).Unix())},
+		CreatedAt: primitive.Timestamp{T: uint32(now.Unix())},
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.sender.Send(mail.Message{
+		To:      account.Email,
+		Subject: "Verify your email address",
+		Body:    body,
+	})
+}
+
+func (s *EmailVerificationServiceImpl) Resend(email string) error {
+	account, err := s.accountRepository.FindByEmail(email)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if account.EmailVerified {
+		return nil
+	}
+
+	last, err := s.tokenRepository.FindByAccount(account.AccountId)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	if last != nil && s.now().Before(time.Unix(int64(last.CreatedAt.T), 0).Add(s.config.ResendInterval)) {
+		return nil
+	}
+
+	return s.SendVerification(account)
+}
+
+func (s *EmailVerificationServiceImpl) Verify(token string) (*models.Account, error) {
+	verification, err := s.tokenRepository.Consume(hashSecret(token))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.now().Unix() >= int64(verification.ExpiresAt.T) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	account, err := s.accountRepository.FindById(verification.AccountId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	account.EmailVerified = true
+	account.UpdatedAt = primitive.Timestamp{T: uint32(s.now().Unix())}
+	return s.accountRepository.Update(account)
+}
+
+func (s *EmailVerificationServiceImpl) CheckLogin(account *models.Account) error {
+	if s.config.RequireVerified && !account.EmailVerified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/mail"
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmailVerificationService(t *testing.T) {
+	accounts := repositories.NewMemoryAccountRepository()
+	var outbox bytes.Buffer
+	config := EmailVerificationConfig{TokenLifetime: time.Hour, ResendInterval: time.Minute, RequireVerified: true}
+	verificationService := NewEmailVerificationServiceImpl(repositories.NewMemoryEmailVerificationTokenRepository(), accounts, mail.NewWriterSender(&outbox), config)
+	mailedToken := regexp.MustCompile(`address: ([A-Za-z0-9_-]+)`)
+
+	account := &models.Account{AccountId: "1", Email: "test@example.com", Roles: []string{models.RoleUser}}
+	accounts.Insert(account)
+
+	lastToken := func(t *testing.T) string {
+		match := mailedToken.FindAllStringSubmatch(outbox.String(), -1)
+		if match == nil {
+			t.Fatalf("no token mailed: %q", outbox.String())
+		}
+		return match[len(match)-1][1]
+	}
+
+	t.Run("unverified accounts cannot log in when verification is required", func(t *testing.T) {
+		assert.ErrorIs(t, verificationService.CheckLogin(account), ErrEmailNotVerified)
+
+		lenient := NewEmailVerificationServiceImpl(nil, accounts, nil, EmailVerificationConfig{})
+		assert.Nil(t, lenient.CheckLogin(account))
+	})
+
+	t.Run("resending is throttled silently", func(t *testing.T) {
+		assert.Nil(t, verificationService.SendVerification(account))
+		outbox.Reset()
+		assert.Nil(t, verificationService.Resend("test@example.com"))
+		assert.Empty(t, outbox.String())
+
+		verificationService.now = func() time.Time { return time.Now().Add(time.Minute) }
+		defer func() { verificationService.now = time.Now }()
+		assert.Nil(t, verificationService.Resend("test@example.com"))
+		assert.NotEmpty(t, outbox.String())
+	})
+
+	t.Run("the latest mailed token verifies the account once", func(t *testing.T) {
+		token := lastToken(t)
+
+		verified, err := verificationService.Verify(token)
+		assert.Nil(t, err)
+		assert.True(t, verified.EmailVerified)
+		assert.Nil(t, verificationService.CheckLogin(verified))
+
+		_, err = verificationService.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidVerificationToken)
+	})
+
+	t.Run("verified and unknown emails are not mailed again", func(t *testing.T) {
+		outbox.Reset()
+		assert.Nil(t, verificationService.Resend("test@example.com"))
+		assert.Nil(t, verificationService.Resend("nobody@example.com"))
+		assert.Empty(t, outbox.String())
+	})
+
+	t.Run("expired tokens are refused", func(t *testing.T) {
+		other := &models.Account{AccountId: "2", Email: "other@example.com"}
+		accounts.Insert(other)
+		assert.Nil(t, verificationService.SendVerification(other))
+
+		verificationService.now = func() time.Time { return time.Now().Add(time.Hour) }
+		defer func() { verificationService.now = time.Now }()
+		_, err := verificationService.Verify(lastToken(t))
+		assert.ErrorIs(t, err, ErrInvalidVerificationToken)
+	})
+}
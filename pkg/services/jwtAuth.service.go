@@ -1,82 +1,233 @@
 package services
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
-	"github.com/croisade/chimichanga/pkg/conf"
 	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type JWTService interface {
-	CreateToken()
-	CreateRefreshToken()
+	CreateToken(accountId string, scopes []string, sessionId string) (string, error)
+	CreateRefreshToken(accountId string, familyId string, tokenId string) (string, error)
+	CreateChallengeToken(accountId string) (string, error)
+	CreateClientToken(accountId string, clientId string, scopes []string, familyId string) (string, error)
+	CreateClientRefreshToken(accountId string, clientId string, scopes []string, familyId string, tokenId string) (string, error)
+	AccessTokenLifetime() time.Duration
+	ValidateToken(string) (*jwt.Token, error)
+	ValidateClaims(string) (*MyCustomClaims, error)
 }
 
-type JWTAuthService struct{}
+var (
+	ErrTokenWithoutSubject = errors.New("token has no subject")
+	ErrTokenExpired        = errors.New("token is expired")
+	ErrTokenNotValidYet    = errors.New("token is not valid yet")
+	ErrTokenIssuer         = errors.New("token is issued by someone else")
+	ErrTokenAudience       = errors.New("token is meant for someone else")
+)
+
+// challengeTokenLifetime is how long a user has to enter their second factor
+// after their password was accepted.
+const challengeTokenLifetime = 5 * time.Minute
+
+// TokenConfig describes the tokens a JWTAuthService issues and accepts.
+// Leeway is the clock skew tolerated between this server and the one that
+// issued a token when checking its times.
+type TokenConfig struct {
+	Issuer               string
+	Audience             string
+	AccessTokenLifetime  time.Duration
+	RefreshTokenLifetime time.Duration
+	Leeway               time.Duration
+}
 
+// JWTAuthService signs tokens with the current key of its KeyService and
+// accepts tokens signed with any key the service still publishes.
+type JWTAuthService struct {
+	keys   KeyService
+	config TokenConfig
+	now    func() time.Time
+}
+
+// MyCustomClaims identifies the account a token was issued to by its subject
+// and the token itself by its jti. Access tokens carry the scopes they grant,
+// space separated, and name the session they were issued in. Refresh tokens
+// name the token family they belong to. Challenge tokens only prove that the
+// password of an account with two-factor authentication was accepted. Tokens
+// issued to a third-party app name it by its client id; its refresh tokens
+// carry the scopes they may be refreshed with.
 type MyCustomClaims struct {
-	Group string `json:"group"`
+	Scope     string `json:"scope,omitempty"`
+	Session   string `json:"sid,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	Family    string `json:"fam,omitempty"`
+	Challenge bool   `json:"chl,omitempty"`
 	jwt.StandardClaims
 }
 
-func NewJWTAuthService() JWTAuthService {
-	return JWTAuthService{}
+// Scopes returns the scopes an access token grants.
+func (c *MyCustomClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
 }
-func (j JWTAuthService) CreateToken() (string, error) {
-	config, err := conf.LoadConfig("../../")
-	if err != nil {
-		log.Fatal("cannot load config:", err)
+
+// IsRefreshToken reports whether the claims belong to a refresh token.
+func (c *MyCustomClaims) IsRefreshToken() bool {
+	return c.Family != ""
+}
+
+// IsChallengeToken reports whether the claims belong to a two-factor
+// challenge token.
+func (c *MyCustomClaims) IsChallengeToken() bool {
+	return c.Challenge
+}
+
+func NewJWTAuthService(keys KeyService, config TokenConfig) JWTAuthService {
+	return JWTAuthService{
+		keys:   keys,
+		config: config,
+		now:    time.Now,
 	}
+}
 
+func (j JWTAuthService) CreateToken(accountId string, scopes []string, sessionId string) (string, error) {
 	claims := MyCustomClaims{
-		"USER",
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Minute * 15).Unix(),
-			Issuer:    "CorroYouRun",
-		},
+		Scope:          strings.Join(scopes, " "),
+		Session:        sessionId,
+		StandardClaims: j.standardClaims(accountId, primitive.NewObjectID().Hex(), j.config.AccessTokenLifetime),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	ss, err := token.SignedString([]byte(config.JWTSecret))
-	return ss, err
+	return j.sign(claims)
 }
 
-func (j JWTAuthService) CreateRefreshToken() (string, error) {
-	config, err := conf.LoadConfig("../../")
-	if err != nil {
-		log.Fatal("cannot load config:", err)
+func (j JWTAuthService) CreateRefreshToken(accountId string, familyId string, tokenId string) (string, error) {
+	claims := MyCustomClaims{
+		Family:         familyId,
+		StandardClaims: j.standardClaims(accountId, tokenId, j.config.RefreshTokenLifetime),
 	}
 
+	return j.sign(claims)
+}
+
+func (j JWTAuthService) CreateChallengeToken(accountId string) (string, error) {
+	claims := MyCustomClaims{
+		Challenge:      true,
+		StandardClaims: j.standardClaims(accountId, primitive.NewObjectID().Hex(), challengeTokenLifetime),
+	}
+
+	return j.sign(claims)
+}
+
+// CreateClientToken issues an access token to a third-party app. Its session
+// is the token family of the app's grant, revoking the grant revokes it.
+func (j JWTAuthService) CreateClientToken(accountId string, clientId string, scopes []string, familyId string) (string, error) {
+	claims := MyCustomClaims{
+		Scope:          strings.Join(scopes, " "),
+		Session:        familyId,
+		ClientId:       clientId,
+		StandardClaims: j.standardClaims(accountId, primitive.NewObjectID().Hex(), j.config.AccessTokenLifetime),
+	}
+
+	return j.sign(claims)
+}
+
+func (j JWTAuthService) CreateClientRefreshToken(accountId string, clientId string, scopes []string, familyId string, tokenId string) (string, error) {
 	claims := MyCustomClaims{
-		"USER",
-		jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 168).Unix(),
-			Issuer:    "CorroYouRun",
-		},
+		Scope:          strings.Join(scopes, " "),
+		Family:         familyId,
+		ClientId:       clientId,
+		StandardClaims: j.standardClaims(accountId, tokenId, j.config.RefreshTokenLifetime),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	ss, err := token.SignedString([]byte(config.JWTSecret))
-	return ss, err
+	return j.sign(claims)
 }
 
+// AccessTokenLifetime is how long the access tokens issued stay valid.
+func (j JWTAuthService) AccessTokenLifetime() time.Duration {
+	return j.config.AccessTokenLifetime
+}
+
+// ValidateToken checks the signature, issuer, audience and times of a token.
 func (j JWTAuthService) ValidateToken(tokenString string) (*jwt.Token, error) {
-	config, err := conf.LoadConfig("../../")
-	if err != nil {
-		log.Fatal("cannot load config:", err)
+	var claims MyCustomClaims
+	return j.parse(tokenString, &claims)
+}
+
+// ValidateClaims validates a token and returns its claims. Tokens without a
+// subject were issued before tokens were bound to an account and are refused.
+func (j JWTAuthService) ValidateClaims(tokenString string) (*MyCustomClaims, error) {
+	var claims MyCustomClaims
+	if _, err := j.parse(tokenString, &claims); err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" {
+		return nil, ErrTokenWithoutSubject
 	}
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-
-		if !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(config.JWTSecret), nil
-	})
+	return &claims, nil
+}
+
+func (j JWTAuthService) standardClaims(accountId string, tokenId string, lifetime time.Duration) jwt.StandardClaims {
+	now := j.now()
+	return jwt.StandardClaims{
+		Id:        tokenId,
+		Subject:   accountId,
+		Issuer:    j.config.Issuer,
+		Audience:  j.config.Audience,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(lifetime).Unix(),
+	}
+}
+
+// parse verifies the signature of a token, then checks its claims. The
+// parser's own time checks are skipped, they know nothing of the leeway.
+func (j JWTAuthService) parse(tokenString string, claims *MyCustomClaims) (*jwt.Token, error) {
+	parser := jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.ParseWithClaims(tokenString, claims, j.verificationKey)
 	if err != nil {
 		return nil, err
 	}
+
+	now := j.now()
+	switch {
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(j.config.Leeway)):
+		return nil, ErrTokenExpired
+	case now.Before(time.Unix(claims.NotBefore, 0).Add(-j.config.Leeway)):
+		return nil, ErrTokenNotValidYet
+	case now.Before(time.Unix(claims.IssuedAt, 0).Add(-j.config.Leeway)):
+		return nil, ErrTokenNotValidYet
+	case claims.Issuer != j.config.Issuer:
+		return nil, ErrTokenIssuer
+	case claims.Audience != j.config.Audience:
+		return nil, ErrTokenAudience
+	}
 	return token, nil
 }
+
+func (j JWTAuthService) sign(claims MyCustomClaims) (string, error) {
+	key, err := j.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Id
+	return token.SignedString(key.Private)
+}
+
+// verificationKey finds the key a token names in its header. The token has
+// to use the algorithm of that key, whatever its header claims.
+func (j JWTAuthService) verificationKey(token *jwt.Token) (interface{}, error) {
+	keyId, _ := token.Header["kid"].(string)
+	key, err := j.keys.VerificationKey(keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.Private.Public(), nil
+}
@@ -3,21 +3,47 @@ package services
 import (
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
 )
 
+var testTokenConfig = TokenConfig{
+	Issuer:               "CorroYouRun",
+	Audience:             "CorroYouRun",
+	AccessTokenLifetime:  15 * time.Minute,
+	RefreshTokenLifetime: 168 * time.Hour,
+	Leeway:               time.Minute,
+}
+
+var testKeyRotation = KeyRotation{
+	Algorithm:    models.AlgorithmEdDSA,
+	Period:       30 * 24 * time.Hour,
+	PublishAhead: time.Hour,
+	Retention:    testTokenConfig.RefreshTokenLifetime,
+}
+
+// newTestJWTService returns a service signing with a fresh in-memory key.
+func newTestJWTService() JWTAuthService {
+	keys := NewKeyServiceImpl(repositories.NewMemorySigningKeyRepository(), testKeyRotation)
+	keys.Rotate()
+	return NewJWTAuthService(keys, testTokenConfig)
+}
+
 func TestJwtAuthService(t *testing.T) {
-	jwtService := NewJWTAuthService()
+	jwtService := newTestJWTService()
 	t.Run("Create Token", func(t *testing.T) {
-		got, err := jwtService.CreateToken()
+		got, err := jwtService.CreateToken("123", []string{models.ScopeRunsRead}, "")
 
 		assert.Nil(t, err)
 		assert.Equal(t, len(strings.Split(got, ".")), 3)
 	})
 
 	t.Run("Validate Token", func(t *testing.T) {
-		token, _ := jwtService.CreateToken()
+		token, _ := jwtService.CreateToken("123", []string{models.ScopeRunsRead}, "")
 		got, err := jwtService.ValidateToken(token)
 
 		assert.Nil(t, err)
@@ -25,9 +51,106 @@ func TestJwtAuthService(t *testing.T) {
 	})
 
 	t.Run("Create Refresh Token", func(t *testing.T) {
-		got, err := jwtService.CreateRefreshToken()
+		got, err := jwtService.CreateRefreshToken("123", "family", "jti")
 
 		assert.Nil(t, err)
 		assert.Equal(t, len(strings.Split(got, ".")), 3)
 	})
+
+	t.Run("Refresh Token names its family", func(t *testing.T) {
+		token, _ := jwtService.CreateRefreshToken("123", "family", "jti")
+		got, err := jwtService.ValidateClaims(token)
+
+		assert.Nil(t, err)
+		assert.True(t, got.IsRefreshToken())
+		assert.Equal(t, "family", got.Family)
+		assert.Equal(t, "jti", got.Id)
+
+		access, _ := jwtService.CreateToken("123", []string{models.ScopeRunsRead}, "")
+		claims, _ := jwtService.ValidateClaims(access)
+		assert.False(t, claims.IsRefreshToken())
+	})
+
+	t.Run("Access Tokens have an id and name their session", func(t *testing.T) {
+		first, _ := jwtService.CreateToken("123", []string{models.ScopeRunsRead}, "session")
+		second, _ := jwtService.CreateToken("123", []string{models.ScopeRunsRead}, "session")
+		firstClaims, _ := jwtService.ValidateClaims(first)
+		secondClaims, _ := jwtService.ValidateClaims(second)
+
+		assert.NotEmpty(t, firstClaims.Id)
+		assert.NotEqual(t, firstClaims.Id, secondClaims.Id)
+		assert.Equal(t, "session", firstClaims.Session)
+	})
+
+	t.Run("Validate Claims", func(t *testing.T) {
+		token, _ := jwtService.CreateToken("123", []string{models.ScopeRunsRead, models.ScopeAccountsAdmin}, "")
+		got, err := jwtService.ValidateClaims(token)
+
+		assert.Nil(t, err)
+		assert.Equal(t, "123", got.Subject)
+		assert.Equal(t, []string{models.ScopeRunsRead, models.ScopeAccountsAdmin}, got.Scopes())
+	})
+
+	t.Run("Validate Claims refuses tokens without subject", func(t *testing.T) {
+		token, _ := jwtService.CreateToken("", []string{models.ScopeRunsRead}, "")
+		_, err := jwtService.ValidateClaims(token)
+
+		assert.ErrorIs(t, err, ErrTokenWithoutSubject)
+	})
+
+	t.Run("Validate Claims refuses tokens signed with other keys", func(t *testing.T) {
+		token, _ := newTestJWTService().CreateToken("123", []string{models.ScopeRunsRead}, "")
+		_, err := jwtService.ValidateClaims(token)
+
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("Validate Claims refuses unsigned tokens", func(t *testing.T) {
+		key, _ := jwtService.keys.SigningKey()
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, MyCustomClaims{StandardClaims: jwt.StandardClaims{Subject: "123"}})
+		token.Header["kid"] = key.Id
+		unsigned, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+		_, err := jwtService.ValidateClaims(unsigned)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Validate Claims checks times with leeway", func(t *testing.T) {
+		issuedAt := time.Unix(time.Now().Unix(), 0)
+		skewed := jwtService
+		skewed.now = func() time.Time { return issuedAt }
+		token, _ := skewed.CreateToken("123", []string{models.ScopeRunsRead}, "")
+
+		for _, tc := range []struct {
+			now  time.Time
+			want error
+		}{
+			{issuedAt.Add(-time.Minute), nil},
+			{issuedAt.Add(-time.Minute - time.Second), ErrTokenNotValidYet},
+			{issuedAt.Add(testTokenConfig.AccessTokenLifetime + time.Minute), nil},
+			{issuedAt.Add(testTokenConfig.AccessTokenLifetime + time.Minute + time.Second), ErrTokenExpired},
+		} {
+			skewed.now = func() time.Time { return tc.now }
+			_, err := skewed.ValidateClaims(token)
+			if tc.want == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.want)
+			}
+		}
+	})
+
+	t.Run("Validate Claims checks issuer and audience", func(t *testing.T) {
+		other := jwtService
+		other.config.Issuer = "someone else"
+		token, _ := other.CreateToken("123", []string{models.ScopeRunsRead}, "")
+		_, err := jwtService.ValidateClaims(token)
+		assert.ErrorIs(t, err, ErrTokenIssuer)
+
+		other = jwtService
+		other.config.Audience = "another service"
+		token, _ = other.CreateToken("123", []string{models.ScopeRunsRead}, "")
+		_, err = jwtService.ValidateToken(token)
+		assert.ErrorIs(t, err, ErrTokenAudience)
+	})
 }
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginThrottleService slows down password guessing. It counts the failed
+// logins of every email, registered or not, and of every client address, and
+// locks out those with too many.
+type LoginThrottleService interface {
+	// Check refuses logins while the email or the client address is locked
+	// out, with a *LoginLockedError.
+	Check(email string, ip string) error
+	RecordFailure(email string, ip string) error
+	// RecordSuccess forgets the failures of email. Those of the client
+	// address stay, a single valid account must not unlock guessing others.
+	RecordSuccess(email string) error
+	Lockouts() ([]*models.LoginThrottle, error)
+	Clear(kind string, value string) error
+}
+
+var ErrLoginLocked = errors.New("too many failed logins, try again later")
+
+// LoginLockedError tells when logins are accepted again.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return ErrLoginLocked.Error()
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrLoginLocked
+}
+
+// LoginThrottleConfig sets how many failed logins are free for an email and
+// for a client address. Every further failure locks logins for BaseDelay,
+// doubled on each failure up to MaxDelay. Failures are forgotten after Window
+// without a new one.
+type LoginThrottleConfig struct {
+	EmailFreeAttempts int
+	IPFreeAttempts    int
+	BaseDelay         time.Duration
+	MaxDelay          time.Duration
+	Window            time.Duration
+}
+
+type LoginThrottleServiceImpl struct {
+	throttleRepository repositories.LoginThrottleRepository
+	config             LoginThrottleConfig
+	now                func() time.Time
+}
+
+func NewLoginThrottleServiceImpl(throttleRepository repositories.LoginThrottleRepository, config LoginThrottleConfig) *LoginThrottleServiceImpl {
+	return &LoginThrottleServiceImpl{
+		throttleRepository: throttleRepository,
+		config:             config,
+		now:                time.Now,
+	}
+}
+
+func (s *LoginThrottleServiceImpl) Check(email string, ip string) error {
+	now := s.now()
+	var retryAfter time.Duration
+	for _, key := range s.keys(email, ip) {
+		throttle, err := s.throttleRepository.Find(key.kind, key.value)
+		if errors.Is(err, repositories.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if wait := time.Unix(int64(throttle.LockedUntil.T), 0).Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+func (s *LoginThrottleServiceImpl) RecordFailure(email string, ip string) error {
+	now := s.now()
+	for _, key := range s.keys(email, ip) {
+		throttle, err := s.throttleRepository.Find(key.kind, key.value)
+		if errors.Is(err, repositories.ErrNotFound) || (err == nil && now.Unix() > int64(throttle.ExpiresAt.T)) {
+			throttle, err = &models.LoginThrottle{Kind: key.kind, Value: key.value}, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		throttle.Failures++
+		expiresAt := now.Add(s.config.Window)
+		if over := throttle.Failures - key.freeAttempts; over > 0 {
+			lockedUntil := now.Add(s.delay(over))
+			throttle.LockedUntil = primitive.Timestamp{T: uint32(lockedUntil.Unix())}
+			if lockedUntil.After(expiresAt) {
+				expiresAt = lockedUntil
+			}
+		}
+		throttle.ExpiresAt = primitive.Timestamp{T: uint32(expiresAt.Unix())}
+
+		if err := s.throttleRepository.Save(throttle); err != nil {
+			return err
+		}
+	}
+
+	return s.throttleRepository.DeleteExpired(primitive.Timestamp{T: uint32(now.Unix())})
+}
+
+func (s *LoginThrottleServiceImpl) RecordSuccess(email string) error {
+	err := s.throttleRepository.Delete(models.ThrottleEmail, normalizeEmail(email))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Lockouts returns the emails and client addresses with failed logins that
+// are not forgotten yet, locked out or not.
+func (s *LoginThrottleServiceImpl) Lockouts() ([]*models.LoginThrottle, error) {
+	if err := s.throttleRepository.DeleteExpired(primitive.Timestamp{T: uint32(s.now().Unix())}); err != nil {
+		return nil, err
+	}
+	return s.throttleRepository.FindAll()
+}
+
+func (s *LoginThrottleServiceImpl) Clear(kind string, value string) error {
+	if kind == models.ThrottleEmail {
+		value = normalizeEmail(value)
+	}
+	return s.throttleRepository.Delete(kind, value)
+}
+
+// delay is how long logins are locked after the over-th failure past the
+// free ones.
+func (s *LoginThrottleServiceImpl) delay(over int) time.Duration {
+	delay := s.config.BaseDelay
+	for i := 1; i < over && delay < s.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.config.MaxDelay {
+		return s.config.MaxDelay
+	}
+	return delay
+}
+
+type throttleKey struct {
+	kind         string
+	value        string
+	freeAttempts int
+}
+
+func (s *LoginThrottleServiceImpl) keys(email string, ip string) []throttleKey {
+	return []throttleKey{
+		{kind: models.ThrottleEmail, value: normalizeEmail(email), freeAttempts: s.config.EmailFreeAttempts},
+		{kind: models.ThrottleIP, value: ip, freeAttempts: s.config.IPFreeAttempts},
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginThrottleService(t *testing.T) {
+	config := LoginThrottleConfig{
+		EmailFreeAttempts: 2,
+		IPFreeAttempts:    4,
+		BaseDelay:         time.Second,
+		MaxDelay:          4 * time.Second,
+		Window:            time.Hour,
+	}
+	clock := time.Unix(time.Now().Unix(), 0)
+	newService := func() *LoginThrottleServiceImpl {
+		service := NewLoginThrottleServiceImpl(repositories.NewMemoryLoginThrottleRepository(), config)
+		service.now = func() time.Time { return clock }
+		return service
+	}
+	retryAfter := func(err error) time.Duration {
+		if locked, ok := err.(*LoginLockedError); ok {
+			return locked.RetryAfter
+		}
+		return 0
+	}
+
+	t.Run("failures past the free ones lock out for twice as long each time", func(t *testing.T) {
+		throttleService := newService()
+
+		var waits []time.Duration
+		for i := 0; i < 6; i++ {
+			assert.Nil(t, throttleService.RecordFailure("Test@example.com", "192.0.2.1"))
+			waits = append(waits, retryAfter(throttleService.Check("test@example.com", "192.0.2.2")))
+		}
+		assert.Equal(t, []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}, waits)
+
+		err := throttleService.Check("other@example.com", "192.0.2.1")
+		assert.ErrorIs(t, err, ErrLoginLocked)
+		assert.Equal(t, 2*time.Second, retryAfter(err))
+	})
+
+	t.Run("success forgets the failures of the email only", func(t *testing.T) {
+		throttleService := newService()
+		for i := 0; i < 5; i++ {
+			throttleService.RecordFailure("test@example.com", "192.0.2.1")
+		}
+
+		assert.Nil(t, throttleService.RecordSuccess("test@example.com"))
+		assert.Nil(t, throttleService.Check("test@example.com", "192.0.2.2"))
+		assert.ErrorIs(t, throttleService.Check("test@example.com", "192.0.2.1"), ErrLoginLocked)
+	})
+
+	t.Run("failures are forgotten after the window", func(t *testing.T) {
+		throttleService := newService()
+		for i := 0; i < 3; i++ {
+			throttleService.RecordFailure("test@example.com", "192.0.2.1")
+		}
+
+		throttleService.now = func() time.Time { return clock.Add(time.Hour + time.Second) }
+		assert.Nil(t, throttleService.RecordFailure("test@example.com", "192.0.2.1"))
+		assert.Nil(t, throttleService.Check("test@example.com", "192.0.2.1"))
+	})
+
+	t.Run("admins see and clear lockouts", func(t *testing.T) {
+		throttleService := newService()
+		for i := 0; i < 3; i++ {
+			throttleService.RecordFailure("test@example.com", "192.0.2.1")
+		}
+
+		lockouts, err := throttleService.Lockouts()
+		assert.Nil(t, err)
+		assert.Len(t, lockouts, 2)
+		assert.Equal(t, models.ThrottleEmail, lockouts[0].Kind)
+		assert.Equal(t, 3, lockouts[0].Failures)
+
+		assert.Nil(t, throttleService.Clear(models.ThrottleEmail, "TEST@example.com"))
+		assert.Nil(t, throttleService.Check("test@example.com", "192.0.2.1"))
+		assert.ErrorIs(t, throttleService.Clear(models.ThrottleEmail, "test@example.com"), repositories.ErrNotFound)
+	})
+}
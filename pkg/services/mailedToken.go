@@ -0,0 +1,47 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// newMailedToken returns 256 random bits, URL safe, for tokens mailed to
+// account holders.
+func newMailedToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// hashSecret is what the random secrets handed to account holders, mailed
+// tokens and recovery codes, are stored and looked up by. They are random
+// enough that a fast hash cannot be reversed.
+func hashSecret(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// mailedTokenBody asks the recipient to use token to do action. The token is
+// sent as the token query parameter of link, or on its own without link.
+func mailedTokenBody(action string, link string, token string, lifetime time.Duration) (string, error) {
+	validity := fmt.Sprintf("It can be used once within %v.", lifetime)
+	if link == "" {
+		return fmt.Sprintf("Use this token to %s: %s\n%s", action, token, validity), nil
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return fmt.Sprintf("Follow this link to %s: %s\n%s", action, u, validity), nil
+}
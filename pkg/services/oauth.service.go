@@ -0,0 +1,671 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OAuthService lets third-party apps act for accounts without their password,
+// through the authorization code flow of RFC 6749 with PKCE (RFC 7636).
+// Every code traded for tokens starts a token family of its own, named after
+// the app; revoking a consent revokes the families of the app, and with them
+// the tokens already issued.
+type OAuthService interface {
+	// RegisterClient registers an app of the account ownerId. Confidential
+	// apps get a secret, returned here only.
+	RegisterClient(ownerId string, name string, redirectURIs []string, scopes []string, confidential bool) (string, *models.OAuthClient, error)
+	Clients(ownerId string) ([]*models.OAuthClient, error)
+	// DeleteClient removes an app along with the consents given to it.
+	DeleteClient(ownerId string, clientId string) error
+	// Authorize checks an authorization request before the account is asked
+	// whether to approve it.
+	Authorize(accountId string, request *AuthorizationRequest) (*AuthorizationPrompt, error)
+	// Approve records the consent of the account to an authorization request
+	// and returns the redirect URI handing the app its code.
+	Approve(accountId string, request *AuthorizationRequest) (string, error)
+	// Deny returns the redirect URI telling the app the request was denied.
+	Deny(request *AuthorizationRequest) (string, error)
+	Consents(accountId string) ([]*models.OAuthConsent, error)
+	RevokeConsent(accountId string, clientId string) error
+	// Exchange answers a token request of an app: a code for its first
+	// tokens, or a refresh token for the next ones.
+	Exchange(request *TokenRequest) (*TokenResponse, error)
+	// Introspect tells an authenticated confidential app whether an access
+	// token issued to an app is active, as RFC 7662 describes.
+	Introspect(clientId string, clientSecret string, token string) (*Introspection, error)
+}
+
+var (
+	ErrInvalidRedirectURI = errors.New("invalid redirect URI")
+	ErrInvalidClientScope = errors.New("scope cannot be granted to apps")
+)
+
+// Error codes of RFC 6749 an OAuthError may carry.
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthAccessDenied            = "access_denied"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+)
+
+// OAuthError is an error response of RFC 6749. Errors of authorization
+// requests the app can be told about carry the RedirectURI telling it; the
+// others must not be sent to a redirect URI that could not be verified.
+type OAuthError struct {
+	Code        string
+	Description string
+	RedirectURI string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// AuthorizationRequest holds the parameters of an authorization request,
+// named as in RFC 6749. Scope is space separated; left out, it asks for every
+// scope of the app. Only S256 code challenges are accepted.
+type AuthorizationRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientId            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// AuthorizationPrompt is what an account is asked to approve. Consented is
+// set when the account already approved every scope, and need not be asked.
+type AuthorizationPrompt struct {
+	ClientId    string   `json:"clientId"`
+	ClientName  string   `json:"clientName"`
+	RedirectURI string   `json:"redirectUri"`
+	Scopes      []string `json:"scopes"`
+	Consented   bool     `json:"consented"`
+}
+
+// TokenRequest holds the parameters of a token request, named as in RFC 6749.
+type TokenRequest struct {
+	GrantType    string `form:"grant_type"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	ClientId     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// TokenResponse is a successful token response of RFC 6749.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// Introspection is an introspection response of RFC 7662. Inactive tokens
+// are described by Active alone.
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientId  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	Audience  string `json:"aud,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	TokenId   string `json:"jti,omitempty"`
+}
+
+// OAuthConfig sets how long apps have to trade an authorization code for
+// tokens.
+type OAuthConfig struct {
+	CodeLifetime time.Duration
+}
+
+type OAuthServiceImpl struct {
+	clientRepository  repositories.OAuthClientRepository
+	consentRepository repositories.OAuthConsentRepository
+	codeRepository    repositories.OAuthAuthorizationCodeRepository
+	familyRepository  repositories.TokenFamilyRepository
+	accountService    AccountService
+	jwtService        JWTService
+	revocationService RevocationService
+	config            OAuthConfig
+	now               func() time.Time
+}
+
+func NewOAuthServiceImpl(clientRepository repositories.OAuthClientRepository, consentRepository repositories.OAuthConsentRepository, codeRepository repositories.OAuthAuthorizationCodeRepository, familyRepository repositories.TokenFamilyRepository, accountService AccountService, jwtService JWTService, revocationService RevocationService, config OAuthConfig) *OAuthServiceImpl {
+	return &OAuthServiceImpl{
+		clientRepository:  clientRepository,
+		consentRepository: consentRepository,
+		codeRepository:    codeRepository,
+		familyRepository:  familyRepository,
+		accountService:    accountService,
+		jwtService:        jwtService,
+		revocationService: revocationService,
+		config:            config,
+		now:               time.Now,
+	}
+}
+
+func (s *OAuthServiceImpl) RegisterClient(ownerId string, name string, redirectURIs []string, scopes []string, confidential bool) (string, *models.OAuthClient, error) {
+	for _, redirectURI := range redirectURIs {
+		if err := checkRedirectURI(redirectURI); err != nil {
+			return "", nil, err
+		}
+	}
+	for _, scope := range scopes {
+		if !models.IsOAuthScope(scope) {
+			return "", nil, fmt.Errorf("%w: %s", ErrInvalidClientScope, scope)
+		}
+	}
+
+	client := &models.OAuthClient{
+		ClientId:     primitive.NewObjectID().Hex(),
+		OwnerId:      ownerId,
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		CreatedAt:    primitive.Timestamp{T: uint32(s.now().Unix())},
+	}
+	var secret string
+	if confidential {
+		var err error
+		if secret, err = newMailedToken(); err != nil {
+			return "", nil, err
+		}
+		client.SecretHash = hashSecret(secret)
+	}
+
+	if err := s.clientRepository.Insert(client); err != nil {
+		return "", nil, err
+	}
+	return secret, client, nil
+}
+
+func (s *OAuthServiceImpl) Clients(ownerId string) ([]*models.OAuthClient, error) {
+	return s.clientRepository.FindByOwner(ownerId)
+}
+
+func (s *OAuthServiceImpl) DeleteClient(ownerId string, clientId string) error {
+	if err := s.clientRepository.Delete(ownerId, clientId); err != nil {
+		return err
+	}
+
+	consents, err := s.consentRepository.FindByClient(clientId)
+	if err != nil {
+		return err
+	}
+	for _, consent := range consents {
+		if err := s.RevokeConsent(consent.AccountId, clientId); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *OAuthServiceImpl) Authorize(accountId string, request *AuthorizationRequest) (*AuthorizationPrompt, error) {
+	client, redirectURI, scopes, err := s.checkAuthorizationRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	consented := false
+	consent, err := s.consentRepository.Find(accountId, client.ClientId)
+	if err == nil {
+		consented = len(intersectScopes(scopes, consent.Scopes)) == len(scopes)
+	} else if !errors.Is(err, repositories.ErrNotFound) {
+		return nil, err
+	}
+
+	return &AuthorizationPrompt{
+		ClientId:    client.ClientId,
+		ClientName:  client.Name,
+		RedirectURI: redirectURI,
+		Scopes:      scopes,
+		Consented:   consented,
+	}, nil
+}
+
+func (s *OAuthServiceImpl) Approve(accountId string, request *AuthorizationRequest) (string, error) {
+	client, redirectURI, scopes, err := s.checkAuthorizationRequest(request)
+	if err != nil {
+		return "", err
+	}
+
+	now := s.now()
+	timestamp := primitive.Timestamp{T: uint32(now.Unix())}
+	consent, err := s.consentRepository.Find(accountId, client.ClientId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		consent = &models.OAuthConsent{AccountId: accountId, ClientId: client.ClientId, CreatedAt: timestamp}
+	} else if err != nil {
+		return "", err
+	}
+	// Consents add up, approving more scopes does not take earlier ones back.
+	for _, scope := range scopes {
+		if !contains(consent.Scopes, scope) {
+			consent.Scopes = append(consent.Scopes, scope)
+		}
+	}
+	consent.UpdatedAt = timestamp
+	if err := s.consentRepository.Save(consent); err != nil {
+		return "", err
+	}
+
+	// Codes are not used long after they were issued, whatever is left of
+	// them is cleaned up now and then.
+	if err := s.codeRepository.DeleteExpired(timestamp); err != nil {
+		return "", err
+	}
+
+	code, err := newMailedToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.codeRepository.Insert(&models.OAuthAuthorizationCode{
+		CodeHash:      hashSecret(code),
+		ClientId:      client.ClientId,
+		AccountId:     accountId,
+		RedirectURI:   redirectURI,
+		Scopes:        scopes,
+		CodeChallenge: request.CodeChallenge,
+		ExpiresAt:     primitive.Timestamp{T: uint32(now.Add(s.config.CodeLifetime).Unix())},
+		CreatedAt:     timestamp,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return redirectWith(redirectURI, request.State, url.Values{"code": {code}}), nil
+}
+
+func (s *OAuthServiceImpl) Deny(request *AuthorizationRequest) (string, error) {
+	_, redirectURI, _, err := s.checkAuthorizationRequest(request)
+	if err != nil {
+		return "", err
+	}
+	return redirectWith(redirectURI, request.State, url.Values{
+		"error":             {OAuthAccessDenied},
+		"error_description": {"the request was denied"},
+	}), nil
+}
+
+func (s *OAuthServiceImpl) Consents(accountId string) ([]*models.OAuthConsent, error) {
+	return s.consentRepository.FindByAccount(accountId)
+}
+
+func (s *OAuthServiceImpl) RevokeConsent(accountId string, clientId string) error {
+	if err := s.consentRepository.Delete(accountId, clientId); err != nil {
+		return err
+	}
+	return s.familyRepository.RevokeByClient(accountId, clientId)
+}
+
+func (s *OAuthServiceImpl) Exchange(request *TokenRequest) (*TokenResponse, error) {
+	switch request.GrantType {
+	case "authorization_code":
+		return s.exchangeCode(request)
+	case "refresh_token":
+		return s.refresh(request)
+	case "":
+		return nil, &OAuthError{Code: OAuthInvalidRequest, Description: "grant_type is required"}
+	}
+	return nil, &OAuthError{Code: OAuthUnsupportedGrantType, Description: "grant_type must be authorization_code or refresh_token"}
+}
+
+func (s *OAuthServiceImpl) Introspect(clientId string, clientSecret string, token string) (*Introspection, error) {
+	client, err := s.authenticateClient(clientId, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if !client.Confidential() {
+		return nil, &OAuthError{Code: OAuthInvalidClient, Description: "only confidential clients may introspect tokens"}
+	}
+
+	claims, err := s.jwtService.ValidateClaims(token)
+	if err != nil || claims.ClientId == "" || claims.IsRefreshToken() || claims.IsChallengeToken() {
+		return &Introspection{Active: false}, nil
+	}
+	revoked, err := s.revocationService.IsRevoked(claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return &Introspection{Active: false}, nil
+	}
+
+	return &Introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientId:  claims.ClientId,
+		TokenType: "Bearer",
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		TokenId:   claims.Id,
+	}, nil
+}
+
+// checkAuthorizationRequest returns the client of an authorization request,
+// the redirect URI to answer it on and the scopes it asks for. Until the
+// redirect URI is known to belong to the client, errors carry none.
+func (s *OAuthServiceImpl) checkAuthorizationRequest(request *AuthorizationRequest) (*models.OAuthClient, string, []string, error) {
+	client, err := s.clientRepository.FindById(request.ClientId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, "", nil, &OAuthError{Code: OAuthInvalidRequest, Description: "unknown client_id"}
+	}
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	redirectURI := request.RedirectURI
+	switch {
+	case redirectURI == "" && len(client.RedirectURIs) == 1:
+		redirectURI = client.RedirectURIs[0]
+	case redirectURI == "":
+		return nil, "", nil, &OAuthError{Code: OAuthInvalidRequest, Description: "redirect_uri is required"}
+	case !contains(client.RedirectURIs, redirectURI):
+		return nil, "", nil, &OAuthError{Code: OAuthInvalidRequest, Description: "redirect_uri is not registered for the client"}
+	}
+
+	fail := func(code string, description string) error {
+		return &OAuthError{
+			Code:        code,
+			Description: description,
+			RedirectURI: redirectWith(redirectURI, request.State, url.Values{
+				"error":             {code},
+				"error_description": {description},
+			}),
+		}
+	}
+
+	if request.ResponseType != "code" {
+		return nil, "", nil, fail(OAuthUnsupportedResponseType, "response_type must be code")
+	}
+	if request.CodeChallenge == "" {
+		return nil, "", nil, fail(OAuthInvalidRequest, "code_challenge is required")
+	}
+	if request.CodeChallengeMethod != "S256" {
+		return nil, "", nil, fail(OAuthInvalidRequest, "code_challenge_method must be S256")
+	}
+	if decoded, err := base64.RawURLEncoding.DecodeString(request.CodeChallenge); err != nil || len(decoded) != sha256.Size {
+		return nil, "", nil, fail(OAuthInvalidRequest, "code_challenge is not a base64url encoded SHA-256 hash")
+	}
+
+	scopes := []string{}
+	for _, scope := range strings.Fields(request.Scope) {
+		if !contains(client.Scopes, scope) {
+			return nil, "", nil, fail(OAuthInvalidScope, "the client may not ask for "+scope)
+		}
+		if !contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		scopes = append(scopes, client.Scopes...)
+	}
+	if len(scopes) == 0 {
+		return nil, "", nil, fail(OAuthInvalidScope, "the client has no scopes to ask for")
+	}
+
+	return client, redirectURI, scopes, nil
+}
+
+// authenticateClient finds the client of a token request. Confidential
+// clients have to give their secret.
+func (s *OAuthServiceImpl) authenticateClient(clientId string, clientSecret string) (*models.OAuthClient, error) {
+	failed := &OAuthError{Code: OAuthInvalidClient, Description: "client authentication failed"}
+	if clientId == "" {
+		return nil, failed
+	}
+
+	client, err := s.clientRepository.FindById(clientId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, failed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Confidential() && subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashSecret(clientSecret))) != 1 {
+		return nil, failed
+	}
+	return client, nil
+}
+
+func (s *OAuthServiceImpl) exchangeCode(request *TokenRequest) (*TokenResponse, error) {
+	client, err := s.authenticateClient(request.ClientId, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if request.Code == "" || request.CodeVerifier == "" {
+		return nil, &OAuthError{Code: OAuthInvalidRequest, Description: "code and code_verifier are required"}
+	}
+
+	code, err := s.codeRepository.Consume(hashSecret(request.Code))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, &OAuthError{Code: OAuthInvalidGrant, Description: "authorization code is invalid or has been used"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	switch {
+	case code.ClientId != client.ClientId:
+		return nil, &OAuthError{Code: OAuthInvalidGrant, Description: "authorization code was issued to another client"}
+	case now.Unix() >= int64(code.ExpiresAt.T):
+		return nil, &OAuthError{Code: OAuthInvalidGrant, Description: "authorization code has expired"}
+	case request.RedirectURI != "" && request.RedirectURI != code.RedirectURI:
+		return nil, &OAuthError{Code: OAuthInvalidGrant, Description: "redirect_uri does not match the authorization request"}
+	case !verifyCodeChallenge(request.CodeVerifier, code.CodeChallenge):
+		return nil, &OAuthError{Code: OAuthInvalidGrant, Description: "code_verifier does not match the code_challenge"}
+	}
+
+	if _, err := s.consentRepository.Find(code.AccountId, client.ClientId); errors.Is(err, repositories.ErrNotFound) {
+		return nil, &OAuthError{Code: OAuthInvalidGrant, Description: "consent has been revoked"}
+	} else if err != nil {
+		return nil, err
+	}
+	account, err := s.grantingAccount(code.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	family := &models.TokenFamily{
+		FamilyId:       primitive.NewObjectID().Hex(),
+		AccountId:      account.AccountId,
+		Device:         client.Name,
+		ClientId:       client.ClientId,
+		CurrentTokenId: primitive.NewObjectID().Hex(),
+		CreatedAt:      primitive.Timestamp{T: uint32(now.Unix())},
+		UpdatedAt:      primitive.Timestamp{T: uint32(now.Unix())},
+	}
+	if err := s.familyRepository.Insert(family); err != nil {
+		return nil, err
+	}
+
+	return s.issue(account, client, code.Scopes, family.FamilyId, family.CurrentTokenId)
+}
+
+func (s *OAuthServiceImpl) refresh(request *TokenRequest) (*TokenResponse, error) {
+	client, err := s.authenticateClient(request.ClientId, request.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if request.RefreshToken == "" {
+		return nil, &OAuthError{Code: OAuthInvalidRequest, Description: "refresh_token is required"}
+	}
+
+	claims, err := s.jwtService.ValidateClaims(request.RefreshToken)
+	if err != nil || !claims.IsRefreshToken() || claims.ClientId != client.ClientId {
+		return nil, &OAuthError{Code: OAuthInvalidGrant, Description: "refresh token is invalid or was issued to another client"}
+	}
+
+	revoked := &OAuthError{Code: OAuthInvalidGrant, Description: "grant has been revoked"}
+	family, err := s.familyRepository.FindById(claims.Family)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, revoked
+	}
+	if err != nil {
+		return nil, err
+	}
+	if family.Revoked || family.AccountId != claims.Subject || family.ClientId != client.ClientId {
+		return nil, revoked
+	}
+
+	consent, err := s.consentRepository.Find(family.AccountId, client.ClientId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, revoked
+	}
+	if err != nil {
+		return nil, err
+	}
+	account, err := s.grantingAccount(family.AccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	nextTokenId := primitive.NewObjectID().Hex()
+	err = s.familyRepository.Rotate(family.FamilyId, claims.Id, nextTokenId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		if err := s.familyRepository.Revoke(family.FamilyId); err != nil {
+			return nil, err
+		}
+		return nil, &OAuthError{Code: OAuthInvalidGrant, Description: "refresh token has already been used, grant revoked"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issue(account, client, intersectScopes(claims.Scopes(), consent.Scopes), family.FamilyId, nextTokenId)
+}
+
+// grantingAccount returns the account a grant acts for.
+func (s *OAuthServiceImpl) grantingAccount(accountId string) (*models.Account, error) {
+	account, err := s.accountService.GetAccount(accountId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, &OAuthError{Code: OAuthInvalidGrant, Description: "account no longer exists"}
+	}
+	return account, err
+}
+
+// issue answers a token request with tokens granting those of scopes the
+// roles of the account still grant.
+func (s *OAuthServiceImpl) issue(account *models.Account, client *models.OAuthClient, scopes []string, familyId string, tokenId string) (*TokenResponse, error) {
+	scopes = models.GrantedScopes(account.Roles, scopes)
+	if len(scopes) == 0 {
+		return nil, &OAuthError{Code: OAuthInvalidScope, Description: "the account no longer grants any of the scopes"}
+	}
+
+	accessToken, err := s.jwtService.CreateClientToken(account.AccountId, client.ClientId, scopes, familyId)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := s.jwtService.CreateClientRefreshToken(account.AccountId, client.ClientId, scopes, familyId, tokenId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.jwtService.AccessTokenLifetime() / time.Second),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+// checkRedirectURI accepts absolute URIs without fragment: https ones, http
+// ones on the loopback interface and the private-use schemes of native apps,
+// which RFC 8252 has contain a period.
+func checkRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() || strings.Contains(redirectURI, "#") {
+		return fmt.Errorf("%w: %s", ErrInvalidRedirectURI, redirectURI)
+	}
+
+	switch scheme := strings.ToLower(u.Scheme); {
+	case scheme == "https" && u.Host != "":
+		return nil
+	case scheme == "http" && (u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1"):
+		return nil
+	case scheme != "http" && scheme != "https" && strings.Contains(scheme, "."):
+		return nil
+	}
+	return fmt.Errorf("%w: use https, a loopback http address or a reverse domain scheme: %s", ErrInvalidRedirectURI, redirectURI)
+}
+
+// verifyCodeChallenge tells whether verifier is the S256 code verifier of
+// challenge.
+func verifyCodeChallenge(verifier string, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, r := range verifier {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("-._~", r)) {
+			return false
+		}
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// redirectWith adds params, and state when there is one, to the query of
+// redirectURI.
+func redirectWith(redirectURI string, state string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// intersectScopes returns those of scopes that are also in allowed.
+func intersectScopes(scopes []string, allowed []string) []string {
+	result := []string{}
+	for _, scope := range scopes {
+		if contains(allowed, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/stretchr/testify/assert"
+)
+
+// testVerifier is a PKCE code verifier, testChallenge its S256 challenge.
+var (
+	testVerifier  = strings.Repeat("v", 43)
+	testChallenge = func() string {
+		sum := sha256.Sum256([]byte(testVerifier))
+		return base64.RawURLEncoding.EncodeToString(sum[:])
+	}()
+)
+
+func TestOAuthService(t *testing.T) {
+	accounts := repositories.NewMemoryAccountRepository()
+	families := repositories.NewMemoryTokenFamilyRepository()
+	jwtService := newTestJWTService()
+	revocationService := NewRevocationServiceImpl(repositories.NewMemoryRevokedTokenRepository(), families, time.Minute)
+	oauthService := NewOAuthServiceImpl(repositories.NewMemoryOAuthClientRepository(), repositories.NewMemoryOAuthConsentRepository(),
+		repositories.NewMemoryOAuthAuthorizationCodeRepository(), families, NewAccountServiceImpl(accounts, testPasswordPolicy),
+		jwtService, revocationService, OAuthConfig{CodeLifetime: time.Minute})
+
+	accounts.Insert(&models.Account{AccountId: "owner", Email: "owner@example.com", Roles: []string{models.RoleUser}})
+	accounts.Insert(&models.Account{AccountId: "runner", Email: "runner@example.com", Roles: []string{models.RoleUser}})
+
+	secret, coach, err := oauthService.RegisterClient("owner", "Coach", []string{"https://coach.example/callback"}, []string{models.ScopeRunsRead, models.ScopeAccountRead}, true)
+	assert.Nil(t, err)
+	_, treadmill, err := oauthService.RegisterClient("owner", "Treadmill", []string{"com.example.treadmill:/callback"}, []string{models.ScopeRunsWrite}, false)
+	assert.Nil(t, err)
+
+	request := func(client *models.OAuthClient, scope string) *AuthorizationRequest {
+		return &AuthorizationRequest{
+			ResponseType:        "code",
+			ClientId:            client.ClientId,
+			Scope:               scope,
+			State:               "xyz",
+			CodeChallenge:       testChallenge,
+			CodeChallengeMethod: "S256",
+		}
+	}
+	// approve returns the code handed to the client.
+	approve := func(client *models.OAuthClient, scope string) string {
+		redirect, err := oauthService.Approve("runner", request(client, scope))
+		assert.Nil(t, err)
+		u, _ := url.Parse(redirect)
+		assert.Equal(t, "xyz", u.Query().Get("state"))
+		return u.Query().Get("code")
+	}
+
+	t.Run("registration checks redirect URIs and scopes", func(t *testing.T) {
+		assert.True(t, coach.Confidential())
+		assert.NotEmpty(t, secret)
+		assert.False(t, treadmill.Confidential())
+
+		for _, redirectURI := range []string{"http://coach.example/callback", "https://coach.example/#token", "/callback", "javascript:alert(1)"} {
+			_, _, err := oauthService.RegisterClient("owner", "Bad", []string{redirectURI}, []string{models.ScopeRunsRead}, false)
+			assert.ErrorIs(t, err, ErrInvalidRedirectURI, redirectURI)
+		}
+		_, _, err := oauthService.RegisterClient("owner", "Bad", []string{"http://127.0.0.1:8080/callback"}, []string{models.ScopeAccountWrite}, false)
+		assert.ErrorIs(t, err, ErrInvalidClientScope)
+	})
+
+	t.Run("authorization requests are checked", func(t *testing.T) {
+		_, err := oauthService.Authorize("runner", &AuthorizationRequest{ClientId: "missing"})
+		var oauthErr *OAuthError
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Empty(t, oauthErr.RedirectURI)
+
+		unregistered := request(coach, "")
+		unregistered.RedirectURI = "https://attacker.example/callback"
+		_, err = oauthService.Authorize("runner", unregistered)
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Empty(t, oauthErr.RedirectURI)
+
+		plain := request(coach, "")
+		plain.CodeChallengeMethod = "plain"
+		_, err = oauthService.Authorize("runner", plain)
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidRequest, oauthErr.Code)
+		assert.True(t, strings.HasPrefix(oauthErr.RedirectURI, "https://coach.example/callback?"))
+
+		_, err = oauthService.Authorize("runner", request(coach, models.ScopeRunsWrite))
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidScope, oauthErr.Code)
+
+		prompt, err := oauthService.Authorize("runner", request(coach, ""))
+		assert.Nil(t, err)
+		assert.Equal(t, []string{models.ScopeRunsRead, models.ScopeAccountRead}, prompt.Scopes)
+		assert.False(t, prompt.Consented)
+	})
+
+	t.Run("codes are exchanged once with their verifier", func(t *testing.T) {
+		code := approve(coach, models.ScopeRunsRead)
+
+		prompt, _ := oauthService.Authorize("runner", request(coach, models.ScopeRunsRead))
+		assert.True(t, prompt.Consented)
+
+		_, err := oauthService.Exchange(&TokenRequest{GrantType: "authorization_code", Code: code, CodeVerifier: testVerifier, ClientId: coach.ClientId, ClientSecret: "wrong"})
+		var oauthErr *OAuthError
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidClient, oauthErr.Code)
+
+		tokens, err := oauthService.Exchange(&TokenRequest{GrantType: "authorization_code", Code: code, CodeVerifier: testVerifier, ClientId: coach.ClientId, ClientSecret: secret})
+		assert.Nil(t, err)
+		assert.Equal(t, models.ScopeRunsRead, tokens.Scope)
+		claims, err := jwtService.ValidateClaims(tokens.AccessToken)
+		assert.Nil(t, err)
+		assert.Equal(t, "runner", claims.Subject)
+		assert.Equal(t, coach.ClientId, claims.ClientId)
+		assert.Equal(t, []string{models.ScopeRunsRead}, claims.Scopes())
+
+		_, err = oauthService.Exchange(&TokenRequest{GrantType: "authorization_code", Code: code, CodeVerifier: testVerifier, ClientId: coach.ClientId, ClientSecret: secret})
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidGrant, oauthErr.Code)
+	})
+
+	t.Run("a wrong verifier is refused", func(t *testing.T) {
+		code := approve(treadmill, "")
+
+		_, err := oauthService.Exchange(&TokenRequest{GrantType: "authorization_code", Code: code, CodeVerifier: strings.Repeat("w", 43), ClientId: treadmill.ClientId})
+		var oauthErr *OAuthError
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidGrant, oauthErr.Code)
+	})
+
+	t.Run("expired codes are refused", func(t *testing.T) {
+		code := approve(treadmill, "")
+		oauthService.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		defer func() { oauthService.now = time.Now }()
+
+		_, err := oauthService.Exchange(&TokenRequest{GrantType: "authorization_code", Code: code, CodeVerifier: testVerifier, ClientId: treadmill.ClientId})
+		var oauthErr *OAuthError
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, "authorization code has expired", oauthErr.Description)
+	})
+
+	t.Run("refresh rotates and keeps the scopes", func(t *testing.T) {
+		code := approve(treadmill, "")
+		tokens, err := oauthService.Exchange(&TokenRequest{GrantType: "authorization_code", Code: code, CodeVerifier: testVerifier, ClientId: treadmill.ClientId})
+		assert.Nil(t, err)
+
+		next, err := oauthService.Exchange(&TokenRequest{GrantType: "refresh_token", RefreshToken: tokens.RefreshToken, ClientId: treadmill.ClientId})
+		assert.Nil(t, err)
+		assert.Equal(t, models.ScopeRunsWrite, next.Scope)
+
+		_, err = oauthService.Exchange(&TokenRequest{GrantType: "refresh_token", RefreshToken: tokens.RefreshToken, ClientId: treadmill.ClientId})
+		var oauthErr *OAuthError
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidGrant, oauthErr.Code)
+
+		_, err = oauthService.Exchange(&TokenRequest{GrantType: "refresh_token", RefreshToken: next.RefreshToken, ClientId: treadmill.ClientId})
+		assert.ErrorAs(t, err, &oauthErr)
+	})
+
+	t.Run("introspection needs a confidential client", func(t *testing.T) {
+		code := approve(coach, models.ScopeRunsRead)
+		tokens, _ := oauthService.Exchange(&TokenRequest{GrantType: "authorization_code", Code: code, CodeVerifier: testVerifier, ClientId: coach.ClientId, ClientSecret: secret})
+
+		_, err := oauthService.Introspect(treadmill.ClientId, "", tokens.AccessToken)
+		var oauthErr *OAuthError
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidClient, oauthErr.Code)
+
+		got, err := oauthService.Introspect(coach.ClientId, secret, tokens.AccessToken)
+		assert.Nil(t, err)
+		assert.True(t, got.Active)
+		assert.Equal(t, models.ScopeRunsRead, got.Scope)
+		assert.Equal(t, coach.ClientId, got.ClientId)
+		assert.Equal(t, "runner", got.Subject)
+
+		sessionToken, _ := jwtService.CreateToken("runner", []string{models.ScopeRunsRead}, "")
+		got, err = oauthService.Introspect(coach.ClientId, secret, sessionToken)
+		assert.Nil(t, err)
+		assert.False(t, got.Active)
+	})
+
+	t.Run("revoking consent revokes the tokens", func(t *testing.T) {
+		code := approve(coach, models.ScopeRunsRead)
+		tokens, _ := oauthService.Exchange(&TokenRequest{GrantType: "authorization_code", Code: code, CodeVerifier: testVerifier, ClientId: coach.ClientId, ClientSecret: secret})
+		pending := approve(coach, models.ScopeRunsRead)
+
+		assert.Nil(t, oauthService.RevokeConsent("runner", coach.ClientId))
+		assert.ErrorIs(t, oauthService.RevokeConsent("runner", coach.ClientId), repositories.ErrNotFound)
+
+		got, err := oauthService.Introspect(coach.ClientId, secret, tokens.AccessToken)
+		assert.Nil(t, err)
+		assert.False(t, got.Active)
+
+		_, err = oauthService.Exchange(&TokenRequest{GrantType: "refresh_token", RefreshToken: tokens.RefreshToken, ClientId: coach.ClientId, ClientSecret: secret})
+		var oauthErr *OAuthError
+		assert.ErrorAs(t, err, &oauthErr)
+		_, err = oauthService.Exchange(&TokenRequest{GrantType: "authorization_code", Code: pending, CodeVerifier: testVerifier, ClientId: coach.ClientId, ClientSecret: secret})
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, "consent has been revoked", oauthErr.Description)
+	})
+
+	t.Run("deleting a client drops its consents", func(t *testing.T) {
+		approve(treadmill, "")
+
+		assert.ErrorIs(t, oauthService.DeleteClient("runner", treadmill.ClientId), repositories.ErrNotFound)
+		assert.Nil(t, oauthService.DeleteClient("owner", treadmill.ClientId))
+
+		consents, err := oauthService.Consents("runner")
+		assert.Nil(t, err)
+		assert.Empty(t, consents)
+	})
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/croisade/chimichanga/pkg/breached"
+	"github.com/croisade/chimichanga/pkg/models"
+)
+
+// PasswordPolicy decides which passwords an account may have. It is checked
+// on signup and on every password change.
+type PasswordPolicy interface {
+	Check(password string, account *models.Account) error
+}
+
+var (
+	ErrWeakPassword     = errors.New("password is too weak")
+	ErrBreachedPassword = errors.New("password appears in a data breach, choose another one")
+)
+
+// maxPasswordBytes is as much of a password as bcrypt hashes, the rest would
+// be silently ignored.
+const maxPasswordBytes = 72
+
+// PasswordPolicyConfig sets how long passwords have to be and how many
+// character classes they mix: lower case, upper case, digits and others.
+type PasswordPolicyConfig struct {
+	MinLength  int
+	MinClasses int
+}
+
+type PasswordPolicyImpl struct {
+	config   PasswordPolicyConfig
+	breached breached.List
+}
+
+// NewPasswordPolicyImpl returns a policy refusing the passwords of
+// breachedList as well, when it is not nil.
+func NewPasswordPolicyImpl(config PasswordPolicyConfig, breachedList breached.List) *PasswordPolicyImpl {
+	return &PasswordPolicyImpl{
+		config:   config,
+		breached: breachedList,
+	}
+}
+
+func (p *PasswordPolicyImpl) Check(password string, account *models.Account) error {
+	if utf8.RuneCountInString(password) < p.config.MinLength {
+		return fmt.Errorf("%w: use at least %d characters", ErrWeakPassword, p.config.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w: use at most %d bytes", ErrWeakPassword, maxPasswordBytes)
+	}
+	if characterClasses(password) < p.config.MinClasses {
+		return fmt.Errorf("%w: mix at least %d of lower case, upper case, digits and symbols", ErrWeakPassword, p.config.MinClasses)
+	}
+	if account != nil && isPersonal(password, account) {
+		return fmt.Errorf("%w: do not use your email or name", ErrWeakPassword)
+	}
+
+	if p.breached == nil {
+		return nil
+	}
+	found, err := p.breached.Contains(password)
+	if err != nil {
+		return err
+	}
+	if found {
+		return ErrBreachedPassword
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// isPersonal tells whether password is the email of account, the part of it
+// before the @, or its name, ignoring case and spaces.
+func isPersonal(password string, account *models.Account) bool {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), ""))
+	}
+	localPart, _, _ := strings.Cut(account.Email, "@")
+
+	password = normalize(password)
+	for _, personal := range []string{
+		account.Email,
+		localPart,
+		account.FirstName,
+		account.LastName,
+		account.FirstName + account.LastName,
+		account.LastName + account.FirstName,
+	} {
+		if personal = normalize(personal); personal != "" && password == personal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/croisade/chimichanga/pkg/breached"
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPasswordPolicy lets the short passwords of the other tests through.
+var testPasswordPolicy = NewPasswordPolicyImpl(PasswordPolicyConfig{MinLength: 6, MinClasses: 1}, nil)
+
+func TestPasswordPolicy(t *testing.T) {
+	dir := t.TempDir()
+	prefix, suffix := breached.Split("Password123!")
+	if err := os.WriteFile(filepath.Join(dir, prefix), []byte(suffix+":42\n"), 0o600); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	policy := NewPasswordPolicyImpl(PasswordPolicyConfig{MinLength: 10, MinClasses: 3}, breached.NewDirectory(dir))
+	account := &models.Account{Email: "Jane.Doe@example.com", FirstName: "Jane", LastName: "Doe Smith"}
+
+	for _, tc := range []struct {
+		password string
+		want     error
+	}{
+		{"Tr0ub4dor&3x", nil},
+		{"correct horse battery staple", ErrWeakPassword},
+		{"Correct horse battery staple", nil},
+		{"Sh0rt!", ErrWeakPassword},
+		{strings.Repeat("Aa1", 25), ErrWeakPassword},
+		{"jane.doe@EXAMPLE.com", ErrWeakPassword},
+		{"Jane Doe Smith1", nil},
+		{"JaneDoe Smith", ErrWeakPassword},
+		{"Password123!", ErrBreachedPassword},
+	} {
+		err := policy.Check(tc.password, account)
+		if tc.want == nil {
+			assert.Nil(t, err, tc.password)
+		} else {
+			assert.ErrorIs(t, err, tc.want, tc.password)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/mail"
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PasswordResetService lets account holders who forgot their password choose
+// a new one through a token mailed to them.
+type PasswordResetService interface {
+	// RequestReset mails a reset token to the account registered with email.
+	// It succeeds without sending anything for unknown emails and within the
+	// resend interval, so that callers cannot tell which emails are
+	// registered.
+	RequestReset(email string) error
+	// ResetPassword sets the password of the account the token was mailed
+	// for, logs every device of the account out and revokes its personal
+	// access tokens. A password the policy refuses leaves the token usable
+	// for another one.
+	ResetPassword(token string, password string) error
+}
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// PasswordResetConfig sets how long a reset token can be used, how often it
+// can be sent again and the link mailed with it. The token is appended to
+// URL as the token query parameter; without URL the token is mailed on its
+// own.
+type PasswordResetConfig struct {
+	TokenLifetime  time.Duration
+	ResendInterval time.Duration
+	URL            string
+}
+
+type PasswordResetServiceImpl struct {
+	resetRepository   repositories.PasswordResetTokenRepository
+	accountRepository repositories.AccountRepository
+	sessionService    SessionService
+	tokenService      PersonalAccessTokenService
+	passwordPolicy    PasswordPolicy
+	sender            mail.Sender
+	config            PasswordResetConfig
+	now               func() time.Time
+}
+
+func NewPasswordResetServiceImpl(resetRepository repositories.PasswordResetTokenRepository, accountRepository repositories.AccountRepository, sessionService SessionService, tokenService PersonalAccessTokenService, passwordPolicy PasswordPolicy, sender mail.Sender, config PasswordResetConfig) *PasswordResetServiceImpl {
+	return &PasswordResetServiceImpl{
+		resetRepository:   resetRepository,
+		accountRepository: accountRepository,
+		sessionService:    sessionService,
+		tokenService:      tokenService,
+		passwordPolicy:    passwordPolicy,
+		sender:            sender,
+		config:            config,
+		now:               time.Now,
+	}
+}
+
+func (s *PasswordResetServiceImpl) RequestReset(email string) error {
+	account, err := s.accountRepository.FindByEmail(email)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	last, err := s.resetRepository.FindByAccount(account.AccountId)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	if last != nil && s.now().Before(time.Unix(int64(last.CreatedAt.T), 0).Add(s.config.ResendInterval)) {
+		return nil
+	}
+
+	token, err := newMailedToken()
+	if err != nil {
+		return err
+	}
+	body, err := mailedTokenBody("choose a new password", s.config.URL, token, s.config.TokenLifetime)
+	if err != nil {
+		return err
+	}
+
+	// Only the latest token mailed to an account can be used.
+	if err := s.resetRepository.DeleteByAccount(account.AccountId); err != nil {
+		return err
+	}
+	now := s.now()
+	err = s.resetRepository.Insert(&models.PasswordResetToken{
+		TokenHash: hashSecret(token),
+		AccountId: account.AccountId,
+		ExpiresAt: primitive.Timestamp{T: uint32(now.Add(s.config.TokenLifetime).Unix())},
+		CreatedAt: primitive.Timestamp{T: uint32(now.Unix())},
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.sender.Send(mail.Message{
+		To:      account.Email,
+		Subject: "Reset your password",
+		Body:    body,
+	})
+}
+
+func (s *PasswordResetServiceImpl) ResetPassword(token string, password string) error {
+	tokenHash := hashSecret(token)
+	reset, err := s.resetRepository.Find(tokenHash)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if s.now().Unix() >= int64(reset.ExpiresAt.T) {
+		return ErrInvalidResetToken
+	}
+
+	account, err := s.accountRepository.FindById(reset.AccountId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.passwordPolicy.Check(password, account); err != nil {
+		return err
+	}
+
+	// Consuming the token last keeps it for another try when the password is
+	// refused, and lets only one of concurrent resets through.
+	_, err = s.resetRepository.Consume(tokenHash)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	account.Password = hashedPassword
+	account.UpdatedAt = primitive.Timestamp{T: uint32(s.now().Unix())}
+	if _, err := s.accountRepository.Update(account); err != nil {
+		return err
+	}
+
+	if err := s.sessionService.EndSession(account.AccountId, ""); err != nil {
+		return err
+	}
+	return s.tokenService.RevokeAll(account.AccountId)
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/mail"
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/stretchr/testify/assert"
+)
+
+var mailedToken = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+func TestPasswordResetService(t *testing.T) {
+	accounts := repositories.NewMemoryAccountRepository()
+	families := repositories.NewMemoryTokenFamilyRepository()
+	sessionService := NewSessionServiceImpl(families, accounts, newTestJWTService())
+	tokenService := NewPersonalAccessTokenServiceImpl(repositories.NewMemoryPersonalAccessTokenRepository(), accounts, PersonalAccessTokenConfig{})
+	var outbox bytes.Buffer
+	resetService := NewPasswordResetServiceImpl(repositories.NewMemoryPasswordResetTokenRepository(), accounts, sessionService, tokenService, testPasswordPolicy, mail.NewWriterSender(&outbox), PasswordResetConfig{
+		TokenLifetime: time.Hour,
+		URL:           "https://example.com/reset",
+	})
+
+	account := &models.Account{AccountId: "1", Email: "test@example.com", Roles: []string{models.RoleUser}}
+	accounts.Insert(account)
+
+	requestToken := func(t *testing.T) string {
+		outbox.Reset()
+		assert.Nil(t, resetService.RequestReset("test@example.com"))
+		match := mailedToken.FindStringSubmatch(outbox.String())
+		if match == nil {
+			t.Fatalf("no token mailed: %q", outbox.String())
+		}
+		return match[1]
+	}
+
+	t.Run("the mailed token sets the password once", func(t *testing.T) {
+		_, refreshToken, _ := sessionService.StartSession(account, "phone")
+		pat, _, err := tokenService.Create("1", "ci", []string{models.ScopeRunsRead}, 0)
+		assert.Nil(t, err)
+		token := requestToken(t)
+		assert.Contains(t, outbox.String(), "To: test@example.com")
+
+		assert.Nil(t, resetService.ResetPassword(token, "changed"))
+		updated, _ := accounts.FindById("1")
+		assert.True(t, (&AccountServiceImpl{}).CheckPasswordHash("changed", updated.Password))
+
+		assert.ErrorIs(t, resetService.ResetPassword(token, "again"), ErrInvalidResetToken)
+
+		_, _, err = sessionService.Refresh(refreshToken)
+		assert.ErrorIs(t, err, ErrSessionRevoked)
+		_, err = tokenService.Authenticate(pat)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("a refused password leaves the token usable", func(t *testing.T) {
+		token := requestToken(t)
+
+		assert.ErrorIs(t, resetService.ResetPassword(token, "test"), ErrWeakPassword)
+		assert.Nil(t, resetService.ResetPassword(token, "changed"))
+	})
+
+	t.Run("a new request replaces the previous token", func(t *testing.T) {
+		first := requestToken(t)
+		second := requestToken(t)
+
+		assert.ErrorIs(t, resetService.ResetPassword(first, "changed"), ErrInvalidResetToken)
+		assert.Nil(t, resetService.ResetPassword(second, "changed"))
+	})
+
+	t.Run("expired tokens are refused", func(t *testing.T) {
+		token := requestToken(t)
+		resetService.now = func() time.Time { return time.Now().Add(time.Hour) }
+		defer func() { resetService.now = time.Now }()
+
+		assert.ErrorIs(t, resetService.ResetPassword(token, "changed"), ErrInvalidResetToken)
+	})
+
+	t.Run("requests are throttled silently", func(t *testing.T) {
+		requestToken(t)
+		resetService.config.ResendInterval = time.Minute
+		defer func() { resetService.config.ResendInterval = 0 }()
+
+		outbox.Reset()
+		assert.Nil(t, resetService.RequestReset("test@example.com"))
+		assert.Empty(t, outbox.String())
+
+		resetService.now = func() time.Time { return time.Now().Add(time.Minute) }
+		defer func() { resetService.now = time.Now }()
+		assert.Nil(t, resetService.RequestReset("test@example.com"))
+		assert.NotEmpty(t, outbox.String())
+	})
+
+	t.Run("unknown emails are not revealed", func(t *testing.T) {
+		outbox.Reset()
+		assert.Nil(t, resetService.RequestReset("nobody@example.com"))
+		assert.Empty(t, outbox.String())
+	})
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PersonalAccessTokenService issues the long-lived tokens scripts act for an
+// account with, in place of logging in and refreshing.
+type PersonalAccessTokenService interface {
+	// Create issues a token granting scopes, which the roles of the account
+	// have to grant as well. A zero lifetime never expires. The token is only
+	// returned here, nothing but its hash is kept.
+	Create(accountId string, name string, scopes []string, lifetime time.Duration) (string, *models.PersonalAccessToken, error)
+	List(accountId string) ([]*models.PersonalAccessToken, error)
+	Revoke(accountId string, tokenId string) error
+	// RevokeAll revokes every token of the account, as a new password does.
+	RevokeAll(accountId string) error
+	// Authenticate returns the stored token for token, its scopes narrowed to
+	// those the roles of the account still grant.
+	Authenticate(token string) (*models.PersonalAccessToken, error)
+}
+
+var (
+	ErrInvalidAccessToken = errors.New("invalid or expired personal access token")
+	ErrScopeNotGranted    = errors.New("scope not granted to the account")
+	ErrTokenNameTaken     = errors.New("a token with this name already exists")
+	ErrTokenLifetime      = errors.New("token lifetime too long")
+)
+
+// lastUsedResolution is how stale the last use of a token may be, recording
+// every request would write on every request.
+const lastUsedResolution = time.Minute
+
+// PersonalAccessTokenConfig caps the lifetime of new tokens at MaxLifetime,
+// when it is set; tokens then have to expire.
+type PersonalAccessTokenConfig struct {
+	MaxLifetime time.Duration
+}
+
+type PersonalAccessTokenServiceImpl struct {
+	tokenRepository   repositories.PersonalAccessTokenRepository
+	accountRepository repositories.AccountRepository
+	config            PersonalAccessTokenConfig
+	now               func() time.Time
+}
+
+func NewPersonalAccessTokenServiceImpl(tokenRepository repositories.PersonalAccessTokenRepository, accountRepository repositories.AccountRepository, config PersonalAccessTokenConfig) *PersonalAccessTokenServiceImpl {
+	return &PersonalAccessTokenServiceImpl{
+		tokenRepository:   tokenRepository,
+		accountRepository: accountRepository,
+		config:            config,
+		now:               time.Now,
+	}
+}
+
+func (s *PersonalAccessTokenServiceImpl) Create(accountId string, name string, scopes []string, lifetime time.Duration) (string, *models.PersonalAccessToken, error) {
+	if s.config.MaxLifetime > 0 && (lifetime <= 0 || lifetime > s.config.MaxLifetime) {
+		return "", nil, fmt.Errorf("%w: tokens expire within %v", ErrTokenLifetime, s.config.MaxLifetime)
+	}
+
+	account, err := s.accountRepository.FindById(accountId)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, scope := range scopes {
+		if len(models.GrantedScopes(account.Roles, []string{scope})) == 0 {
+			return "", nil, fmt.Errorf("%w: %s", ErrScopeNotGranted, scope)
+		}
+	}
+
+	secret, err := newMailedToken()
+	if err != nil {
+		return "", nil, err
+	}
+	token := models.PersonalAccessTokenPrefix + secret
+
+	now := s.now()
+	pat := &models.PersonalAccessToken{
+		TokenId:   primitive.NewObjectID().Hex(),
+		AccountId: accountId,
+		Name:      name,
+		Scopes:    scopes,
+		TokenHash: hashSecret(token),
+		CreatedAt: primitive.Timestamp{T: uint32(now.Unix())},
+	}
+	if lifetime > 0 {
+		pat.ExpiresAt = primitive.Timestamp{T: uint32(now.Add(lifetime).Unix())}
+	}
+
+	err = s.tokenRepository.Insert(pat)
+	if errors.Is(err, repositories.ErrDuplicate) {
+		return "", nil, ErrTokenNameTaken
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return token, pat, nil
+}
+
+func (s *PersonalAccessTokenServiceImpl) List(accountId string) ([]*models.PersonalAccessToken, error) {
+	return s.tokenRepository.FindByAccount(accountId)
+}
+
+func (s *PersonalAccessTokenServiceImpl) Revoke(accountId string, tokenId string) error {
+	return s.tokenRepository.Delete(accountId, tokenId)
+}
+
+func (s *PersonalAccessTokenServiceImpl) RevokeAll(accountId string) error {
+	return s.tokenRepository.DeleteByAccount(accountId)
+}
+
+func (s *PersonalAccessTokenServiceImpl) Authenticate(token string) (*models.PersonalAccessToken, error) {
+	pat, err := s.tokenRepository.FindByHash(hashSecret(token))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if pat.Expired(now.Unix()) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	account, err := s.accountRepository.FindById(pat.AccountId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Roles taken away since the token was created take its scopes with them.
+	pat.Scopes = models.GrantedScopes(account.Roles, pat.Scopes)
+
+	if now.Sub(time.Unix(int64(pat.LastUsedAt.T), 0)) >= lastUsedResolution {
+		pat.LastUsedAt = primitive.Timestamp{T: uint32(now.Unix())}
+		if err := s.tokenRepository.Touch(pat.TokenId, pat.LastUsedAt); err != nil {
+			return nil, err
+		}
+	}
+	return pat, nil
+}
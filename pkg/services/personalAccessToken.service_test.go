@@ -0,0 +1,92 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersonalAccessTokenService(t *testing.T) {
+	accounts := repositories.NewMemoryAccountRepository()
+	tokens := repositories.NewMemoryPersonalAccessTokenRepository()
+	tokenService := NewPersonalAccessTokenServiceImpl(tokens, accounts, PersonalAccessTokenConfig{})
+
+	account := &models.Account{AccountId: "1", Email: "test@example.com", Roles: []string{models.RoleUser, models.RoleAdmin}}
+	accounts.Insert(account)
+
+	clock := time.Now()
+	tokenService.now = func() time.Time { return clock }
+
+	t.Run("created tokens authenticate with their scopes", func(t *testing.T) {
+		token, created, err := tokenService.Create("1", "ci", []string{models.ScopeRunsRead}, 0)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(token, models.PersonalAccessTokenPrefix))
+		assert.NotContains(t, created.TokenHash, token)
+
+		got, err := tokenService.Authenticate(token)
+		assert.Nil(t, err)
+		assert.Equal(t, created.TokenId, got.TokenId)
+		assert.Equal(t, "1", got.AccountId)
+		assert.Equal(t, []string{models.ScopeRunsRead}, got.Scopes)
+		assert.Equal(t, uint32(clock.Unix()), got.LastUsedAt.T)
+
+		_, err = tokenService.Authenticate(token + "x")
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("names are unique per account", func(t *testing.T) {
+		_, _, err := tokenService.Create("1", "ci", []string{models.ScopeRunsRead}, 0)
+		assert.ErrorIs(t, err, ErrTokenNameTaken)
+	})
+
+	t.Run("tokens expire", func(t *testing.T) {
+		token, _, err := tokenService.Create("1", "short", []string{models.ScopeRunsRead}, time.Hour)
+		assert.Nil(t, err)
+
+		clock = clock.Add(time.Hour)
+		defer func() { clock = clock.Add(-time.Hour) }()
+		_, err = tokenService.Authenticate(token)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	})
+
+	t.Run("tokens grant only what the roles of the account still grant", func(t *testing.T) {
+		_, _, err := tokenService.Create("1", "too much", []string{models.ScopeRunsRead, "runs:delete"}, 0)
+		assert.ErrorIs(t, err, ErrScopeNotGranted)
+
+		token, _, err := tokenService.Create("1", "admin", []string{models.ScopeAccountsAdmin, models.ScopeRunsRead}, 0)
+		assert.Nil(t, err)
+
+		account.Roles = []string{models.RoleUser}
+		accounts.Update(account)
+
+		got, err := tokenService.Authenticate(token)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{models.ScopeRunsRead}, got.Scopes)
+	})
+
+	t.Run("revoked tokens no longer authenticate", func(t *testing.T) {
+		token, created, _ := tokenService.Create("1", "revoked", []string{models.ScopeRunsRead}, 0)
+
+		assert.ErrorIs(t, tokenService.Revoke("2", created.TokenId), repositories.ErrNotFound)
+		assert.Nil(t, tokenService.Revoke("1", created.TokenId))
+
+		_, err := tokenService.Authenticate(token)
+		assert.ErrorIs(t, err, ErrInvalidAccessToken)
+
+		listed, _ := tokenService.List("1")
+		assert.Len(t, listed, 3)
+	})
+
+	t.Run("the lifetime can be capped", func(t *testing.T) {
+		capped := NewPersonalAccessTokenServiceImpl(tokens, accounts, PersonalAccessTokenConfig{MaxLifetime: 24 * time.Hour})
+
+		_, _, err := capped.Create("1", "forever", []string{models.ScopeRunsRead}, 0)
+		assert.ErrorIs(t, err, ErrTokenLifetime)
+		_, _, err = capped.Create("1", "day", []string{models.ScopeRunsRead}, 24*time.Hour)
+		assert.Nil(t, err)
+	})
+}
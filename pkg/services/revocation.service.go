@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RevocationService refuses access tokens before they expire. A token is
+// revoked by its jti, or along with the rest of its session when the token
+// family of the session is revoked.
+type RevocationService interface {
+	RevokeToken(tokenId string, accountId string, expiresAt time.Time) error
+	IsRevoked(*MyCustomClaims) (bool, error)
+}
+
+type RevocationServiceImpl struct {
+	revokedTokenRepository repositories.RevokedTokenRepository
+	familyRepository       repositories.TokenFamilyRepository
+	leeway                 time.Duration
+}
+
+// NewRevocationServiceImpl returns a service remembering revoked tokens
+// until they expired, leeway included.
+func NewRevocationServiceImpl(revokedTokenRepository repositories.RevokedTokenRepository, familyRepository repositories.TokenFamilyRepository, leeway time.Duration) *RevocationServiceImpl {
+	return &RevocationServiceImpl{
+		revokedTokenRepository: revokedTokenRepository,
+		familyRepository:       familyRepository,
+		leeway:                 leeway,
+	}
+}
+
+func (s *RevocationServiceImpl) RevokeToken(tokenId string, accountId string, expiresAt time.Time) error {
+	err := s.revokedTokenRepository.Insert(&models.RevokedToken{
+		TokenId:   tokenId,
+		AccountId: accountId,
+		ExpiresAt: primitive.Timestamp{T: uint32(expiresAt.Unix())},
+	})
+	if err != nil && !errors.Is(err, repositories.ErrDuplicate) {
+		return err
+	}
+
+	// Expired tokens are refused by their signature check, the list only
+	// has to remember the ones that are still valid.
+	return s.revokedTokenRepository.DeleteExpired(primitive.Timestamp{T: uint32(time.Now().Add(-s.leeway).Unix())})
+}
+
+func (s *RevocationServiceImpl) IsRevoked(claims *MyCustomClaims) (bool, error) {
+	if claims.Id != "" {
+		revoked, err := s.revokedTokenRepository.Exists(claims.Id)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	if claims.Session == "" {
+		return false, nil
+	}
+	family, err := s.familyRepository.FindById(claims.Session)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return family.Revoked, nil
+}
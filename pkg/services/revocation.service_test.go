@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevocationService(t *testing.T) {
+	families := repositories.NewMemoryTokenFamilyRepository()
+	revocationService := NewRevocationServiceImpl(repositories.NewMemoryRevokedTokenRepository(), families, time.Minute)
+
+	families.Insert(&models.TokenFamily{FamilyId: "session", AccountId: "1", CurrentTokenId: "refresh"})
+
+	t.Run("revoked tokens are refused", func(t *testing.T) {
+		claims := &MyCustomClaims{StandardClaims: jwt.StandardClaims{Id: "a", Subject: "1"}}
+
+		revoked, err := revocationService.IsRevoked(claims)
+		assert.Nil(t, err)
+		assert.False(t, revoked)
+
+		assert.Nil(t, revocationService.RevokeToken("a", "1", time.Now().Add(time.Minute)))
+		assert.Nil(t, revocationService.RevokeToken("a", "1", time.Now().Add(time.Minute)))
+
+		revoked, err = revocationService.IsRevoked(claims)
+		assert.Nil(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("tokens of a revoked session are refused", func(t *testing.T) {
+		claims := &MyCustomClaims{Session: "session", StandardClaims: jwt.StandardClaims{Id: "b", Subject: "1"}}
+
+		revoked, _ := revocationService.IsRevoked(claims)
+		assert.False(t, revoked)
+
+		families.Revoke("session")
+
+		revoked, _ = revocationService.IsRevoked(claims)
+		assert.True(t, revoked)
+	})
+
+	t.Run("tokens of an unknown session are refused", func(t *testing.T) {
+		claims := &MyCustomClaims{Session: "missing", StandardClaims: jwt.StandardClaims{Id: "c", Subject: "1"}}
+
+		revoked, _ := revocationService.IsRevoked(claims)
+		assert.True(t, revoked)
+	})
+}
@@ -1,28 +1,42 @@
 package services
 
 import (
-	"context"
 	"errors"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/croisade/chimichanga/pkg/models"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/croisade/chimichanga/pkg/repositories"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type RunService interface {
 	CreateRun(*models.Run) (*models.Run, error)
+	ValidateRun(*models.Run) error
 	GetRun(*RunRequest) (*models.Run, error)
 	GetAll(*RunFetchRequest) ([]*models.Run, error)
 	UpdateRun(*RunUpdateRequest) (*models.Run, error)
 	DeleteRun(*RunRequest) error
+	AddSplit(*SplitRequest) (*models.Run, error)
+	UpdateSplit(*SplitUpdateRequest) (*models.Run, error)
+	DeleteSplit(*SplitDeleteRequest) (*models.Run, error)
 }
 
+// paceTolerance is how far, relative to the derived value, a supplied pace
+// may be off before the run is rejected. It absorbs rounding on the client.
+const paceTolerance = 0.02
+
+var (
+	ErrInconsistentRun   = errors.New("pace does not match distance and time")
+	ErrInconsistentSplit = errors.New("split pace does not match distance and time")
+	ErrIncompleteSplit   = errors.New("a split needs two of distance, time and pace")
+	ErrSplitNotFound     = errors.New("split not found")
+	ErrTotalsFromSplits  = errors.New("distance, time, pace and incline are computed from the splits")
+)
+
 type RunServiceImpl struct {
-	runCollection *mongo.Collection
-	ctx           context.Context
+	runRepository repositories.RunRepository
 }
 
 type RunRequest struct {
@@ -35,73 +49,85 @@ type RunFetchRequest struct {
 }
 
 type RunUpdateRequest struct {
-	AccountId string  `json:"accountId" bson:"accountId" binding:"required"`
-	RunId     string  `json:"runId" bson:"runId" binding:"required"`
-	Pace      float32 `json:"pace" bson:"pace"`
-	Time      string  `json:"time" bson:"time"`
-	Distance  float32 `json:"distance" bson:"distance"`
-	Lap       int     `json:"lap" bson:"lap"`
-	Incline   float32 `json:"incline" bson:"incline"`
+	AccountId string          `json:"accountId" bson:"accountId" binding:"required"`
+	RunId     string          `json:"runId" bson:"runId" binding:"required"`
+	Pace      float32         `json:"pace" bson:"pace"`
+	Time      models.Duration `json:"time" bson:"time"`
+	Distance  float32         `json:"distance" bson:"distance"`
+	Incline   float32         `json:"incline" bson:"incline"`
 }
 
-func NewRunService(runCollection *mongo.Collection, ctx context.Context) *RunServiceImpl {
+type SplitRequest struct {
+	AccountId string       `json:"accountId" binding:"required"`
+	RunId     string       `json:"runId" binding:"required"`
+	Split     models.Split `json:"split"`
+}
+
+// SplitUpdateRequest replaces a split. Lap is the 1-based position of the split.
+type SplitUpdateRequest struct {
+	AccountId string       `json:"accountId" binding:"required"`
+	RunId     string       `json:"runId" binding:"required"`
+	Lap       int          `json:"lap" binding:"required,gte=1"`
+	Split     models.Split `json:"split"`
+}
+
+type SplitDeleteRequest struct {
+	AccountId string `json:"accountId" binding:"required"`
+	RunId     string `json:"runId" binding:"required"`
+	Lap       int    `json:"lap" binding:"required,gte=1"`
+}
+
+func NewRunService(runRepository repositories.RunRepository) *RunServiceImpl {
 	return &RunServiceImpl{
-		runCollection: runCollection,
-		ctx:           ctx,
+		runRepository: runRepository,
 	}
 }
 
+// CreateRun stores a new run. A run that already carries a creation time, such
+// as one imported from a training log, keeps it.
 func (u *RunServiceImpl) CreateRun(run *models.Run) (*models.Run, error) {
-	var result *models.Run
+	if err := u.ValidateRun(run); err != nil {
+		return nil, err
+	}
 
 	run.RunId = primitive.NewObjectID().Hex()
-	run.CreatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
+	if run.CreatedAt.T == 0 {
+		run.CreatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
+	}
 	run.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
 
-	_, err := u.runCollection.InsertOne(u.ctx, run)
+	err := u.runRepository.Insert(run)
 
 	if err != nil {
 		return nil, err
 	}
 
-	filter := bson.M{"accountId": run.AccountId}
-	err = u.runCollection.FindOne(u.ctx, filter).Decode(&result)
-	return result, err
+	return u.runRepository.FindOne(run.AccountId, run.RunId)
 }
 
-func (u *RunServiceImpl) GetRun(runRequest *RunRequest) (*models.Run, error) {
-	var run *models.Run
-	query := bson.M{"accountId": runRequest.AccountId, "runId": runRequest.RunId}
+// ValidateRun applies the checks and derivations of CreateRun to run without
+// storing it.
+func (u *RunServiceImpl) ValidateRun(run *models.Run) error {
+	if len(run.Splits) > 0 && (run.Distance != 0 || run.Time != 0 || run.Pace != 0 || run.Incline != 0) {
+		return ErrTotalsFromSplits
+	}
+	if err := totalSplits(run); err != nil {
+		return err
+	}
+	return derivePace(run)
+}
 
-	err := u.runCollection.FindOne(u.ctx, query).Decode(&run)
-	return run, err
+func (u *RunServiceImpl) GetRun(runRequest *RunRequest) (*models.Run, error) {
+	return u.runRepository.FindOne(runRequest.AccountId, runRequest.RunId)
 }
 
 func (u *RunServiceImpl) GetAll(runAccountId *RunFetchRequest) ([]*models.Run, error) {
-	var runs []*models.Run
-	filter := bson.M{"accountId": runAccountId.AccountId}
-
-	cursor, err := u.runCollection.Find(u.ctx, filter)
+	runs, err := u.runRepository.FindByAccount(runAccountId.AccountId)
 
 	if err != nil {
 		return nil, err
 	}
 
-	for cursor.Next(u.ctx) {
-		var run models.Run
-		err := cursor.Decode(&run)
-		if err != nil {
-			return nil, err
-		}
-		runs = append(runs, &run)
-
-	}
-	if err := cursor.Err(); err != nil {
-		return nil, err
-	}
-
-	cursor.Close(u.ctx)
-
 	if len(runs) == 0 {
 		return nil, errors.New("documents not found")
 	}
@@ -109,16 +135,17 @@ func (u *RunServiceImpl) GetAll(runAccountId *RunFetchRequest) ([]*models.Run, e
 }
 
 func (u *RunServiceImpl) UpdateRun(run *RunUpdateRequest) (*models.Run, error) {
-	filter := bson.M{"accountId": run.AccountId}
-	var result *models.Run
-
 	existingRun, err := u.GetRun(&RunRequest{run.AccountId, run.RunId})
 
 	if err != nil {
 		return nil, err
 	}
 
-	if run.Time != "" {
+	if len(existingRun.Splits) > 0 && (run.Time != 0 || run.Distance != 0.0 || run.Pace != 0.0 || run.Incline != 0.0) {
+		return nil, ErrTotalsFromSplits
+	}
+
+	if run.Time != 0 {
 		existingRun.Time = run.Time
 	}
 	if run.Distance != 0.0 {
@@ -127,40 +154,157 @@ func (u *RunServiceImpl) UpdateRun(run *RunUpdateRequest) (*models.Run, error) {
 	if run.Incline != 0.0 {
 		existingRun.Incline = run.Incline
 	}
-	if run.Lap != 0 {
-		existingRun.Lap = run.Lap
-	}
 	if run.Pace != 0.0 {
 		existingRun.Pace = run.Pace
+	} else if run.Time != 0 || run.Distance != 0.0 {
+		// The stored pace was derived from the values being replaced.
+		existingRun.Pace = 0.0
+	}
+
+	if err := derivePace(existingRun); err != nil {
+		return nil, err
 	}
 
 	existingRun.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
 
-	upsert := false
-	after := options.After
-	opt := options.FindOneAndUpdateOptions{
-		ReturnDocument: &after,
-		Upsert:         &upsert,
+	return u.runRepository.Update(existingRun)
+}
+
+func (u *RunServiceImpl) DeleteRun(runRequest *RunRequest) error {
+	err := u.runRepository.Delete(runRequest.AccountId, runRequest.RunId)
+
+	if errors.Is(err, repositories.ErrNotFound) {
+		return errors.New("no matched document found for delete")
+	}
+
+	return err
+}
+
+func (u *RunServiceImpl) AddSplit(request *SplitRequest) (*models.Run, error) {
+	run, err := u.GetRun(&RunRequest{request.AccountId, request.RunId})
+	if err != nil {
+		return nil, err
+	}
+
+	run.Splits = append(run.Splits, request.Split)
+	return u.saveSplits(run)
+}
+
+func (u *RunServiceImpl) UpdateSplit(request *SplitUpdateRequest) (*models.Run, error) {
+	run, err := u.GetRun(&RunRequest{request.AccountId, request.RunId})
+	if err != nil {
+		return nil, err
 	}
 
-	updatedRun := u.runCollection.FindOneAndUpdate(u.ctx, filter, bson.M{"$set": existingRun}, &opt)
-	if updatedRun.Err() != nil {
-		return nil, updatedRun.Err()
+	if request.Lap > len(run.Splits) {
+		return nil, ErrSplitNotFound
+	}
+
+	run.Splits[request.Lap-1] = request.Split
+	return u.saveSplits(run)
+}
+
+func (u *RunServiceImpl) DeleteSplit(request *SplitDeleteRequest) (*models.Run, error) {
+	run, err := u.GetRun(&RunRequest{request.AccountId, request.RunId})
+	if err != nil {
+		return nil, err
 	}
 
-	decodeErr := updatedRun.Decode(&result)
+	if request.Lap > len(run.Splits) {
+		return nil, ErrSplitNotFound
+	}
 
-	return result, decodeErr
+	run.Splits = append(run.Splits[:request.Lap-1], run.Splits[request.Lap:]...)
+	return u.saveSplits(run)
 }
 
-func (u *RunServiceImpl) DeleteRun(runRequest *RunRequest) error {
-	filter := bson.M{"accountId": runRequest.AccountId, "runId": runRequest.RunId}
+// saveSplits recomputes the totals of a run whose splits changed and stores it.
+// A run left without splits keeps the totals of its last split list.
+func (u *RunServiceImpl) saveSplits(run *models.Run) (*models.Run, error) {
+	if len(run.Splits) > 0 {
+		run.Pace = 0
+	}
+	if err := totalSplits(run); err != nil {
+		return nil, err
+	}
+	if err := derivePace(run); err != nil {
+		return nil, err
+	}
 
-	result, _ := u.runCollection.DeleteOne(u.ctx, filter)
+	run.UpdatedAt = primitive.Timestamp{T: uint32(time.Now().Unix())}
 
-	if result.DeletedCount != 1 {
-		return errors.New("no matched document found for delete")
+	return u.runRepository.Update(run)
+}
+
+// totalSplits completes every split of run and sets the run's distance, time
+// and time weighted incline from them. Runs without splits are left alone.
+func totalSplits(run *models.Run) error {
+	if len(run.Splits) == 0 {
+		return nil
+	}
+
+	var distance, seconds, inclineSeconds, inclineSum float64
+	for i := range run.Splits {
+		split := &run.Splits[i]
+		if err := deriveSplit(split); err != nil {
+			return fmt.Errorf("split %d: %w", i+1, err)
+		}
+
+		distance += float64(split.Distance)
+		seconds += split.Time.Seconds()
+		inclineSeconds += float64(split.Incline) * split.Time.Seconds()
+		inclineSum += float64(split.Incline)
 	}
 
+	run.Distance = float32(distance)
+	run.Time = models.DurationFromSeconds(seconds)
+	run.Incline = float32(inclineSum / float64(len(run.Splits)))
+	if seconds > 0 {
+		run.Incline = float32(inclineSeconds / seconds)
+	}
+	return nil
+}
+
+// deriveSplit fills in whichever of distance, time and pace a split is
+// missing, and checks the pace when all three were given.
+func deriveSplit(split *models.Split) error {
+	switch {
+	case split.Distance > 0 && split.Time > 0:
+		derived := float64(split.Distance) / split.Time.Seconds()
+		if split.Pace == 0 {
+			split.Pace = float32(derived)
+		} else if !withinTolerance(split.Pace, derived) {
+			return ErrInconsistentSplit
+		}
+	case split.Distance > 0 && split.Pace > 0:
+		split.Time = models.DurationFromSeconds(float64(split.Distance) / float64(split.Pace))
+	case split.Time > 0 && split.Pace > 0:
+		split.Distance = float32(float64(split.Pace) * split.Time.Seconds())
+	default:
+		return ErrIncompleteSplit
+	}
 	return nil
 }
+
+// derivePace fills in the pace, in metres per second, when it was omitted and
+// rejects runs whose pace disagrees with their distance and time.
+func derivePace(run *models.Run) error {
+	if run.Time <= 0 || run.Distance <= 0 {
+		return nil
+	}
+
+	derived := float64(run.Distance) / run.Time.Seconds()
+	if run.Pace == 0 {
+		run.Pace = float32(derived)
+		return nil
+	}
+
+	if !withinTolerance(run.Pace, derived) {
+		return ErrInconsistentRun
+	}
+	return nil
+}
+
+func withinTolerance(pace float32, derived float64) bool {
+	return math.Abs(float64(pace)-derived) <= derived*paceTolerance
+}
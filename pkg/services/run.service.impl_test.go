@@ -1,39 +1,22 @@
 package services
 
 import (
-	"context"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-var accountCollection *mongo.Collection
-var runsCollection *mongo.Collection
-var ctx context.Context
+var accountRepository *repositories.MemoryAccountRepository
+var runRepository *repositories.MemoryRunRepository
 
 func setup() {
-	ctx = context.TODO()
-	c, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
-	if err != nil {
-		log.Fatalf("Error: %v", err)
-	}
-
-	accountCollection = c.Database("CorroYouRun").Collection("accounts")
-	runsCollection = c.Database("CorroYouRun").Collection("runs")
-	_, delErr := runsCollection.DeleteMany(ctx, bson.D{{}})
-	_, accDelErr := accountCollection.DeleteMany(ctx, bson.D{{}})
-
-	if delErr != nil {
-		log.Fatalf("Error: %v", delErr)
-	}
-	if accDelErr != nil {
-		log.Fatalf("Error: %v", delErr)
-	}
+	accountRepository = repositories.NewMemoryAccountRepository()
+	runRepository = repositories.NewMemoryRunRepository()
 	log.Println("\n-----Setup complete-----")
 }
 
@@ -44,16 +27,148 @@ func TestMain(m *testing.M) {
 }
 
 func TestCreateRun(t *testing.T) {
-	run := &models.Run{Pace: 6.0, Lap: 0, Distance: 3.0, Time: "30:00", Incline: 0.0, AccountId: "123"}
-	response := &models.Run{}
+	run := &models.Run{Pace: models.Metric.ToMetresPerSecond(6.0), Distance: models.Metric.ToMetres(3.0), Time: models.Duration(30 * time.Minute), Incline: 0.0, AccountId: "123"}
 
-	runService := NewRunService(runsCollection, ctx)
+	runService := NewRunService(runRepository)
 	got, err := runService.CreateRun(run)
 	assert.Nil(t, err)
 
-	query := bson.M{"accountId": run.AccountId}
-	findErr := runsCollection.FindOne(ctx, query).Decode(&response)
+	response, findErr := runRepository.FindOne(run.AccountId, got.RunId)
 
 	assert.Nil(t, findErr)
 	assert.Equal(t, response.Pace, got.Pace)
 }
+
+func TestValidateRun(t *testing.T) {
+	runService := NewRunService(repositories.NewMemoryRunRepository())
+
+	run := &models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), AccountId: "123"}
+	assert.Nil(t, runService.ValidateRun(run))
+	assert.Equal(t, float32(1.6666666), run.Pace)
+	assert.Empty(t, run.RunId)
+
+	err := runService.ValidateRun(&models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), Pace: 5.0})
+	assert.ErrorIs(t, err, ErrInconsistentRun)
+}
+
+func TestCreateRunKeepsCreationTime(t *testing.T) {
+	runService := NewRunService(repositories.NewMemoryRunRepository())
+	recorded := primitive.Timestamp{T: uint32(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC).Unix())}
+
+	run, err := runService.CreateRun(&models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), AccountId: "123", CreatedAt: recorded})
+	assert.Nil(t, err)
+	assert.Equal(t, recorded, run.CreatedAt)
+	assert.NotEqual(t, recorded, run.UpdatedAt)
+}
+
+func TestUpdateRunOnlyTouchesRequestedRun(t *testing.T) {
+	runService := NewRunService(repositories.NewMemoryRunRepository())
+	first, _ := runService.CreateRun(&models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), AccountId: "123"})
+	second, _ := runService.CreateRun(&models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), AccountId: "123"})
+
+	got, err := runService.UpdateRun(&RunUpdateRequest{AccountId: "123", RunId: second.RunId, Distance: 5000.0})
+	assert.Nil(t, err)
+	assert.Equal(t, second.RunId, got.RunId)
+	assert.Equal(t, float32(5000.0), got.Distance)
+
+	unchanged, _ := runService.GetRun(&RunRequest{AccountId: "123", RunId: first.RunId})
+	assert.Equal(t, float32(3000.0), unchanged.Distance)
+}
+
+func TestDeleteRun(t *testing.T) {
+	runService := NewRunService(repositories.NewMemoryRunRepository())
+	run, _ := runService.CreateRun(&models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), AccountId: "123"})
+
+	err := runService.DeleteRun(&RunRequest{AccountId: "123", RunId: run.RunId})
+	assert.Nil(t, err)
+
+	err = runService.DeleteRun(&RunRequest{AccountId: "123", RunId: run.RunId})
+	assert.ErrorContains(t, err, "no matched document")
+}
+
+func TestRunPace(t *testing.T) {
+	runService := NewRunService(repositories.NewMemoryRunRepository())
+
+	t.Run("derives pace when it is omitted", func(t *testing.T) {
+		got, err := runService.CreateRun(&models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), AccountId: "123"})
+
+		assert.Nil(t, err)
+		assert.Equal(t, float32(6.0), models.Metric.FromMetresPerSecond(got.Pace))
+	})
+
+	t.Run("accepts a consistent pace", func(t *testing.T) {
+		pace := models.Metric.ToMetresPerSecond(6.1)
+		_, err := runService.CreateRun(&models.Run{Pace: pace, Distance: 3000.0, Time: models.Duration(30 * time.Minute), AccountId: "123"})
+
+		assert.Nil(t, err)
+	})
+
+	t.Run("rejects an inconsistent pace", func(t *testing.T) {
+		pace := models.Metric.ToMetresPerSecond(8.0)
+		_, err := runService.CreateRun(&models.Run{Pace: pace, Distance: 3000.0, Time: models.Duration(30 * time.Minute), AccountId: "123"})
+
+		assert.ErrorIs(t, err, ErrInconsistentRun)
+	})
+
+	t.Run("re-derives pace when distance changes", func(t *testing.T) {
+		run, _ := runService.CreateRun(&models.Run{Distance: 3000.0, Time: models.Duration(30 * time.Minute), AccountId: "123"})
+
+		got, err := runService.UpdateRun(&RunUpdateRequest{AccountId: "123", RunId: run.RunId, Distance: 4000.0})
+
+		assert.Nil(t, err)
+		assert.Equal(t, float32(8.0), models.Metric.FromMetresPerSecond(got.Pace))
+	})
+}
+
+func TestRunSplits(t *testing.T) {
+	runService := NewRunService(repositories.NewMemoryRunRepository())
+	intervals := []models.Split{
+		{Distance: 1000.0, Time: models.Duration(5 * time.Minute), Incline: 1.0},
+		{Pace: 4.0, Time: models.Duration(5 * time.Minute), Incline: 3.0, HeartRate: 170},
+	}
+
+	run, err := runService.CreateRun(&models.Run{Splits: intervals, AccountId: "123"})
+
+	t.Run("totals are computed from the splits", func(t *testing.T) {
+		assert.Nil(t, err)
+		assert.Equal(t, float32(2200.0), run.Distance)
+		assert.Equal(t, models.Duration(10*time.Minute), run.Time)
+		assert.Equal(t, float32(2.0), run.Incline)
+		assert.InDelta(t, 2200.0/600.0, run.Pace, 0.0001)
+		assert.Equal(t, float32(1200.0), run.Splits[1].Distance)
+	})
+
+	t.Run("totals cannot be set next to splits", func(t *testing.T) {
+		_, err := runService.CreateRun(&models.Run{Distance: 5000.0, Splits: intervals, AccountId: "123"})
+		assert.ErrorIs(t, err, ErrTotalsFromSplits)
+
+		_, err = runService.UpdateRun(&RunUpdateRequest{AccountId: "123", RunId: run.RunId, Distance: 5000.0})
+		assert.ErrorIs(t, err, ErrTotalsFromSplits)
+	})
+
+	t.Run("incomplete splits are rejected", func(t *testing.T) {
+		_, err := runService.AddSplit(&SplitRequest{AccountId: "123", RunId: run.RunId, Split: models.Split{Distance: 400.0}})
+
+		assert.ErrorIs(t, err, ErrIncompleteSplit)
+		assert.ErrorContains(t, err, "split 3")
+	})
+
+	t.Run("add, update and delete splits", func(t *testing.T) {
+		got, err := runService.AddSplit(&SplitRequest{AccountId: "123", RunId: run.RunId, Split: models.Split{Distance: 800.0, Pace: 4.0}})
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(got.Splits))
+		assert.Equal(t, float32(3000.0), got.Distance)
+
+		got, err = runService.UpdateSplit(&SplitUpdateRequest{AccountId: "123", RunId: run.RunId, Lap: 1, Split: models.Split{Distance: 2000.0, Time: models.Duration(10 * time.Minute)}})
+		assert.Nil(t, err)
+		assert.Equal(t, float32(4000.0), got.Distance)
+
+		got, err = runService.DeleteSplit(&SplitDeleteRequest{AccountId: "123", RunId: run.RunId, Lap: 3})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(got.Splits))
+		assert.Equal(t, float32(3200.0), got.Distance)
+
+		_, err = runService.DeleteSplit(&SplitDeleteRequest{AccountId: "123", RunId: run.RunId, Lap: 3})
+		assert.ErrorIs(t, err, ErrSplitNotFound)
+	})
+}
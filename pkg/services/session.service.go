@@ -0,0 +1,138 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SessionService issues refresh tokens in per-device families. Each refresh
+// rotates the family to a new token; presenting a token that was already
+// rotated away revokes the whole family, since one of its holders stole it.
+type SessionService interface {
+	StartSession(account *models.Account, device string) (token string, refreshToken string, err error)
+	Refresh(refreshToken string) (token string, nextRefreshToken string, err error)
+	EndSession(accountId string, refreshToken string) error
+}
+
+var (
+	ErrNotRefreshToken    = errors.New("not a refresh token")
+	ErrSessionRevoked     = errors.New("session has been revoked")
+	ErrRefreshTokenReused = errors.New("refresh token has already been used, session revoked")
+)
+
+type SessionServiceImpl struct {
+	familyRepository  repositories.TokenFamilyRepository
+	accountRepository repositories.AccountRepository
+	jwtService        JWTService
+}
+
+func NewSessionServiceImpl(familyRepository repositories.TokenFamilyRepository, accountRepository repositories.AccountRepository, jwtService JWTService) *SessionServiceImpl {
+	return &SessionServiceImpl{
+		familyRepository:  familyRepository,
+		accountRepository: accountRepository,
+		jwtService:        jwtService,
+	}
+}
+
+func (s *SessionServiceImpl) StartSession(account *models.Account, device string) (string, string, error) {
+	family := &models.TokenFamily{
+		FamilyId:       primitive.NewObjectID().Hex(),
+		AccountId:      account.AccountId,
+		Device:         device,
+		CurrentTokenId: primitive.NewObjectID().Hex(),
+		CreatedAt:      primitive.Timestamp{T: uint32(time.Now().Unix())},
+		UpdatedAt:      primitive.Timestamp{T: uint32(time.Now().Unix())},
+	}
+	if err := s.familyRepository.Insert(family); err != nil {
+		return "", "", err
+	}
+
+	return s.issue(account, family.FamilyId, family.CurrentTokenId)
+}
+
+func (s *SessionServiceImpl) Refresh(refreshToken string) (string, string, error) {
+	claims, err := s.jwtService.ValidateClaims(refreshToken)
+	if err != nil {
+		return "", "", err
+	}
+	// Refresh tokens of third-party apps are refreshed through OAuthService,
+	// here they would come back with every scope of the account.
+	if !claims.IsRefreshToken() || claims.ClientId != "" {
+		return "", "", ErrNotRefreshToken
+	}
+
+	family, err := s.familyRepository.FindById(claims.Family)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return "", "", ErrSessionRevoked
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if family.Revoked || family.AccountId != claims.Subject {
+		return "", "", ErrSessionRevoked
+	}
+
+	// The roles are read again so that changes to the account apply from
+	// the next refresh on.
+	account, err := s.accountRepository.FindById(family.AccountId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		s.familyRepository.Revoke(family.FamilyId)
+		return "", "", ErrSessionRevoked
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	nextTokenId := primitive.NewObjectID().Hex()
+	err = s.familyRepository.Rotate(family.FamilyId, claims.Id, nextTokenId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		if err := s.familyRepository.Revoke(family.FamilyId); err != nil {
+			return "", "", err
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	return s.issue(account, family.FamilyId, nextTokenId)
+}
+
+// EndSession revokes the family of refreshToken, or every family of the
+// account when no refresh token is given.
+func (s *SessionServiceImpl) EndSession(accountId string, refreshToken string) error {
+	if refreshToken == "" {
+		return s.familyRepository.RevokeByAccount(accountId)
+	}
+
+	claims, err := s.jwtService.ValidateClaims(refreshToken)
+	if err != nil {
+		return err
+	}
+	if !claims.IsRefreshToken() || claims.Subject != accountId {
+		return ErrNotRefreshToken
+	}
+
+	err = s.familyRepository.Revoke(claims.Family)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return ErrSessionRevoked
+	}
+	return err
+}
+
+func (s *SessionServiceImpl) issue(account *models.Account, familyId string, tokenId string) (string, string, error) {
+	token, err := s.jwtService.CreateToken(account.AccountId, models.ScopesFor(account.Roles), familyId)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := s.jwtService.CreateRefreshToken(account.AccountId, familyId, tokenId)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionService(t *testing.T) {
+	accounts := repositories.NewMemoryAccountRepository()
+	families := repositories.NewMemoryTokenFamilyRepository()
+	jwtService := newTestJWTService()
+	sessionService := NewSessionServiceImpl(families, accounts, jwtService)
+
+	account := &models.Account{AccountId: "1", Email: "test@example.com", Roles: []string{models.RoleUser}}
+	accounts.Insert(account)
+
+	t.Run("refresh rotates the refresh token", func(t *testing.T) {
+		_, first, err := sessionService.StartSession(account, "phone")
+		assert.Nil(t, err)
+
+		token, second, err := sessionService.Refresh(first)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, token)
+		assert.NotEqual(t, first, second)
+
+		_, _, err = sessionService.Refresh(second)
+		assert.Nil(t, err)
+	})
+
+	t.Run("reusing a rotated token revokes the family", func(t *testing.T) {
+		_, first, _ := sessionService.StartSession(account, "phone")
+		_, second, _ := sessionService.Refresh(first)
+
+		_, _, err := sessionService.Refresh(first)
+		assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+		_, _, err = sessionService.Refresh(second)
+		assert.ErrorIs(t, err, ErrSessionRevoked)
+	})
+
+	t.Run("families are independent", func(t *testing.T) {
+		_, phone, _ := sessionService.StartSession(account, "phone")
+		_, laptop, _ := sessionService.StartSession(account, "laptop")
+
+		assert.Nil(t, sessionService.EndSession("1", phone))
+
+		_, _, err := sessionService.Refresh(phone)
+		assert.ErrorIs(t, err, ErrSessionRevoked)
+		_, _, err = sessionService.Refresh(laptop)
+		assert.Nil(t, err)
+	})
+
+	t.Run("refresh tokens of apps are refused", func(t *testing.T) {
+		families.Insert(&models.TokenFamily{FamilyId: "app", AccountId: "1", ClientId: "c1", CurrentTokenId: "t1"})
+		refreshToken, _ := jwtService.CreateClientRefreshToken("1", "c1", []string{models.ScopeRunsRead}, "app", "t1")
+
+		_, _, err := sessionService.Refresh(refreshToken)
+		assert.ErrorIs(t, err, ErrNotRefreshToken)
+	})
+
+	t.Run("ending every session", func(t *testing.T) {
+		_, refreshToken, _ := sessionService.StartSession(account, "phone")
+
+		assert.Nil(t, sessionService.EndSession("1", ""))
+
+		_, _, err := sessionService.Refresh(refreshToken)
+		assert.ErrorIs(t, err, ErrSessionRevoked)
+	})
+
+	t.Run("access tokens cannot refresh", func(t *testing.T) {
+		token, _, _ := sessionService.StartSession(account, "phone")
+
+		_, _, err := sessionService.Refresh(token)
+		assert.ErrorIs(t, err, ErrNotRefreshToken)
+	})
+}
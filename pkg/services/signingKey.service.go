@@ -0,0 +1,316 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// KeyService holds the keys tokens are signed with. A new key is generated
+// every rotation period and published for a while before it signs, so that
+// verifiers refreshing the key set know it before they see tokens signed
+// with it. Keys that stopped signing stay published until every token they
+// signed has expired.
+type KeyService interface {
+	Rotate() error
+	SigningKey() (*Key, error)
+	VerificationKey(keyId string) (*Key, error)
+	KeySet() JSONWebKeySet
+}
+
+var (
+	ErrNoSigningKey         = errors.New("no signing key, keys have not been rotated in")
+	ErrUnknownKey           = errors.New("token is signed with an unknown key")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+)
+
+// keyReloadInterval limits how often tokens naming an unknown key, and
+// requests for the key set, make the service look for keys other instances
+// generated.
+const keyReloadInterval = time.Minute
+
+// Key is a signing key ready for use.
+type Key struct {
+	Id        string
+	Method    jwt.SigningMethod
+	Private   crypto.Signer
+	CreatedAt time.Time
+}
+
+// JSONWebKey is the public half of a Key as described by RFC 7517.
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// KeyRotation schedules signing keys. A key of Algorithm is generated every
+// Period and published PublishAhead before it signs. Retention is how long a
+// key verifies tokens after it stopped signing, the longest a token lives.
+type KeyRotation struct {
+	Algorithm    string
+	Period       time.Duration
+	PublishAhead time.Duration
+	Retention    time.Duration
+}
+
+type KeyServiceImpl struct {
+	keyRepository repositories.SigningKeyRepository
+	rotation      KeyRotation
+	now           func() time.Time
+
+	mu       sync.RWMutex
+	keys     []*Key
+	loadedAt time.Time
+}
+
+func NewKeyServiceImpl(keyRepository repositories.SigningKeyRepository, rotation KeyRotation) *KeyServiceImpl {
+	return &KeyServiceImpl{
+		keyRepository: keyRepository,
+		rotation:      rotation,
+		now:           time.Now,
+	}
+}
+
+// Rotate generates a key when the newest one is due for replacement and
+// deletes the keys no unexpired token can be signed with. It is meant to run
+// on startup and then periodically.
+func (s *KeyServiceImpl) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.load()
+	if err != nil {
+		return err
+	}
+	now := s.now()
+
+	if len(keys) == 0 || now.Sub(keys[len(keys)-1].CreatedAt) >= s.rotation.Period || keys[len(keys)-1].Method.Alg() != s.rotation.Algorithm {
+		key, err := s.generate(now)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	// Every key older than the signing one stopped signing when its
+	// successor started to, and verifies tokens until they have all expired.
+	signing := s.signingIndex(keys, now)
+	retained := keys[:0]
+	for i, key := range keys {
+		if i < signing && now.Sub(keys[i+1].CreatedAt.Add(s.rotation.PublishAhead)) > s.rotation.Retention {
+			if err := s.keyRepository.Delete(key.Id); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+				return err
+			}
+			continue
+		}
+		retained = append(retained, key)
+	}
+
+	s.keys = retained
+	s.loadedAt = now
+	return nil
+}
+
+func (s *KeyServiceImpl) SigningKey() (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.keys) == 0 {
+		return nil, ErrNoSigningKey
+	}
+	return s.keys[s.signingIndex(s.keys, s.now())], nil
+}
+
+func (s *KeyServiceImpl) VerificationKey(keyId string) (*Key, error) {
+	s.mu.RLock()
+	key := findKey(s.keys, keyId)
+	stale := s.now().Sub(s.loadedAt) >= keyReloadInterval
+	s.mu.RUnlock()
+
+	if key != nil {
+		return key, nil
+	}
+	if !stale {
+		return nil, ErrUnknownKey
+	}
+
+	// Another instance may have rotated in a key this one has not seen yet.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	s.keys = keys
+	s.loadedAt = s.now()
+
+	if key = findKey(s.keys, keyId); key == nil {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// KeySet publishes the keys generated by any instance up to the reload
+// interval ago, well within the time a key is published before it signs.
+// When they cannot be reloaded the keys already held are published.
+func (s *KeyServiceImpl) KeySet() JSONWebKeySet {
+	s.mu.RLock()
+	stale := s.now().Sub(s.loadedAt) >= keyReloadInterval
+	s.mu.RUnlock()
+
+	if stale {
+		s.mu.Lock()
+		if keys, err := s.load(); err == nil {
+			s.keys = keys
+			s.loadedAt = s.now()
+		}
+		s.mu.Unlock()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range s.keys {
+		set.Keys = append(set.Keys, key.JSONWebKey())
+	}
+	return set
+}
+
+// signingIndex picks the newest key published for long enough. The first
+// key signs right away, there is nobody to announce it to in advance.
+func (s *KeyServiceImpl) signingIndex(keys []*Key, now time.Time) int {
+	for i := len(keys) - 1; i > 0; i-- {
+		if !keys[i].CreatedAt.Add(s.rotation.PublishAhead).After(now) {
+			return i
+		}
+	}
+	return 0
+}
+
+func (s *KeyServiceImpl) load() ([]*Key, error) {
+	stored, err := s.keyRepository.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*Key, 0, len(stored))
+	for _, signingKey := range stored {
+		key, err := decodeKey(signingKey)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", signingKey.KeyId, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *KeyServiceImpl) generate(now time.Time) (*Key, error) {
+	var private crypto.Signer
+	var err error
+	switch s.rotation.Algorithm {
+	case models.AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case models.AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, s.rotation.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKey := &models.SigningKey{
+		KeyId:      primitive.NewObjectID().Hex(),
+		Algorithm:  s.rotation.Algorithm,
+		PrivateKey: der,
+		CreatedAt:  primitive.Timestamp{T: uint32(now.Unix())},
+	}
+	if err := s.keyRepository.Insert(signingKey); err != nil {
+		return nil, err
+	}
+	return decodeKey(signingKey)
+}
+
+func decodeKey(signingKey *models.SigningKey) (*Key, error) {
+	var method jwt.SigningMethod
+	switch signingKey.Algorithm {
+	case models.AlgorithmRS256:
+		method = jwt.SigningMethodRS256
+	case models.AlgorithmEdDSA:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, signingKey.Algorithm)
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(signingKey.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedAlgorithm, private)
+	}
+
+	return &Key{
+		Id:        signingKey.KeyId,
+		Method:    method,
+		Private:   signer,
+		CreatedAt: time.Unix(int64(signingKey.CreatedAt.T), 0),
+	}, nil
+}
+
+// JSONWebKey describes the public half of the key.
+func (k *Key) JSONWebKey() JSONWebKey {
+	jwk := JSONWebKey{KeyId: k.Id, Use: "sig", Algorithm: k.Method.Alg()}
+
+	switch public := k.Private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+func findKey(keys []*Key, keyId string) *Key {
+	for _, key := range keys {
+		if key.Id == keyId {
+			return key
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyService(t *testing.T) {
+	const period = 30 * 24 * time.Hour
+	now := time.Unix(1700000000, 0)
+	keyRepository := repositories.NewMemorySigningKeyRepository()
+	rotation := KeyRotation{Algorithm: models.AlgorithmEdDSA, Period: period, PublishAhead: time.Hour, Retention: 168 * time.Hour}
+	keyService := NewKeyServiceImpl(keyRepository, rotation)
+	keyService.now = func() time.Time { return now }
+
+	t.Run("the first key signs right away", func(t *testing.T) {
+		_, err := keyService.SigningKey()
+		assert.ErrorIs(t, err, ErrNoSigningKey)
+
+		assert.Nil(t, keyService.Rotate())
+		assert.Nil(t, keyService.Rotate())
+
+		key, err := keyService.SigningKey()
+		assert.Nil(t, err)
+		assert.Equal(t, "EdDSA", key.Method.Alg())
+		assert.Len(t, keyService.KeySet().Keys, 1)
+	})
+
+	t.Run("a new key is published before it signs", func(t *testing.T) {
+		first, _ := keyService.SigningKey()
+
+		now = now.Add(period)
+		assert.Nil(t, keyService.Rotate())
+		assert.Len(t, keyService.KeySet().Keys, 2)
+
+		current, _ := keyService.SigningKey()
+		assert.Equal(t, first.Id, current.Id)
+
+		now = now.Add(time.Hour)
+		current, _ = keyService.SigningKey()
+		assert.NotEqual(t, first.Id, current.Id)
+
+		verifying, err := keyService.VerificationKey(first.Id)
+		assert.Nil(t, err)
+		assert.Equal(t, first.Id, verifying.Id)
+	})
+
+	t.Run("retired keys are dropped once their tokens expired", func(t *testing.T) {
+		first := keyService.KeySet().Keys[0]
+
+		now = now.Add(rotation.Retention)
+		assert.Nil(t, keyService.Rotate())
+		assert.Len(t, keyService.KeySet().Keys, 2)
+
+		now = now.Add(time.Second)
+		assert.Nil(t, keyService.Rotate())
+		assert.Len(t, keyService.KeySet().Keys, 1)
+
+		_, err := keyService.VerificationKey(first.KeyId)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("keys other instances generated are picked up", func(t *testing.T) {
+		other := NewKeyServiceImpl(keyRepository, rotation)
+		other.now = func() time.Time { return now.Add(period) }
+		assert.Nil(t, other.Rotate())
+		keys := other.KeySet().Keys
+		generated := keys[len(keys)-1]
+
+		_, err := keyService.VerificationKey(generated.KeyId)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+
+		now = now.Add(keyReloadInterval)
+		_, err = keyService.VerificationKey(generated.KeyId)
+		assert.Nil(t, err)
+	})
+
+	t.Run("keys other instances generated are published", func(t *testing.T) {
+		other := NewKeyServiceImpl(keyRepository, rotation)
+		other.now = func() time.Time { return now.Add(2 * period) }
+		assert.Nil(t, other.Rotate())
+		keys := other.KeySet().Keys
+		generated := keys[len(keys)-1]
+
+		assert.NotContains(t, keyService.KeySet().Keys, generated)
+
+		now = now.Add(keyReloadInterval)
+		assert.Contains(t, keyService.KeySet().Keys, generated)
+	})
+
+	t.Run("changing the algorithm rotates right away", func(t *testing.T) {
+		rsaRotation := rotation
+		rsaRotation.Algorithm = models.AlgorithmRS256
+		rsaService := NewKeyServiceImpl(keyRepository, rsaRotation)
+		rsaService.now = func() time.Time { return now }
+		assert.Nil(t, rsaService.Rotate())
+
+		keys := rsaService.KeySet().Keys
+		newest := keys[len(keys)-1]
+		assert.Equal(t, "RSA", newest.KeyType)
+		assert.Equal(t, "RS256", newest.Algorithm)
+		assert.Equal(t, "AQAB", newest.E)
+		assert.NotEmpty(t, newest.N)
+
+		jwtService := NewJWTAuthService(rsaService, testTokenConfig)
+		now = now.Add(time.Hour)
+		token, err := jwtService.CreateToken("123", []string{models.ScopeRunsRead}, "")
+		assert.Nil(t, err)
+		claims, err := jwtService.ValidateClaims(token)
+		assert.Nil(t, err)
+		assert.Equal(t, "123", claims.Subject)
+	})
+
+	t.Run("unknown algorithms are refused", func(t *testing.T) {
+		hmacRotation := rotation
+		hmacRotation.Algorithm = "HS256"
+		unknown := NewKeyServiceImpl(repositories.NewMemorySigningKeyRepository(), hmacRotation)
+		assert.ErrorIs(t, unknown.Rotate(), ErrUnsupportedAlgorithm)
+	})
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/croisade/chimichanga/pkg/totp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TwoFactorService enrolls accounts in TOTP two-factor authentication and
+// completes the logins of enrolled accounts. Logging in to an enrolled account
+// takes a challenge token, issued once the password is accepted, and a code
+// from the authenticator app or one of the account's recovery codes.
+type TwoFactorService interface {
+	// Enroll generates a new secret for the account. It is only used once
+	// Confirm received a code generated from it.
+	Enroll(accountId string) (*TOTPEnrollment, error)
+	// Confirm enables two-factor authentication and returns the recovery
+	// codes of the account. They are not stored and cannot be shown again.
+	Confirm(accountId string, code string) ([]string, error)
+	Disable(accountId string, code string) error
+	Challenge(account *models.Account) (string, error)
+	// ChallengeAccount returns the account a challenge token was issued for.
+	ChallengeAccount(challengeToken string) (*models.Account, error)
+	// CompleteChallenge uses code for the account of a challenge, it cannot
+	// be used again.
+	CompleteChallenge(account *models.Account, code string) (*models.Account, error)
+}
+
+// TOTPEnrollment is what authenticator apps are set up with, the secret
+// itself or the otpauth URI, usually shown as a QR code.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+var (
+	ErrTwoFactorEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not enrolled")
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	ErrNotChallengeToken    = errors.New("not a two-factor challenge token")
+)
+
+// recoveryCodeCount is how many recovery codes an account gets, each usable
+// once in place of a TOTP code.
+const recoveryCodeCount = 10
+
+type TwoFactorServiceImpl struct {
+	accountRepository repositories.AccountRepository
+	jwtService        JWTService
+	issuer            string
+	now               func() time.Time
+}
+
+// NewTwoFactorServiceImpl returns a service naming issuer in the otpauth URIs,
+// the name authenticator apps list the account under.
+func NewTwoFactorServiceImpl(accountRepository repositories.AccountRepository, jwtService JWTService, issuer string) *TwoFactorServiceImpl {
+	return &TwoFactorServiceImpl{
+		accountRepository: accountRepository,
+		jwtService:        jwtService,
+		issuer:            issuer,
+		now:               time.Now,
+	}
+}
+
+func (s *TwoFactorServiceImpl) Enroll(accountId string) (*TOTPEnrollment, error) {
+	account, err := s.accountRepository.FindById(accountId)
+	if err != nil {
+		return nil, err
+	}
+	if account.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	account.TOTPSecret = secret
+	account.TOTPLastStep = 0
+	if _, err := s.update(account); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{Secret: secret, URI: totp.URI(s.issuer, account.Email, secret)}, nil
+}
+
+func (s *TwoFactorServiceImpl) Confirm(accountId string, code string) ([]string, error) {
+	account, err := s.accountRepository.FindById(accountId)
+	if err != nil {
+		return nil, err
+	}
+	if account.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if account.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	step, ok := totp.Validate(account.TOTPSecret, code, s.now(), 1)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	account.TOTPEnabled = true
+	account.TOTPLastStep = step
+	account.RecoveryCodes = hashes
+	if _, err := s.update(account); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *TwoFactorServiceImpl) Disable(accountId string, code string) error {
+	account, err := s.accountRepository.FindById(accountId)
+	if err != nil {
+		return err
+	}
+	if !account.TOTPEnabled {
+		return ErrTwoFactorNotEnrolled
+	}
+	if !s.useCode(account, code) {
+		return ErrInvalidTwoFactorCode
+	}
+
+	account.TOTPEnabled = false
+	account.TOTPSecret = ""
+	account.TOTPLastStep = 0
+	account.RecoveryCodes = nil
+	_, err = s.update(account)
+	return err
+}
+
+func (s *TwoFactorServiceImpl) Challenge(account *models.Account) (string, error) {
+	return s.jwtService.CreateChallengeToken(account.AccountId)
+}
+
+func (s *TwoFactorServiceImpl) ChallengeAccount(challengeToken string) (*models.Account, error) {
+	claims, err := s.jwtService.ValidateClaims(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.IsChallengeToken() {
+		return nil, ErrNotChallengeToken
+	}
+
+	account, err := s.accountRepository.FindById(claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if !account.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	return account, nil
+}
+
+func (s *TwoFactorServiceImpl) CompleteChallenge(account *models.Account, code string) (*models.Account, error) {
+	if !s.useCode(account, code) {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	return s.update(account)
+}
+
+// useCode checks code against the account, consuming it: TOTP codes cannot be
+// used again, nor can any code of an earlier step, and recovery codes are
+// removed. The caller stores the account.
+func (s *TwoFactorServiceImpl) useCode(account *models.Account, code string) bool {
+	if step, ok := totp.Validate(account.TOTPSecret, code, s.now(), 1); ok {
+		if step <= account.TOTPLastStep {
+			return false
+		}
+		account.TOTPLastStep = step
+		return true
+	}
+
+	hash := hashSecret(normalizeRecoveryCode(code))
+	for i, stored := range account.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			account.RecoveryCodes = append(account.RecoveryCodes[:i:i], account.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TwoFactorServiceImpl) update(account *models.Account) (*models.Account, error) {
+	account.UpdatedAt = primitive.Timestamp{T: uint32(s.now().Unix())}
+	return s.accountRepository.Update(account)
+}
+
+// newRecoveryCodes returns recovery codes of 80 random bits, grouped for
+// reading like ABCD-EFGH-IJKL-MNOP, and the hashes they are stored as.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(random)
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		hashes[i] = hashSecret(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts recovery codes typed in lower case or without
+// the dashes.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/croisade/chimichanga/pkg/models"
+	"github.com/croisade/chimichanga/pkg/repositories"
+	"github.com/croisade/chimichanga/pkg/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTwoFactorService(t *testing.T) {
+	accounts := repositories.NewMemoryAccountRepository()
+	jwtService := newTestJWTService()
+	twoFactorService := NewTwoFactorServiceImpl(accounts, jwtService, "CorroYouRun")
+
+	account := &models.Account{AccountId: "1", Email: "test@example.com", Roles: []string{models.RoleUser}}
+	accounts.Insert(account)
+
+	// Every code is generated for its own step, a step can only be used once.
+	clock := time.Now()
+	twoFactorService.now = func() time.Time { return clock }
+	nextCode := func(t *testing.T, secret string) string {
+		clock = clock.Add(totp.Period)
+		code, err := totp.Code(secret, totp.Step(clock))
+		assert.Nil(t, err)
+		return code
+	}
+
+	var secret string
+	var recoveryCodes []string
+
+	t.Run("enrollment takes effect once a code is confirmed", func(t *testing.T) {
+		enrollment, err := twoFactorService.Enroll("1")
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/CorroYouRun:test@example.com?"))
+		secret = enrollment.Secret
+
+		stored, _ := accounts.FindById("1")
+		assert.False(t, stored.TOTPEnabled)
+
+		_, err = twoFactorService.Confirm("1", "000000")
+		assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+
+		recoveryCodes, err = twoFactorService.Confirm("1", nextCode(t, secret))
+		assert.Nil(t, err)
+		assert.Len(t, recoveryCodes, recoveryCodeCount)
+
+		stored, _ = accounts.FindById("1")
+		assert.True(t, stored.TOTPEnabled)
+		assert.NotContains(t, stored.RecoveryCodes, recoveryCodes[0])
+
+		_, err = twoFactorService.Enroll("1")
+		assert.ErrorIs(t, err, ErrTwoFactorEnabled)
+	})
+
+	t.Run("challenges complete with a code used once", func(t *testing.T) {
+		challenge, err := twoFactorService.Challenge(account)
+		assert.Nil(t, err)
+
+		challenged, err := twoFactorService.ChallengeAccount(challenge)
+		assert.Nil(t, err)
+		assert.Equal(t, "1", challenged.AccountId)
+
+		code := nextCode(t, secret)
+		completed, err := twoFactorService.CompleteChallenge(challenged, code)
+		assert.Nil(t, err)
+		assert.Equal(t, "1", completed.AccountId)
+
+		challenged, _ = twoFactorService.ChallengeAccount(challenge)
+		_, err = twoFactorService.CompleteChallenge(challenged, code)
+		assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	})
+
+	t.Run("recovery codes work once in place of a code", func(t *testing.T) {
+		challenged, _ := accounts.FindById("1")
+		_, err := twoFactorService.CompleteChallenge(challenged, strings.ToLower(recoveryCodes[0]))
+		assert.Nil(t, err)
+
+		challenged, _ = accounts.FindById("1")
+		_, err = twoFactorService.CompleteChallenge(challenged, recoveryCodes[0])
+		assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+	})
+
+	t.Run("only challenge tokens name the account of a challenge", func(t *testing.T) {
+		token, _ := jwtService.CreateToken("1", models.ScopesFor(account.Roles), "")
+
+		_, err := twoFactorService.ChallengeAccount(token)
+		assert.ErrorIs(t, err, ErrNotChallengeToken)
+	})
+
+	t.Run("disabling takes a code", func(t *testing.T) {
+		assert.ErrorIs(t, twoFactorService.Disable("1", "000000"), ErrInvalidTwoFactorCode)
+		assert.Nil(t, twoFactorService.Disable("1", recoveryCodes[1]))
+
+		stored, _ := accounts.FindById("1")
+		assert.False(t, stored.TOTPEnabled)
+		assert.Empty(t, stored.TOTPSecret)
+		assert.Empty(t, stored.RecoveryCodes)
+	})
+}